@@ -0,0 +1,173 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"go.lunarway.com/postgresql-controller/api/v1beta1"
+)
+
+const (
+	// ConversionAnnotationV1alpha1 holds the v1alpha1 spec and status of an
+	// object served as v1beta1 if they could not be represented in v1beta1.
+	ConversionAnnotationV1alpha1 = "postgresql.lunar.tech/conversion-v1alpha1"
+	// ConversionAnnotationV1beta1 holds the v1beta1 spec and status of an
+	// object stored as v1alpha1 if they could not be represented in v1alpha1.
+	ConversionAnnotationV1beta1 = "postgresql.lunar.tech/conversion-v1beta1"
+)
+
+// content is the part of an object that differs between API versions.
+type content[Spec, Status any] struct {
+	Spec   Spec   `json:"spec"`
+	Status Status `json:"status,omitempty"`
+}
+
+// convertLossless converts src with convert and returns the result along with
+// the annotations of the converted object.
+//
+// Not every value survives a round trip between versions, e.g. a v1beta1
+// condition other than Ready has no v1alpha1 counterpart. If revert does not
+// reproduce src, src is stashed as JSON in the stashKey annotation. If the
+// annotations hold a stash under restoreKey from a conversion in the opposite
+// direction and it still reverts to src, the stash is returned instead of the
+// converted value.
+func convertLossless[S, D any](src S, annotations map[string]string, convert func(S) D, revert func(D) S, stashKey, restoreKey string) (D, map[string]string, error) {
+	var converted map[string]string
+	for key, value := range annotations {
+		if key == stashKey || key == restoreKey {
+			continue
+		}
+		if converted == nil {
+			converted = make(map[string]string, len(annotations))
+		}
+		converted[key] = value
+	}
+
+	if stash, ok := annotations[restoreKey]; ok {
+		var restored D
+		if err := json.Unmarshal([]byte(stash), &restored); err == nil && equality.Semantic.DeepEqual(revert(restored), src) {
+			return restored, converted, nil
+		}
+	}
+
+	dst := convert(src)
+	if equality.Semantic.DeepEqual(revert(dst), src) {
+		return dst, converted, nil
+	}
+	stash, err := json.Marshal(src)
+	if err != nil {
+		var zero D
+		return zero, nil, fmt.Errorf("stash annotation %s: %w", stashKey, err)
+	}
+	if converted == nil {
+		converted = make(map[string]string, 1)
+	}
+	converted[stashKey] = string(stash)
+	return dst, converted, nil
+}
+
+// readyConditions returns the v1beta1 conditions describing a v1alpha1 phase.
+// No conditions are returned for an empty phase.
+func readyConditions(phase, message string, updated metav1.Time, generation int64) []metav1.Condition {
+	if phase == "" {
+		return nil
+	}
+	status := metav1.ConditionFalse
+	if phase == v1beta1.ReasonRunning {
+		status = metav1.ConditionTrue
+	}
+	return []metav1.Condition{{
+		Type:               v1beta1.ConditionTypeReady,
+		Status:             status,
+		ObservedGeneration: generation,
+		LastTransitionTime: updated,
+		Reason:             phase,
+		Message:            message,
+	}}
+}
+
+// readyPhase returns the v1alpha1 phase, error message and phase update time
+// described by the Ready condition in conditions.
+func readyPhase(conditions []metav1.Condition) (string, string, metav1.Time) {
+	ready := meta.FindStatusCondition(conditions, v1beta1.ConditionTypeReady)
+	if ready == nil {
+		return "", "", metav1.Time{}
+	}
+	return ready.Reason, ready.Message, ready.LastTransitionTime
+}
+
+func resourceVarToBeta(src ResourceVar) v1beta1.ResourceVar {
+	dst := v1beta1.ResourceVar{
+		Value: src.Value,
+	}
+	if src.ValueFrom != nil {
+		dst.ValueFrom = &v1beta1.ResourceVarSource{
+			SecretKeyRef:    keySelectorToBeta(src.ValueFrom.SecretKeyRef),
+			ConfigMapKeyRef: keySelectorToBeta(src.ValueFrom.ConfigMapKeyRef),
+		}
+	}
+	return dst
+}
+
+func resourceVarFromBeta(src v1beta1.ResourceVar) ResourceVar {
+	dst := ResourceVar{
+		Value: src.Value,
+	}
+	if src.ValueFrom != nil {
+		dst.ValueFrom = &ResourceVarSource{
+			SecretKeyRef:    keySelectorFromBeta(src.ValueFrom.SecretKeyRef),
+			ConfigMapKeyRef: keySelectorFromBeta(src.ValueFrom.ConfigMapKeyRef),
+		}
+	}
+	return dst
+}
+
+func resourceVarPtrToBeta(src *ResourceVar) *v1beta1.ResourceVar {
+	if src == nil {
+		return nil
+	}
+	dst := resourceVarToBeta(*src)
+	return &dst
+}
+
+func resourceVarPtrFromBeta(src *v1beta1.ResourceVar) *ResourceVar {
+	if src == nil {
+		return nil
+	}
+	dst := resourceVarFromBeta(*src)
+	return &dst
+}
+
+func keySelectorToBeta(src *KeySelector) *v1beta1.KeySelector {
+	if src == nil {
+		return nil
+	}
+	return &v1beta1.KeySelector{Name: src.Name, Key: src.Key}
+}
+
+func keySelectorFromBeta(src *v1beta1.KeySelector) *KeySelector {
+	if src == nil {
+		return nil
+	}
+	return &KeySelector{Name: src.Name, Key: src.Key}
+}
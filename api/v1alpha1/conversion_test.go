@@ -0,0 +1,413 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"go.lunarway.com/postgresql-controller/api/v1beta1"
+)
+
+// viaJSON mimics the API server serializing obj between conversions. obj
+// must be a pointer.
+func viaJSON[T any](t *testing.T, obj T) T {
+	t.Helper()
+	raw, err := json.Marshal(obj)
+	require.NoError(t, err, "marshal")
+	decoded := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(T)
+	require.NoError(t, json.Unmarshal(raw, decoded), "unmarshal")
+	return decoded
+}
+
+func TestConversion_fromV1alpha1(t *testing.T) {
+	updated := metav1.NewTime(time.Date(2019, time.September, 16, 14, 0, 0, 0, time.UTC).Local())
+	later := metav1.NewTime(updated.Add(time.Hour))
+	allDatabases := true
+	connectionLimit := int32(20)
+	value := func(v string) ResourceVar {
+		return ResourceVar{Value: v}
+	}
+	secret := ResourceVar{
+		ValueFrom: &ResourceVarSource{
+			SecretKeyRef: &KeySelector{Name: "secret", Key: "password"},
+		},
+	}
+	meta := metav1.ObjectMeta{Name: "test", Namespace: "default", Labels: map[string]string{"app": "test"}}
+
+	tt := []struct {
+		name  string
+		src   conversion.Convertible
+		hub   conversion.Hub
+		dst   conversion.Convertible
+		lossy bool
+	}{
+		{
+			name: "database",
+			src: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name:            "user",
+					Password:        &secret,
+					IsShared:        true,
+					Host:            value("localhost:5432"),
+					Extensions:      []PostgreSQLDatabaseExtension{{ExtensionName: "pg_trgm", Version: "1.6", Schema: "extensions"}},
+					Schemas:         []string{"billing", "audit"},
+					Encoding:        "UTF8",
+					LCCollate:       "C",
+					LCCtype:         "C",
+					ICULocale:       "en-US",
+					Template:        "template0",
+					Tablespace:      "fast",
+					ConnectionLimit: &connectionLimit,
+					Parameters: &PostgreSQLDatabaseParameters{
+						Database: map[string]string{"statement_timeout": "30s"},
+						User:     map[string]string{"log_statement": "all"},
+					},
+					DeletionPolicy:         PostgreSQLDatabaseDeletionPolicyRevokeLogin,
+					ExtensionRemovalPolicy: PostgreSQLDatabaseExtensionRemovalPolicyDrop,
+				},
+				Status: PostgreSQLDatabaseStatus{
+					PhaseUpdated: updated,
+					Phase:        PostgreSQLDatabasePhaseFailed,
+					Host:         "localhost:5432",
+					User:         "user",
+					Error:        "connection refused",
+					Extensions: []PostgreSQLDatabaseInstalledExtension{
+						{Name: "pg_trgm", Version: "1.6", Schema: "extensions"},
+					},
+				},
+			},
+			hub: &v1beta1.PostgreSQLDatabase{},
+			dst: &PostgreSQLDatabase{},
+		},
+		{
+			name: "database with error and no phase",
+			src: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Status: PostgreSQLDatabaseStatus{
+					Error: "connection refused",
+				},
+			},
+			hub:   &v1beta1.PostgreSQLDatabase{},
+			dst:   &PostgreSQLDatabase{},
+			lossy: true,
+		},
+		{
+			name: "user",
+			src: &PostgreSQLUser{
+				ObjectMeta: meta,
+				Spec: PostgreSQLUserSpec{
+					Name: "user",
+					Read: &[]AccessSpec{
+						{
+							Host:         value("localhost:5432"),
+							AllDatabases: &allDatabases,
+							Reason:       "Debugging",
+							Start:        &updated,
+							Stop:         &later,
+						},
+					},
+					Write: &[]WriteAccessSpec{
+						{
+							AccessSpec: AccessSpec{
+								Host:     value("localhost:5432"),
+								Database: value("user"),
+								Schema:   value("user"),
+								Reason:   "Migration",
+							},
+							Extended: true,
+						},
+					},
+				},
+				Status: PostgreSQLUserStatus{
+					ObservedGeneration: 2,
+					Phase:              PostgreSQLUserPhaseRunning,
+					PhaseUpdated:       updated,
+					RoleName:           "user",
+					PolicyName:         "policy",
+					Hosts: []PostgreSQLUserHostStatus{
+						{Host: "localhost:5432", Phase: PostgreSQLUserAccessPhaseGranted},
+					},
+					Accesses: []PostgreSQLUserAccessStatus{
+						{Host: "localhost:5432", AllDatabases: true, Privilege: "read", Reason: "Debugging", Phase: PostgreSQLUserAccessPhaseGranted},
+					},
+				},
+			},
+			hub: &v1beta1.PostgreSQLUser{},
+			dst: &PostgreSQLUser{},
+		},
+		{
+			name: "service user",
+			src: &PostgreSQLServiceUser{
+				ObjectMeta: meta,
+				Spec: PostgreSQLServiceUserSpec{
+					Username: value("service"),
+					Host:     value("localhost:5432"),
+					Password: &secret,
+					Roles:    []PostgreSQLServiceUserRole{{RoleName: "reader"}},
+				},
+				Status: &PostgreSQLServiceUserStatus{
+					ObservedGeneration: 1,
+					Conditions: []PostgreSQLServiceUserCondition{
+						{
+							Type:               PostgreSQLServiceUserPhaseRunning,
+							Status:             corev1.ConditionTrue,
+							LastUpdateTime:     updated,
+							LastTransitionTime: updated,
+							Reason:             "Running",
+						},
+					},
+				},
+			},
+			hub: &v1beta1.PostgreSQLServiceUser{},
+			dst: &PostgreSQLServiceUser{},
+		},
+		{
+			name: "service user without status",
+			src: &PostgreSQLServiceUser{
+				ObjectMeta: meta,
+				Spec: PostgreSQLServiceUserSpec{
+					Username: value("service"),
+					Host:     value("localhost:5432"),
+				},
+			},
+			hub: &v1beta1.PostgreSQLServiceUser{},
+			dst: &PostgreSQLServiceUser{},
+		},
+		{
+			name: "service user with updated condition",
+			src: &PostgreSQLServiceUser{
+				ObjectMeta: meta,
+				Status: &PostgreSQLServiceUserStatus{
+					Conditions: []PostgreSQLServiceUserCondition{
+						{
+							Type:               PostgreSQLServiceUserPhaseFailed,
+							Status:             corev1.ConditionTrue,
+							LastUpdateTime:     later,
+							LastTransitionTime: updated,
+							Reason:             "Failed",
+							Message:            "connection refused",
+						},
+					},
+				},
+			},
+			hub:   &v1beta1.PostgreSQLServiceUser{},
+			dst:   &PostgreSQLServiceUser{},
+			lossy: true,
+		},
+		{
+			name: "host credentials",
+			src: &PostgreSQLHostCredentials{
+				ObjectMeta: meta,
+				Spec: PostgreSQLHostCredentialsSpec{
+					Host:           value("localhost:5432"),
+					User:           value("admin"),
+					Password:       secret,
+					Params:         "sslmode=require",
+					Authentication: PostgreSQLHostAuthenticationPassword,
+					DBIResourceID:  "db-ABCDEFGHIJKL01234",
+				},
+				Status: PostgreSQLHostCredentialsStatus{
+					Phase:           PostgreSQLHostCredentialsPhaseInvalid,
+					PhaseUpdated:    updated,
+					Host:            "localhost:5432",
+					Reachable:       true,
+					SuperuserMember: false,
+					Error:           "not a superuser",
+				},
+			},
+			hub: &v1beta1.PostgreSQLHostCredentials{},
+			dst: &PostgreSQLHostCredentials{},
+		},
+		{
+			name: "custom role",
+			src: &CustomRole{
+				ObjectMeta: meta,
+				Spec: CustomRoleSpec{
+					RoleName:   "reader",
+					GrantRoles: []string{"pg_monitor"},
+					Databases:  []string{"postgres"},
+					Grants:     []CustomRoleGrant{{Schema: "public", Privileges: []string{"SELECT"}}},
+					Functions:  []CustomRoleFunction{{Name: "f", Returns: "void", Body: "RETURN;", OwningRole: "$controllerUser"}},
+				},
+				Status: CustomRoleStatus{
+					Phase:        CustomRolePhaseFailed,
+					PhaseUpdated: updated,
+					Error:        "connection refused",
+					FailingHost:  "localhost:5432",
+				},
+			},
+			hub: &v1beta1.CustomRole{},
+			dst: &CustomRole{},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.src.ConvertTo(tc.hub)
+			require.NoError(t, err, "convert to hub")
+
+			_, stashed := tc.hub.(metav1.Object).GetAnnotations()[ConversionAnnotationV1alpha1]
+			assert.Equal(t, tc.lossy, stashed, "stash annotation presence not as expected")
+
+			hub := viaJSON(t, tc.hub)
+			err = tc.dst.ConvertFrom(hub)
+			require.NoError(t, err, "convert from hub")
+
+			assert.Equal(t, tc.src, tc.dst, "round trip not lossless")
+		})
+	}
+}
+
+func TestConversion_fromV1beta1(t *testing.T) {
+	updated := metav1.NewTime(time.Date(2019, time.September, 16, 14, 0, 0, 0, time.UTC).Local())
+	meta := metav1.ObjectMeta{Name: "test", Namespace: "default"}
+	ready := metav1.Condition{
+		Type:               v1beta1.ConditionTypeReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: 3,
+		LastTransitionTime: updated,
+		Reason:             v1beta1.ReasonRunning,
+	}
+	degraded := metav1.Condition{
+		Type:               "Degraded",
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: updated,
+		Reason:             "AsExpected",
+	}
+
+	tt := []struct {
+		name  string
+		src   conversion.Hub
+		spoke conversion.Convertible
+		dst   conversion.Hub
+		lossy bool
+	}{
+		{
+			name: "user",
+			src: &v1beta1.PostgreSQLUser{
+				ObjectMeta: meta,
+				Spec: v1beta1.PostgreSQLUserSpec{
+					Name: "user",
+					Read: []v1beta1.AccessSpec{{Host: v1beta1.ResourceVar{Value: "localhost:5432"}, Reason: "Debugging"}},
+				},
+				Status: v1beta1.PostgreSQLUserStatus{
+					ObservedGeneration: 3,
+					Conditions:         []metav1.Condition{ready},
+				},
+			},
+			spoke: &PostgreSQLUser{},
+			dst:   &v1beta1.PostgreSQLUser{},
+		},
+		{
+			name: "user with additional condition",
+			src: &v1beta1.PostgreSQLUser{
+				ObjectMeta: meta,
+				Spec: v1beta1.PostgreSQLUserSpec{
+					Name: "user",
+				},
+				Status: v1beta1.PostgreSQLUserStatus{
+					ObservedGeneration: 3,
+					Conditions:         []metav1.Condition{ready, degraded},
+				},
+			},
+			spoke: &PostgreSQLUser{},
+			dst:   &v1beta1.PostgreSQLUser{},
+			lossy: true,
+		},
+		{
+			name: "database with observed generation",
+			src: &v1beta1.PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: v1beta1.PostgreSQLDatabaseSpec{
+					Name:            "user",
+					HostCredentials: "localhost",
+					DeletionPolicy:  v1beta1.PostgreSQLDatabaseDeletionPolicyDrop,
+					PasswordGeneration: &v1beta1.PostgreSQLDatabasePasswordGeneration{
+						Length:           64,
+						RotationInterval: &metav1.Duration{Duration: 720 * time.Hour},
+					},
+				},
+				Status: v1beta1.PostgreSQLDatabaseStatus{
+					Conditions: []metav1.Condition{ready},
+				},
+			},
+			spoke: &PostgreSQLDatabase{},
+			dst:   &v1beta1.PostgreSQLDatabase{},
+			lossy: true,
+		},
+		{
+			name: "service user",
+			src: &v1beta1.PostgreSQLServiceUser{
+				ObjectMeta: meta,
+				Spec: v1beta1.PostgreSQLServiceUserSpec{
+					Username: v1beta1.ResourceVar{Value: "service"},
+				},
+				Status: v1beta1.PostgreSQLServiceUserStatus{
+					ObservedGeneration: 3,
+					Conditions:         []metav1.Condition{ready},
+				},
+			},
+			spoke: &PostgreSQLServiceUser{},
+			dst:   &v1beta1.PostgreSQLServiceUser{},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.spoke.ConvertFrom(tc.src)
+			require.NoError(t, err, "convert from hub")
+
+			_, stashed := tc.spoke.(metav1.Object).GetAnnotations()[ConversionAnnotationV1beta1]
+			assert.Equal(t, tc.lossy, stashed, "stash annotation presence not as expected")
+
+			spoke := viaJSON(t, tc.spoke)
+			err = spoke.ConvertTo(tc.dst)
+			require.NoError(t, err, "convert to hub")
+
+			assert.Equal(t, tc.src, tc.dst, "round trip not lossless")
+		})
+	}
+}
+
+func TestConversion_staleStash(t *testing.T) {
+	updated := metav1.NewTime(time.Date(2019, time.September, 16, 14, 0, 0, 0, time.UTC).Local())
+	src := &v1beta1.PostgreSQLDatabase{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Status: v1beta1.PostgreSQLDatabaseStatus{
+			Conditions: []metav1.Condition{{
+				Type:               v1beta1.ConditionTypeReady,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: 3,
+				LastTransitionTime: updated,
+				Reason:             v1beta1.ReasonRunning,
+			}},
+		},
+	}
+	alpha := &PostgreSQLDatabase{}
+	err := alpha.ConvertFrom(src)
+	require.NoError(t, err, "convert from hub")
+	require.Contains(t, alpha.Annotations, ConversionAnnotationV1beta1, "expected a stash")
+
+	// the controller updates the status in v1alpha1 so the stash is stale
+	alpha.Status.Phase = PostgreSQLDatabasePhaseFailed
+	alpha.Status.Error = "connection refused"
+
+	dst := &v1beta1.PostgreSQLDatabase{}
+	err = alpha.ConvertTo(dst)
+	require.NoError(t, err, "convert to hub")
+
+	assert.Empty(t, dst.Annotations, "stale stash should be dropped")
+	assert.Equal(t, []metav1.Condition{{
+		Type:               v1beta1.ConditionTypeReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: updated,
+		Reason:             v1beta1.ReasonFailed,
+		Message:            "connection refused",
+	}}, dst.Status.Conditions, "conditions not as expected")
+}
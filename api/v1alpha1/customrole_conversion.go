@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"go.lunarway.com/postgresql-controller/api/v1beta1"
+)
+
+type (
+	customRoleContent     = content[CustomRoleSpec, CustomRoleStatus]
+	customRoleBetaContent = content[v1beta1.CustomRoleSpec, v1beta1.CustomRoleStatus]
+)
+
+// ConvertTo converts this CustomRole to the hub version.
+func (src *CustomRole) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.CustomRole)
+	converted, annotations, err := convertLossless(customRoleContent{Spec: src.Spec, Status: src.Status}, src.Annotations, customRoleToBeta, customRoleFromBeta, ConversionAnnotationV1alpha1, ConversionAnnotationV1beta1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this CustomRole.
+func (dst *CustomRole) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.CustomRole)
+	converted, annotations, err := convertLossless(customRoleBetaContent{Spec: src.Spec, Status: src.Status}, src.Annotations, customRoleFromBeta, customRoleToBeta, ConversionAnnotationV1beta1, ConversionAnnotationV1alpha1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+func customRoleToBeta(src customRoleContent) customRoleBetaContent {
+	dst := customRoleBetaContent{
+		Spec: v1beta1.CustomRoleSpec{
+			RoleName:   src.Spec.RoleName,
+			GrantRoles: src.Spec.GrantRoles,
+			Databases:  src.Spec.Databases,
+		},
+		Status: v1beta1.CustomRoleStatus{
+			Conditions:  readyConditions(string(src.Status.Phase), src.Status.Error, src.Status.PhaseUpdated, 0),
+			FailingHost: src.Status.FailingHost,
+		},
+	}
+	if src.Spec.Grants != nil {
+		dst.Spec.Grants = make([]v1beta1.CustomRoleGrant, len(src.Spec.Grants))
+		for i, grant := range src.Spec.Grants {
+			dst.Spec.Grants[i] = v1beta1.CustomRoleGrant(grant)
+		}
+	}
+	if src.Spec.Functions != nil {
+		dst.Spec.Functions = make([]v1beta1.CustomRoleFunction, len(src.Spec.Functions))
+		for i, function := range src.Spec.Functions {
+			dst.Spec.Functions[i] = v1beta1.CustomRoleFunction(function)
+		}
+	}
+	return dst
+}
+
+func customRoleFromBeta(src customRoleBetaContent) customRoleContent {
+	phase, message, updated := readyPhase(src.Status.Conditions)
+	dst := customRoleContent{
+		Spec: CustomRoleSpec{
+			RoleName:   src.Spec.RoleName,
+			GrantRoles: src.Spec.GrantRoles,
+			Databases:  src.Spec.Databases,
+		},
+		Status: CustomRoleStatus{
+			Phase:        CustomRolePhase(phase),
+			PhaseUpdated: updated,
+			Error:        message,
+			FailingHost:  src.Status.FailingHost,
+		},
+	}
+	if src.Spec.Grants != nil {
+		dst.Spec.Grants = make([]CustomRoleGrant, len(src.Spec.Grants))
+		for i, grant := range src.Spec.Grants {
+			dst.Spec.Grants[i] = CustomRoleGrant(grant)
+		}
+	}
+	if src.Spec.Functions != nil {
+		dst.Spec.Functions = make([]CustomRoleFunction, len(src.Spec.Functions))
+		for i, function := range src.Spec.Functions {
+			dst.Spec.Functions[i] = CustomRoleFunction(function)
+		}
+	}
+	return dst
+}
@@ -166,6 +166,7 @@ type CustomRoleStatus struct {
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Role",type="string",JSONPath=".spec.roleName"
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase"
@@ -0,0 +1,94 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"go.lunarway.com/postgresql-controller/pkg/customrole"
+)
+
+// SetupCustomRoleWebhookWithManager registers the validating webhook for
+// CustomRole resources and the conversion webhook between its API versions with
+// the manager.
+func SetupCustomRoleWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&CustomRole{}).
+		WithValidator(&CustomRoleValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-postgresql-lunar-tech-v1alpha1-customrole,mutating=false,failurePolicy=fail,sideEffects=None,groups=postgresql.lunar.tech,resources=customroles,verbs=create;update,versions=v1alpha1,name=vcustomrole.lunar.tech,admissionReviewVersions=v1
+
+// CustomRoleValidator validates CustomRole resources on admission. It applies
+// the same privilege and function checks as the reconciler so invalid
+// resources are rejected before they reach the Invalid phase.
+// +kubebuilder:object:generate=false
+type CustomRoleValidator struct{}
+
+var _ admission.CustomValidator = &CustomRoleValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CustomRoleValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	role, ok := obj.(*CustomRole)
+	if !ok {
+		return nil, fmt.Errorf("expected a CustomRole but got a %T", obj)
+	}
+	return nil, role.validate()
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CustomRoleValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return v.ValidateCreate(ctx, newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CustomRoleValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *CustomRole) validate() error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if r.Spec.RoleName == "" {
+		errs = append(errs, field.Required(spec.Child("roleName"), ""))
+	}
+	for i, grant := range r.Spec.Grants {
+		if err := customrole.ValidatePrivileges(grant.Privileges); err != nil {
+			errs = append(errs, field.Invalid(spec.Child("grants").Index(i).Child("privileges"), grant.Privileges, err.Error()))
+		}
+	}
+	for i, function := range r.Spec.Functions {
+		err := customrole.ValidateFunction(customrole.Function{
+			Name:       function.Name,
+			Args:       function.Args,
+			Returns:    function.Returns,
+			OwningRole: function.OwningRole,
+			Body:       function.Body,
+		})
+		if err != nil {
+			errs = append(errs, field.Invalid(spec.Child("functions").Index(i), function.Name, err.Error()))
+		}
+	}
+	return invalid("CustomRole", r.Name, errs)
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"go.lunarway.com/postgresql-controller/api/v1beta1"
+)
+
+type (
+	databaseContent     = content[PostgreSQLDatabaseSpec, PostgreSQLDatabaseStatus]
+	databaseBetaContent = content[v1beta1.PostgreSQLDatabaseSpec, v1beta1.PostgreSQLDatabaseStatus]
+)
+
+// ConvertTo converts this PostgreSQLDatabase to the hub version.
+func (src *PostgreSQLDatabase) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.PostgreSQLDatabase)
+	converted, annotations, err := convertLossless(databaseContent{Spec: src.Spec, Status: src.Status}, src.Annotations, databaseToBeta, databaseFromBeta, ConversionAnnotationV1alpha1, ConversionAnnotationV1beta1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this PostgreSQLDatabase.
+func (dst *PostgreSQLDatabase) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.PostgreSQLDatabase)
+	converted, annotations, err := convertLossless(databaseBetaContent{Spec: src.Spec, Status: src.Status}, src.Annotations, databaseFromBeta, databaseToBeta, ConversionAnnotationV1beta1, ConversionAnnotationV1alpha1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+func databaseToBeta(src databaseContent) databaseBetaContent {
+	dst := databaseBetaContent{
+		Spec: v1beta1.PostgreSQLDatabaseSpec{
+			Name:                   src.Spec.Name,
+			User:                   resourceVarToBeta(src.Spec.User),
+			Password:               resourceVarPtrToBeta(src.Spec.Password),
+			PasswordGeneration:     passwordGenerationToBeta(src.Spec.PasswordGeneration),
+			IsShared:               src.Spec.IsShared,
+			Host:                   resourceVarToBeta(src.Spec.Host),
+			HostCredentials:        src.Spec.HostCredentials,
+			Schemas:                src.Spec.Schemas,
+			Encoding:               src.Spec.Encoding,
+			LCCollate:              src.Spec.LCCollate,
+			LCCtype:                src.Spec.LCCtype,
+			ICULocale:              src.Spec.ICULocale,
+			Template:               src.Spec.Template,
+			Tablespace:             src.Spec.Tablespace,
+			ConnectionLimit:        src.Spec.ConnectionLimit,
+			Parameters:             parametersToBeta(src.Spec.Parameters),
+			DeletionPolicy:         v1beta1.PostgreSQLDatabaseDeletionPolicy(src.Spec.DeletionPolicy),
+			ExtensionRemovalPolicy: v1beta1.PostgreSQLDatabaseExtensionRemovalPolicy(src.Spec.ExtensionRemovalPolicy),
+		},
+		Status: v1beta1.PostgreSQLDatabaseStatus{
+			Conditions: readyConditions(string(src.Status.Phase), src.Status.Error, src.Status.PhaseUpdated, 0),
+			Host:       src.Status.Host,
+			User:       src.Status.User,
+		},
+	}
+	if src.Spec.Extensions != nil {
+		dst.Spec.Extensions = make([]v1beta1.PostgreSQLDatabaseExtension, len(src.Spec.Extensions))
+		for i, extension := range src.Spec.Extensions {
+			dst.Spec.Extensions[i] = v1beta1.PostgreSQLDatabaseExtension(extension)
+		}
+	}
+	if src.Status.Extensions != nil {
+		dst.Status.Extensions = make([]v1beta1.PostgreSQLDatabaseInstalledExtension, len(src.Status.Extensions))
+		for i, extension := range src.Status.Extensions {
+			dst.Status.Extensions[i] = v1beta1.PostgreSQLDatabaseInstalledExtension(extension)
+		}
+	}
+	return dst
+}
+
+func databaseFromBeta(src databaseBetaContent) databaseContent {
+	phase, message, updated := readyPhase(src.Status.Conditions)
+	dst := databaseContent{
+		Spec: PostgreSQLDatabaseSpec{
+			Name:                   src.Spec.Name,
+			User:                   resourceVarFromBeta(src.Spec.User),
+			Password:               resourceVarPtrFromBeta(src.Spec.Password),
+			PasswordGeneration:     passwordGenerationFromBeta(src.Spec.PasswordGeneration),
+			IsShared:               src.Spec.IsShared,
+			Host:                   resourceVarFromBeta(src.Spec.Host),
+			HostCredentials:        src.Spec.HostCredentials,
+			Schemas:                src.Spec.Schemas,
+			Encoding:               src.Spec.Encoding,
+			LCCollate:              src.Spec.LCCollate,
+			LCCtype:                src.Spec.LCCtype,
+			ICULocale:              src.Spec.ICULocale,
+			Template:               src.Spec.Template,
+			Tablespace:             src.Spec.Tablespace,
+			ConnectionLimit:        src.Spec.ConnectionLimit,
+			Parameters:             parametersFromBeta(src.Spec.Parameters),
+			DeletionPolicy:         PostgreSQLDatabaseDeletionPolicy(src.Spec.DeletionPolicy),
+			ExtensionRemovalPolicy: PostgreSQLDatabaseExtensionRemovalPolicy(src.Spec.ExtensionRemovalPolicy),
+		},
+		Status: PostgreSQLDatabaseStatus{
+			PhaseUpdated: updated,
+			Phase:        PostgreSQLDatabasePhase(phase),
+			Host:         src.Status.Host,
+			User:         src.Status.User,
+			Error:        message,
+		},
+	}
+	if src.Spec.Extensions != nil {
+		dst.Spec.Extensions = make([]PostgreSQLDatabaseExtension, len(src.Spec.Extensions))
+		for i, extension := range src.Spec.Extensions {
+			dst.Spec.Extensions[i] = PostgreSQLDatabaseExtension(extension)
+		}
+	}
+	if src.Status.Extensions != nil {
+		dst.Status.Extensions = make([]PostgreSQLDatabaseInstalledExtension, len(src.Status.Extensions))
+		for i, extension := range src.Status.Extensions {
+			dst.Status.Extensions[i] = PostgreSQLDatabaseInstalledExtension(extension)
+		}
+	}
+	return dst
+}
+
+func passwordGenerationToBeta(src *PostgreSQLDatabasePasswordGeneration) *v1beta1.PostgreSQLDatabasePasswordGeneration {
+	if src == nil {
+		return nil
+	}
+	dst := v1beta1.PostgreSQLDatabasePasswordGeneration(*src.DeepCopy())
+	return &dst
+}
+
+func passwordGenerationFromBeta(src *v1beta1.PostgreSQLDatabasePasswordGeneration) *PostgreSQLDatabasePasswordGeneration {
+	if src == nil {
+		return nil
+	}
+	dst := PostgreSQLDatabasePasswordGeneration(*src.DeepCopy())
+	return &dst
+}
+
+func parametersToBeta(src *PostgreSQLDatabaseParameters) *v1beta1.PostgreSQLDatabaseParameters {
+	if src == nil {
+		return nil
+	}
+	dst := v1beta1.PostgreSQLDatabaseParameters(*src.DeepCopy())
+	return &dst
+}
+
+func parametersFromBeta(src *v1beta1.PostgreSQLDatabaseParameters) *PostgreSQLDatabaseParameters {
+	if src == nil {
+		return nil
+	}
+	dst := PostgreSQLDatabaseParameters(*src.DeepCopy())
+	return &dst
+}
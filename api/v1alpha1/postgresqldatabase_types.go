@@ -57,6 +57,12 @@ type PostgreSQLDatabaseSpec struct {
 	// +optional
 	Host ResourceVar `json:"host"`
 
+	// PasswordGeneration makes the controller generate the password of the
+	// database user and write it to a Secret owned by this resource. It must
+	// not be set together with Password.
+	// +optional
+	PasswordGeneration *PostgreSQLDatabasePasswordGeneration `json:"passwordGeneration,omitempty"`
+
 	// HostCredentials is the name of a PostgreSQLHostCredentials resource in
 	// the same namespace. This should be omitted if Host is provided.
 	// +optional
@@ -65,12 +71,187 @@ type PostgreSQLDatabaseSpec struct {
 	// Extensions is a list of extensions a given record expects to have available
 	// +optional
 	Extensions []PostgreSQLDatabaseExtension `json:"extensions,omitempty"`
+
+	// ExtensionRemovalPolicy controls what happens to extensions removed from
+	// Extensions. Retain, the default, leaves them installed. Drop drops them
+	// from the database. Only extensions listed in the status are dropped, and
+	// extensions with dependent objects fail to drop.
+	// +optional
+	// +kubebuilder:validation:Enum=Retain;Drop
+	ExtensionRemovalPolicy PostgreSQLDatabaseExtensionRemovalPolicy `json:"extensionRemovalPolicy,omitempty"`
+
+	// Schemas is a list of additional schemas created in the database and
+	// owned by the database user. Each schema gets its own read, readwrite
+	// and readowningwrite roles named after the schema, eg. billing_read, so
+	// schema names must be unique on the host. A schema with roles of another
+	// database or named after an existing role is Invalid. Schemas removed
+	// from the list are left in the database along with their roles.
+	// +optional
+	// +kubebuilder:validation:items:Pattern=`^[a-z_][a-z0-9_]*$`
+	// +kubebuilder:validation:items:MaxLength=47
+	Schemas []string `json:"schemas,omitempty"`
+
+	// Encoding is the character set encoding of the database, eg. UTF8. It
+	// is only used when the database is created.
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
+
+	// LCCollate is the collation order (LC_COLLATE) of the database, eg. C. It
+	// is only used when the database is created.
+	// +optional
+	LCCollate string `json:"lcCollate,omitempty"`
+
+	// LCCtype is the character classification (LC_CTYPE) of the database. It
+	// is only used when the database is created.
+	// +optional
+	LCCtype string `json:"lcCtype,omitempty"`
+
+	// ICULocale makes the database use the ICU locale provider with the given
+	// locale, eg. en-US. It requires PostgreSQL 15 or later and is only used
+	// when the database is created.
+	// +optional
+	ICULocale string `json:"icuLocale,omitempty"`
+
+	// Template is the name of the database the database is created from.
+	// Defaults to template1. An encoding or locale differing from the one of
+	// template1 requires template0. It is only used when the database is
+	// created.
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// Tablespace is the name of the default tablespace of the database. It is
+	// only used when the database is created. Existing databases are not moved
+	// as ALTER DATABASE SET TABLESPACE requires exclusive access and copies all
+	// data of the database.
+	// +optional
+	Tablespace string `json:"tablespace,omitempty"`
+
+	// ConnectionLimit is the number of concurrent connections allowed to the
+	// database. -1 means no limit. Unlike the other options it is applied to
+	// existing databases as well. The limit is left unchanged if omitted.
+	// +optional
+	// +kubebuilder:validation:Minimum=-1
+	ConnectionLimit *int32 `json:"connectionLimit,omitempty"`
+
+	// Parameters are runtime parameters set on the database and on the
+	// database user in the database, eg. statement_timeout. If set, the
+	// controller owns these settings and resets the ones removed from it. The
+	// settings are left untouched if omitted.
+	// +optional
+	Parameters *PostgreSQLDatabaseParameters `json:"parameters,omitempty"`
+
+	// DeletionPolicy controls what happens to the database on the host when
+	// this resource is deleted. Retain, the default, leaves the database and
+	// its roles untouched. RevokeLogin removes the login privilege of the
+	// database user and terminates its sessions. Drop terminates all
+	// connections, drops the database and removes the roles created for it.
+	// Drop is not allowed for shared databases.
+	// +optional
+	// +kubebuilder:validation:Enum=Retain;RevokeLogin;Drop
+	DeletionPolicy PostgreSQLDatabaseDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// PostgreSQLDatabasePasswordGeneration configures a password generated by the
+// controller. The Secret holds the keys host, port, database, user, password
+// and dsn.
+// +k8s:openapi-gen=true
+type PostgreSQLDatabasePasswordGeneration struct {
+	// SecretName is the name of the Secret in the same namespace the
+	// credentials are written to. Defaults to the name of the resource with a
+	// -postgresql suffix.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Length of the generated password. Defaults to 32.
+	// +optional
+	// +kubebuilder:validation:Minimum=16
+	// +kubebuilder:validation:Maximum=128
+	Length int `json:"length,omitempty"`
+
+	// RotationInterval is the interval at which the password is rotated, eg.
+	// 720h. The password is never rotated if omitted.
+	// +optional
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
 }
 
+// PostgreSQLDatabaseParameters are runtime parameters by name. Values are
+// single literals, eg. 30s or on.
+// +k8s:openapi-gen=true
+type PostgreSQLDatabaseParameters struct {
+	// Database parameters are set with ALTER DATABASE ... SET and apply to
+	// all roles connecting to the database.
+	// +optional
+	Database map[string]string `json:"database,omitempty"`
+
+	// User parameters are set with ALTER ROLE ... IN DATABASE ... SET for
+	// the database user and take precedence over Database.
+	// +optional
+	User map[string]string `json:"user,omitempty"`
+}
+
+// PostgreSQLDatabaseDeletionPolicy describes what happens to a database when
+// its PostgreSQLDatabase resource is deleted.
+// +k8s:openapi-gen=true
+type PostgreSQLDatabaseDeletionPolicy string
+
+const (
+	// PostgreSQLDatabaseDeletionPolicyRetain leaves the database and its roles
+	// on the host.
+	PostgreSQLDatabaseDeletionPolicyRetain PostgreSQLDatabaseDeletionPolicy = "Retain"
+	// PostgreSQLDatabaseDeletionPolicyRevokeLogin revokes the login privilege
+	// of the database user and terminates its sessions.
+	PostgreSQLDatabaseDeletionPolicyRevokeLogin PostgreSQLDatabaseDeletionPolicy = "RevokeLogin"
+	// PostgreSQLDatabaseDeletionPolicyDrop terminates all connections to the
+	// database, drops it and removes the roles created for it.
+	PostgreSQLDatabaseDeletionPolicyDrop PostgreSQLDatabaseDeletionPolicy = "Drop"
+)
+
 // PostgreSQLDatabaseExtension describes which an extension for a given database should be installed
 // +k8s:openapi-gen=true
 type PostgreSQLDatabaseExtension struct {
 	ExtensionName string `json:"extensionName"`
+
+	// Version is the version of the extension, eg. 1.6. An installed
+	// extension is updated with ALTER EXTENSION ... UPDATE TO when the
+	// version differs. The default version is installed and the installed
+	// version is left unchanged if omitted.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Schema is the schema the extension is installed in. Defaults to a
+	// schema named after the database. An installed extension is moved to
+	// the schema if it differs.
+	// +optional
+	Schema string `json:"schema,omitempty"`
+}
+
+// PostgreSQLDatabaseExtensionRemovalPolicy describes what happens to an
+// extension removed from a PostgreSQLDatabase resource.
+// +k8s:openapi-gen=true
+type PostgreSQLDatabaseExtensionRemovalPolicy string
+
+const (
+	// PostgreSQLDatabaseExtensionRemovalPolicyRetain leaves the extension
+	// installed in the database.
+	PostgreSQLDatabaseExtensionRemovalPolicyRetain PostgreSQLDatabaseExtensionRemovalPolicy = "Retain"
+	// PostgreSQLDatabaseExtensionRemovalPolicyDrop drops the extension from
+	// the database.
+	PostgreSQLDatabaseExtensionRemovalPolicyDrop PostgreSQLDatabaseExtensionRemovalPolicy = "Drop"
+)
+
+// PostgreSQLDatabaseInstalledExtension is an extension installed in the
+// database.
+// +k8s:openapi-gen=true
+type PostgreSQLDatabaseInstalledExtension struct {
+	// Name of the extension.
+	Name string `json:"name"`
+
+	// Version of the extension.
+	Version string `json:"version"`
+
+	// Schema the extension is installed in.
+	// +optional
+	Schema string `json:"schema,omitempty"`
 }
 
 // PostgreSQLDatabasePhase represents the current phase of a PostgreSQL
@@ -101,9 +282,15 @@ type PostgreSQLDatabaseStatus struct {
 	Host         string                  `json:"host,omitempty"`
 	User         string                  `json:"user,omitempty"`
 	Error        string                  `json:"error,omitempty"`
+
+	// Extensions are the extensions of the spec installed in the database
+	// with their versions.
+	// +optional
+	Extensions []PostgreSQLDatabaseInstalledExtension `json:"extensions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
 
 // PostgreSQLDatabase is the Schema for the postgresqldatabases API
@@ -145,6 +332,21 @@ type ResourceVar struct {
 	ValueFrom *ResourceVarSource `json:"valueFrom,omitempty"`
 }
 
+// IsSet reports whether the ResourceVar holds a value or references one. It
+// does not resolve references.
+func (r ResourceVar) IsSet() bool {
+	if r.Value != "" {
+		return true
+	}
+	if r.ValueFrom == nil {
+		return false
+	}
+	if r.ValueFrom.SecretKeyRef != nil && r.ValueFrom.SecretKeyRef.Key != "" {
+		return true
+	}
+	return r.ValueFrom.ConfigMapKeyRef != nil && r.ValueFrom.ConfigMapKeyRef.Key != ""
+}
+
 // ResourceVarSource represents a source for the value of a ResourceVar
 type ResourceVarSource struct {
 	// Selects a key of a secret in the custom resource's namespace
@@ -0,0 +1,161 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupPostgreSQLDatabaseWebhookWithManager registers the validating webhook
+// for PostgreSQLDatabase resources and the conversion webhook between its API
+// versions with the manager.
+func SetupPostgreSQLDatabaseWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&PostgreSQLDatabase{}).
+		WithValidator(&PostgreSQLDatabaseValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-postgresql-lunar-tech-v1alpha1-postgresqldatabase,mutating=false,failurePolicy=fail,sideEffects=None,groups=postgresql.lunar.tech,resources=postgresqldatabases,verbs=create;update,versions=v1alpha1,name=vpostgresqldatabase.lunar.tech,admissionReviewVersions=v1
+
+// PostgreSQLDatabaseValidator validates PostgreSQLDatabase resources on
+// admission.
+// +kubebuilder:object:generate=false
+type PostgreSQLDatabaseValidator struct{}
+
+var _ admission.CustomValidator = &PostgreSQLDatabaseValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *PostgreSQLDatabaseValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	database, ok := obj.(*PostgreSQLDatabase)
+	if !ok {
+		return nil, fmt.Errorf("expected a PostgreSQLDatabase but got a %T", obj)
+	}
+	return nil, database.validate()
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *PostgreSQLDatabaseValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return v.ValidateCreate(ctx, newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *PostgreSQLDatabaseValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *PostgreSQLDatabase) validate() error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if r.Spec.Name == "" {
+		errs = append(errs, field.Required(spec.Child("name"), ""))
+	}
+	if err := ValidateAdminCredentials(r.Spec.Host, r.Spec.HostCredentials); err != nil {
+		errs = append(errs, field.Invalid(spec.Child("hostCredentials"), r.Spec.HostCredentials, err.Error()))
+	}
+	if r.Spec.Password != nil && r.Spec.PasswordGeneration != nil {
+		errs = append(errs, field.Forbidden(spec.Child("passwordGeneration"), "must not be set together with password"))
+	}
+	if err := ValidateDeletionPolicy(r.Spec.DeletionPolicy, r.Spec.IsShared); err != nil {
+		errs = append(errs, field.Forbidden(spec.Child("deletionPolicy"), err.Error()))
+	}
+	extensions := make(map[string]bool, len(r.Spec.Extensions))
+	for i, extension := range r.Spec.Extensions {
+		path := spec.Child("extensions").Index(i).Child("extensionName")
+		switch {
+		case extension.ExtensionName == "":
+			errs = append(errs, field.Required(path, ""))
+		case extensions[extension.ExtensionName]:
+			errs = append(errs, field.Duplicate(path, extension.ExtensionName))
+		}
+		extensions[extension.ExtensionName] = true
+	}
+	schemas := make(map[string]bool, len(r.Spec.Schemas))
+	for i, schema := range r.Spec.Schemas {
+		path := spec.Child("schemas").Index(i)
+		switch {
+		case strings.EqualFold(schema, "public"):
+			errs = append(errs, field.Forbidden(path, "must not be public"))
+		case schemas[schema]:
+			errs = append(errs, field.Duplicate(path, schema))
+		}
+		schemas[schema] = true
+	}
+	if r.Spec.Parameters != nil {
+		errs = append(errs, validateParameters(spec.Child("parameters", "database"), r.Spec.Parameters.Database)...)
+		errs = append(errs, validateParameters(spec.Child("parameters", "user"), r.Spec.Parameters.User)...)
+	}
+	return invalid("PostgreSQLDatabase", r.Name, errs)
+}
+
+// parameterName matches the names of runtime parameters including the
+// two-part names of custom options, eg. pg_stat_statements.track.
+var parameterName = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// validateParameters returns an error for each parameter in parameters with a
+// name that is not a lowercase runtime parameter name.
+func validateParameters(path *field.Path, parameters map[string]string) field.ErrorList {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs field.ErrorList
+	for _, name := range names {
+		if !parameterName.MatchString(name) {
+			errs = append(errs, field.Invalid(path.Key(name), name, "must be a lowercase parameter name, eg. statement_timeout"))
+		}
+	}
+	return errs
+}
+
+// errAdminCredentials is returned by ValidateAdminCredentials.
+var errAdminCredentials = errors.New("must specify exactly one of `host` and `hostCredentials`")
+
+// ValidateAdminCredentials returns an error unless exactly one of host and
+// hostCredentials is set. The admin credentials of a PostgreSQLDatabase are
+// either looked up by host name or read from a PostgreSQLHostCredentials
+// resource.
+func ValidateAdminCredentials(host ResourceVar, hostCredentials string) error {
+	if host.IsSet() == (hostCredentials != "") {
+		return errAdminCredentials
+	}
+	return nil
+}
+
+// errDropShared is returned by ValidateDeletionPolicy.
+var errDropShared = errors.New("must not be Drop when isShared is true")
+
+// ValidateDeletionPolicy returns an error if a shared database is configured
+// to be dropped on deletion. A shared database is used by other
+// PostgreSQLDatabase resources as well, so it is never dropped.
+func ValidateDeletionPolicy(policy PostgreSQLDatabaseDeletionPolicy, isShared bool) error {
+	if policy == PostgreSQLDatabaseDeletionPolicyDrop && isShared {
+		return errDropShared
+	}
+	return nil
+}
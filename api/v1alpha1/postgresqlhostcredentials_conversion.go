@@ -0,0 +1,97 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"go.lunarway.com/postgresql-controller/api/v1beta1"
+)
+
+type (
+	hostCredentialsContent     = content[PostgreSQLHostCredentialsSpec, PostgreSQLHostCredentialsStatus]
+	hostCredentialsBetaContent = content[v1beta1.PostgreSQLHostCredentialsSpec, v1beta1.PostgreSQLHostCredentialsStatus]
+)
+
+// ConvertTo converts this PostgreSQLHostCredentials to the hub version.
+func (src *PostgreSQLHostCredentials) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.PostgreSQLHostCredentials)
+	converted, annotations, err := convertLossless(hostCredentialsContent{Spec: src.Spec, Status: src.Status}, src.Annotations, hostCredentialsToBeta, hostCredentialsFromBeta, ConversionAnnotationV1alpha1, ConversionAnnotationV1beta1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this PostgreSQLHostCredentials.
+func (dst *PostgreSQLHostCredentials) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.PostgreSQLHostCredentials)
+	converted, annotations, err := convertLossless(hostCredentialsBetaContent{Spec: src.Spec, Status: src.Status}, src.Annotations, hostCredentialsFromBeta, hostCredentialsToBeta, ConversionAnnotationV1beta1, ConversionAnnotationV1alpha1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+func hostCredentialsToBeta(src hostCredentialsContent) hostCredentialsBetaContent {
+	return hostCredentialsBetaContent{
+		Spec: v1beta1.PostgreSQLHostCredentialsSpec{
+			Host:           resourceVarToBeta(src.Spec.Host),
+			User:           resourceVarToBeta(src.Spec.User),
+			Password:       resourceVarToBeta(src.Spec.Password),
+			Params:         src.Spec.Params,
+			Authentication: v1beta1.PostgreSQLHostAuthentication(src.Spec.Authentication),
+			DBIResourceID:  src.Spec.DBIResourceID,
+		},
+		Status: v1beta1.PostgreSQLHostCredentialsStatus{
+			Conditions:      readyConditions(string(src.Status.Phase), src.Status.Error, src.Status.PhaseUpdated, 0),
+			Host:            src.Status.Host,
+			Reachable:       src.Status.Reachable,
+			SuperuserMember: src.Status.SuperuserMember,
+		},
+	}
+}
+
+func hostCredentialsFromBeta(src hostCredentialsBetaContent) hostCredentialsContent {
+	phase, message, updated := readyPhase(src.Status.Conditions)
+	return hostCredentialsContent{
+		Spec: PostgreSQLHostCredentialsSpec{
+			Host:           resourceVarFromBeta(src.Spec.Host),
+			User:           resourceVarFromBeta(src.Spec.User),
+			Password:       resourceVarFromBeta(src.Spec.Password),
+			Params:         src.Spec.Params,
+			Authentication: PostgreSQLHostAuthentication(src.Spec.Authentication),
+			DBIResourceID:  src.Spec.DBIResourceID,
+		},
+		Status: PostgreSQLHostCredentialsStatus{
+			Phase:           PostgreSQLHostCredentialsPhase(phase),
+			PhaseUpdated:    updated,
+			Host:            src.Status.Host,
+			Reachable:       src.Status.Reachable,
+			SuperuserMember: src.Status.SuperuserMember,
+			Error:           message,
+		},
+	}
+}
@@ -39,14 +39,94 @@ type PostgreSQLHostCredentialsSpec struct {
 	// Params is the space-separated list of parameters (e.g.,
 	// `"sslmode=require"`)
 	Params string `json:"params,omitempty"`
+
+	// Authentication is how developers authenticate as the roles of
+	// PostgreSQLUser resources on the host. AWSIAM uses AWS IAM database
+	// authentication, Password generates short-lived passwords delivered in a
+	// Secret and None only manages the roles. Defaults to the authentication
+	// configured for the controller.
+	// +optional
+	// +kubebuilder:validation:Enum=AWSIAM;None;Password
+	Authentication PostgreSQLHostAuthentication `json:"authentication,omitempty"`
+
+	// DBIResourceID is the DbiResourceId of the RDS instance of the host, eg.
+	// db-ABCDEFGHIJKL01234. If set, AWS IAM policy statements only allow users
+	// to connect to this instance while they have granted accesses on the host.
+	// Otherwise they allow connecting to every instance in the account.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^db-[A-Z0-9]+$`
+	DBIResourceID string `json:"dbiResourceId,omitempty"`
 }
 
+// PostgreSQLHostAuthentication is how developers authenticate as the roles of
+// PostgreSQLUser resources on a host.
+// +k8s:openapi-gen=true
+type PostgreSQLHostAuthentication string
+
+const (
+	// PostgreSQLHostAuthenticationAWSIAM uses AWS IAM database authentication.
+	PostgreSQLHostAuthenticationAWSIAM PostgreSQLHostAuthentication = "AWSIAM"
+	// PostgreSQLHostAuthenticationNone only manages the roles.
+	PostgreSQLHostAuthenticationNone PostgreSQLHostAuthentication = "None"
+	// PostgreSQLHostAuthenticationPassword generates short-lived passwords.
+	PostgreSQLHostAuthenticationPassword PostgreSQLHostAuthentication = "Password"
+)
+
+// PostgreSQLHostCredentialsPhase represents the current phase of a
+// PostgreSQLHostCredentials resource.
+// +k8s:openapi-gen=true
+type PostgreSQLHostCredentialsPhase string
+
+const (
+	// PostgreSQLHostCredentialsPhaseFailed indicates that the host could not be
+	// reached or that the admin user does not have the privileges the controller
+	// requires. It will be attempted again in the future.
+	PostgreSQLHostCredentialsPhaseFailed PostgreSQLHostCredentialsPhase = "Failed"
+	// PostgreSQLHostCredentialsPhaseInvalid indicates that the host, user or
+	// password could not be resolved. It will not be attempted again before the
+	// resource is updated.
+	PostgreSQLHostCredentialsPhaseInvalid PostgreSQLHostCredentialsPhase = "Invalid"
+	// PostgreSQLHostCredentialsPhaseRunning indicates that the credentials are
+	// registered with the controller and the host passed its preflight checks.
+	PostgreSQLHostCredentialsPhaseRunning PostgreSQLHostCredentialsPhase = "Running"
+)
+
 // PostgreSQLHostCredentialsStatus defines the observed state of PostgreSQLHostCredentials
 type PostgreSQLHostCredentialsStatus struct {
+	// Phase is the current phase of the PostgreSQLHostCredentials resource
+	// +optional
+	Phase PostgreSQLHostCredentialsPhase `json:"phase,omitempty"`
+
+	// PhaseUpdated is the time when the phase last changed
+	// +optional
+	PhaseUpdated metav1.Time `json:"phaseUpdated,omitempty"`
+
+	// Host is the resolved host name the credentials are registered for.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Reachable indicates whether the controller could connect to the host
+	// with the credentials.
+	// +optional
+	Reachable bool `json:"reachable"`
+
+	// SuperuserMember indicates whether the admin user is a member of the
+	// superuser role configured for the controller.
+	// +optional
+	SuperuserMember bool `json:"superuserMember"`
+
+	// Error contains the error message when Phase is Failed or Invalid
+	// +optional
+	Error string `json:"error,omitempty"`
 }
 
 //+kubebuilder:object:root=true
+//+kubebuilder:storageversion
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Host",type="string",JSONPath=".status.host"
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Reachable",type="boolean",JSONPath=".status.reachable"
+//+kubebuilder:printcolumn:name="Superuser",type="boolean",JSONPath=".status.superuserMember"
 
 // PostgreSQLHostCredentials is the Schema for the postgresqlhostcredentials API
 type PostgreSQLHostCredentials struct {
@@ -66,6 +146,10 @@ type PostgreSQLHostCredentialsList struct {
 	Items           []PostgreSQLHostCredentials `json:"items"`
 }
 
+func (s PostgreSQLHostCredentialsStatus) IsUnchanged(phase PostgreSQLHostCredentialsPhase, errorMessage, host string, reachable, superuserMember bool) bool {
+	return s.Phase == phase && s.Error == errorMessage && s.Host == host && s.Reachable == reachable && s.SuperuserMember == superuserMember
+}
+
 func init() {
 	SchemeBuilder.Register(&PostgreSQLHostCredentials{}, &PostgreSQLHostCredentialsList{})
 }
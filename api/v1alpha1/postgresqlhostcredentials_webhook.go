@@ -0,0 +1,74 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupPostgreSQLHostCredentialsWebhookWithManager registers the validating
+// webhook for PostgreSQLHostCredentials resources and the conversion webhook
+// between its API versions with the manager.
+func SetupPostgreSQLHostCredentialsWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&PostgreSQLHostCredentials{}).
+		WithValidator(&PostgreSQLHostCredentialsValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-postgresql-lunar-tech-v1alpha1-postgresqlhostcredentials,mutating=false,failurePolicy=fail,sideEffects=None,groups=postgresql.lunar.tech,resources=postgresqlhostcredentials,verbs=create;update,versions=v1alpha1,name=vpostgresqlhostcredentials.lunar.tech,admissionReviewVersions=v1
+
+// PostgreSQLHostCredentialsValidator validates PostgreSQLHostCredentials
+// resources on admission.
+// +kubebuilder:object:generate=false
+type PostgreSQLHostCredentialsValidator struct{}
+
+var _ admission.CustomValidator = &PostgreSQLHostCredentialsValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *PostgreSQLHostCredentialsValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	hostCredentials, ok := obj.(*PostgreSQLHostCredentials)
+	if !ok {
+		return nil, fmt.Errorf("expected a PostgreSQLHostCredentials but got a %T", obj)
+	}
+	return nil, hostCredentials.validate()
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *PostgreSQLHostCredentialsValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return v.ValidateCreate(ctx, newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *PostgreSQLHostCredentialsValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *PostgreSQLHostCredentials) validate() error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	errs = append(errs, validateResourceVarRequired(spec.Child("host"), r.Spec.Host)...)
+	errs = append(errs, validateResourceVarRequired(spec.Child("user"), r.Spec.User)...)
+	errs = append(errs, validateResourceVarRequired(spec.Child("password"), r.Spec.Password)...)
+	return invalid("PostgreSQLHostCredentials", r.Name, errs)
+}
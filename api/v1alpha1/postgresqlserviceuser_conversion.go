@@ -0,0 +1,118 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"go.lunarway.com/postgresql-controller/api/v1beta1"
+)
+
+type (
+	serviceUserContent     = content[PostgreSQLServiceUserSpec, *PostgreSQLServiceUserStatus]
+	serviceUserBetaContent = content[v1beta1.PostgreSQLServiceUserSpec, v1beta1.PostgreSQLServiceUserStatus]
+)
+
+// ConvertTo converts this PostgreSQLServiceUser to the hub version.
+func (src *PostgreSQLServiceUser) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.PostgreSQLServiceUser)
+	converted, annotations, err := convertLossless(serviceUserContent{Spec: src.Spec, Status: src.Status}, src.Annotations, serviceUserToBeta, serviceUserFromBeta, ConversionAnnotationV1alpha1, ConversionAnnotationV1beta1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this PostgreSQLServiceUser.
+func (dst *PostgreSQLServiceUser) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.PostgreSQLServiceUser)
+	converted, annotations, err := convertLossless(serviceUserBetaContent{Spec: src.Spec, Status: src.Status}, src.Annotations, serviceUserFromBeta, serviceUserToBeta, ConversionAnnotationV1beta1, ConversionAnnotationV1alpha1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+// serviceUserToBeta converts the single v1alpha1 condition, whose type is the
+// phase of the service user, to the Ready condition.
+func serviceUserToBeta(src serviceUserContent) serviceUserBetaContent {
+	dst := serviceUserBetaContent{
+		Spec: v1beta1.PostgreSQLServiceUserSpec{
+			Username: resourceVarToBeta(src.Spec.Username),
+			Host:     resourceVarToBeta(src.Spec.Host),
+			Password: resourceVarPtrToBeta(src.Spec.Password),
+		},
+	}
+	if src.Spec.Roles != nil {
+		dst.Spec.Roles = make([]v1beta1.PostgreSQLServiceUserRole, len(src.Spec.Roles))
+		for i, role := range src.Spec.Roles {
+			dst.Spec.Roles[i] = v1beta1.PostgreSQLServiceUserRole{RoleName: role.RoleName}
+		}
+	}
+	if src.Status == nil {
+		return dst
+	}
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	if len(src.Status.Conditions) != 0 {
+		condition := src.Status.Conditions[0]
+		dst.Status.Conditions = readyConditions(string(condition.Type), condition.Message, condition.LastTransitionTime, src.Status.ObservedGeneration)
+	}
+	return dst
+}
+
+func serviceUserFromBeta(src serviceUserBetaContent) serviceUserContent {
+	dst := serviceUserContent{
+		Spec: PostgreSQLServiceUserSpec{
+			Username: resourceVarFromBeta(src.Spec.Username),
+			Host:     resourceVarFromBeta(src.Spec.Host),
+			Password: resourceVarPtrFromBeta(src.Spec.Password),
+		},
+	}
+	if src.Spec.Roles != nil {
+		dst.Spec.Roles = make([]PostgreSQLServiceUserRole, len(src.Spec.Roles))
+		for i, role := range src.Spec.Roles {
+			dst.Spec.Roles[i] = PostgreSQLServiceUserRole{RoleName: role.RoleName}
+		}
+	}
+	if src.Status.ObservedGeneration == 0 && len(src.Status.Conditions) == 0 {
+		return dst
+	}
+	dst.Status = &PostgreSQLServiceUserStatus{
+		ObservedGeneration: src.Status.ObservedGeneration,
+	}
+	phase, message, updated := readyPhase(src.Status.Conditions)
+	if phase != "" {
+		dst.Status.Conditions = []PostgreSQLServiceUserCondition{{
+			Type:               PostgreSQLServiceUserConditionType(phase),
+			Status:             corev1.ConditionTrue,
+			LastUpdateTime:     updated,
+			LastTransitionTime: updated,
+			Reason:             phase,
+			Message:            message,
+		}}
+	}
+	return dst
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupPostgreSQLServiceUserWebhookWithManager registers the validating webhook
+// for PostgreSQLServiceUser resources and the conversion webhook between its
+// API versions with the manager.
+func SetupPostgreSQLServiceUserWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&PostgreSQLServiceUser{}).
+		WithValidator(&PostgreSQLServiceUserValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-postgresql-lunar-tech-v1alpha1-postgresqlserviceuser,mutating=false,failurePolicy=fail,sideEffects=None,groups=postgresql.lunar.tech,resources=postgresqlserviceusers,verbs=create;update,versions=v1alpha1,name=vpostgresqlserviceuser.lunar.tech,admissionReviewVersions=v1
+
+// PostgreSQLServiceUserValidator validates PostgreSQLServiceUser resources on
+// admission.
+// +kubebuilder:object:generate=false
+type PostgreSQLServiceUserValidator struct{}
+
+var _ admission.CustomValidator = &PostgreSQLServiceUserValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *PostgreSQLServiceUserValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	serviceUser, ok := obj.(*PostgreSQLServiceUser)
+	if !ok {
+		return nil, fmt.Errorf("expected a PostgreSQLServiceUser but got a %T", obj)
+	}
+	return nil, serviceUser.validate()
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *PostgreSQLServiceUserValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return v.ValidateCreate(ctx, newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *PostgreSQLServiceUserValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *PostgreSQLServiceUser) validate() error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	errs = append(errs, validateResourceVarRequired(spec.Child("username"), r.Spec.Username)...)
+	errs = append(errs, validateResourceVarRequired(spec.Child("host"), r.Spec.Host)...)
+	for i, role := range r.Spec.Roles {
+		if role.RoleName == "" {
+			errs = append(errs, field.Required(spec.Child("roles").Index(i).Child("roleName"), ""))
+		}
+	}
+	return invalid("PostgreSQLServiceUser", r.Name, errs)
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"go.lunarway.com/postgresql-controller/api/v1beta1"
+)
+
+type (
+	userContent     = content[PostgreSQLUserSpec, PostgreSQLUserStatus]
+	userBetaContent = content[v1beta1.PostgreSQLUserSpec, v1beta1.PostgreSQLUserStatus]
+)
+
+// ConvertTo converts this PostgreSQLUser to the hub version.
+func (src *PostgreSQLUser) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.PostgreSQLUser)
+	converted, annotations, err := convertLossless(userContent{Spec: src.Spec, Status: src.Status}, src.Annotations, userToBeta, userFromBeta, ConversionAnnotationV1alpha1, ConversionAnnotationV1beta1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this PostgreSQLUser.
+func (dst *PostgreSQLUser) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.PostgreSQLUser)
+	converted, annotations, err := convertLossless(userBetaContent{Spec: src.Spec, Status: src.Status}, src.Annotations, userFromBeta, userToBeta, ConversionAnnotationV1beta1, ConversionAnnotationV1alpha1)
+	if err != nil {
+		return err
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = annotations
+	dst.Spec = converted.Spec
+	dst.Status = converted.Status
+	return nil
+}
+
+func userToBeta(src userContent) userBetaContent {
+	dst := userBetaContent{
+		Spec: v1beta1.PostgreSQLUserSpec{
+			Name: src.Spec.Name,
+		},
+		Status: v1beta1.PostgreSQLUserStatus{
+			ObservedGeneration: src.Status.ObservedGeneration,
+			Conditions:         readyConditions(string(src.Status.Phase), src.Status.Error, src.Status.PhaseUpdated, src.Status.ObservedGeneration),
+			RoleName:           src.Status.RoleName,
+			PolicyName:         src.Status.PolicyName,
+		},
+	}
+	if src.Spec.Read != nil {
+		dst.Spec.Read = make([]v1beta1.AccessSpec, len(*src.Spec.Read))
+		for i, access := range *src.Spec.Read {
+			dst.Spec.Read[i] = accessSpecToBeta(access)
+		}
+	}
+	if src.Spec.Write != nil {
+		dst.Spec.Write = make([]v1beta1.WriteAccessSpec, len(*src.Spec.Write))
+		for i, access := range *src.Spec.Write {
+			dst.Spec.Write[i] = v1beta1.WriteAccessSpec{
+				AccessSpec: accessSpecToBeta(access.AccessSpec),
+				Extended:   access.Extended,
+			}
+		}
+	}
+	if src.Status.Hosts != nil {
+		dst.Status.Hosts = make([]v1beta1.PostgreSQLUserHostStatus, len(src.Status.Hosts))
+		for i, host := range src.Status.Hosts {
+			dst.Status.Hosts[i] = v1beta1.PostgreSQLUserHostStatus{
+				Host:    host.Host,
+				Phase:   v1beta1.PostgreSQLUserAccessPhase(host.Phase),
+				Message: host.Message,
+			}
+		}
+	}
+	if src.Status.Accesses != nil {
+		dst.Status.Accesses = make([]v1beta1.PostgreSQLUserAccessStatus, len(src.Status.Accesses))
+		for i, access := range src.Status.Accesses {
+			dst.Status.Accesses[i] = v1beta1.PostgreSQLUserAccessStatus{
+				Host:         access.Host,
+				Database:     access.Database,
+				Schema:       access.Schema,
+				AllDatabases: access.AllDatabases,
+				Privilege:    v1beta1.PostgreSQLUserPrivilege(access.Privilege),
+				Reason:       access.Reason,
+				Phase:        v1beta1.PostgreSQLUserAccessPhase(access.Phase),
+				Message:      access.Message,
+			}
+		}
+	}
+	return dst
+}
+
+func userFromBeta(src userBetaContent) userContent {
+	phase, message, updated := readyPhase(src.Status.Conditions)
+	dst := userContent{
+		Spec: PostgreSQLUserSpec{
+			Name: src.Spec.Name,
+		},
+		Status: PostgreSQLUserStatus{
+			ObservedGeneration: src.Status.ObservedGeneration,
+			Phase:              PostgreSQLUserPhase(phase),
+			PhaseUpdated:       updated,
+			Error:              message,
+			RoleName:           src.Status.RoleName,
+			PolicyName:         src.Status.PolicyName,
+		},
+	}
+	if src.Spec.Read != nil {
+		read := make([]AccessSpec, len(src.Spec.Read))
+		for i, access := range src.Spec.Read {
+			read[i] = accessSpecFromBeta(access)
+		}
+		dst.Spec.Read = &read
+	}
+	if src.Spec.Write != nil {
+		write := make([]WriteAccessSpec, len(src.Spec.Write))
+		for i, access := range src.Spec.Write {
+			write[i] = WriteAccessSpec{
+				AccessSpec: accessSpecFromBeta(access.AccessSpec),
+				Extended:   access.Extended,
+			}
+		}
+		dst.Spec.Write = &write
+	}
+	if src.Status.Hosts != nil {
+		dst.Status.Hosts = make([]PostgreSQLUserHostStatus, len(src.Status.Hosts))
+		for i, host := range src.Status.Hosts {
+			dst.Status.Hosts[i] = PostgreSQLUserHostStatus{
+				Host:    host.Host,
+				Phase:   PostgreSQLUserAccessPhase(host.Phase),
+				Message: host.Message,
+			}
+		}
+	}
+	if src.Status.Accesses != nil {
+		dst.Status.Accesses = make([]PostgreSQLUserAccessStatus, len(src.Status.Accesses))
+		for i, access := range src.Status.Accesses {
+			dst.Status.Accesses[i] = PostgreSQLUserAccessStatus{
+				Host:         access.Host,
+				Database:     access.Database,
+				Schema:       access.Schema,
+				AllDatabases: access.AllDatabases,
+				Privilege:    string(access.Privilege),
+				Reason:       access.Reason,
+				Phase:        PostgreSQLUserAccessPhase(access.Phase),
+				Message:      access.Message,
+			}
+		}
+	}
+	return dst
+}
+
+func accessSpecToBeta(src AccessSpec) v1beta1.AccessSpec {
+	return v1beta1.AccessSpec{
+		Host:         resourceVarToBeta(src.Host),
+		AllDatabases: src.AllDatabases,
+		Database:     resourceVarToBeta(src.Database),
+		Schema:       resourceVarToBeta(src.Schema),
+		Reason:       src.Reason,
+		Start:        src.Start,
+		Stop:         src.Stop,
+	}
+}
+
+func accessSpecFromBeta(src v1beta1.AccessSpec) AccessSpec {
+	return AccessSpec{
+		Host:         resourceVarFromBeta(src.Host),
+		AllDatabases: src.AllDatabases,
+		Database:     resourceVarFromBeta(src.Database),
+		Schema:       resourceVarFromBeta(src.Schema),
+		Reason:       src.Reason,
+		Start:        src.Start,
+		Stop:         src.Stop,
+	}
+}
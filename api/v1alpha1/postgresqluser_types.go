@@ -63,20 +63,147 @@ type WriteAccessSpec struct {
 	Extended bool `json:"extended"`
 }
 
+// PostgreSQLUserPhase represents the current phase of a PostgreSQLUser
+// resource.
+// +k8s:openapi-gen=true
+type PostgreSQLUserPhase string
+
+const (
+	// PostgreSQLUserPhaseFailed indicates that one or more access requests or
+	// the IAM policy could not be reconciled. It will be attempted again in the
+	// future.
+	PostgreSQLUserPhaseFailed PostgreSQLUserPhase = "Failed"
+	// PostgreSQLUserPhaseRunning indicates that all access requests and the IAM
+	// policy are reconciled.
+	PostgreSQLUserPhaseRunning PostgreSQLUserPhase = "Running"
+)
+
+// PostgreSQLUserAccessPhase represents the outcome of a single access request
+// or of all access requests on a host.
+// +k8s:openapi-gen=true
+type PostgreSQLUserAccessPhase string
+
+const (
+	// PostgreSQLUserAccessPhaseGranted indicates that the access is granted.
+	PostgreSQLUserAccessPhaseGranted PostgreSQLUserAccessPhase = "Granted"
+	// PostgreSQLUserAccessPhasePending indicates that the start time of the
+	// access request is in the future.
+	PostgreSQLUserAccessPhasePending PostgreSQLUserAccessPhase = "Pending"
+	// PostgreSQLUserAccessPhaseExpired indicates that the stop time of the
+	// access request is in the past.
+	PostgreSQLUserAccessPhaseExpired PostgreSQLUserAccessPhase = "Expired"
+	// PostgreSQLUserAccessPhaseSkipped indicates that the access request uses a
+	// feature that is not enabled in the controller.
+	PostgreSQLUserAccessPhaseSkipped PostgreSQLUserAccessPhase = "Skipped"
+	// PostgreSQLUserAccessPhaseFailed indicates that the access request could
+	// not be resolved or granted.
+	PostgreSQLUserAccessPhaseFailed PostgreSQLUserAccessPhase = "Failed"
+)
+
+// PostgreSQLUserAccessStatus describes the outcome of a single read or write
+// access request.
+// +k8s:openapi-gen=true
+type PostgreSQLUserAccessStatus struct {
+	// Host is the resolved host name of the access request.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Database is the resolved database name of the access request. It is
+	// empty for allDatabases requests.
+	// +optional
+	Database string `json:"database,omitempty"`
+
+	// Schema is the resolved schema name of the access request.
+	// +optional
+	Schema string `json:"schema,omitempty"`
+
+	// AllDatabases indicates that the access request covers all databases on
+	// the host.
+	// +optional
+	AllDatabases bool `json:"allDatabases,omitempty"`
+
+	// Privilege is the privilege of the access request: read, write or
+	// owningwrite.
+	Privilege string `json:"privilege"`
+
+	// Reason is the reason stated in the access request.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Phase is the outcome of the access request.
+	Phase PostgreSQLUserAccessPhase `json:"phase"`
+
+	// Message is a human readable description of the outcome. It contains the
+	// error message when Phase is Failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PostgreSQLUserHostStatus describes the outcome of syncing the user's roles on
+// a single host.
+// +k8s:openapi-gen=true
+type PostgreSQLUserHostStatus struct {
+	// Host is the host name.
+	Host string `json:"host"`
+
+	// Phase is either Granted or Failed.
+	Phase PostgreSQLUserAccessPhase `json:"phase"`
+
+	// Message contains the error message when Phase is Failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // PostgreSQLUserStatus defines the observed state of PostgreSQLUser
 // +k8s:openapi-gen=true
 type PostgreSQLUserStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the most recent generation observed by the
+	// controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Phase is the current phase of the PostgreSQLUser resource
+	// +optional
+	Phase PostgreSQLUserPhase `json:"phase,omitempty"`
+
+	// PhaseUpdated is the time when the phase last changed
+	// +optional
+	PhaseUpdated metav1.Time `json:"phaseUpdated,omitempty"`
+
+	// Error contains the error message when Phase is Failed
+	// +optional
+	Error string `json:"error,omitempty"`
+
+	// RoleName is the name of the PostgreSQL role created for the user.
+	// +optional
+	RoleName string `json:"roleName,omitempty"`
+
+	// PolicyName is the name of the IAM policy granting the user access to
+	// connect as RoleName.
+	// +optional
+	PolicyName string `json:"policyName,omitempty"`
+
+	// Hosts describes the outcome of syncing roles on each host.
+	// +optional
+	// +listType=atomic
+	Hosts []PostgreSQLUserHostStatus `json:"hosts,omitempty"`
+
+	// Accesses describes the outcome of each read and write access request.
+	// +optional
+	// +listType=atomic
+	Accesses []PostgreSQLUserAccessStatus `json:"accesses,omitempty"`
 }
 
 //+kubebuilder:object:root=true
+//+kubebuilder:storageversion
 //+kubebuilder:subresource:status
 
 // PostgreSQLUser is the Schema for the postgresqlusers API
 // +k8s:openapi-gen=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=postgresqlusers,scope=Namespaced,shortName=pguser
+// +kubebuilder:printcolumn:name="Role",type="string",JSONPath=".status.roleName"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase"
 type PostgreSQLUser struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -0,0 +1,106 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupPostgreSQLUserWebhookWithManager registers the validating webhook for
+// PostgreSQLUser resources and the conversion webhook between its API versions
+// with the manager.
+func SetupPostgreSQLUserWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&PostgreSQLUser{}).
+		WithValidator(&PostgreSQLUserValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-postgresql-lunar-tech-v1alpha1-postgresqluser,mutating=false,failurePolicy=fail,sideEffects=None,groups=postgresql.lunar.tech,resources=postgresqlusers,verbs=create;update,versions=v1alpha1,name=vpostgresqluser.lunar.tech,admissionReviewVersions=v1
+
+// PostgreSQLUserValidator validates PostgreSQLUser resources on admission.
+// +kubebuilder:object:generate=false
+type PostgreSQLUserValidator struct{}
+
+var _ admission.CustomValidator = &PostgreSQLUserValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *PostgreSQLUserValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	user, ok := obj.(*PostgreSQLUser)
+	if !ok {
+		return nil, fmt.Errorf("expected a PostgreSQLUser but got a %T", obj)
+	}
+	return nil, user.validate()
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *PostgreSQLUserValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return v.ValidateCreate(ctx, newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *PostgreSQLUserValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *PostgreSQLUser) validate() error {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	if r.Spec.Name == "" {
+		errs = append(errs, field.Required(spec.Child("name"), ""))
+	}
+	if r.Spec.Read != nil {
+		for i, access := range *r.Spec.Read {
+			errs = append(errs, validateAccessSpec(spec.Child("read").Index(i), access)...)
+		}
+	}
+	if r.Spec.Write != nil {
+		for i, access := range *r.Spec.Write {
+			errs = append(errs, validateAccessSpec(spec.Child("write").Index(i), access.AccessSpec)...)
+		}
+	}
+	return invalid("PostgreSQLUser", r.Name, errs)
+}
+
+// validateAccessSpec validates a read or write access request. Either a
+// database and schema or allDatabases must be requested.
+func validateAccessSpec(path *field.Path, access AccessSpec) field.ErrorList {
+	var errs field.ErrorList
+	errs = append(errs, validateResourceVarRequired(path.Child("host"), access.Host)...)
+	if access.Reason == "" {
+		errs = append(errs, field.Required(path.Child("reason"), ""))
+	}
+	allDatabases := access.AllDatabases != nil && *access.AllDatabases
+	switch {
+	case allDatabases && access.Database.IsSet():
+		errs = append(errs, field.Forbidden(path.Child("database"), "must not be set when allDatabases is true"))
+	case !allDatabases:
+		errs = append(errs, validateResourceVarRequired(path.Child("database"), access.Database)...)
+		errs = append(errs, validateResourceVarRequired(path.Child("schema"), access.Schema)...)
+	}
+	if !access.Start.IsZero() && !access.Stop.IsZero() && !access.Start.Before(access.Stop) {
+		errs = append(errs, field.Invalid(path.Child("stop"), access.Stop.UTC().Format(time.RFC3339), "must be after start"))
+	}
+	return errs
+}
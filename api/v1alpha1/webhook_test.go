@@ -0,0 +1,284 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestValidators(t *testing.T) {
+	trueValue := true
+	start := metav1.NewTime(time.Date(2019, time.September, 16, 10, 0, 0, 0, time.UTC))
+	stop := metav1.NewTime(time.Date(2019, time.September, 16, 14, 0, 0, 0, time.UTC))
+	value := func(v string) ResourceVar {
+		return ResourceVar{Value: v}
+	}
+	meta := metav1.ObjectMeta{Name: "test"}
+
+	tt := []struct {
+		name      string
+		validator admission.CustomValidator
+		obj       runtime.Object
+		err       string
+	}{
+		{
+			name:      "database with host",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name: "user",
+					Host: value("localhost:5432"),
+				},
+			},
+		},
+		{
+			name:      "database with host credentials",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name:            "user",
+					HostCredentials: "localhost",
+				},
+			},
+		},
+		{
+			name:      "database with host and host credentials",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name:            "user",
+					Host:            value("localhost:5432"),
+					HostCredentials: "localhost",
+				},
+			},
+			err: "PostgreSQLDatabase.postgresql.lunar.tech \"test\" is invalid: spec.hostCredentials: Invalid value: \"localhost\": must specify exactly one of `host` and `hostCredentials`",
+		},
+		{
+			name:      "database with password and password generation",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name:               "user",
+					Host:               value("localhost:5432"),
+					Password:           &ResourceVar{Value: "secret"},
+					PasswordGeneration: &PostgreSQLDatabasePasswordGeneration{},
+				},
+			},
+			err: "PostgreSQLDatabase.postgresql.lunar.tech \"test\" is invalid: spec.passwordGeneration: Forbidden: must not be set together with password",
+		},
+		{
+			name:      "shared database with drop policy",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name:           "user",
+					Host:           value("localhost:5432"),
+					IsShared:       true,
+					DeletionPolicy: PostgreSQLDatabaseDeletionPolicyDrop,
+				},
+			},
+			err: "PostgreSQLDatabase.postgresql.lunar.tech \"test\" is invalid: spec.deletionPolicy: Forbidden: must not be Drop when isShared is true",
+		},
+		{
+			name:      "database with public and duplicate schemas",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name:    "user",
+					Host:    value("localhost:5432"),
+					Schemas: []string{"billing", "public", "billing"},
+				},
+			},
+			err: "PostgreSQLDatabase.postgresql.lunar.tech \"test\" is invalid: [spec.schemas[1]: Forbidden: must not be public, spec.schemas[2]: Duplicate value: \"billing\"]",
+		},
+		{
+			name:      "database with duplicate extensions",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name: "user",
+					Host: value("localhost:5432"),
+					Extensions: []PostgreSQLDatabaseExtension{
+						{ExtensionName: "pg_trgm", Version: "1.5"},
+						{ExtensionName: "pg_trgm", Version: "1.6"},
+					},
+				},
+			},
+			err: "PostgreSQLDatabase.postgresql.lunar.tech \"test\" is invalid: spec.extensions[1].extensionName: Duplicate value: \"pg_trgm\"",
+		},
+		{
+			name:      "database with invalid parameter names",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name: "user",
+					Host: value("localhost:5432"),
+					Parameters: &PostgreSQLDatabaseParameters{
+						Database: map[string]string{"statement_timeout": "30s", "Work_Mem": "8MB"},
+						User:     map[string]string{"pg_stat_statements.track": "all", "log_statement; DROP": "all"},
+					},
+				},
+			},
+			err: "PostgreSQLDatabase.postgresql.lunar.tech \"test\" is invalid: [spec.parameters.database[Work_Mem]: Invalid value: \"Work_Mem\": must be a lowercase parameter name, eg. statement_timeout, spec.parameters.user[log_statement; DROP]: Invalid value: \"log_statement; DROP\": must be a lowercase parameter name, eg. statement_timeout]",
+		},
+		{
+			name:      "database without host",
+			validator: &PostgreSQLDatabaseValidator{},
+			obj: &PostgreSQLDatabase{
+				ObjectMeta: meta,
+				Spec: PostgreSQLDatabaseSpec{
+					Name: "user",
+					Host: ResourceVar{
+						ValueFrom: &ResourceVarSource{
+							ConfigMapKeyRef: &KeySelector{Name: "database"},
+						},
+					},
+				},
+			},
+			err: "must specify exactly one of `host` and `hostCredentials`",
+		},
+		{
+			name:      "valid user",
+			validator: &PostgreSQLUserValidator{},
+			obj: &PostgreSQLUser{
+				ObjectMeta: meta,
+				Spec: PostgreSQLUserSpec{
+					Name: "bso",
+					Read: &[]AccessSpec{
+						{
+							Host:         value("localhost:5432"),
+							AllDatabases: &trueValue,
+							Reason:       "I am a developer",
+						},
+					},
+					Write: &[]WriteAccessSpec{
+						{
+							AccessSpec: AccessSpec{
+								Host:     value("localhost:5432"),
+								Database: value("user"),
+								Schema:   value("user"),
+								Reason:   "Related to support ticket LW-1234",
+								Start:    &start,
+								Stop:     &stop,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:      "user with invalid accesses",
+			validator: &PostgreSQLUserValidator{},
+			obj: &PostgreSQLUser{
+				ObjectMeta: meta,
+				Spec: PostgreSQLUserSpec{
+					Name: "bso",
+					Read: &[]AccessSpec{
+						{
+							Host:         value("localhost:5432"),
+							AllDatabases: &trueValue,
+							Database:     value("user"),
+						},
+					},
+					Write: &[]WriteAccessSpec{
+						{
+							AccessSpec: AccessSpec{
+								Host:   value("localhost:5432"),
+								Reason: "Related to support ticket LW-1234",
+								Start:  &stop,
+								Stop:   &start,
+							},
+						},
+					},
+				},
+			},
+			err: "[spec.read[0].reason: Required value, spec.read[0].database: Forbidden: must not be set when allDatabases is true, spec.write[0].database: Required value: must specify either value or valueFrom with a key, spec.write[0].schema: Required value: must specify either value or valueFrom with a key, spec.write[0].stop: Invalid value: \"2019-09-16T10:00:00Z\": must be after start]",
+		},
+		{
+			name:      "custom role with unknown privilege",
+			validator: &CustomRoleValidator{},
+			obj: &CustomRole{
+				ObjectMeta: meta,
+				Spec: CustomRoleSpec{
+					RoleName: "reader",
+					Grants: []CustomRoleGrant{
+						{Privileges: []string{"select"}},
+						{Privileges: []string{"SELEKT"}},
+					},
+				},
+			},
+			err: "spec.grants[1].privileges: Invalid value: []string{\"SELEKT\"}: invalid privilege \"SELEKT\"",
+		},
+		{
+			name:      "custom role with unsafe function args",
+			validator: &CustomRoleValidator{},
+			obj: &CustomRole{
+				ObjectMeta: meta,
+				Spec: CustomRoleSpec{
+					RoleName: "reader",
+					Functions: []CustomRoleFunction{
+						{
+							Name:    "set_setting",
+							Args:    "input text); DROP TABLE users; --",
+							Returns: "void",
+							Body:    "RETURN;",
+						},
+					},
+				},
+			},
+			err: "spec.functions[0]: Invalid value: \"set_setting\": function \"set_setting\": args contains unsafe SQL characters",
+		},
+		{
+			name:      "service user without host",
+			validator: &PostgreSQLServiceUserValidator{},
+			obj: &PostgreSQLServiceUser{
+				ObjectMeta: meta,
+				Spec: PostgreSQLServiceUserSpec{
+					Username: value("service"),
+					Roles:    []PostgreSQLServiceUserRole{{RoleName: ""}},
+				},
+			},
+			err: "[spec.host: Required value: must specify either value or valueFrom with a key, spec.roles[0].roleName: Required value]",
+		},
+		{
+			name:      "host credentials without password",
+			validator: &PostgreSQLHostCredentialsValidator{},
+			obj: &PostgreSQLHostCredentials{
+				ObjectMeta: meta,
+				Spec: PostgreSQLHostCredentialsSpec{
+					Host: value("localhost:5432"),
+					User: value("iam_creator"),
+				},
+			},
+			err: "spec.password: Required value: must specify either value or valueFrom with a key",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, createErr := tc.validator.ValidateCreate(context.Background(), tc.obj)
+			_, updateErr := tc.validator.ValidateUpdate(context.Background(), tc.obj, tc.obj)
+			if tc.err == "" {
+				assert.NoError(t, createErr, "unexpected create error")
+				assert.NoError(t, updateErr, "unexpected update error")
+				return
+			}
+			if assert.Error(t, createErr, "expected a create error") {
+				assert.Contains(t, createErr.Error(), tc.err, "create error not as expected")
+			}
+			assert.Equal(t, createErr, updateErr, "update error should match create error")
+		})
+	}
+}
@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -259,6 +260,21 @@ func (in *PostgreSQLDatabaseExtension) DeepCopy() *PostgreSQLDatabaseExtension {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostgreSQLDatabaseInstalledExtension) DeepCopyInto(out *PostgreSQLDatabaseInstalledExtension) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLDatabaseInstalledExtension.
+func (in *PostgreSQLDatabaseInstalledExtension) DeepCopy() *PostgreSQLDatabaseInstalledExtension {
+	if in == nil {
+		return nil
+	}
+	out := new(PostgreSQLDatabaseInstalledExtension)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PostgreSQLDatabaseList) DeepCopyInto(out *PostgreSQLDatabaseList) {
 	*out = *in
@@ -291,6 +307,55 @@ func (in *PostgreSQLDatabaseList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostgreSQLDatabaseParameters) DeepCopyInto(out *PostgreSQLDatabaseParameters) {
+	*out = *in
+	if in.Database != nil {
+		in, out := &in.Database, &out.Database
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.User != nil {
+		in, out := &in.User, &out.User
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLDatabaseParameters.
+func (in *PostgreSQLDatabaseParameters) DeepCopy() *PostgreSQLDatabaseParameters {
+	if in == nil {
+		return nil
+	}
+	out := new(PostgreSQLDatabaseParameters)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostgreSQLDatabasePasswordGeneration) DeepCopyInto(out *PostgreSQLDatabasePasswordGeneration) {
+	*out = *in
+	if in.RotationInterval != nil {
+		in, out := &in.RotationInterval, &out.RotationInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLDatabasePasswordGeneration.
+func (in *PostgreSQLDatabasePasswordGeneration) DeepCopy() *PostgreSQLDatabasePasswordGeneration {
+	if in == nil {
+		return nil
+	}
+	out := new(PostgreSQLDatabasePasswordGeneration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PostgreSQLDatabaseSpec) DeepCopyInto(out *PostgreSQLDatabaseSpec) {
 	*out = *in
@@ -301,11 +366,31 @@ func (in *PostgreSQLDatabaseSpec) DeepCopyInto(out *PostgreSQLDatabaseSpec) {
 		(*in).DeepCopyInto(*out)
 	}
 	in.Host.DeepCopyInto(&out.Host)
+	if in.PasswordGeneration != nil {
+		in, out := &in.PasswordGeneration, &out.PasswordGeneration
+		*out = new(PostgreSQLDatabasePasswordGeneration)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Extensions != nil {
 		in, out := &in.Extensions, &out.Extensions
 		*out = make([]PostgreSQLDatabaseExtension, len(*in))
 		copy(*out, *in)
 	}
+	if in.Schemas != nil {
+		in, out := &in.Schemas, &out.Schemas
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConnectionLimit != nil {
+		in, out := &in.ConnectionLimit, &out.ConnectionLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = new(PostgreSQLDatabaseParameters)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLDatabaseSpec.
@@ -322,6 +407,11 @@ func (in *PostgreSQLDatabaseSpec) DeepCopy() *PostgreSQLDatabaseSpec {
 func (in *PostgreSQLDatabaseStatus) DeepCopyInto(out *PostgreSQLDatabaseStatus) {
 	*out = *in
 	in.PhaseUpdated.DeepCopyInto(&out.PhaseUpdated)
+	if in.Extensions != nil {
+		in, out := &in.Extensions, &out.Extensions
+		*out = make([]PostgreSQLDatabaseInstalledExtension, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLDatabaseStatus.
@@ -340,7 +430,7 @@ func (in *PostgreSQLHostCredentials) DeepCopyInto(out *PostgreSQLHostCredentials
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLHostCredentials.
@@ -414,6 +504,7 @@ func (in *PostgreSQLHostCredentialsSpec) DeepCopy() *PostgreSQLHostCredentialsSp
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PostgreSQLHostCredentialsStatus) DeepCopyInto(out *PostgreSQLHostCredentialsStatus) {
 	*out = *in
+	in.PhaseUpdated.DeepCopyInto(&out.PhaseUpdated)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLHostCredentialsStatus.
@@ -576,7 +667,7 @@ func (in *PostgreSQLUser) DeepCopyInto(out *PostgreSQLUser) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLUser.
@@ -597,6 +688,36 @@ func (in *PostgreSQLUser) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostgreSQLUserAccessStatus) DeepCopyInto(out *PostgreSQLUserAccessStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLUserAccessStatus.
+func (in *PostgreSQLUserAccessStatus) DeepCopy() *PostgreSQLUserAccessStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PostgreSQLUserAccessStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostgreSQLUserHostStatus) DeepCopyInto(out *PostgreSQLUserHostStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLUserHostStatus.
+func (in *PostgreSQLUserHostStatus) DeepCopy() *PostgreSQLUserHostStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PostgreSQLUserHostStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PostgreSQLUserList) DeepCopyInto(out *PostgreSQLUserList) {
 	*out = *in
@@ -669,6 +790,17 @@ func (in *PostgreSQLUserSpec) DeepCopy() *PostgreSQLUserSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PostgreSQLUserStatus) DeepCopyInto(out *PostgreSQLUserStatus) {
 	*out = *in
+	in.PhaseUpdated.DeepCopyInto(&out.PhaseUpdated)
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]PostgreSQLUserHostStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Accesses != nil {
+		in, out := &in.Accesses, &out.Accesses
+		*out = make([]PostgreSQLUserAccessStatus, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgreSQLUserStatus.
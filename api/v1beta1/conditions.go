@@ -0,0 +1,34 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// ConditionTypeReady is the condition type every kind reports. It is True
+// when the controller has reconciled the resource.
+const ConditionTypeReady = "Ready"
+
+// Reasons of the Ready condition.
+const (
+	// ReasonRunning indicates that the resource is reconciled.
+	ReasonRunning = "Running"
+	// ReasonFailed indicates that the controller was unable to reconcile the
+	// resource. It will be attempted again in the future.
+	ReasonFailed = "Failed"
+	// ReasonInvalid indicates that the specification of the resource is
+	// invalid and should be fixed. It will not be attempted again before the
+	// resource is updated.
+	ReasonInvalid = "Invalid"
+)
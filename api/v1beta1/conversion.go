@@ -0,0 +1,35 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// v1beta1 is the hub of the conversion between API versions. Every other
+// version converts to and from it.
+
+// Hub marks this type as a conversion hub.
+func (*CustomRole) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*PostgreSQLDatabase) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*PostgreSQLHostCredentials) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*PostgreSQLServiceUser) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*PostgreSQLUser) Hub() {}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PostgreSQLHostCredentialsSpec defines the desired state of PostgreSQLHostCredentials
+type PostgreSQLHostCredentialsSpec struct {
+	// Host is the hostname of the PostgreSQL instance.
+	Host ResourceVar `json:"host,omitempty"`
+
+	// User is the admin user for the PostgreSQL instance. It will be used by
+	// posgresql-controller to manage resources on the host.
+	User ResourceVar `json:"user,omitempty"`
+
+	// Password is the admin user password for the PostgreSQL instance. It will
+	// be used by postgresql-controller to manage resources on the host.
+	Password ResourceVar `json:"password,omitempty"`
+
+	// Params is the space-separated list of parameters (e.g.,
+	// `"sslmode=require"`)
+	Params string `json:"params,omitempty"`
+
+	// Authentication is how developers authenticate as the roles of
+	// PostgreSQLUser resources on the host. AWSIAM uses AWS IAM database
+	// authentication, Password generates short-lived passwords delivered in a
+	// Secret and None only manages the roles. Defaults to the authentication
+	// configured for the controller.
+	// +optional
+	// +kubebuilder:validation:Enum=AWSIAM;None;Password
+	Authentication PostgreSQLHostAuthentication `json:"authentication,omitempty"`
+
+	// DBIResourceID is the DbiResourceId of the RDS instance of the host, eg.
+	// db-ABCDEFGHIJKL01234. If set, AWS IAM policy statements only allow users
+	// to connect to this instance while they have granted accesses on the host.
+	// Otherwise they allow connecting to every instance in the account.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^db-[A-Z0-9]+$`
+	DBIResourceID string `json:"dbiResourceId,omitempty"`
+}
+
+// PostgreSQLHostAuthentication is how developers authenticate as the roles of
+// PostgreSQLUser resources on a host.
+type PostgreSQLHostAuthentication string
+
+const (
+	// PostgreSQLHostAuthenticationAWSIAM uses AWS IAM database authentication.
+	PostgreSQLHostAuthenticationAWSIAM PostgreSQLHostAuthentication = "AWSIAM"
+	// PostgreSQLHostAuthenticationNone only manages the roles.
+	PostgreSQLHostAuthenticationNone PostgreSQLHostAuthentication = "None"
+	// PostgreSQLHostAuthenticationPassword generates short-lived passwords.
+	PostgreSQLHostAuthenticationPassword PostgreSQLHostAuthentication = "Password"
+)
+
+// PostgreSQLHostCredentialsStatus defines the observed state of PostgreSQLHostCredentials
+type PostgreSQLHostCredentialsStatus struct {
+	// Conditions describe the current state of the credentials. The Ready
+	// condition is True when the credentials are registered with the
+	// controller and the host passed its preflight checks.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// Host is the resolved host name the credentials are registered for.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Reachable indicates whether the controller could connect to the host
+	// with the credentials.
+	// +optional
+	Reachable bool `json:"reachable"`
+
+	// SuperuserMember indicates whether the admin user is a member of the
+	// superuser role configured for the controller.
+	// +optional
+	SuperuserMember bool `json:"superuserMember"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:unservedversion
+// +kubebuilder:printcolumn:name="Host",type="string",JSONPath=".status.host"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Reachable",type="boolean",JSONPath=".status.reachable"
+// +kubebuilder:printcolumn:name="Superuser",type="boolean",JSONPath=".status.superuserMember"
+
+// PostgreSQLHostCredentials is the Schema for the postgresqlhostcredentials API
+type PostgreSQLHostCredentials struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PostgreSQLHostCredentialsSpec   `json:"spec,omitempty"`
+	Status PostgreSQLHostCredentialsStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PostgreSQLHostCredentialsList contains a list of PostgreSQLHostCredentials
+type PostgreSQLHostCredentialsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PostgreSQLHostCredentials `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PostgreSQLHostCredentials{}, &PostgreSQLHostCredentialsList{})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PostgreSQLServiceUserSpec defines the desired state of PostgreSQLServiceUser
+type PostgreSQLServiceUserSpec struct {
+	// Name of the service user
+	Username ResourceVar `json:"username"`
+
+	// Host to connect to
+	Host ResourceVar `json:"host"`
+
+	// Password used with the Host and Name used to connect to the database
+	// +optional
+	Password *ResourceVar `json:"password,omitempty"`
+
+	// Roles to grant to the select name
+	// +optional
+	// +listType=atomic
+	Roles []PostgreSQLServiceUserRole `json:"roles,omitempty"`
+}
+
+// PostgreSQLServiceUserRole is a role granted to a service user.
+type PostgreSQLServiceUserRole struct {
+	// RoleName is the name of the role to which to grant to the user
+	RoleName string `json:"roleName"`
+}
+
+// PostgreSQLServiceUserStatus defines the observed state of PostgreSQLServiceUser
+type PostgreSQLServiceUserStatus struct {
+	// ObservedGeneration is the most recent generation observed by the
+	// controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the current state of the service user. The Ready
+	// condition is True when the service user and its roles are reconciled.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:unservedversion
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+
+// PostgreSQLServiceUser is the Schema for the postgresqlserviceusers API
+type PostgreSQLServiceUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PostgreSQLServiceUserSpec   `json:"spec"`
+	Status PostgreSQLServiceUserStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PostgreSQLServiceUserList contains a list of PostgreSQLServiceUser
+type PostgreSQLServiceUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []PostgreSQLServiceUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PostgreSQLServiceUser{}, &PostgreSQLServiceUserList{})
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PostgreSQLUserSpec defines the desired state of PostgreSQLUser
+type PostgreSQLUserSpec struct {
+	Name string `json:"name"`
+	// +optional
+	// +listType=atomic
+	Read []AccessSpec `json:"read,omitempty"`
+	// +optional
+	// +listType=atomic
+	Write []WriteAccessSpec `json:"write,omitempty"`
+}
+
+// AccessSpec defines a read access request specification.
+type AccessSpec struct {
+	Host ResourceVar `json:"host"`
+	// +optional
+	AllDatabases *bool `json:"allDatabases,omitempty"`
+	// +optional
+	Database ResourceVar `json:"database,omitempty"`
+	// +optional
+	Schema ResourceVar `json:"schema,omitempty"`
+	Reason string      `json:"reason"`
+	// +optional
+	Start *metav1.Time `json:"start,omitempty"`
+	// +optional
+	Stop *metav1.Time `json:"stop,omitempty"`
+}
+
+// WriteAccessSpec defines a write access request specification.
+type WriteAccessSpec struct {
+	AccessSpec `json:",inline"`
+	// +optional
+	Extended bool `json:"extended,omitempty"`
+}
+
+// PostgreSQLUserPrivilege is the privilege granted by an access request.
+// +kubebuilder:validation:Enum=read;write;owningwrite
+type PostgreSQLUserPrivilege string
+
+const (
+	PostgreSQLUserPrivilegeRead        PostgreSQLUserPrivilege = "read"
+	PostgreSQLUserPrivilegeWrite       PostgreSQLUserPrivilege = "write"
+	PostgreSQLUserPrivilegeOwningWrite PostgreSQLUserPrivilege = "owningwrite"
+)
+
+// PostgreSQLUserAccessPhase represents the outcome of a single access request
+// or of all access requests on a host.
+// +kubebuilder:validation:Enum=Granted;Pending;Expired;Skipped;Failed
+type PostgreSQLUserAccessPhase string
+
+const (
+	// PostgreSQLUserAccessPhaseGranted indicates that the access is granted.
+	PostgreSQLUserAccessPhaseGranted PostgreSQLUserAccessPhase = "Granted"
+	// PostgreSQLUserAccessPhasePending indicates that the start time of the
+	// access request is in the future.
+	PostgreSQLUserAccessPhasePending PostgreSQLUserAccessPhase = "Pending"
+	// PostgreSQLUserAccessPhaseExpired indicates that the stop time of the
+	// access request is in the past.
+	PostgreSQLUserAccessPhaseExpired PostgreSQLUserAccessPhase = "Expired"
+	// PostgreSQLUserAccessPhaseSkipped indicates that the access request uses a
+	// feature that is not enabled in the controller.
+	PostgreSQLUserAccessPhaseSkipped PostgreSQLUserAccessPhase = "Skipped"
+	// PostgreSQLUserAccessPhaseFailed indicates that the access request could
+	// not be resolved or granted.
+	PostgreSQLUserAccessPhaseFailed PostgreSQLUserAccessPhase = "Failed"
+)
+
+// PostgreSQLUserAccessStatus describes the outcome of a single read or write
+// access request.
+type PostgreSQLUserAccessStatus struct {
+	// Host is the resolved host name of the access request.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Database is the resolved database name of the access request. It is
+	// empty for allDatabases requests.
+	// +optional
+	Database string `json:"database,omitempty"`
+
+	// Schema is the resolved schema name of the access request.
+	// +optional
+	Schema string `json:"schema,omitempty"`
+
+	// AllDatabases indicates that the access request covers all databases on
+	// the host.
+	// +optional
+	AllDatabases bool `json:"allDatabases,omitempty"`
+
+	// Privilege is the privilege of the access request.
+	Privilege PostgreSQLUserPrivilege `json:"privilege"`
+
+	// Reason is the reason stated in the access request.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Phase is the outcome of the access request.
+	Phase PostgreSQLUserAccessPhase `json:"phase"`
+
+	// Message is a human readable description of the outcome. It contains the
+	// error message when Phase is Failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PostgreSQLUserHostStatus describes the outcome of syncing the user's roles on
+// a single host.
+type PostgreSQLUserHostStatus struct {
+	// Host is the host name.
+	Host string `json:"host"`
+
+	// Phase is either Granted or Failed.
+	Phase PostgreSQLUserAccessPhase `json:"phase"`
+
+	// Message contains the error message when Phase is Failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PostgreSQLUserStatus defines the observed state of PostgreSQLUser
+type PostgreSQLUserStatus struct {
+	// ObservedGeneration is the most recent generation observed by the
+	// controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the current state of the user. The Ready condition
+	// is True when all access requests and the IAM policy are reconciled.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// RoleName is the name of the PostgreSQL role created for the user.
+	// +optional
+	RoleName string `json:"roleName,omitempty"`
+
+	// PolicyName is the name of the IAM policy granting the user access to
+	// connect as RoleName.
+	// +optional
+	PolicyName string `json:"policyName,omitempty"`
+
+	// Hosts describes the outcome of syncing roles on each host.
+	// +optional
+	// +listType=atomic
+	Hosts []PostgreSQLUserHostStatus `json:"hosts,omitempty"`
+
+	// Accesses describes the outcome of each read and write access request.
+	// +optional
+	// +listType=atomic
+	Accesses []PostgreSQLUserAccessStatus `json:"accesses,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:unservedversion
+// +kubebuilder:resource:path=postgresqlusers,scope=Namespaced,shortName=pguser
+// +kubebuilder:printcolumn:name="Role",type="string",JSONPath=".status.roleName"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+
+// PostgreSQLUser is the Schema for the postgresqlusers API
+type PostgreSQLUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PostgreSQLUserSpec   `json:"spec,omitempty"`
+	Status PostgreSQLUserStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PostgreSQLUserList contains a list of PostgreSQLUser
+type PostgreSQLUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PostgreSQLUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PostgreSQLUser{}, &PostgreSQLUserList{})
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"os"
 	"time"
@@ -33,13 +35,17 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	postgresqlv1beta1 "go.lunarway.com/postgresql-controller/api/v1beta1"
 	"go.lunarway.com/postgresql-controller/internal/config"
 	"go.lunarway.com/postgresql-controller/internal/controller"
+	"go.lunarway.com/postgresql-controller/pkg/auth"
 	"go.lunarway.com/postgresql-controller/pkg/grants"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
 	"go.lunarway.com/postgresql-controller/pkg/iam"
 	"go.lunarway.com/postgresql-controller/pkg/kube"
 	//+kubebuilder:scaffold:imports
@@ -54,6 +60,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(postgresqlv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(postgresqlv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -128,20 +135,95 @@ func main() {
 		os.Exit(1)
 	}
 
+	// hostCredentials is shared by all controllers. It is seeded with the
+	// credentials from the controller arguments and kept up to date with
+	// PostgreSQLHostCredentials resources by its reconciler.
+	hostCredentials := hostcredentials.NewRegistry(config.HostCredentials)
+
 	if err = (&controller.PostgreSQLDatabaseReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("PostgreSQLDatabase"),
+		Scheme: mgr.GetScheme(),
 
 		ManagerRoleName:   config.ManagerRoleName,
 		SuperuserRoleName: config.SuperuserRoleName,
-		HostCredentials:   config.HostCredentials,
+		HostCredentials:   hostCredentials,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PostgreSQLDatabase")
 		os.Exit(1)
 	}
+	authenticators := map[auth.Method]auth.Authenticator{
+		auth.MethodNone: auth.None{},
+		auth.MethodPassword: &auth.Password{
+			Client:          mgr.GetClient(),
+			Scheme:          mgr.GetScheme(),
+			HostCredentials: hostCredentials,
+			Validity:        config.PasswordValidity,
+		},
+	}
+	// AWS IAM authentication is only available with login roles to attach the
+	// policies to. Otherwise every IAM call, including the removal of deleted
+	// users, would fail.
+	var awsIAM *auth.AWSIAM
+	if config.AWSIAMEnabled() {
+		// awsSession is shared by all IAM calls so credentials are resolved
+		// once and refreshed by the SDK when they expire.
+		awsSession, err := iam.NewSession(iam.SessionConfig{
+			Region:          config.AWS.Region,
+			Profile:         config.AWS.Profile,
+			AccessKeyID:     config.AWS.AccessKeyID,
+			SecretAccessKey: config.AWS.SecretAccessKey,
+			AssumeRoleARN:   config.AWS.AssumeRoleARN,
+			ExternalID:      config.AWS.AssumeRoleExternalID,
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to create AWS session")
+			os.Exit(1)
+		}
+		iamClient := iam.NewClient(awsSession, ctrl.Log.WithName("iam"), config.AWS.AccountID, config.IAMPolicyPrefix, iam.CacheConfig{
+			TTL:           config.IAMCacheTTL,
+			BatchInterval: config.IAMBatchInterval,
+		})
+		// pending IAM policy changes are written on shutdown so they are not
+		// lost until the next resync
+		if err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return iamClient.Flush()
+		})); err != nil {
+			setupLog.Error(err, "unable to add IAM policy flush on shutdown")
+			os.Exit(1)
+		}
+
+		awsIAM = &auth.AWSIAM{
+			Client:             iamClient,
+			PolicyName:         config.AWS.PolicyName,
+			Region:             config.AWS.Region,
+			AccountID:          config.AWS.AccountID,
+			LoginRoles:         config.GetLoginRoles(),
+			RolePrefix:         config.UserRolePrefix,
+			Principal:          config.AWS.Principal,
+			PreviousPrincipals: config.AWS.PreviousPrincipals,
+		}
+		authenticators[auth.MethodAWSIAM] = awsIAM
+	}
+
+	// authentication picks how developers log in as the roles of users on each
+	// host. It is kept up to date with PostgreSQLHostCredentials resources by
+	// their reconciler.
+	if err := config.ValidateAuthentication(); err != nil {
+		setupLog.Error(err, "unable to configure authentication")
+		os.Exit(1)
+	}
+	authentication, err := auth.NewSelector(config.GetDefaultAuthentication(), authenticators, config.GetHostAuthentication())
+	if err != nil {
+		setupLog.Error(err, "unable to configure authentication")
+		os.Exit(1)
+	}
+
 	if err = (&controller.PostgreSQLUserReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("postgresql-controller"),
 
 		Log: ctrl.Log.WithName("controllers").WithName("PostgreSQLUser"),
 
@@ -149,8 +231,14 @@ func main() {
 			AllDatabasesReadEnabled:  config.AllDatabasesReadEnabled,
 			AllDatabasesWriteEnabled: config.AllDatabasesWriteEnabled,
 			ExtendedWritesEnabled:    config.ExtendedWriteEnabled,
-			HostCredentials:          config.HostCredentials,
+			HostCredentials:          hostCredentials,
 			StaticRoles:              config.GetUserRoles(),
+			HostRoles:                authentication.Roles,
+			DeletionPolicy:           config.UserDeletionPolicy,
+			DeletionReassignRole:     config.UserDeletionReassignRole,
+			SessionTermination:       config.SessionTermination,
+			ReadParameters:           config.UserReadParameters,
+			WriteParameters:          config.UserWriteParameters,
 
 			Now: time.Now,
 			AllDatabases: func(namespace string) ([]postgresqlv1alpha1.PostgreSQLDatabase, error) {
@@ -160,32 +248,32 @@ func main() {
 				return kube.ResourceValue(mgr.GetClient(), resource, namespace)
 			},
 		},
-		EnsureIAMUser: iam.EnsureUser,
-		RemoveIAMUser: iam.RemoveUser,
-
-		RolePrefix:         config.UserRolePrefix,
-		AWSPolicyName:      config.AWS.PolicyName,
-		AWSRegion:          config.AWS.Region,
-		AWSAccountID:       config.AWS.AccountID,
-		AWSProfile:         config.AWS.Profile,
-		AWSAccessKeyID:     config.AWS.AccessKeyID,
-		AWSSecretAccessKey: config.AWS.SecretAccessKey,
-		IAMPolicyPrefix:    config.IAMPolicyPrefix,
-		AWSLoginRoles:      config.GetLoginRoles(),
+		Authentication: authentication,
+
+		RolePrefix: config.UserRolePrefix,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PostgreSQLUser")
 		os.Exit(1)
 	}
 	if err = (&controller.PostgreSQLHostCredentialsReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Log:               ctrl.Log.WithName("controllers").WithName("PostgreSQLHostCredentials"),
+		Scheme:            mgr.GetScheme(),
+		SuperuserRoleName: config.SuperuserRoleName,
+		Registry:          hostCredentials,
+		Authentication:    authentication,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PostgreSQLHostCredentials")
 		os.Exit(1)
 	}
 	if err = (&controller.PostgreSQLServiceUserReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:            mgr.GetClient(),
+		Log:               ctrl.Log.WithName("controllers").WithName("PostgreSQLServiceUser"),
+		Scheme:            mgr.GetScheme(),
+		SuperuserRoleName: config.SuperuserRoleName,
+		HostCredentials:   hostCredentials,
+
+		DeletionReassignRole: config.UserDeletionReassignRole,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PostgreSQLServiceUser")
 		os.Exit(1)
@@ -194,11 +282,49 @@ func main() {
 		Client:            mgr.GetClient(),
 		Log:               ctrl.Log.WithName("controllers").WithName("CustomRole"),
 		SuperuserRoleName: config.SuperuserRoleName,
-		HostCredentials:   config.HostCredentials,
+		HostCredentials:   hostCredentials,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CustomRole")
 		os.Exit(1)
 	}
+	if config.IAMSweepInterval > 0 {
+		if awsIAM == nil {
+			setupLog.Error(errors.New("--iam-sweep-interval requires --aws-login-role"), "unable to add IAM policy sweeper")
+			os.Exit(1)
+		}
+		if err = mgr.Add(&controller.IAMSweeper{
+			Client:     mgr.GetClient(),
+			Log:        ctrl.Log.WithName("iam-sweep"),
+			Interval:   config.IAMSweepInterval,
+			ReportOnly: config.IAMSweepReportOnly,
+			Sweep:      awsIAM.Sweep,
+		}); err != nil {
+			setupLog.Error(err, "unable to add IAM policy sweeper")
+			os.Exit(1)
+		}
+	}
+	if config.EnableWebhooks {
+		if err = postgresqlv1alpha1.SetupPostgreSQLDatabaseWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PostgreSQLDatabase")
+			os.Exit(1)
+		}
+		if err = postgresqlv1alpha1.SetupPostgreSQLUserWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PostgreSQLUser")
+			os.Exit(1)
+		}
+		if err = postgresqlv1alpha1.SetupPostgreSQLServiceUserWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PostgreSQLServiceUser")
+			os.Exit(1)
+		}
+		if err = postgresqlv1alpha1.SetupPostgreSQLHostCredentialsWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PostgreSQLHostCredentials")
+			os.Exit(1)
+		}
+		if err = postgresqlv1alpha1.SetupCustomRoleWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CustomRole")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -10,6 +10,9 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.lunarway.com/postgresql-controller/pkg/auth"
+	"go.lunarway.com/postgresql-controller/pkg/grants"
+	"go.lunarway.com/postgresql-controller/pkg/iam"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 )
 
@@ -30,6 +33,20 @@ type ControllerConfiguration struct {
 	IAMPolicyPrefix          string
 	SecureMetrics            bool
 	EnableHTTP2              bool
+	EnableWebhooks           bool
+	UserDeletionPolicy       grants.UserDeletionPolicy
+	UserDeletionReassignRole string
+	SessionTermination       grants.SessionTermination
+	DefaultAuthentication    auth.Method
+	HostAuthentication       map[string]auth.Method
+	HostDBIResourceIDs       map[string]string
+	PasswordValidity         time.Duration
+	IAMCacheTTL              time.Duration
+	IAMBatchInterval         time.Duration
+	IAMSweepInterval         time.Duration
+	IAMSweepReportOnly       bool
+	UserReadParameters       postgres.Parameters
+	UserWriteParameters      postgres.Parameters
 }
 
 type AwsConfig struct {
@@ -40,6 +57,14 @@ type AwsConfig struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	LoginRoles      string
+	// AssumeRoleARN is an optional role assumed with the resolved credentials.
+	AssumeRoleARN        string
+	AssumeRoleExternalID string
+	// Principal maps user names to the AWS principal allowed to connect as
+	// their role.
+	Principal iam.Principal
+	// PreviousPrincipals are migrated to Principal in existing policies.
+	PreviousPrincipals []iam.Principal
 }
 
 func (c *ControllerConfiguration) RegisterFlags(flagSet *flag.FlagSet) {
@@ -53,25 +78,111 @@ func (c *ControllerConfiguration) RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Var(&HostCredentials{value: &c.HostCredentials}, "host-credentials", "Host and credential pairs in the form hostname=user:password. Use comma separated pairs for multiple hosts")
 	flagSet.StringVar(&c.ManagerRoleName, "manager-role-name", "postgres_role_manager", "Name of the role which will be managing other roles")
 	flagSet.StringVar(&c.SuperuserRoleName, "superuser-role-name", "rds_superuser", "Name of the superuser role the connecting user must be a member of (defaults to RDS's rds_superuser; override for non-RDS deployments)")
-	flagSet.StringVar(&c.UserRoles, "user-roles", "rds_iam", "List of roles granted to all users")
+	flagSet.StringVar(&c.UserRoles, "user-roles", "", "List of roles granted to all users. Roles required by the authentication of a host, eg. rds_iam, are granted as well")
 	flagSet.BoolVar(&c.AllDatabasesReadEnabled, "all-databases-enabled-read", false, "Enable usage of allDatabases field in read access requests")
 	flagSet.BoolVar(&c.AllDatabasesWriteEnabled, "all-databases-enabled-write", false, "Enable usage of allDatabases field in write access requests")
 	flagSet.StringVar(&c.UserRolePrefix, "user-role-prefix", "iam_developer_", "Prefix of roles created in PostgreSQL for users")
 	flagSet.StringVar(&c.AWS.PolicyName, "aws-policy-name", "postgres-controller-users", "AWS Policy name to update IAM statements on")
 	flagSet.StringVar(&c.AWS.Region, "aws-region", "eu-west-1", "AWS Region where IAM policies are located")
 	flagSet.StringVar(&c.AWS.AccountID, "aws-account-id", "660013655494", "AWS Account id where IAM policies are located")
-	flagSet.StringVar(&c.AWS.Profile, "aws-profile", "", "AWS Profile to use for credentials")
-	flagSet.StringVar(&c.AWS.AccessKeyID, "aws-access-key-id", "", "AWS access key id to use for credentials")
-	flagSet.StringVar(&c.AWS.SecretAccessKey, "aws-secret-access-key", "", "AWS secret access key to use for credentials")
-	flagSet.StringVar(&c.AWS.LoginRoles, "aws-login-role", "", "AWS IAM role to attach the policies to")
+	flagSet.StringVar(&c.AWS.Profile, "aws-profile", "", "AWS Profile to use for credentials. Defaults to the default credential chain")
+	flagSet.StringVar(&c.AWS.AccessKeyID, "aws-access-key-id", "", "AWS access key id to use for credentials. Defaults to the default credential chain")
+	flagSet.StringVar(&c.AWS.SecretAccessKey, "aws-secret-access-key", "", "AWS secret access key to use for credentials. Defaults to the default credential chain")
+	flagSet.StringVar(&c.AWS.AssumeRoleARN, "aws-assume-role-arn", "", "ARN of an AWS IAM role to assume with the credentials, eg. in the account where IAM policies are located")
+	flagSet.StringVar(&c.AWS.AssumeRoleExternalID, "aws-assume-role-external-id", "", "External ID required to assume the role of --aws-assume-role-arn")
+	flagSet.StringVar(&c.AWS.LoginRoles, "aws-login-role", "", "AWS IAM role to attach the policies to. Required by AWSIAM authentication")
+	c.AWS.Principal = iam.DefaultPrincipal
+	flagSet.Var(&AWSPrincipal{value: &c.AWS.Principal}, "aws-principal", "AWS principal allowed to connect as the role of a user in the form key=template. The key is aws:userid, aws:username or aws:PrincipalTag/<tag> and {name} in the template is replaced by the user name")
+	c.AWS.PreviousPrincipals = []iam.Principal{iam.DefaultPrincipal}
+	flagSet.Var(&AWSPrincipals{value: &c.AWS.PreviousPrincipals}, "aws-previous-principals", "Comma separated AWS principals in the form key=template previously used. Statements of these principals are migrated to the current principal")
 	flagSet.BoolVar(&c.ExtendedWriteEnabled, "extended-write-enabled", false, "Enable extended write access requests")
 	flagSet.StringVar(&c.IAMPolicyPrefix, "iam-policy-prefix", "/", "Path prefix to use when creating IAM policies")
+	flagSet.DurationVar(&c.IAMCacheTTL, "iam-cache-ttl", 5*time.Minute, "How long IAM policies and the policies attached to the AWS login roles are cached before they are read again. Zero disables the cache")
+	flagSet.DurationVar(&c.IAMBatchInterval, "iam-batch-interval", 10*time.Second, "How long changes to IAM policies are collected before they are written. Every policy is written at most once per interval. Zero writes changes right away")
+	flagSet.DurationVar(&c.IAMSweepInterval, "iam-sweep-interval", 0, "Interval of sweeps removing IAM policy statements of users without a PostgreSQLUser and duplicate statements. Zero disables sweeps")
+	flagSet.BoolVar(&c.IAMSweepReportOnly, "iam-sweep-report-only", false, "Only report the statements found by IAM policy sweeps without removing them")
 	flagSet.BoolVar(&c.SecureMetrics, "secure-metrics", false, "Whether to serve metrics with https")
 	flagSet.BoolVar(&c.EnableHTTP2, "enable-http2", false, "Whether to serve traffic via. http2")
+	flagSet.BoolVar(&c.EnableWebhooks, "enable-webhooks", false, "Enable the validating admission webhooks. Requires a serving certificate for the webhook server")
+	c.UserDeletionPolicy = grants.UserDeletionPolicyRevokeLogin
+	flagSet.Var(&UserDeletionPolicy{value: &c.UserDeletionPolicy}, "user-deletion-policy", "What happens to the role of a deleted PostgreSQLUser on the hosts. RevokeLogin revokes its memberships and login and Drop drops it")
+	flagSet.StringVar(&c.UserDeletionReassignRole, "user-deletion-reassign-role", "", "Role receiving the objects owned by roles dropped with user deletion policy Drop and by deleted service users. Defaults to the connecting user of the host")
+	c.SessionTermination = grants.SessionTerminationNever
+	flagSet.Var(&SessionTermination{value: &c.SessionTermination}, "terminate-sessions-on-revoke", "Terminate the open sessions of a user when roles are revoked from it. Never, Write to terminate when a write role is revoked or Any")
+	flagSet.Var(&AuthenticationMethod{value: &c.DefaultAuthentication}, "default-authentication", "How developers authenticate as the roles of users on hosts without an authentication of their own. AWSIAM, Password or None. Defaults to AWSIAM if --aws-login-role is set and None otherwise")
+	flagSet.Var(&HostAuthentication{value: &c.HostAuthentication}, "host-authentication", "Host and authentication pairs in the form hostname=Password overriding the default authentication. Use comma separated pairs for multiple hosts")
+	flagSet.Var(&HostDBIResourceIDs{value: &c.HostDBIResourceIDs}, "host-dbi-resource-ids", "Host and RDS DbiResourceId pairs in the form hostname=db-ABCDEFGHIJKL01234 scoping AWS IAM policy statements to the instance. Use comma separated pairs for multiple hosts")
+	flagSet.Var(&Parameters{value: &c.UserReadParameters}, "user-read-parameters", "Runtime parameters in the form name=value set on users in each database they have read access to, eg. default_transaction_read_only=on. Use comma separated pairs for multiple parameters")
+	flagSet.Var(&Parameters{value: &c.UserWriteParameters}, "user-write-parameters", "Runtime parameters in the form name=value set on users in each database they have write access to instead of --user-read-parameters, eg. log_statement=all. Use comma separated pairs for multiple parameters")
+	flagSet.DurationVar(&c.PasswordValidity, "password-authentication-validity", 12*time.Hour, "How long passwords generated for users on hosts with Password authentication are valid if their access does not stop before")
 }
 
 func (c *ControllerConfiguration) GetUserRoles() []string {
-	return strings.Split(c.UserRoles, ",")
+	var roles []string
+	for _, role := range strings.Split(c.UserRoles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// GetHostAuthentication returns the static authentication configuration of
+// hosts combining --host-authentication and --host-dbi-resource-ids.
+func (c *ControllerConfiguration) GetHostAuthentication() map[string]auth.HostConfig {
+	hosts := make(map[string]auth.HostConfig, len(c.HostAuthentication))
+	for host, method := range c.HostAuthentication {
+		config := hosts[host]
+		config.Method = method
+		hosts[host] = config
+	}
+	for host, resourceID := range c.HostDBIResourceIDs {
+		config := hosts[host]
+		config.DBIResourceID = resourceID
+		hosts[host] = config
+	}
+	return hosts
+}
+
+// AWSIAMEnabled reports whether AWS IAM authentication is configured. It
+// requires login roles to attach the policies to.
+func (c *ControllerConfiguration) AWSIAMEnabled() bool {
+	return strings.TrimSpace(c.AWS.LoginRoles) != ""
+}
+
+// GetDefaultAuthentication returns the authentication of hosts without one of
+// their own. Unless set by --default-authentication it is AWSIAM if AWS IAM
+// authentication is configured and None otherwise.
+func (c *ControllerConfiguration) GetDefaultAuthentication() auth.Method {
+	if c.DefaultAuthentication != "" {
+		return c.DefaultAuthentication
+	}
+	if c.AWSIAMEnabled() {
+		return auth.MethodAWSIAM
+	}
+	return auth.MethodNone
+}
+
+// ValidateAuthentication returns an error if AWS IAM authentication is used
+// by default or by a host without being configured.
+func (c *ControllerConfiguration) ValidateAuthentication() error {
+	if c.AWSIAMEnabled() {
+		return nil
+	}
+	if c.GetDefaultAuthentication() == auth.MethodAWSIAM {
+		return fmt.Errorf("--default-authentication=%s requires --aws-login-role", auth.MethodAWSIAM)
+	}
+	hosts := make([]string, 0, len(c.HostAuthentication))
+	for host := range c.HostAuthentication {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if c.HostAuthentication[host] == auth.MethodAWSIAM {
+			return fmt.Errorf("--host-authentication %s=%s requires --aws-login-role", host, auth.MethodAWSIAM)
+		}
+	}
+	return nil
 }
 
 func (c *ControllerConfiguration) GetLoginRoles() []string {
@@ -91,9 +202,24 @@ func (c *ControllerConfiguration) Log(log logr.Logger) {
 		"awsRegion", c.AWS.Region,
 		"awsAccountID", c.AWS.AccountID,
 		"awsLoginRoles", c.AWS.LoginRoles,
+		"awsAssumeRoleARN", c.AWS.AssumeRoleARN,
+		"awsPrincipal", c.AWS.Principal,
+		"awsPreviousPrincipals", c.AWS.PreviousPrincipals,
 		"allDatabasesReadEnabled", c.AllDatabasesReadEnabled,
 		"allDatabasesWriteEnabled", c.AllDatabasesWriteEnabled,
 		"iamPolicyPrefix", c.IAMPolicyPrefix,
+		"iamCacheTTL", c.IAMCacheTTL,
+		"iamBatchInterval", c.IAMBatchInterval,
+		"iamSweepInterval", c.IAMSweepInterval,
+		"iamSweepReportOnly", c.IAMSweepReportOnly,
+		"userDeletionPolicy", c.UserDeletionPolicy,
+		"terminateSessionsOnRevoke", c.SessionTermination,
+		"defaultAuthentication", c.GetDefaultAuthentication(),
+		"hostAuthentication", c.HostAuthentication,
+		"hostDBIResourceIDs", c.HostDBIResourceIDs,
+		"passwordAuthenticationValidity", c.PasswordValidity,
+		"userReadParameters", c.UserReadParameters,
+		"userWriteParameters", c.UserWriteParameters,
 	)
 }
 
@@ -162,3 +288,265 @@ func (h *HostCredentials) String() string {
 	w.Flush()
 	return "[" + strings.TrimSpace(buf.String()) + "]"
 }
+
+// UserDeletionPolicy is a flag.Value parsing a grants.UserDeletionPolicy.
+type UserDeletionPolicy struct {
+	value *grants.UserDeletionPolicy
+}
+
+func (p *UserDeletionPolicy) Set(val string) error {
+	policy, err := grants.ParseUserDeletionPolicy(strings.TrimSpace(val))
+	if err != nil {
+		return err
+	}
+	*p.value = policy
+	return nil
+}
+
+func (p *UserDeletionPolicy) Type() string {
+	return "userDeletionPolicy"
+}
+
+func (p *UserDeletionPolicy) String() string {
+	if p.value == nil {
+		return ""
+	}
+	return string(*p.value)
+}
+
+// SessionTermination is a flag.Value parsing a grants.SessionTermination.
+type SessionTermination struct {
+	value *grants.SessionTermination
+}
+
+func (t *SessionTermination) Set(val string) error {
+	termination, err := grants.ParseSessionTermination(strings.TrimSpace(val))
+	if err != nil {
+		return err
+	}
+	*t.value = termination
+	return nil
+}
+
+func (t *SessionTermination) Type() string {
+	return "sessionTermination"
+}
+
+func (t *SessionTermination) String() string {
+	if t.value == nil {
+		return ""
+	}
+	return string(*t.value)
+}
+
+// AuthenticationMethod is a flag.Value parsing an auth.Method.
+type AuthenticationMethod struct {
+	value *auth.Method
+}
+
+func (m *AuthenticationMethod) Set(val string) error {
+	method, err := auth.ParseMethod(strings.TrimSpace(val))
+	if err != nil {
+		return err
+	}
+	*m.value = method
+	return nil
+}
+
+func (m *AuthenticationMethod) Type() string {
+	return "authenticationMethod"
+}
+
+func (m *AuthenticationMethod) String() string {
+	if m.value == nil {
+		return ""
+	}
+	return string(*m.value)
+}
+
+// HostAuthentication is a flag.Value parsing comma separated host and
+// auth.Method pairs.
+type HostAuthentication struct {
+	value *map[string]auth.Method
+}
+
+func (h *HostAuthentication) Set(val string) error {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return nil
+	}
+	if *h.value == nil {
+		*h.value = map[string]auth.Method{}
+	}
+	for _, pair := range strings.Split(val, ",") {
+		host, method, ok := strings.Cut(pair, "=")
+		if !ok || host == "" {
+			return fmt.Errorf("%s must be formatted as host=method", pair)
+		}
+		parsed, err := auth.ParseMethod(method)
+		if err != nil {
+			return fmt.Errorf("parse host '%s' failed: %w", pair, err)
+		}
+		(*h.value)[host] = parsed
+	}
+	return nil
+}
+
+func (h *HostAuthentication) Type() string {
+	return "stringToAuthenticationMethod"
+}
+
+func (h *HostAuthentication) String() string {
+	if h.value == nil {
+		return "[]"
+	}
+	pairs := make([]string, 0, len(*h.value))
+	for host, method := range *h.value {
+		pairs = append(pairs, host+"="+string(method))
+	}
+	sort.Strings(pairs)
+	return "[" + strings.Join(pairs, ",") + "]"
+}
+
+// HostDBIResourceIDs is a flag.Value parsing comma separated host and RDS
+// DbiResourceId pairs.
+type HostDBIResourceIDs struct {
+	value *map[string]string
+}
+
+func (h *HostDBIResourceIDs) Set(val string) error {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return nil
+	}
+	if *h.value == nil {
+		*h.value = map[string]string{}
+	}
+	for _, pair := range strings.Split(val, ",") {
+		host, resourceID, ok := strings.Cut(pair, "=")
+		if !ok || host == "" || !strings.HasPrefix(resourceID, "db-") {
+			return fmt.Errorf("%s must be formatted as host=db-<id>", pair)
+		}
+		(*h.value)[host] = resourceID
+	}
+	return nil
+}
+
+func (h *HostDBIResourceIDs) Type() string {
+	return "stringToString"
+}
+
+func (h *HostDBIResourceIDs) String() string {
+	if h.value == nil {
+		return "[]"
+	}
+	pairs := make([]string, 0, len(*h.value))
+	for host, resourceID := range *h.value {
+		pairs = append(pairs, host+"="+resourceID)
+	}
+	sort.Strings(pairs)
+	return "[" + strings.Join(pairs, ",") + "]"
+}
+
+// Parameters is a flag.Value parsing comma separated runtime parameter name
+// and value pairs.
+type Parameters struct {
+	value *postgres.Parameters
+}
+
+func (p *Parameters) Set(val string) error {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return nil
+	}
+	if *p.value == nil {
+		*p.value = postgres.Parameters{}
+	}
+	for _, pair := range strings.Split(val, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return fmt.Errorf("%s must be formatted as name=value", pair)
+		}
+		(*p.value)[name] = value
+	}
+	return nil
+}
+
+func (p *Parameters) Type() string {
+	return "stringToString"
+}
+
+func (p *Parameters) String() string {
+	if p.value == nil {
+		return "[]"
+	}
+	pairs := make([]string, 0, len(*p.value))
+	for name, value := range *p.value {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return "[" + strings.Join(pairs, ",") + "]"
+}
+
+// AWSPrincipal is a flag.Value parsing an iam.Principal.
+type AWSPrincipal struct {
+	value *iam.Principal
+}
+
+func (p *AWSPrincipal) Set(val string) error {
+	principal, err := iam.ParsePrincipal(val)
+	if err != nil {
+		return err
+	}
+	*p.value = principal
+	return nil
+}
+
+func (p *AWSPrincipal) Type() string {
+	return "awsPrincipal"
+}
+
+func (p *AWSPrincipal) String() string {
+	if p.value == nil {
+		return ""
+	}
+	return p.value.String()
+}
+
+// AWSPrincipals is a flag.Value parsing comma separated iam.Principal values.
+// An empty value clears the list.
+type AWSPrincipals struct {
+	value *[]iam.Principal
+}
+
+func (p *AWSPrincipals) Set(val string) error {
+	var principals []iam.Principal
+	for _, s := range strings.Split(val, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		principal, err := iam.ParsePrincipal(s)
+		if err != nil {
+			return err
+		}
+		principals = append(principals, principal)
+	}
+	*p.value = principals
+	return nil
+}
+
+func (p *AWSPrincipals) Type() string {
+	return "awsPrincipals"
+}
+
+func (p *AWSPrincipals) String() string {
+	if p.value == nil {
+		return "[]"
+	}
+	principals := make([]string, 0, len(*p.value))
+	for _, principal := range *p.value {
+		principals = append(principals, principal.String())
+	}
+	return "[" + strings.Join(principals, ",") + "]"
+}
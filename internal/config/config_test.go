@@ -2,9 +2,14 @@ package config
 
 import (
 	"errors"
+	"flag"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lunarway.com/postgresql-controller/pkg/auth"
+	"go.lunarway.com/postgresql-controller/pkg/grants"
+	"go.lunarway.com/postgresql-controller/pkg/iam"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 )
 
@@ -150,3 +155,232 @@ func TestHostCredentials_String(t *testing.T) {
 		})
 	}
 }
+
+func TestUserDeletionPolicy_Set(t *testing.T) {
+	tt := []struct {
+		name   string
+		value  string
+		err    error
+		output grants.UserDeletionPolicy
+	}{
+		{
+			name:   "revoke login",
+			value:  "RevokeLogin",
+			output: grants.UserDeletionPolicyRevokeLogin,
+		},
+		{
+			name:   "drop",
+			value:  " Drop ",
+			output: grants.UserDeletionPolicyDrop,
+		},
+		{
+			name:   "unknown",
+			value:  "Retain",
+			err:    errors.New("unknown user deletion policy 'Retain': must be one of RevokeLogin or Drop"),
+			output: grants.UserDeletionPolicyRevokeLogin,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			output := grants.UserDeletionPolicyRevokeLogin
+			p := UserDeletionPolicy{value: &output}
+			err := p.Set(tc.value)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error(), "output error not as expected")
+			} else {
+				assert.NoError(t, err, "unexpected error")
+			}
+			assert.Equal(t, tc.output, output, "output not as expected")
+		})
+	}
+}
+
+func TestHostAuthentication_Set(t *testing.T) {
+	tt := []struct {
+		name   string
+		value  string
+		err    error
+		output map[string]auth.Method
+	}{
+		{
+			name:   "empty",
+			value:  "",
+			output: nil,
+		},
+		{
+			name:  "multiple hosts",
+			value: "rds:5432=AWSIAM,plain:5432=Password,trusted=None",
+			output: map[string]auth.Method{
+				"rds:5432":   auth.MethodAWSIAM,
+				"plain:5432": auth.MethodPassword,
+				"trusted":    auth.MethodNone,
+			},
+		},
+		{
+			name:   "missing method",
+			value:  "plain:5432",
+			err:    errors.New("plain:5432 must be formatted as host=method"),
+			output: map[string]auth.Method{},
+		},
+		{
+			name:   "unknown method",
+			value:  "plain:5432=Kerberos",
+			err:    errors.New("parse host 'plain:5432=Kerberos' failed: unknown authentication method 'Kerberos': must be one of AWSIAM, None or Password"),
+			output: map[string]auth.Method{},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var output map[string]auth.Method
+			h := HostAuthentication{value: &output}
+			err := h.Set(tc.value)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error(), "output error not as expected")
+			} else {
+				assert.NoError(t, err, "unexpected error")
+			}
+			assert.Equal(t, tc.output, output, "output not as expected")
+		})
+	}
+}
+
+func TestControllerConfiguration_GetHostAuthentication(t *testing.T) {
+	var c ControllerConfiguration
+	require.NoError(t, (&HostAuthentication{value: &c.HostAuthentication}).Set("plain:5432=Password,rds:5432=AWSIAM"))
+	require.NoError(t, (&HostDBIResourceIDs{value: &c.HostDBIResourceIDs}).Set("rds:5432=db-RDS,other:5432=db-OTHER"))
+
+	assert.Equal(t, map[string]auth.HostConfig{
+		"plain:5432": {Method: auth.MethodPassword},
+		"rds:5432":   {Method: auth.MethodAWSIAM, DBIResourceID: "db-RDS"},
+		"other:5432": {DBIResourceID: "db-OTHER"},
+	}, c.GetHostAuthentication())
+
+	err := (&HostDBIResourceIDs{value: &c.HostDBIResourceIDs}).Set("rds:5432=i-123")
+	assert.EqualError(t, err, "rds:5432=i-123 must be formatted as host=db-<id>")
+}
+
+func TestParameters_Set(t *testing.T) {
+	var parameters postgres.Parameters
+	value := &Parameters{value: &parameters}
+	require.NoError(t, value.Set("idle_in_transaction_session_timeout=1min, log_statement=all"))
+	require.NoError(t, value.Set("log_statement=ddl"))
+
+	assert.Equal(t, postgres.Parameters{
+		"idle_in_transaction_session_timeout": "1min",
+		"log_statement":                       "ddl",
+	}, parameters)
+	assert.Equal(t, "[idle_in_transaction_session_timeout=1min,log_statement=ddl]", value.String())
+
+	err := value.Set("log_statement")
+	assert.EqualError(t, err, "log_statement must be formatted as name=value")
+}
+
+func TestAWSPrincipals_Set(t *testing.T) {
+	tt := []struct {
+		name   string
+		value  string
+		err    error
+		output []iam.Principal
+	}{
+		{
+			name:   "empty",
+			value:  "",
+			output: nil,
+		},
+		{
+			name:  "multiple principals",
+			value: "aws:userid=*:{name}@lunar.app, aws:PrincipalTag/email={name}@example.com",
+			output: []iam.Principal{
+				iam.DefaultPrincipal,
+				{Key: "aws:PrincipalTag/email", Template: "{name}@example.com"},
+			},
+		},
+		{
+			name:   "invalid principal",
+			value:  "aws:userid=*:{name}@lunar.app,aws:username=static",
+			err:    errors.New("principal template 'static' must hold {name} exactly once"),
+			output: []iam.Principal{iam.DefaultPrincipal},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			output := []iam.Principal{iam.DefaultPrincipal}
+			p := AWSPrincipals{value: &output}
+			err := p.Set(tc.value)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error(), "output error not as expected")
+			} else {
+				assert.NoError(t, err, "unexpected error")
+			}
+			assert.Equal(t, tc.output, output, "output not as expected")
+		})
+	}
+}
+
+func TestControllerConfiguration_GetUserRoles(t *testing.T) {
+	assert.Empty(t, (&ControllerConfiguration{}).GetUserRoles(), "empty flag")
+	assert.Equal(t, []string{"rds_iam", "iam_developer"}, (&ControllerConfiguration{UserRoles: "rds_iam, iam_developer,"}).GetUserRoles(), "list")
+}
+
+func TestControllerConfiguration_AWSIAMEnabled(t *testing.T) {
+	assert.False(t, (&ControllerConfiguration{}).AWSIAMEnabled(), "without login roles")
+	assert.True(t, (&ControllerConfiguration{AWS: AwsConfig{LoginRoles: "login"}}).AWSIAMEnabled(), "with login roles")
+}
+
+func TestControllerConfiguration_authentication(t *testing.T) {
+	tt := []struct {
+		name   string
+		args   []string
+		method auth.Method
+		err    string
+	}{
+		{
+			name:   "defaults without aws login role",
+			args:   nil,
+			method: auth.MethodNone,
+		},
+		{
+			name:   "defaults with aws login role",
+			args:   []string{"--aws-login-role=login"},
+			method: auth.MethodAWSIAM,
+		},
+		{
+			name:   "password without aws login role",
+			args:   []string{"--default-authentication=Password"},
+			method: auth.MethodPassword,
+		},
+		{
+			name:   "aws iam without aws login role",
+			args:   []string{"--default-authentication=AWSIAM"},
+			method: auth.MethodAWSIAM,
+			err:    "--default-authentication=AWSIAM requires --aws-login-role",
+		},
+		{
+			name:   "aws iam host without aws login role",
+			args:   []string{"--host-authentication=host1=Password,host2=AWSIAM"},
+			method: auth.MethodNone,
+			err:    "--host-authentication host2=AWSIAM requires --aws-login-role",
+		},
+		{
+			name:   "aws iam host with aws login role",
+			args:   []string{"--host-authentication=host2=AWSIAM", "--default-authentication=None", "--aws-login-role=login"},
+			method: auth.MethodNone,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet(tc.name, flag.ContinueOnError)
+			var c ControllerConfiguration
+			c.RegisterFlags(flagSet)
+			require.NoError(t, flagSet.Parse(tc.args), "parse flags")
+
+			assert.Equal(t, tc.method, c.GetDefaultAuthentication(), "default authentication")
+			err := c.ValidateAuthentication()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -39,6 +39,8 @@ import (
 
 	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
 	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
+	"go.lunarway.com/postgresql-controller/pkg/metrics"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 )
 
@@ -49,8 +51,8 @@ type CustomRoleReconciler struct {
 
 	SuperuserRoleName string
 
-	// HostCredentials contains a map of credentials for hosts (keyed by host name)
-	HostCredentials map[string]postgres.Credentials
+	// HostCredentials contains the credentials for hosts (keyed by host name)
+	HostCredentials *hostcredentials.Registry
 }
 
 const customRoleFinalizer = "customrole.postgresql.lunar.tech/finalizer"
@@ -59,6 +61,7 @@ const customRoleFinalizer = "customrole.postgresql.lunar.tech/finalizer"
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=customroles/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=customroles/finalizers,verbs=update
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqldatabases,verbs=list;watch
+//+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlhostcredentials,verbs=list;watch
 //+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list
 
 func (r *CustomRoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -70,7 +73,9 @@ func (r *CustomRoleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 	reqLogger = reqLogger.WithValues("requestId", requestID.String())
 
+	start := time.Now()
 	err = r.reconcile(ctx, reqLogger, req)
+	metrics.ObserveReconcile("CustomRole", start, err)
 	return customRoleRequeueStrategy(reqLogger, err)
 }
 
@@ -99,6 +104,10 @@ func (r *CustomRoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				GenericFunc: func(_ event.GenericEvent) bool { return false },
 			}),
 		).
+		// Roles are provisioned on a newly registered host without waiting for
+		// the next resync. They are applied to every known host regardless of
+		// namespace.
+		WatchesRawSource(registeredHostCredentials(r.HostCredentials, r.Client, &postgresqlv1alpha1.CustomRoleList{})).
 		Complete(r)
 }
 
@@ -166,12 +175,15 @@ func (r *CustomRoleReconciler) reconcile(ctx context.Context, reqLogger logr.Log
 	grants := toPostgresGrants(customRole.Spec.Grants)
 	functions := toPostgresFunctions(customRole.Spec.Functions)
 
-	for host, creds := range r.HostCredentials {
+	hosts := make(map[string]int)
+	for host, creds := range r.HostCredentials.All() {
 		if err := r.reconcileOnHost(reqLogger, host, creds, roleName, customRole.Spec.GrantRoles, customRole.Spec.Databases, grants, functions); err != nil {
 			r.persistStatus(ctx, customRole, host, err)
 			return fmt.Errorf("reconcile on host %s: %w", host, err)
 		}
+		hosts[host] = 1
 	}
+	metrics.TrackRoles("CustomRole", req.NamespacedName.String(), hosts)
 
 	r.persistStatus(ctx, customRole, "", nil)
 	return nil
@@ -18,7 +18,7 @@ func (r *CustomRoleReconciler) reconcileRoleOnHost(log logr.Logger, adminDB *sql
 }
 
 func (r *CustomRoleReconciler) cleanupRole(_ context.Context, log logr.Logger, roleName string) error {
-	for host, creds := range r.HostCredentials {
+	for host, creds := range r.HostCredentials.All() {
 		if err := r.cleanupRoleOnHost(log, host, creds, roleName); err != nil {
 			return fmt.Errorf("cleanup on host %s: %w", host, err)
 		}
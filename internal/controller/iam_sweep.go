@@ -0,0 +1,104 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/daemon"
+	"go.lunarway.com/postgresql-controller/pkg/iam"
+)
+
+// IAMSweeper periodically removes statements of users without a PostgreSQLUser
+// resource and duplicate statements of a user from the managed IAM policies.
+// Such statements are left behind eg. when a user is deleted while the
+// controller is down or its finalizer is removed by hand.
+//
+// It runs on the leader only as the statements are shared by all replicas.
+type IAMSweeper struct {
+	client.Client
+	Log logr.Logger
+
+	// Interval is the time between sweeps. The first sweep runs on start.
+	Interval time.Duration
+	// ReportOnly only logs and records the statements found without removing
+	// them.
+	ReportOnly bool
+	// Sweep sweeps the policies keeping statements of the users returned by
+	// owners, eg. auth.AWSIAM.Sweep.
+	Sweep func(log logr.Logger, owners func() (map[string]bool, error), reportOnly bool) (iam.SweepResult, error)
+}
+
+var _ manager.Runnable = &IAMSweeper{}
+
+// Start sweeps the policies every interval until ctx is cancelled.
+func (s *IAMSweeper) Start(ctx context.Context) error {
+	stop := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(stop)
+	}()
+	daemon.New(daemon.Configuration{
+		Logger:       s.Log,
+		SyncInterval: s.Interval,
+		Sync: func() {
+			s.sweep(ctx)
+		},
+	}).Loop(stop)
+	return nil
+}
+
+// sweep runs a single sweep and logs its outcome.
+func (s *IAMSweeper) sweep(ctx context.Context) {
+	result, err := s.Sweep(s.Log, func() (map[string]bool, error) {
+		return s.owners(ctx)
+	}, s.ReportOnly)
+	if err != nil {
+		s.Log.Error(err, "Failed to sweep IAM policies")
+		return
+	}
+	if len(result.Orphaned) == 0 && len(result.Duplicated) == 0 {
+		s.Log.V(1).Info("No orphaned or duplicate IAM policy statements found")
+		return
+	}
+	if s.ReportOnly {
+		s.Log.Info("Found orphaned or duplicate IAM policy statements", "orphaned", result.Orphaned, "duplicated", result.Duplicated)
+		return
+	}
+	s.Log.Info("Removed orphaned or duplicate IAM policy statements", "orphaned", result.Orphaned, "duplicated", result.Duplicated)
+}
+
+// owners returns the names of the users of all PostgreSQLUser resources.
+func (s *IAMSweeper) owners(ctx context.Context) (map[string]bool, error) {
+	var users postgresqlv1alpha1.PostgreSQLUserList
+	err := s.List(ctx, &users)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	owners := make(map[string]bool, len(users.Items))
+	for _, user := range users.Items {
+		owners[user.Spec.Name] = true
+	}
+	return owners, nil
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/iam"
+	"go.lunarway.com/postgresql-controller/test"
+)
+
+func TestIAMSweeper_sweep(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, postgresqlv1alpha1.AddToScheme(scheme))
+	cl := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&postgresqlv1alpha1.PostgreSQLUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "dev"},
+				Spec:       postgresqlv1alpha1.PostgreSQLUserSpec{Name: "alice"},
+			},
+			&postgresqlv1alpha1.PostgreSQLUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "bob", Namespace: "prod"},
+				Spec:       postgresqlv1alpha1.PostgreSQLUserSpec{Name: "bob"},
+			},
+		).
+		Build()
+
+	tt := []struct {
+		name       string
+		reportOnly bool
+		err        error
+	}{
+		{name: "remove"},
+		{name: "report only", reportOnly: true},
+		{name: "failed sweep", err: errors.New("throttled")},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				owners     map[string]bool
+				reportOnly bool
+			)
+			s := &IAMSweeper{
+				Client:     cl,
+				Log:        test.NewLogger(t),
+				ReportOnly: tc.reportOnly,
+				Sweep: func(_ logr.Logger, ownersFunc func() (map[string]bool, error), r bool) (iam.SweepResult, error) {
+					var err error
+					owners, err = ownersFunc()
+					reportOnly = r
+					if err != nil {
+						return iam.SweepResult{}, err
+					}
+					return iam.SweepResult{Orphaned: []string{"carol"}}, tc.err
+				},
+			}
+
+			s.sweep(context.Background())
+
+			assert.Equal(t, map[string]bool{"alice": true, "bob": true}, owners, "owners not as expected")
+			assert.Equal(t, tc.reportOnly, reportOnly, "report only not as expected")
+		})
+	}
+}
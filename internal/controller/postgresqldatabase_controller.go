@@ -20,40 +20,63 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
 	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
 	"go.lunarway.com/postgresql-controller/pkg/kube"
+	"go.lunarway.com/postgresql-controller/pkg/metrics"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 )
 
 // PostgreSQLDatabaseReconciler reconciles a PostgreSQLDatabase object
 type PostgreSQLDatabaseReconciler struct {
 	client.Client
-	Log logr.Logger
+	Log    logr.Logger
+	Scheme *runtime.Scheme
 
 	ManagerRoleName   string
 	SuperuserRoleName string
-	// contains a map of credentials for hosts
-	HostCredentials map[string]postgres.Credentials
+	// contains the credentials for hosts
+	HostCredentials *hostcredentials.Registry
+}
+
+// postgreSQLDatabaseFinalizer is set on databases with a deletion policy other
+// than Retain to clean up the database on the host before the resource is
+// removed.
+const postgreSQLDatabaseFinalizer = "postgresqldatabase.postgresql.lunar.tech/finalizer"
+
+// databaseRoles returns the number of roles created for a database: the
+// service role and the read, readwrite and readowningwrite roles of the service
+// user schema and of each additional schema.
+func databaseRoles(schemas []string) int {
+	return 1 + 3*(len(schemas)+1)
 }
 
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqldatabases,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqldatabases/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list
+//+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqldatabases/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=create;update;patch
 
 func (r *PostgreSQLDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	start := time.Now()
 	reqLogger := log.FromContext(ctx)
 
 	requestID, err := uuid.NewRandom()
@@ -63,17 +86,52 @@ func (r *PostgreSQLDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.R
 	reqLogger = reqLogger.WithValues("requestId", requestID.String())
 	status, err := r.reconcile(ctx, reqLogger, req)
 	status.Persist(ctx, err, r.Log)
+	metrics.ObserveReconcile("PostgreSQLDatabase", start, err)
 
+	if err == nil && status.rotatePasswordIn > 0 {
+		reqLogger.Info("Scheduling reconciliation at next password rotation", "requeueAfter", status.rotatePasswordIn)
+		return ctrl.Result{RequeueAfter: status.rotatePasswordIn}, nil
+	}
 	return requeueStrategy(reqLogger, err)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PostgreSQLDatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := indexReferences(mgr, &postgresqlv1alpha1.PostgreSQLDatabase{}, databaseReferences)
+	if err != nil {
+		return err
+	}
+	// Watch referenced Secrets and ConfigMaps to apply a rotated password as
+	// soon as it changes. Secrets with generated passwords are owned by the
+	// database.
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&postgresqlv1alpha1.PostgreSQLDatabase{}).
+		Owns(&corev1.Secret{}).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(mapReferencing(r.Client, &postgresqlv1alpha1.PostgreSQLDatabaseList{}, secretRefIndexKey)),
+		).
+		Watches(
+			&corev1.ConfigMap{},
+			handler.EnqueueRequestsFromMapFunc(mapReferencing(r.Client, &postgresqlv1alpha1.PostgreSQLDatabaseList{}, configMapRefIndexKey)),
+		).
+		WatchesRawSource(registeredHostCredentials(r.HostCredentials, r.Client, &postgresqlv1alpha1.PostgreSQLDatabaseList{})).
 		Complete(r)
 }
 
+// databaseReferences returns the ResourceVars of a PostgreSQLDatabase.
+func databaseReferences(obj client.Object) []postgresqlv1alpha1.ResourceVar {
+	database, ok := obj.(*postgresqlv1alpha1.PostgreSQLDatabase)
+	if !ok {
+		return nil
+	}
+	vars := []postgresqlv1alpha1.ResourceVar{database.Spec.User, database.Spec.Host}
+	if database.Spec.Password != nil {
+		vars = append(vars, *database.Spec.Password)
+	}
+	return vars
+}
+
 func (r *PostgreSQLDatabaseReconciler) reconcile(ctx context.Context, reqLogger logr.Logger, request reconcile.Request) (status, error) {
 	reqLogger.V(1).Info("Reconciling PostgreSQLDatabase")
 	// Fetch the PostgreSQLDatabase instance
@@ -84,6 +142,7 @@ func (r *PostgreSQLDatabaseReconciler) reconcile(ctx context.Context, reqLogger
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
+			metrics.UntrackRoles("PostgreSQLDatabase", request.NamespacedName.String())
 			return status{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -93,6 +152,25 @@ func (r *PostgreSQLDatabaseReconciler) reconcile(ctx context.Context, reqLogger
 		"database", database.Spec.Name,
 		"isShared", database.Spec.IsShared,
 	)
+
+	if !database.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, reqLogger, database)
+	}
+
+	// The finalizer is only needed when there is something to clean up on
+	// deletion. It is removed again if the policy is changed back to Retain.
+	needsFinalizer := deletionPolicy(database) != postgresqlv1alpha1.PostgreSQLDatabaseDeletionPolicyRetain
+	if needsFinalizer != controllerutil.ContainsFinalizer(database, postgreSQLDatabaseFinalizer) {
+		if needsFinalizer {
+			controllerutil.AddFinalizer(database, postgreSQLDatabaseFinalizer)
+		} else {
+			controllerutil.RemoveFinalizer(database, postgreSQLDatabaseFinalizer)
+		}
+		if err := r.Update(ctx, database); err != nil {
+			return status{}, fmt.Errorf("update finalizer: %w", err)
+		}
+		return status{}, nil
+	}
 	reqLogger.V(1).Info("Updating PostgreSQLDatabase resource")
 
 	status := status{
@@ -116,24 +194,28 @@ func (r *PostgreSQLDatabaseReconciler) reconcile(ctx context.Context, reqLogger
 		return status, err
 	}
 
-	user, err := kube.ResourceValue(r.Client, database.Spec.User, request.Namespace)
+	user, err := r.resolveUser(reqLogger, database)
 	if err != nil {
-		if !ctlerrors.IsInvalid(err) {
-			return status, fmt.Errorf("resolve user reference: %w", err)
-		}
-		// backwards compatibility to support resources without a User
-		reqLogger.Info("User name fallback to database name")
-		user = database.Spec.Name
+		return status, err
 	}
 	status.user = user
 	reqLogger = reqLogger.WithValues("user", user)
 	password := ""
 	if database.Spec.Password != nil {
+		if database.Spec.PasswordGeneration != nil {
+			return status, ctlerrors.NewInvalid(errors.New("must not specify both `password` and `passwordGeneration`"))
+		}
 		password, err = kube.ResourceValue(r.Client, *database.Spec.Password, request.Namespace)
 		if err != nil {
 			return status, fmt.Errorf("resolve password reference: %w", err)
 		}
 	}
+	if database.Spec.PasswordGeneration != nil {
+		password, status.rotatePasswordIn, err = r.ensurePasswordSecret(ctx, reqLogger, database, host, user, adminCredentials.Params)
+		if err != nil {
+			return status, fmt.Errorf("generate password: %w", err)
+		}
+	}
 	isShared := database.Spec.IsShared
 	extensions := database.Spec.Extensions
 
@@ -147,7 +229,10 @@ func (r *PostgreSQLDatabaseReconciler) reconcile(ctx context.Context, reqLogger
 			Host:        host,
 			Admin:       *adminCredentials,
 			ManagerRole: r.ManagerRoleName,
-			Extensions:  fromApiExtensions(extensions),
+			Extensions:  append(fromApiExtensions(extensions), removedExtensions(database)...),
+			Schemas:     database.Spec.Schemas,
+			Options:     databaseOptions(database.Spec),
+			Parameters:  databaseParameters(database.Spec.Parameters),
 			Target: postgres.Credentials{
 				Name:     database.Spec.Name,
 				User:     user,
@@ -156,23 +241,226 @@ func (r *PostgreSQLDatabaseReconciler) reconcile(ctx context.Context, reqLogger
 			},
 		},
 	)
-	if err != nil {
+	if err != nil && !errors.Is(err, postgres.ErrExtensionNotDropped) {
 		return status, fmt.Errorf("ensure database: %w", err)
 	}
+	ensureErr := err
+	metrics.TrackRoles("PostgreSQLDatabase", request.NamespacedName.String(), map[string]int{host: databaseRoles(database.Spec.Schemas)})
+
+	// extensions that could not be dropped are kept in the status so they are
+	// dropped on the next reconciliation
+	listed := extensions
+	if ensureErr != nil {
+		listed = append([]postgresqlv1alpha1.PostgreSQLDatabaseExtension{}, extensions...)
+		for _, e := range removedExtensions(database) {
+			listed = append(listed, postgresqlv1alpha1.PostgreSQLDatabaseExtension{ExtensionName: e.Name})
+		}
+	}
+	if len(listed) != 0 {
+		installed, err := postgres.InstalledExtensions(reqLogger, host, *adminCredentials, database.Spec.Name)
+		if err != nil {
+			return status, fmt.Errorf("list installed extensions: %w", err)
+		}
+		status.extensions = installedExtensions(listed, installed)
+	}
 
+	if ensureErr != nil {
+		return status, fmt.Errorf("ensure database: %w", ensureErr)
+	}
 	return status, nil
 }
 
+// resolveUser resolves the user name of database. It falls back to the
+// database name if no user is specified.
+func (r *PostgreSQLDatabaseReconciler) resolveUser(log logr.Logger, database *postgresqlv1alpha1.PostgreSQLDatabase) (string, error) {
+	user, err := kube.ResourceValue(r.Client, database.Spec.User, database.Namespace)
+	if err != nil {
+		if !ctlerrors.IsInvalid(err) {
+			return "", fmt.Errorf("resolve user reference: %w", err)
+		}
+		// backwards compatibility to support resources without a User
+		log.Info("User name fallback to database name")
+		user = database.Spec.Name
+	}
+	return user, nil
+}
+
+// deletionPolicy returns the deletion policy of database defaulting to Retain.
+func deletionPolicy(database *postgresqlv1alpha1.PostgreSQLDatabase) postgresqlv1alpha1.PostgreSQLDatabaseDeletionPolicy {
+	if database.Spec.DeletionPolicy == "" {
+		return postgresqlv1alpha1.PostgreSQLDatabaseDeletionPolicyRetain
+	}
+	return database.Spec.DeletionPolicy
+}
+
+// finalize applies the deletion policy of database and removes the finalizer
+// when done.
+//
+// Dropping a shared database is refused and the finalizer is kept until the
+// policy is changed. This keeps the database of other services safe if the
+// admission webhook is not enabled.
+func (r *PostgreSQLDatabaseReconciler) finalize(ctx context.Context, log logr.Logger, database *postgresqlv1alpha1.PostgreSQLDatabase) (status, error) {
+	if !controllerutil.ContainsFinalizer(database, postgreSQLDatabaseFinalizer) {
+		return status{}, nil
+	}
+	deletionStatus := status{
+		log:      log,
+		client:   r.Client,
+		now:      metav1.Now,
+		database: database,
+		host:     database.Status.Host,
+		user:     database.Status.User,
+	}
+	policy := deletionPolicy(database)
+	if err := postgresqlv1alpha1.ValidateDeletionPolicy(policy, database.Spec.IsShared); err != nil {
+		return deletionStatus, ctlerrors.NewInvalid(fmt.Errorf("refusing to delete database: deletionPolicy %w", err))
+	}
+
+	log = log.WithValues("deletionPolicy", policy)
+	log.Info("Applying deletion policy before deletion")
+	if err := r.finalizeDatabase(ctx, log, database, policy); err != nil {
+		return deletionStatus, fmt.Errorf("finalize database: %w", err)
+	}
+	controllerutil.RemoveFinalizer(database, postgreSQLDatabaseFinalizer)
+	if err := r.Update(ctx, database); err != nil {
+		return deletionStatus, fmt.Errorf("remove finalizer: %w", err)
+	}
+	return status{}, nil
+}
+
+// finalizeDatabase revokes login of or drops the database on the host
+// according to policy.
+func (r *PostgreSQLDatabaseReconciler) finalizeDatabase(ctx context.Context, log logr.Logger, database *postgresqlv1alpha1.PostgreSQLDatabase, policy postgresqlv1alpha1.PostgreSQLDatabaseDeletionPolicy) error {
+	if policy == postgresqlv1alpha1.PostgreSQLDatabaseDeletionPolicyRetain {
+		return nil
+	}
+	host, adminCredentials, err := r.adminCredentials(ctx, log, &adminCredentialsParams{
+		namespace:       database.Namespace,
+		host:            database.Spec.Host,
+		hostCredentials: database.Spec.HostCredentials,
+	})
+	if err != nil {
+		return skipUnresolvable(log, fmt.Errorf("determining host credentials: %w", err))
+	}
+	user, err := r.resolveUser(log, database)
+	if err != nil {
+		return skipUnresolvable(log, err)
+	}
+	return r.applyDeletionPolicy(log.WithValues("host", host, "user", user), policy, host, *adminCredentials, postgres.Credentials{
+		Name:   database.Spec.Name,
+		User:   user,
+		Shared: database.Spec.IsShared,
+	}, database.Spec.Schemas)
+}
+
+// skipUnresolvable returns nil if err is caused by references that can no
+// longer be resolved, eg. the namespace is being deleted and the host
+// credentials are already gone. There is no way for us to clean up the host
+// then and keeping the finalizer would block the deletion forever.
+func skipUnresolvable(log logr.Logger, err error) error {
+	if ctlerrors.IsInvalid(err) || apierrors.IsNotFound(err) {
+		log.Info("Skipping deletion policy as the references of the database cannot be resolved", "error", err)
+		return nil
+	}
+	return err
+}
+
+func (r *PostgreSQLDatabaseReconciler) applyDeletionPolicy(log logr.Logger, policy postgresqlv1alpha1.PostgreSQLDatabaseDeletionPolicy, host string, admin, target postgres.Credentials, schemas []string) error {
+	switch policy {
+	case postgresqlv1alpha1.PostgreSQLDatabaseDeletionPolicyRevokeLogin:
+		return postgres.RevokeDatabaseLogin(log, host, admin, target)
+	case postgresqlv1alpha1.PostgreSQLDatabaseDeletionPolicyDrop:
+		return postgres.DropDatabase(log, host, admin, target, schemas...)
+	default:
+		return ctlerrors.NewInvalid(fmt.Errorf("unknown deletionPolicy %q", policy))
+	}
+}
+
 func fromApiExtensions(extensions []postgresqlv1alpha1.PostgreSQLDatabaseExtension) postgres.Extensions {
 	postgresExtensions := make([]postgres.Extension, 0, len(extensions))
 
 	for _, e := range extensions {
-		postgresExtensions = append(postgresExtensions, postgres.NewExtension(e.ExtensionName))
+		postgresExtensions = append(postgresExtensions, postgres.Extension{
+			Name:    e.ExtensionName,
+			Version: e.Version,
+			Schema:  e.Schema,
+		})
 	}
 
 	return postgresExtensions
 }
 
+// removedExtensions returns the extensions listed in the status of database
+// that are no longer in its spec marked to be dropped. Extensions are only
+// dropped if the extension removal policy is Drop.
+func removedExtensions(database *postgresqlv1alpha1.PostgreSQLDatabase) postgres.Extensions {
+	if database.Spec.ExtensionRemovalPolicy != postgresqlv1alpha1.PostgreSQLDatabaseExtensionRemovalPolicyDrop {
+		return nil
+	}
+	desired := make(map[string]bool, len(database.Spec.Extensions))
+	for _, e := range database.Spec.Extensions {
+		desired[e.ExtensionName] = true
+	}
+	var removed postgres.Extensions
+	for _, e := range database.Status.Extensions {
+		if !desired[e.Name] {
+			removed = append(removed, postgres.Extension{Name: e.Name, Drop: true})
+		}
+	}
+	return removed
+}
+
+// installedExtensions returns the extensions of installed that are listed in
+// extensions in the order of extensions.
+func installedExtensions(extensions []postgresqlv1alpha1.PostgreSQLDatabaseExtension, installed postgres.Extensions) []postgresqlv1alpha1.PostgreSQLDatabaseInstalledExtension {
+	byName := make(map[string]postgres.Extension, len(installed))
+	for _, e := range installed {
+		byName[e.Name] = e
+	}
+	var status []postgresqlv1alpha1.PostgreSQLDatabaseInstalledExtension
+	for _, e := range extensions {
+		extension, ok := byName[e.ExtensionName]
+		if !ok {
+			continue
+		}
+		status = append(status, postgresqlv1alpha1.PostgreSQLDatabaseInstalledExtension{
+			Name:    extension.Name,
+			Version: extension.Version,
+			Schema:  extension.Schema,
+		})
+	}
+	return status
+}
+
+// databaseOptions returns the options the database of spec is created with.
+func databaseOptions(spec postgresqlv1alpha1.PostgreSQLDatabaseSpec) postgres.DatabaseOptions {
+	options := postgres.DatabaseOptions{
+		Encoding:   spec.Encoding,
+		LCCollate:  spec.LCCollate,
+		LCCtype:    spec.LCCtype,
+		ICULocale:  spec.ICULocale,
+		Template:   spec.Template,
+		Tablespace: spec.Tablespace,
+	}
+	if spec.ConnectionLimit != nil {
+		connectionLimit := int(*spec.ConnectionLimit)
+		options.ConnectionLimit = &connectionLimit
+	}
+	return options
+}
+
+// databaseParameters returns the runtime parameters of the database of spec.
+// It returns nil if the parameters are not managed by the controller.
+func databaseParameters(parameters *postgresqlv1alpha1.PostgreSQLDatabaseParameters) *postgres.DatabaseParameters {
+	if parameters == nil {
+		return nil
+	}
+	return &postgres.DatabaseParameters{
+		Database: parameters.Database,
+		User:     parameters.User,
+	}
+}
+
 type status struct {
 	log    logr.Logger
 	client client.Client
@@ -181,6 +469,14 @@ type status struct {
 	database *postgresqlv1alpha1.PostgreSQLDatabase
 	host     string
 	user     string
+	// extensions are the installed extensions of the spec. They are only
+	// written if the database is reconciled without errors or only extensions
+	// failed to drop.
+	extensions []postgresqlv1alpha1.PostgreSQLDatabaseInstalledExtension
+
+	// rotatePasswordIn is the duration until a generated password must be
+	// rotated. It is zero if the password is not rotated.
+	rotatePasswordIn time.Duration
 }
 
 // Persist writes the status to a PostgreSQLDatabase instance and persists it on
@@ -220,7 +516,9 @@ func (s *status) update(err error) bool {
 	phaseEqual := s.database.Status.Phase == phase
 	errorEqual := s.database.Status.Error == errorMessage
 	hostEqual := s.database.Status.Host == s.host
-	if phaseEqual && errorEqual && hostEqual {
+	writeExtensions := err == nil || errors.Is(err, postgres.ErrExtensionNotDropped)
+	extensionsEqual := !writeExtensions || reflect.DeepEqual(s.database.Status.Extensions, s.extensions)
+	if phaseEqual && errorEqual && hostEqual && extensionsEqual {
 		return false
 	}
 	s.database.Status.PhaseUpdated = s.now()
@@ -228,6 +526,9 @@ func (s *status) update(err error) bool {
 	s.database.Status.Host = s.host
 	s.database.Status.User = s.user
 	s.database.Status.Error = errorMessage
+	if writeExtensions {
+		s.database.Status.Extensions = s.extensions
+	}
 	return true
 }
 
@@ -274,19 +575,54 @@ type EnsureParams struct {
 	ManagerRole string
 
 	// Extensions is a list of extensions expected to be enabled. Extensions outside of this list won't be disabled
+	// unless they are marked to be dropped
 	Extensions []postgres.Extension
 
+	// Schemas is a list of additional schemas created in the database.
+	Schemas []string
+
+	// Options are the options the database is created with.
+	Options postgres.DatabaseOptions
+
+	// Parameters are the runtime parameters of the database and the database
+	// user. They are left untouched if nil.
+	Parameters *postgres.DatabaseParameters
+
 	// Target contains the credentials for the Postgres database that we intend
 	// to create.
 	Target postgres.Credentials
 }
 
 func (r *PostgreSQLDatabaseReconciler) EnsurePostgreSQLDatabase(ctx context.Context, log logr.Logger, params *EnsureParams) error {
-	err := postgres.Database(log, params.Host, params.Admin, params.Target, params.ManagerRole, params.Extensions)
+	err := postgres.CreateDatabase(log, params.Host, params.Admin, params.Target.Name, params.Options)
+	if errors.Is(err, postgres.ErrDatabaseOptionChanged) {
+		return ctlerrors.NewInvalid(fmt.Errorf("create database %s on host %s: %w", params.Target.Name, params.Host, err))
+	}
 	if err != nil {
 		return fmt.Errorf("create database %s on host %s: %w", params.Target.Name, params.Host, err)
 	}
 
+	err = postgres.Database(log, params.Host, params.Admin, params.Target, params.ManagerRole, params.Extensions, params.Schemas...)
+	// extensions that cannot be dropped are reported after the parameters are
+	// applied so they do not block the rest of the database
+	var dropErr error
+	if errors.Is(err, postgres.ErrExtensionNotDropped) {
+		dropErr, err = err, nil
+	}
+	if err != nil {
+		return fmt.Errorf("create database %s on host %s: %w", params.Target.Name, params.Host, err)
+	}
+
+	if params.Parameters != nil {
+		err = postgres.SetDatabaseParameters(log, params.Host, params.Admin, params.Target, *params.Parameters)
+		if err != nil {
+			return fmt.Errorf("set parameters of database %s on host %s: %w", params.Target.Name, params.Host, err)
+		}
+	}
+
+	if dropErr != nil {
+		return fmt.Errorf("drop extensions of database %s on host %s: %w", params.Target.Name, params.Host, dropErr)
+	}
 	return nil
 }
 
@@ -321,8 +657,8 @@ type adminCredentialsParams struct {
 	namespace string
 
 	// host is the host name of the host. If it is provided, its value must be
-	// a key in the `PostgreSQLDatabaseReconciler`'s `HostCredentials` map
-	// field. It must not be provided if `HostCredentials` is provided.
+	// known by the `PostgreSQLDatabaseReconciler`'s `HostCredentials`
+	// registry. It must not be provided if `HostCredentials` is provided.
 	host postgresqlv1alpha1.ResourceVar
 
 	// hostCredentials is the name of the `PostgreSQLHostCredentials` resource
@@ -333,11 +669,17 @@ type adminCredentialsParams struct {
 // adminCredentials returns the correct `postgres.Credentials` based on the
 // values of `params.Host` and `params.HostCredentials` fields of `params`.
 // Exactly one of these fields must be set, and if `Host` is set, then this
-// method will return the adminCredentials from `r.HostCredentials` map,
+// method will return the adminCredentials from `r.HostCredentials` registry,
 // otherwise it will search the Kubernetes namespace for a
 // `PostgreSQLHostCredentials` with the name specified in
 // `params.HostCredentials`.
 func (r *PostgreSQLDatabaseReconciler) adminCredentials(ctx context.Context, reqLogger logr.Logger, params *adminCredentialsParams) (string, *postgres.Credentials, error) {
+	// This is also validated by the admission webhook but it is not guaranteed
+	// to be enabled.
+	if err := postgresqlv1alpha1.ValidateAdminCredentials(params.host, params.hostCredentials); err != nil {
+		return "", nil, ctlerrors.NewInvalid(err)
+	}
+
 	host, err := kube.ResourceValue(r.Client, params.host, params.namespace)
 	if err != nil {
 		// if the `host` value is missing, we want to keep going because it
@@ -360,12 +702,14 @@ func (r *PostgreSQLDatabaseReconciler) adminCredentials(ctx context.Context, req
 	}
 
 	// If the `Host` field is populated but no the `HostCredentials` field,
-	// then return the credentials from the `r.HostCredentials` map.
+	// then return the credentials from the `r.HostCredentials` registry.
 	if params.hostCredentials == "" && host != "" {
-		reqLogger.Info("Using local host credential from controller arguments")
-		cs, ok := r.HostCredentials[host]
+		reqLogger.Info("Using local host credential from controller registry")
+		cs, ok := r.HostCredentials.Get(host)
 		if !ok {
-			return "", nil, ctlerrors.NewInvalid(fmt.Errorf("unknown credentials for host"))
+			// the credentials may not be registered yet, eg. right after a
+			// restart, and the database is reconciled again once they are
+			return "", nil, ctlerrors.NewTemporary(fmt.Errorf("unknown credentials for host"))
 		}
 		return host, &cs, nil
 	}
@@ -392,29 +736,5 @@ func (r *PostgreSQLDatabaseReconciler) remoteCredentials(ctx context.Context, na
 		return "", nil, fmt.Errorf("get PostgreSQLHostCredentials resource: %w", err)
 	}
 
-	// Resolve the `user` field.
-	user, err := kube.ResourceValue(r.Client, hostCreds.Spec.User, hostCreds.Namespace)
-	if err != nil {
-		return "", nil, fmt.Errorf("resolve user resource var: %w", err)
-	}
-
-	// Resolve the `password` field.
-	password, err := kube.ResourceValue(r.Client, hostCreds.Spec.Password, hostCreds.Namespace)
-	if err != nil {
-		return "", nil, fmt.Errorf("resolve password resource var: %w", err)
-	}
-
-	// Resolve the `host` field.
-	host, err := kube.ResourceValue(r.Client, hostCreds.Spec.Host, hostCreds.Namespace)
-	if err != nil {
-		return "", nil, fmt.Errorf("resolve host resource var: %w", err)
-	}
-
-	// Return the resulting host and credentials
-	return host, &postgres.Credentials{
-		Name:     user,
-		User:     user,
-		Password: password,
-		Params:   hostCreds.Spec.Params,
-	}, nil
+	return resolveHostCredentials(r.Client, &hostCreds)
 }
@@ -10,7 +10,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
 	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
 	"go.lunarway.com/postgresql-controller/test"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -155,6 +157,91 @@ func TestStatus_update(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "extensions changed",
+			status: status{
+				database: &lunarwayv1alpha1.PostgreSQLDatabase{
+					Status: lunarwayv1alpha1.PostgreSQLDatabaseStatus{
+						Phase:        lunarwayv1alpha1.PostgreSQLDatabasePhaseRunning,
+						PhaseUpdated: before,
+						Extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+							{Name: "pg_trgm", Version: "1.5", Schema: "user"},
+						},
+					},
+				},
+				extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+					{Name: "pg_trgm", Version: "1.6", Schema: "user"},
+				},
+			},
+			err:     nil,
+			changes: true,
+			after: &lunarwayv1alpha1.PostgreSQLDatabase{
+				Status: lunarwayv1alpha1.PostgreSQLDatabaseStatus{
+					Phase:        lunarwayv1alpha1.PostgreSQLDatabasePhaseRunning,
+					PhaseUpdated: now,
+					Extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+						{Name: "pg_trgm", Version: "1.6", Schema: "user"},
+					},
+				},
+			},
+		},
+		{
+			name: "extensions kept on error",
+			status: status{
+				database: &lunarwayv1alpha1.PostgreSQLDatabase{
+					Status: lunarwayv1alpha1.PostgreSQLDatabaseStatus{
+						Phase:        lunarwayv1alpha1.PostgreSQLDatabasePhaseRunning,
+						PhaseUpdated: before,
+						Extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+							{Name: "pg_trgm", Version: "1.5", Schema: "user"},
+						},
+					},
+				},
+			},
+			err:     errors.New("connection refused"),
+			changes: true,
+			after: &lunarwayv1alpha1.PostgreSQLDatabase{
+				Status: lunarwayv1alpha1.PostgreSQLDatabaseStatus{
+					Phase:        lunarwayv1alpha1.PostgreSQLDatabasePhaseFailed,
+					PhaseUpdated: now,
+					Error:        "connection refused",
+					Extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+						{Name: "pg_trgm", Version: "1.5", Schema: "user"},
+					},
+				},
+			},
+		},
+		{
+			name: "extensions written when not dropped",
+			status: status{
+				database: &lunarwayv1alpha1.PostgreSQLDatabase{
+					Status: lunarwayv1alpha1.PostgreSQLDatabaseStatus{
+						Phase:        lunarwayv1alpha1.PostgreSQLDatabasePhaseRunning,
+						PhaseUpdated: before,
+						Extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+							{Name: "hstore", Version: "1.8", Schema: "user"},
+						},
+					},
+				},
+				extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+					{Name: "pg_trgm", Version: "1.6", Schema: "user"},
+					{Name: "hstore", Version: "1.8", Schema: "user"},
+				},
+			},
+			err:     fmt.Errorf("%w: extension hstore: dependent objects", postgres.ErrExtensionNotDropped),
+			changes: true,
+			after: &lunarwayv1alpha1.PostgreSQLDatabase{
+				Status: lunarwayv1alpha1.PostgreSQLDatabaseStatus{
+					Phase:        lunarwayv1alpha1.PostgreSQLDatabasePhaseFailed,
+					PhaseUpdated: now,
+					Error:        "extension not dropped: extension hstore: dependent objects",
+					Extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+						{Name: "pg_trgm", Version: "1.6", Schema: "user"},
+						{Name: "hstore", Version: "1.8", Schema: "user"},
+					},
+				},
+			},
+		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
@@ -168,6 +255,27 @@ func TestStatus_update(t *testing.T) {
 	}
 }
 
+func TestRemovedExtensions(t *testing.T) {
+	database := func(policy lunarwayv1alpha1.PostgreSQLDatabaseExtensionRemovalPolicy) *lunarwayv1alpha1.PostgreSQLDatabase {
+		return &lunarwayv1alpha1.PostgreSQLDatabase{
+			Spec: lunarwayv1alpha1.PostgreSQLDatabaseSpec{
+				Extensions:             []lunarwayv1alpha1.PostgreSQLDatabaseExtension{{ExtensionName: "pg_trgm"}},
+				ExtensionRemovalPolicy: policy,
+			},
+			Status: lunarwayv1alpha1.PostgreSQLDatabaseStatus{
+				Extensions: []lunarwayv1alpha1.PostgreSQLDatabaseInstalledExtension{
+					{Name: "hstore", Version: "1.8"},
+					{Name: "pg_trgm", Version: "1.6"},
+				},
+			},
+		}
+	}
+
+	assert.Nil(t, removedExtensions(database("")), "default policy")
+	assert.Nil(t, removedExtensions(database(lunarwayv1alpha1.PostgreSQLDatabaseExtensionRemovalPolicyRetain)), "retain policy")
+	assert.Equal(t, postgres.Extensions{{Name: "hstore", Drop: true}}, removedExtensions(database(lunarwayv1alpha1.PostgreSQLDatabaseExtensionRemovalPolicyDrop)), "drop policy")
+}
+
 // TestPostgreSQLDatabase_Reconcile_hostCredentialsResourceReference tests that
 // a PostgreSQLDatabase resource can reference a PostgreSQLHostCredentials
 // resource.
@@ -420,3 +528,133 @@ func TestPostgreSQLDatabase_Reconcile_unknownHostCredentialsResourceReference(t
 		RequeueAfter: 10 * time.Second,
 	}, res, "result not as expected")
 }
+
+func TestPostgreSQLDatabase_Reconcile_deletionPolicyFinalizer(t *testing.T) {
+	logf.SetLogger(zap.New(zap.UseDevMode(true)))
+
+	tt := []struct {
+		name       string
+		policy     lunarwayv1alpha1.PostgreSQLDatabaseDeletionPolicy
+		finalizers []string
+		expected   []string
+	}{
+		{
+			name:     "drop adds finalizer",
+			policy:   lunarwayv1alpha1.PostgreSQLDatabaseDeletionPolicyDrop,
+			expected: []string{postgreSQLDatabaseFinalizer},
+		},
+		{
+			name:     "revoke login adds finalizer",
+			policy:   lunarwayv1alpha1.PostgreSQLDatabaseDeletionPolicyRevokeLogin,
+			expected: []string{postgreSQLDatabaseFinalizer},
+		},
+		{
+			name:       "retain removes finalizer",
+			policy:     lunarwayv1alpha1.PostgreSQLDatabaseDeletionPolicyRetain,
+			finalizers: []string{postgreSQLDatabaseFinalizer},
+			expected:   nil,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			databaseResource := &lunarwayv1alpha1.PostgreSQLDatabase{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "database",
+					Namespace:  "default",
+					Finalizers: tc.finalizers,
+				},
+				Spec: lunarwayv1alpha1.PostgreSQLDatabaseSpec{
+					Name:            "database",
+					HostCredentials: "unknown",
+					DeletionPolicy:  tc.policy,
+				},
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(lunarwayv1alpha1.GroupVersion, databaseResource, &lunarwayv1alpha1.PostgreSQLDatabaseList{})
+			cl := fake.NewClientBuilder().
+				WithObjects(databaseResource).
+				WithStatusSubresource(databaseResource).
+				Build()
+			r := &PostgreSQLDatabaseReconciler{
+				Client: cl,
+				Log:    ctrl.Log.WithName(t.Name()),
+			}
+
+			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "database", Namespace: "default"}}
+			_, err := r.Reconcile(context.Background(), req)
+			assert.NoError(t, err)
+
+			var database lunarwayv1alpha1.PostgreSQLDatabase
+			err = cl.Get(context.Background(), req.NamespacedName, &database)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, database.Finalizers, "finalizers not as expected")
+		})
+	}
+}
+
+func TestPostgreSQLDatabase_Reconcile_deletion(t *testing.T) {
+	logf.SetLogger(zap.New(zap.UseDevMode(true)))
+
+	tt := []struct {
+		name     string
+		isShared bool
+		deleted  bool
+		phase    lunarwayv1alpha1.PostgreSQLDatabasePhase
+	}{
+		{
+			// the host credentials are unknown so there is nothing to clean up
+			name:    "unresolvable references",
+			deleted: true,
+		},
+		{
+			name:     "shared database is not dropped",
+			isShared: true,
+			deleted:  false,
+			phase:    lunarwayv1alpha1.PostgreSQLDatabasePhaseInvalid,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			now := metav1.Now()
+			databaseResource := &lunarwayv1alpha1.PostgreSQLDatabase{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "database",
+					Namespace:         "default",
+					DeletionTimestamp: &now,
+					Finalizers:        []string{postgreSQLDatabaseFinalizer},
+				},
+				Spec: lunarwayv1alpha1.PostgreSQLDatabaseSpec{
+					Name:            "database",
+					HostCredentials: "unknown",
+					IsShared:        tc.isShared,
+					DeletionPolicy:  lunarwayv1alpha1.PostgreSQLDatabaseDeletionPolicyDrop,
+				},
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(lunarwayv1alpha1.GroupVersion, databaseResource, &lunarwayv1alpha1.PostgreSQLDatabaseList{}, &lunarwayv1alpha1.PostgreSQLHostCredentials{})
+			cl := fake.NewClientBuilder().
+				WithObjects(databaseResource).
+				WithStatusSubresource(databaseResource).
+				Build()
+			r := &PostgreSQLDatabaseReconciler{
+				Client: cl,
+				Log:    ctrl.Log.WithName(t.Name()),
+			}
+
+			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "database", Namespace: "default"}}
+			res, err := r.Reconcile(context.Background(), req)
+			assert.NoError(t, err)
+			assert.Equal(t, reconcile.Result{}, res, "result not as expected")
+
+			var database lunarwayv1alpha1.PostgreSQLDatabase
+			err = cl.Get(context.Background(), req.NamespacedName, &database)
+			if tc.deleted {
+				assert.True(t, apierrors.IsNotFound(err), "expected database to be deleted: %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []string{postgreSQLDatabaseFinalizer}, database.Finalizers, "finalizers not as expected")
+			assert.Equal(t, tc.phase, database.Status.Phase, "phase not as expected")
+		})
+	}
+}
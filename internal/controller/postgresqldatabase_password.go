@@ -0,0 +1,156 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/password"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+)
+
+const (
+	// defaultPasswordLength is the length of generated passwords if the
+	// PostgreSQLDatabase does not specify one.
+	defaultPasswordLength = 32
+
+	// passwordRotatedAnnotation holds the time a generated password was last
+	// changed in RFC 3339 format.
+	passwordRotatedAnnotation = "postgresql.lunar.tech/password-rotated"
+
+	// defaultPort is written to the password Secret if the host does not
+	// include a port.
+	defaultPort = "5432"
+)
+
+// passwordSecretName returns the name of the Secret holding the generated
+// password of database.
+func passwordSecretName(database *postgresqlv1alpha1.PostgreSQLDatabase) string {
+	if database.Spec.PasswordGeneration.SecretName != "" {
+		return database.Spec.PasswordGeneration.SecretName
+	}
+	return fmt.Sprintf("%s-postgresql", database.Name)
+}
+
+// ensurePasswordSecret ensures that the Secret of a database with password
+// generation exists and holds a password along with the connection details of
+// the database. A new password is generated if the Secret has none or the
+// rotation interval has passed since it was last changed.
+//
+// The Secret is the source of truth of the password. It is written before the
+// password is applied to the role so a failure to alter the role is recovered
+// on the next reconcile.
+//
+// It returns the password and the duration until it must be rotated. The
+// duration is zero if the password is never rotated.
+func (r *PostgreSQLDatabaseReconciler) ensurePasswordSecret(ctx context.Context, log logr.Logger, database *postgresqlv1alpha1.PostgreSQLDatabase, host, user, params string) (string, time.Duration, error) {
+	generation := database.Spec.PasswordGeneration
+	length := generation.Length
+	if length == 0 {
+		length = defaultPasswordLength
+	}
+	now := time.Now()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: database.Namespace,
+			Name:      passwordSecretName(database),
+		},
+	}
+	var (
+		pass     string
+		rotateIn time.Duration
+	)
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		// never take over a Secret created by someone else as that would
+		// overwrite their data.
+		if secret.ResourceVersion != "" && !metav1.IsControlledBy(secret, database) {
+			return ctlerrors.NewInvalid(fmt.Errorf("secret %s exists and is not owned by this resource", secret.Name))
+		}
+		err := controllerutil.SetControllerReference(database, secret, r.Scheme)
+		if err != nil {
+			return fmt.Errorf("set owner: %w", err)
+		}
+
+		pass = string(secret.Data["password"])
+		rotated, err := time.Parse(time.RFC3339, secret.Annotations[passwordRotatedAnnotation])
+		if err != nil {
+			rotated = time.Time{}
+		}
+		rotationDue := generation.RotationInterval != nil && !now.Before(rotated.Add(generation.RotationInterval.Duration))
+		if pass == "" || rotationDue {
+			pass, err = password.Generate(length)
+			if err != nil {
+				return fmt.Errorf("generate password: %w", err)
+			}
+			rotated = now
+			log.Info("Generated new password", "secret", secret.Name)
+		}
+		if generation.RotationInterval != nil {
+			rotateIn = rotated.Add(generation.RotationInterval.Duration).Sub(now)
+		}
+
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		secret.Annotations[passwordRotatedAnnotation] = rotated.UTC().Format(time.RFC3339)
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = connectionSecretData(host, database.Spec.Name, user, pass, params)
+		return nil
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("ensure secret %s: %w", secret.Name, err)
+	}
+	if op != controllerutil.OperationResultNone {
+		log.Info(fmt.Sprintf("Password secret %s", op), "secret", secret.Name)
+	}
+	return pass, rotateIn, nil
+}
+
+// connectionSecretData returns the keys of a password Secret. The dsn key
+// holds a connection string in the format of postgres.ConnectionString.
+func connectionSecretData(host, database, user, pass, params string) map[string][]byte {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, defaultPort
+	}
+	dsn := postgres.ConnectionString{
+		Host:     host,
+		Database: database,
+		User:     user,
+		Password: pass,
+		Params:   params,
+	}
+	return map[string][]byte{
+		"host":     []byte(hostname),
+		"port":     []byte(port),
+		"database": []byte(database),
+		"user":     []byte(user),
+		"password": []byte(pass),
+		"dsn":      []byte(dsn.Raw()),
+	}
+}
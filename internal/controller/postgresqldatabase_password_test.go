@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPostgreSQLDatabase_ensurePasswordSecret(t *testing.T) {
+	newDatabase := func(generation *lunarwayv1alpha1.PostgreSQLDatabasePasswordGeneration) *lunarwayv1alpha1.PostgreSQLDatabase {
+		return &lunarwayv1alpha1.PostgreSQLDatabase{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "user",
+				Namespace: "default",
+				UID:       "database-uid",
+			},
+			Spec: lunarwayv1alpha1.PostgreSQLDatabaseSpec{
+				Name:               "user",
+				HostCredentials:    "localhost",
+				PasswordGeneration: generation,
+			},
+		}
+	}
+	setup := func(t *testing.T, objs ...client.Object) (*PostgreSQLDatabaseReconciler, client.Client) {
+		t.Helper()
+		s := scheme.Scheme
+		s.AddKnownTypes(lunarwayv1alpha1.GroupVersion, &lunarwayv1alpha1.PostgreSQLDatabase{}, &lunarwayv1alpha1.PostgreSQLDatabaseList{})
+		cl := fake.NewClientBuilder().WithObjects(objs...).Build()
+		return &PostgreSQLDatabaseReconciler{
+			Client: cl,
+			Scheme: s,
+		}, cl
+	}
+	getSecret := func(t *testing.T, cl client.Client, name string) *corev1.Secret {
+		t.Helper()
+		var secret corev1.Secret
+		err := cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, &secret)
+		require.NoError(t, err)
+		return &secret
+	}
+
+	t.Run("creates secret", func(t *testing.T) {
+		database := newDatabase(&lunarwayv1alpha1.PostgreSQLDatabasePasswordGeneration{})
+		r, cl := setup(t, database)
+
+		password, rotateIn, err := r.ensurePasswordSecret(context.Background(), logr.Discard(), database, "localhost:5432", "user", "sslmode=require")
+		require.NoError(t, err)
+		assert.Len(t, password, defaultPasswordLength)
+		assert.Zero(t, rotateIn, "password should not be rotated")
+
+		secret := getSecret(t, cl, "user-postgresql")
+		assert.True(t, metav1.IsControlledBy(secret, database), "secret should be owned by the database")
+		assert.Equal(t, map[string][]byte{
+			"host":     []byte("localhost"),
+			"port":     []byte("5432"),
+			"database": []byte("user"),
+			"user":     []byte("user"),
+			"password": []byte(password),
+			"dsn":      []byte("postgresql://user:" + password + "@localhost:5432/user?sslmode=require"),
+		}, secret.Data, "secret data not as expected")
+
+		// the password is kept on the next reconcile
+		again, _, err := r.ensurePasswordSecret(context.Background(), logr.Discard(), database, "localhost:5432", "user", "sslmode=require")
+		require.NoError(t, err)
+		assert.Equal(t, password, again, "password should be kept")
+	})
+
+	t.Run("rotates password", func(t *testing.T) {
+		database := newDatabase(&lunarwayv1alpha1.PostgreSQLDatabasePasswordGeneration{
+			SecretName:       "user-db",
+			Length:           20,
+			RotationInterval: &metav1.Duration{Duration: time.Hour},
+		})
+		r, cl := setup(t, database)
+
+		password, rotateIn, err := r.ensurePasswordSecret(context.Background(), logr.Discard(), database, "localhost", "user", "")
+		require.NoError(t, err)
+		assert.Len(t, password, 20)
+		assert.InDelta(t, time.Hour, rotateIn, float64(time.Minute), "rotation not as expected")
+		assert.Equal(t, "5432", string(getSecret(t, cl, "user-db").Data["port"]), "port should default")
+
+		// pretend the password was generated more than an hour ago
+		secret := getSecret(t, cl, "user-db")
+		secret.Annotations[passwordRotatedAnnotation] = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+		require.NoError(t, cl.Update(context.Background(), secret))
+
+		rotated, rotateIn, err := r.ensurePasswordSecret(context.Background(), logr.Discard(), database, "localhost", "user", "")
+		require.NoError(t, err)
+		assert.NotEqual(t, password, rotated, "password should be rotated")
+		assert.InDelta(t, time.Hour, rotateIn, float64(time.Minute), "rotation not as expected")
+		assert.Equal(t, rotated, string(getSecret(t, cl, "user-db").Data["password"]), "secret should hold the rotated password")
+	})
+
+	t.Run("secret not owned", func(t *testing.T) {
+		database := newDatabase(&lunarwayv1alpha1.PostgreSQLDatabasePasswordGeneration{})
+		r, _ := setup(t, database, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "user-postgresql"},
+			Data:       map[string][]byte{"password": []byte("existing")},
+		})
+
+		_, _, err := r.ensurePasswordSecret(context.Background(), logr.Discard(), database, "localhost:5432", "user", "")
+		assert.True(t, ctlerrors.IsInvalid(err), "expected an invalid error: %v", err)
+	})
+}
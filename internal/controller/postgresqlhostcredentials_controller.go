@@ -18,17 +18,30 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/auth"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
+	"go.lunarway.com/postgresql-controller/pkg/kube"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
 )
 
 // PostgreSQLHostCredentialsReconciler reconciles a PostgreSQLHostCredentials object
@@ -36,11 +49,24 @@ type PostgreSQLHostCredentialsReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	SuperuserRoleName string
+
+	// Registry is fed with the resolved credentials of every
+	// PostgreSQLHostCredentials resource. It is shared with all other
+	// controllers.
+	Registry *hostcredentials.Registry
+
+	// Authentication is fed with the authentication method and RDS instance of
+	// every PostgreSQLHostCredentials resource specifying them. It is shared
+	// with the PostgreSQLUser controller.
+	Authentication *auth.Selector
 }
 
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlhostcredentials,verbs=get;list;watch
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlhostcredentials/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlhostcredentials/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -53,12 +79,8 @@ func (r *PostgreSQLHostCredentialsReconciler) Reconcile(ctx context.Context, req
 	reqLogger = reqLogger.WithValues("requestId", requestID.String())
 	reqLogger.V(1).Info("Reconciling PostgreSQLHostCredentials")
 
-	result, err := r.reconcile(ctx, reqLogger, req)
-	if err != nil {
-		reqLogger.Error(err, "Failed to reconcile PostgreSQLHostCredentials object")
-	}
-
-	return result, err
+	err = r.reconcile(ctx, reqLogger, req)
+	return hostCredentialsRequeueStrategy(reqLogger, err)
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -68,21 +90,220 @@ func (r *PostgreSQLHostCredentialsReconciler) SetupWithManager(mgr ctrl.Manager)
 		Complete(r)
 }
 
-func (r *PostgreSQLHostCredentialsReconciler) reconcile(ctx context.Context, reqLogger logr.Logger, request reconcile.Request) (ctrl.Result, error) {
+func (r *PostgreSQLHostCredentialsReconciler) reconcile(ctx context.Context, reqLogger logr.Logger, request reconcile.Request) error {
+	source := request.NamespacedName.String()
+
 	creds := postgresqlv1alpha1.PostgreSQLHostCredentials{}
 	err := r.Client.Get(ctx, request.NamespacedName, &creds)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-			// Return and don't requeue
-			reqLogger.Info("PostgreSQLHostCredentials not found")
-			return ctrl.Result{}, nil
+			// Make sure its credentials are no longer handed out to other controllers.
+			reqLogger.Info("PostgreSQLHostCredentials not found. Removing its credentials from the registry")
+			r.Registry.Remove(source)
+			r.Authentication.Remove(source)
+			return nil
 		}
 		// Error reading the object - requeue the request
-		return ctrl.Result{}, err
+		return err
+	}
+	if !creds.DeletionTimestamp.IsZero() {
+		reqLogger.Info("PostgreSQLHostCredentials is being deleted. Removing its credentials from the registry")
+		r.Registry.Remove(source)
+		r.Authentication.Remove(source)
+		return nil
+	}
+
+	host, credentials, err := resolveHostCredentials(r.Client, &creds)
+	if err != nil {
+		r.unregisterInvalid(reqLogger, source, err)
+		r.persistStatus(ctx, &creds, "", false, false, err)
+		return fmt.Errorf("resolve credentials: %w", err)
+	}
+	reqLogger = reqLogger.WithValues("host", host)
+
+	// credentials are only handed out to other controllers once they pass the
+	// preflight checks.
+	reachable, superuserMember, err := r.preflight(reqLogger, host, *credentials)
+	if err != nil {
+		r.unregisterInvalid(reqLogger, source, err)
+		r.persistStatus(ctx, &creds, host, reachable, superuserMember, err)
+		return err
+	}
+	// the authentication is set first as setting the credentials reconciles
+	// the resources using them again, eg. those failing with unknown
+	// credentials after a restart of the controller.
+	r.Authentication.Set(source, host, auth.HostConfig{
+		Method:        auth.Method(creds.Spec.Authentication),
+		DBIResourceID: creds.Spec.DBIResourceID,
+	})
+	r.Registry.Set(source, host, *credentials)
+	reqLogger.Info("Registered host credentials", "authentication", creds.Spec.Authentication, "dbiResourceId", creds.Spec.DBIResourceID)
+	r.persistStatus(ctx, &creds, host, reachable, superuserMember, nil)
+	return nil
+}
+
+// unregisterInvalid removes the credentials registered by source if err
+// makes them unusable. On other errors, eg. an unreachable host, the last good
+// credentials are kept so other controllers keep working with the host.
+func (r *PostgreSQLHostCredentialsReconciler) unregisterInvalid(log logr.Logger, source string, err error) {
+	if !ctlerrors.IsInvalid(err) {
+		return
+	}
+	log.Info("Removing credentials from the registry as they are invalid", "error", err)
+	r.Registry.Remove(source)
+	r.Authentication.Remove(source)
+}
+
+// registeredHostCredentials returns a source enqueuing all resources of list
+// every time credentials are registered in registry. Resources failing with
+// unknown credentials, eg. right after a restart of the controller, are
+// reconciled as soon as the credentials are known.
+//
+// The subscription is made right away so registrations before the controller
+// starts are not missed.
+func registeredHostCredentials(registry *hostcredentials.Registry, c client.Client, list client.ObjectList) source.Source {
+	registered := registry.Subscribe()
+	enqueue := mapAll(c, list)
+	return source.Func(func(ctx context.Context, queue workqueue.RateLimitingInterface) error {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-registered:
+					for _, request := range enqueue(ctx, nil) {
+						queue.Add(request)
+					}
+				}
+			}
+		}()
+		return nil
+	})
+}
+
+// mapAll returns a handler.MapFunc that enqueues all resources of list in the
+// cluster. Resources may use the credentials of a host regardless of the
+// namespace of the PostgreSQLHostCredentials resource.
+func mapAll(c client.Client, list client.ObjectList) handler.MapFunc {
+	return func(ctx context.Context, _ client.Object) []reconcile.Request {
+		items := list.DeepCopyObject().(client.ObjectList)
+		err := c.List(ctx, items)
+		if err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		_ = meta.EachListItem(items, func(item runtime.Object) error {
+			o, ok := item.(client.Object)
+			if !ok {
+				return nil
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Namespace: o.GetNamespace(),
+					Name:      o.GetName(),
+				},
+			})
+			return nil
+		})
+		return requests
+	}
+}
+
+// preflight connects to host and runs the preflight checks that every
+// controller relies on. It reports whether the host was reachable and whether
+// the admin user is a member of the superuser role.
+func (r *PostgreSQLHostCredentialsReconciler) preflight(log logr.Logger, host string, credentials postgres.Credentials) (bool, bool, error) {
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     credentials.User,
+		Password: credentials.Password,
+		Params:   credentials.Params,
+	})
+	if err != nil {
+		return false, false, fmt.Errorf("connect to host %s: %w", host, err)
+	}
+	defer db.Close()
+
+	if err := postgres.Preflight(log, db, r.SuperuserRoleName); err != nil {
+		return true, false, err
+	}
+	return true, true, nil
+}
+
+func (r *PostgreSQLHostCredentialsReconciler) persistStatus(ctx context.Context, creds *postgresqlv1alpha1.PostgreSQLHostCredentials, host string, reachable, superuserMember bool, reconcileErr error) {
+	var phase postgresqlv1alpha1.PostgreSQLHostCredentialsPhase
+	var errorMessage string
+
+	switch {
+	case reconcileErr == nil:
+		phase = postgresqlv1alpha1.PostgreSQLHostCredentialsPhaseRunning
+	case ctlerrors.IsInvalid(reconcileErr):
+		phase = postgresqlv1alpha1.PostgreSQLHostCredentialsPhaseInvalid
+		errorMessage = reconcileErr.Error()
+	default:
+		phase = postgresqlv1alpha1.PostgreSQLHostCredentialsPhaseFailed
+		errorMessage = reconcileErr.Error()
+	}
+
+	if creds.Status.IsUnchanged(phase, errorMessage, host, reachable, superuserMember) {
+		return
+	}
+
+	creds.Status.Phase = phase
+	creds.Status.PhaseUpdated = metav1.Now()
+	creds.Status.Error = errorMessage
+	creds.Status.Host = host
+	creds.Status.Reachable = reachable
+	creds.Status.SuperuserMember = superuserMember
+
+	if err := r.Client.Status().Update(ctx, creds); err != nil {
+		r.Log.Error(err, "failed to update PostgreSQLHostCredentials status")
+	}
+}
+
+// resolveHostCredentials resolves the host and admin credentials of a
+// `PostgreSQLHostCredentials` resource.
+func resolveHostCredentials(c client.Client, hostCreds *postgresqlv1alpha1.PostgreSQLHostCredentials) (string, *postgres.Credentials, error) {
+	// Resolve the `user` field.
+	user, err := kube.ResourceValue(c, hostCreds.Spec.User, hostCreds.Namespace)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve user resource var: %w", err)
+	}
+
+	// Resolve the `password` field.
+	password, err := kube.ResourceValue(c, hostCreds.Spec.Password, hostCreds.Namespace)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve password resource var: %w", err)
+	}
+
+	// Resolve the `host` field.
+	host, err := kube.ResourceValue(c, hostCreds.Spec.Host, hostCreds.Namespace)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve host resource var: %w", err)
+	}
+
+	// Return the resulting host and credentials
+	return host, &postgres.Credentials{
+		Name:     user,
+		User:     user,
+		Password: password,
+		Params:   hostCreds.Spec.Params,
+	}, nil
+}
+
+func hostCredentialsRequeueStrategy(log logr.Logger, err error) (ctrl.Result, error) {
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+
+	if ctlerrors.IsInvalid(err) {
+		log.Info("Dropping PostgreSQLHostCredentials from queue as it is invalid", "error", err)
+		return reconcile.Result{}, nil
 	}
 
-	// HostCredentials instance created or updated
-	return ctrl.Result{}, nil
+	// the host might be temporarily unavailable so keep checking it
+	log.Info("Failed to reconcile PostgreSQLHostCredentials object, attempting again shortly", "error", err)
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 }
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+)
+
+func TestRegisteredHostCredentials(t *testing.T) {
+	s := runtime.NewScheme()
+	require.NoError(t, lunarwayv1alpha1.AddToScheme(s))
+	cl := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(
+			&lunarwayv1alpha1.PostgreSQLUser{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "alice"}},
+		).
+		Build()
+	registry := hostcredentials.NewRegistry(nil)
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := registeredHostCredentials(registry, cl, &lunarwayv1alpha1.PostgreSQLUserList{})
+	// registrations before the source is started are not missed
+	registry.Set("default/host", "localhost:5432", postgres.Credentials{User: "admin"})
+	require.NoError(t, src.Start(ctx, queue))
+
+	request, _ := queue.Get()
+	assert.Equal(t, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "alice"}}, request, "request not as expected")
+	queue.Done(request)
+
+	// every registration enqueues again, also with unchanged credentials
+	registry.Set("default/host", "localhost:5432", postgres.Credentials{User: "admin"})
+	request, _ = queue.Get()
+	assert.Equal(t, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "alice"}}, request, "request not as expected")
+	queue.Done(request)
+}
+
+func TestMapAll(t *testing.T) {
+	s := runtime.NewScheme()
+	require.NoError(t, lunarwayv1alpha1.AddToScheme(s))
+	cl := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(
+			&lunarwayv1alpha1.PostgreSQLUser{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "alice"}},
+			&lunarwayv1alpha1.PostgreSQLUser{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "bob"}},
+		).
+		Build()
+
+	requests := mapAll(cl, &lunarwayv1alpha1.PostgreSQLUserList{})(context.Background(), &lunarwayv1alpha1.PostgreSQLHostCredentials{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "host"},
+	})
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "alice"}},
+		{NamespacedName: types.NamespacedName{Namespace: "other", Name: "bob"}},
+	}, requests, "requests not as expected")
+}
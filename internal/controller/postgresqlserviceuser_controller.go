@@ -18,45 +18,316 @@ package controller
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
+	"go.lunarway.com/postgresql-controller/pkg/kube"
+	"go.lunarway.com/postgresql-controller/pkg/metrics"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
 )
 
 // PostgreSQLServiceUserReconciler reconciles a PostgreSQLServiceUser object
 type PostgreSQLServiceUserReconciler struct {
 	client.Client
+	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	SuperuserRoleName string
+
+	// HostCredentials contains the credentials for hosts (keyed by host name)
+	HostCredentials *hostcredentials.Registry
+
+	// DeletionReassignRole receives the objects owned by dropped service users.
+	// Defaults to the connecting user of the host.
+	DeletionReassignRole string
 }
 
+const serviceUserFinalizer = "postgresqlserviceuser.postgresql.lunar.tech/finalizer"
+
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlserviceusers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlserviceusers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlserviceusers/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the PostgreSQLServiceUser object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.4/pkg/reconcile
+// Reconcile ensures that the login role described by a PostgreSQLServiceUser
+// exists on its host with the requested password and role memberships. The
+// role is dropped again when the resource is deleted.
 func (r *PostgreSQLServiceUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	reqLogger := log.FromContext(ctx)
 
-	// TODO(user): your logic here
+	requestID, err := uuid.NewRandom()
+	if err != nil {
+		reqLogger.Error(err, "Failed to pick a request ID. Continuing without")
+	}
+	reqLogger = reqLogger.WithValues("requestId", requestID.String())
 
-	return ctrl.Result{}, nil
+	start := time.Now()
+	err = r.reconcile(ctx, reqLogger, req)
+	metrics.ObserveReconcile("PostgreSQLServiceUser", start, err)
+	return serviceUserRequeueStrategy(reqLogger, err)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PostgreSQLServiceUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := indexReferences(mgr, &postgresqlv1alpha1.PostgreSQLServiceUser{}, serviceUserReferences)
+	if err != nil {
+		return err
+	}
+	// Watch referenced Secrets and ConfigMaps to apply a rotated password as
+	// soon as it changes.
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&postgresqlv1alpha1.PostgreSQLServiceUser{}).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(mapReferencing(r.Client, &postgresqlv1alpha1.PostgreSQLServiceUserList{}, secretRefIndexKey)),
+		).
+		Watches(
+			&corev1.ConfigMap{},
+			handler.EnqueueRequestsFromMapFunc(mapReferencing(r.Client, &postgresqlv1alpha1.PostgreSQLServiceUserList{}, configMapRefIndexKey)),
+		).
+		WatchesRawSource(registeredHostCredentials(r.HostCredentials, r.Client, &postgresqlv1alpha1.PostgreSQLServiceUserList{})).
 		Complete(r)
 }
+
+// serviceUserReferences returns the ResourceVars of a PostgreSQLServiceUser.
+func serviceUserReferences(obj client.Object) []postgresqlv1alpha1.ResourceVar {
+	serviceUser, ok := obj.(*postgresqlv1alpha1.PostgreSQLServiceUser)
+	if !ok {
+		return nil
+	}
+	vars := []postgresqlv1alpha1.ResourceVar{serviceUser.Spec.Username, serviceUser.Spec.Host}
+	if serviceUser.Spec.Password != nil {
+		vars = append(vars, *serviceUser.Spec.Password)
+	}
+	return vars
+}
+
+func (r *PostgreSQLServiceUserReconciler) reconcile(ctx context.Context, reqLogger logr.Logger, req ctrl.Request) error {
+	reqLogger.V(1).Info("Reconciling PostgreSQLServiceUser")
+
+	serviceUser := &postgresqlv1alpha1.PostgreSQLServiceUser{}
+	err := r.Client.Get(ctx, req.NamespacedName, serviceUser)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.UntrackRoles("PostgreSQLServiceUser", req.NamespacedName.String())
+			return nil
+		}
+		return err
+	}
+
+	// Handle deletion: drop the PostgreSQL role before allowing Kubernetes to
+	// remove the object.
+	if !serviceUser.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(serviceUser, serviceUserFinalizer) {
+			reqLogger.V(1).Info("Dropping service user before deletion")
+			if err := r.finalizeServiceUser(reqLogger, serviceUser); err != nil {
+				return fmt.Errorf("finalize service user: %w", err)
+			}
+			controllerutil.RemoveFinalizer(serviceUser, serviceUserFinalizer)
+			if err := r.Update(ctx, serviceUser); err != nil {
+				return fmt.Errorf("remove finalizer: %w", err)
+			}
+		}
+		return nil
+	}
+
+	// Ensure the finalizer is present so we can clean up on deletion.
+	if !controllerutil.ContainsFinalizer(serviceUser, serviceUserFinalizer) {
+		controllerutil.AddFinalizer(serviceUser, serviceUserFinalizer)
+		if err := r.Update(ctx, serviceUser); err != nil {
+			return fmt.Errorf("add finalizer: %w", err)
+		}
+		return nil
+	}
+
+	err = r.reconcileServiceUser(reqLogger, serviceUser)
+	r.persistStatus(ctx, serviceUser, err)
+	return err
+}
+
+func (r *PostgreSQLServiceUserReconciler) reconcileServiceUser(log logr.Logger, serviceUser *postgresqlv1alpha1.PostgreSQLServiceUser) error {
+	host, username, err := r.resolveHostAndUsername(serviceUser)
+	if err != nil {
+		return err
+	}
+	log = log.WithValues("host", host, "user", username)
+
+	password := ""
+	if serviceUser.Spec.Password != nil {
+		password, err = kube.ResourceValue(r.Client, *serviceUser.Spec.Password, serviceUser.Namespace)
+		if err != nil {
+			return fmt.Errorf("resolve password reference: %w", err)
+		}
+		// an empty password disables login so it is only accepted by omitting
+		// the reference, not by an empty value
+		if password == "" {
+			return ctlerrors.NewInvalid(fmt.Errorf("password reference resolves to an empty value: omit password to disable login"))
+		}
+	}
+
+	roles := make([]string, 0, len(serviceUser.Spec.Roles))
+	for _, role := range serviceUser.Spec.Roles {
+		roles = append(roles, role.RoleName)
+	}
+
+	db, err := r.connect(host)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := postgres.Preflight(log, db, r.SuperuserRoleName); err != nil {
+		return err
+	}
+
+	owner := client.ObjectKeyFromObject(serviceUser).String()
+	if err := postgres.EnsureServiceUser(log, db, username, password, roles, owner); err != nil {
+		return fmt.Errorf("ensure service user on host %s: %w", host, err)
+	}
+	metrics.TrackRoles("PostgreSQLServiceUser", owner, map[string]int{host: 1})
+	return nil
+}
+
+func (r *PostgreSQLServiceUserReconciler) finalizeServiceUser(log logr.Logger, serviceUser *postgresqlv1alpha1.PostgreSQLServiceUser) error {
+	host, username, err := r.resolveHostAndUsername(serviceUser)
+	if err != nil {
+		// if the references can no longer be resolved, eg. the secret holding
+		// the user name was deleted before the resource, there is no way for us
+		// to know what role to drop. Keeping the finalizer would block the
+		// deletion forever. Missing host credentials are temporary and retried
+		// as the role must still be dropped.
+		if ctlerrors.IsInvalid(err) {
+			log.Info("Skipping drop of service user as its references cannot be resolved", "error", err)
+			return nil
+		}
+		return err
+	}
+
+	creds, _ := r.HostCredentials.Get(host)
+	// roles not created for this resource, eg. pre-existing ones refused by
+	// EnsureServiceUser, are left untouched
+	owner := client.ObjectKeyFromObject(serviceUser).String()
+	return postgres.DropServiceUser(log.WithValues("host", host), host, creds, username, owner, r.DeletionReassignRole)
+}
+
+// resolveHostAndUsername resolves the host and user name references of
+// serviceUser and ensures that the controller has credentials for the host.
+func (r *PostgreSQLServiceUserReconciler) resolveHostAndUsername(serviceUser *postgresqlv1alpha1.PostgreSQLServiceUser) (string, string, error) {
+	host, err := kube.ResourceValue(r.Client, serviceUser.Spec.Host, serviceUser.Namespace)
+	if err != nil {
+		return "", "", fmt.Errorf("resolve host reference: %w", err)
+	}
+	// the credentials may not be registered yet, eg. right after a restart,
+	// and the service user is reconciled again once they are
+	if _, ok := r.HostCredentials.Get(host); !ok {
+		return "", "", ctlerrors.NewTemporary(fmt.Errorf("unknown credentials for host %s", host))
+	}
+	username, err := kube.ResourceValue(r.Client, serviceUser.Spec.Username, serviceUser.Namespace)
+	if err != nil {
+		return "", "", fmt.Errorf("resolve username reference: %w", err)
+	}
+	return host, username, nil
+}
+
+func (r *PostgreSQLServiceUserReconciler) connect(host string) (*sql.DB, error) {
+	creds, _ := r.HostCredentials.Get(host)
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     creds.User,
+		Password: creds.Password,
+		Params:   creds.Params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect to host %s: %w", host, err)
+	}
+	return db, nil
+}
+
+func (r *PostgreSQLServiceUserReconciler) persistStatus(ctx context.Context, serviceUser *postgresqlv1alpha1.PostgreSQLServiceUser, reconcileErr error) {
+	status, changed := serviceUserStatus(serviceUser.Status, serviceUser.Generation, reconcileErr, metav1.Now())
+	if !changed {
+		return
+	}
+	serviceUser.Status = status
+	if err := r.Client.Status().Update(ctx, serviceUser); err != nil {
+		r.Log.Error(err, "failed to update PostgreSQLServiceUser status")
+	}
+}
+
+// serviceUserStatus returns the status of a service user based on the outcome
+// of a reconciliation and whether it differs from current.
+func serviceUserStatus(current *postgresqlv1alpha1.PostgreSQLServiceUserStatus, generation int64, reconcileErr error, now metav1.Time) (*postgresqlv1alpha1.PostgreSQLServiceUserStatus, bool) {
+	var conditionType postgresqlv1alpha1.PostgreSQLServiceUserConditionType
+	var message string
+	switch {
+	case reconcileErr == nil:
+		conditionType = postgresqlv1alpha1.PostgreSQLServiceUserPhaseRunning
+		message = "Service user is in sync"
+	case ctlerrors.IsInvalid(reconcileErr):
+		conditionType = postgresqlv1alpha1.PostgreSQLServiceUserPhaseInvalid
+		message = reconcileErr.Error()
+	default:
+		conditionType = postgresqlv1alpha1.PostgreSQLServiceUserPhaseFailed
+		message = reconcileErr.Error()
+	}
+
+	condition := postgresqlv1alpha1.PostgreSQLServiceUserCondition{
+		Type:               conditionType,
+		Status:             corev1.ConditionTrue,
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+		Reason:             string(conditionType),
+		Message:            message,
+	}
+	if current != nil && len(current.Conditions) != 0 {
+		previous := current.Conditions[0]
+		if current.ObservedGeneration == generation && previous.Type == condition.Type && previous.Message == condition.Message {
+			return current, false
+		}
+		if previous.Type == condition.Type {
+			condition.LastTransitionTime = previous.LastTransitionTime
+		}
+	}
+
+	return &postgresqlv1alpha1.PostgreSQLServiceUserStatus{
+		ObservedGeneration: generation,
+		Conditions:         []postgresqlv1alpha1.PostgreSQLServiceUserCondition{condition},
+	}, true
+}
+
+func serviceUserRequeueStrategy(log logr.Logger, err error) (ctrl.Result, error) {
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+
+	if ctlerrors.IsInvalid(err) {
+		log.Info("Dropping PostgreSQLServiceUser from queue as it is invalid", "error", err)
+		return reconcile.Result{}, nil
+	}
+
+	if ctlerrors.IsTemporary(err) {
+		log.Info("Failed to reconcile PostgreSQLServiceUser object, attempting again shortly", "error", err)
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	log.Info("Failed to reconcile PostgreSQLServiceUser object due to unknown error", "error", err)
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+}
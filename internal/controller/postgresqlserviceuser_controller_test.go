@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceUserStatus(t *testing.T) {
+	before := metav1.Time{
+		Time: time.Date(2019, time.December, 18, 17, 7, 3, 0, time.UTC),
+	}
+	now := metav1.Time{
+		Time: time.Date(2019, time.December, 18, 18, 7, 3, 0, time.UTC),
+	}
+	condition := func(conditionType lunarwayv1alpha1.PostgreSQLServiceUserConditionType, message string, updated, transitioned metav1.Time) lunarwayv1alpha1.PostgreSQLServiceUserCondition {
+		return lunarwayv1alpha1.PostgreSQLServiceUserCondition{
+			Type:               conditionType,
+			Status:             corev1.ConditionTrue,
+			LastUpdateTime:     updated,
+			LastTransitionTime: transitioned,
+			Reason:             string(conditionType),
+			Message:            message,
+		}
+	}
+	tt := []struct {
+		name       string
+		current    *lunarwayv1alpha1.PostgreSQLServiceUserStatus
+		generation int64
+		err        error
+		changes    bool
+		after      *lunarwayv1alpha1.PostgreSQLServiceUserStatus
+	}{
+		{
+			name:       "no status and no error",
+			current:    nil,
+			generation: 1,
+			err:        nil,
+			changes:    true,
+			after: &lunarwayv1alpha1.PostgreSQLServiceUserStatus{
+				ObservedGeneration: 1,
+				Conditions: []lunarwayv1alpha1.PostgreSQLServiceUserCondition{
+					condition(lunarwayv1alpha1.PostgreSQLServiceUserPhaseRunning, "Service user is in sync", now, now),
+				},
+			},
+		},
+		{
+			name: "invalid spec",
+			current: &lunarwayv1alpha1.PostgreSQLServiceUserStatus{
+				ObservedGeneration: 1,
+				Conditions: []lunarwayv1alpha1.PostgreSQLServiceUserCondition{
+					condition(lunarwayv1alpha1.PostgreSQLServiceUserPhaseRunning, "Service user is in sync", before, before),
+				},
+			},
+			generation: 2,
+			err:        ctlerrors.NewInvalid(errors.New("unknown credentials for host")),
+			changes:    true,
+			after: &lunarwayv1alpha1.PostgreSQLServiceUserStatus{
+				ObservedGeneration: 2,
+				Conditions: []lunarwayv1alpha1.PostgreSQLServiceUserCondition{
+					condition(lunarwayv1alpha1.PostgreSQLServiceUserPhaseInvalid, "unknown credentials for host", now, now),
+				},
+			},
+		},
+		{
+			name: "same failure",
+			current: &lunarwayv1alpha1.PostgreSQLServiceUserStatus{
+				ObservedGeneration: 1,
+				Conditions: []lunarwayv1alpha1.PostgreSQLServiceUserCondition{
+					condition(lunarwayv1alpha1.PostgreSQLServiceUserPhaseFailed, "connection refused", before, before),
+				},
+			},
+			generation: 1,
+			err:        errors.New("connection refused"),
+			changes:    false,
+			after: &lunarwayv1alpha1.PostgreSQLServiceUserStatus{
+				ObservedGeneration: 1,
+				Conditions: []lunarwayv1alpha1.PostgreSQLServiceUserCondition{
+					condition(lunarwayv1alpha1.PostgreSQLServiceUserPhaseFailed, "connection refused", before, before),
+				},
+			},
+		},
+		{
+			name: "new generation keeps transition time",
+			current: &lunarwayv1alpha1.PostgreSQLServiceUserStatus{
+				ObservedGeneration: 1,
+				Conditions: []lunarwayv1alpha1.PostgreSQLServiceUserCondition{
+					condition(lunarwayv1alpha1.PostgreSQLServiceUserPhaseRunning, "Service user is in sync", before, before),
+				},
+			},
+			generation: 2,
+			err:        nil,
+			changes:    true,
+			after: &lunarwayv1alpha1.PostgreSQLServiceUserStatus{
+				ObservedGeneration: 2,
+				Conditions: []lunarwayv1alpha1.PostgreSQLServiceUserCondition{
+					condition(lunarwayv1alpha1.PostgreSQLServiceUserPhaseRunning, "Service user is in sync", now, before),
+				},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			after, changes := serviceUserStatus(tc.current, tc.generation, tc.err, now)
+			assert.Equal(t, tc.changes, changes, "change indication not as expected")
+			assert.Equal(t, tc.after, after, "service user status not as expected")
+		})
+	}
+}
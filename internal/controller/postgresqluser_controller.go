@@ -20,14 +20,16 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -36,29 +38,24 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/auth"
 	"go.lunarway.com/postgresql-controller/pkg/grants"
-	"go.lunarway.com/postgresql-controller/pkg/iam"
+	"go.lunarway.com/postgresql-controller/pkg/metrics"
 )
 
 // PostgreSQLUserReconciler reconciles a PostgreSQLUser object
 type PostgreSQLUserReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-
-	Granter       grants.Granter
-	EnsureIAMUser func(client *iam.Client, logger logr.Logger, config iam.EnsureUserConfig, username, rolename string) error
-	RemoveIAMUser func(client *iam.Client, awsLoginRoles []string, username string) error
-
-	RolePrefix         string
-	AWSPolicyName      string
-	AWSRegion          string
-	AWSAccountID       string
-	AWSProfile         string
-	AWSAccessKeyID     string
-	AWSSecretAccessKey string
-	IAMPolicyPrefix    string
-	AWSLoginRoles      []string
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	Granter grants.Granter
+	// Authentication lets developers log in as the roles of users on each
+	// host. Every host uses None if it is nil.
+	Authentication *auth.Selector
+
+	RolePrefix string
 }
 
 const userFinalizer = "postgresqluser.lunar.tech/finalizer"
@@ -67,6 +64,8 @@ const userFinalizer = "postgresqluser.lunar.tech/finalizer"
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlusers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=postgresql.lunar.tech,resources=postgresqlusers/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=create;update;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *PostgreSQLUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	reqLogger := log.FromContext(ctx)
@@ -78,17 +77,28 @@ func (r *PostgreSQLUserReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	reqLogger = reqLogger.WithValues("requestId", requestID.String())
 	reqLogger.V(1).Info("Reconciling PostgreSQLUSer")
 
+	start := time.Now()
 	result, err := r.reconcile(ctx, reqLogger, req)
+	metrics.ObserveReconcile("PostgreSQLUser", start, err)
 	if err != nil {
 		reqLogger.Error(err, "Failed to reconcile PostgreSQLUser object")
+		// controller-runtime ignores the result when an error is returned so a
+		// scheduled retry is only honoured without the error
+		if result.RequeueAfter != 0 {
+			return result, nil
+		}
 	}
 	return result, err
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PostgreSQLUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Secrets with generated passwords are owned by the user so they are
+	// recreated if deleted.
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&postgresqlv1alpha1.PostgreSQLUser{}).
+		Owns(&corev1.Secret{}).
+		WatchesRawSource(registeredHostCredentials(r.Granter.HostCredentials, r.Client, &postgresqlv1alpha1.PostgreSQLUserList{})).
 		WithOptions(controller.Options{MaxConcurrentReconciles: 1}). //explicitly set to 1 (which is also the default) because our reconciliation process is not necessarily concurrency safe.
 		Complete(r)
 }
@@ -112,6 +122,7 @@ func (r *PostgreSQLUserReconciler) reconcile(ctx context.Context, reqLogger logr
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
 			reqLogger.Info("Object not found")
+			metrics.UntrackRoles("PostgreSQLUser", request.NamespacedName.String())
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -122,19 +133,6 @@ func (r *PostgreSQLUserReconciler) reconcile(ctx context.Context, reqLogger logr
 	reqLogger = reqLogger.WithValues("user", user.Spec.Name, "rolePrefix", r.RolePrefix)
 	reqLogger.V(1).Info("Reconciling found PostgreSQLUser resource", "user", user.Spec.Name)
 
-	awsConfig := &aws.Config{
-		Region:      aws.String(r.AWSRegion),
-		Credentials: r.getCredentials(),
-	}
-
-	// Initialize session to AWS
-	session, err := session.NewSession(awsConfig)
-	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("session initialization for region %s: %w", r.AWSRegion, err)
-	}
-
-	client := iam.NewClient(session, reqLogger, r.AWSAccountID, r.IAMPolicyPrefix)
-
 	markedToBeDeleted := user.GetDeletionTimestamp() != nil
 	if markedToBeDeleted {
 		if !inList(user.Finalizers, userFinalizer) {
@@ -143,7 +141,7 @@ func (r *PostgreSQLUserReconciler) reconcile(ctx context.Context, reqLogger logr
 		// Run finalization logic for userFinalizer. If the
 		// finalization logic fails, don't remove the finalizer so
 		// that we can retry during the next reconciliation.
-		if err := r.finalizeUser(reqLogger, client, user); err != nil {
+		if err := r.finalizeUser(ctx, reqLogger, user); err != nil {
 			return ctrl.Result{}, err
 		}
 
@@ -173,38 +171,208 @@ func (r *PostgreSQLUserReconciler) reconcile(ctx context.Context, reqLogger logr
 	// We need to sanitize the user.Spec.Name to be a valid PostgreSQL role name
 	sanitizedUser := sanitizedUser(user)
 
-	// Error check in the bottom because we want aws policy to be set no matter what.
-	granterErr := r.Granter.SyncUser(reqLogger, request.Namespace, r.RolePrefix, *sanitizedUser)
+	// Error check in the bottom because we want authentication to be set up no
+	// matter what.
+	syncResult, granterErr := r.Granter.SyncUser(reqLogger, request.Namespace, r.RolePrefix, *sanitizedUser)
+
+	authResult, authErr := r.Authentication.EnsureUser(ctx, reqLogger, userLogin(user, sanitizedUser, syncResult))
 
-	awsPolicyErr := r.EnsureIAMUser(client, reqLogger, iam.EnsureUserConfig{
-		PolicyBaseName:    r.AWSPolicyName,
-		Region:            r.AWSRegion,
-		AccountID:         r.AWSAccountID,
-		MaxUsersPerPolicy: 30,
-		RolePrefix:        r.RolePrefix,
-		AWSLoginRoles:     r.AWSLoginRoles,
-	}, user.Spec.Name, sanitizedUser.Spec.Name)
+	var reconcileErr error
+	if granterErr != nil || authErr != nil {
+		reconcileErr = fmt.Errorf("grantErr: %v, authErr: %v", granterErr, authErr)
+	}
+
+	r.persistStatus(ctx, reqLogger, user, syncResult, authResult.PolicyName, reconcileErr)
+	r.recordTerminatedSessions(user, syncResult)
+	trackUserRoles(request.NamespacedName.String(), syncResult)
+	if reconcileErr != nil {
+		// retry before the next access boundary even if the exponential backoff
+		// has grown beyond it, eg. to revoke an expiring access
+		requeueAfter := errorRequeueAfter(user.Spec, r.Granter.Now())
+		if requeueAfter != 0 {
+			reqLogger.Info("Scheduling retry before next access boundary", "requeueAfter", requeueAfter)
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, reconcileErr
+	}
 
-	if granterErr != nil || awsPolicyErr != nil {
-		return ctrl.Result{}, fmt.Errorf("grantErr: %v, awsPolicyErr: %v", granterErr, awsPolicyErr)
+	// Access requests are only granted and revoked when the user is reconciled
+	// so make sure that happens when the next one starts or stops.
+	now := r.Granter.Now()
+	if boundary, ok := nextAccessBoundary(user.Spec, now); ok {
+		requeueAfter := boundary.Sub(now) + accessBoundaryMargin
+		if authResult.RequeueAfter == 0 || requeueAfter < authResult.RequeueAfter {
+			reqLogger.Info(fmt.Sprintf("Scheduling reconciliation at next access boundary %s", boundary.UTC().Format(time.RFC3339)), "requeueAfter", requeueAfter)
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+	}
+	if authResult.RequeueAfter != 0 {
+		reqLogger.Info("Scheduling reconciliation to renew authentication", "requeueAfter", authResult.RequeueAfter)
+		return ctrl.Result{RequeueAfter: authResult.RequeueAfter}, nil
 	}
 
 	return ctrl.Result{}, nil
 }
 
-func (r *PostgreSQLUserReconciler) getCredentials() *credentials.Credentials {
-	var awsCredentials *credentials.Credentials
-	if len(r.AWSProfile) != 0 {
-		awsCredentials = credentials.NewSharedCredentials("", r.AWSProfile)
-	} else {
-		awsCredentials = credentials.NewStaticCredentials(r.AWSAccessKeyID, r.AWSSecretAccessKey, "")
+// userLogin returns the login of user on the hosts its role was synchronized
+// on. Hosts where the synchronization failed are marked as failed.
+func userLogin(user, sanitizedUser *postgresqlv1alpha1.PostgreSQLUser, result grants.SyncResult) auth.Login {
+	login := auth.Login{
+		User:     user,
+		Name:     sanitizedUser.Spec.Name,
+		RoleName: result.RoleName,
+	}
+	for _, host := range result.Hosts {
+		stop, granted := result.Stops[host.Host]
+		login.Hosts = append(login.Hosts, auth.Host{
+			Name:    host.Host,
+			Granted: granted,
+			Stop:    stop,
+			Failed:  host.Phase == postgresqlv1alpha1.PostgreSQLUserAccessPhaseFailed,
+		})
+	}
+	return login
+}
+
+// recordTerminatedSessions records an event for every host where sessions of
+// the user were terminated after revoking roles.
+func (r *PostgreSQLUserReconciler) recordTerminatedSessions(user *postgresqlv1alpha1.PostgreSQLUser, result grants.SyncResult) {
+	for _, terminated := range result.TerminatedSessions {
+		r.Recorder.Eventf(user, corev1.EventTypeNormal, "SessionsTerminated", "Terminated %d sessions of role %s on host %s after revoking %s", terminated.Sessions, result.RoleName, terminated.Host, strings.Join(terminated.Revoked, ", "))
+	}
+}
+
+// trackUserRoles records the developer role of a user on every host it was
+// synchronized on in the managed roles metric.
+func trackUserRoles(resource string, result grants.SyncResult) {
+	hosts := make(map[string]int, len(result.Hosts))
+	for _, host := range result.Hosts {
+		if host.Phase == postgresqlv1alpha1.PostgreSQLUserAccessPhaseFailed {
+			continue
+		}
+		hosts[host.Host] = 1
+	}
+	metrics.TrackRoles("PostgreSQLUser", resource, hosts)
+}
+
+// accessBoundaryMargin is added to the time until the next access boundary to
+// make sure the boundary has passed when the user is reconciled. The granter
+// considers an access expired only after its stop time.
+const accessBoundaryMargin = time.Second
+
+// userRetryDelay is the longest delay before retrying a failed reconciliation
+// of a user with an upcoming access boundary.
+const userRetryDelay = 10 * time.Second
+
+// errorRequeueAfter returns the delay before retrying a failed reconciliation
+// of a user with spec. It is the shortest of userRetryDelay and the time until
+// the next access boundary, or zero if there is no boundary.
+func errorRequeueAfter(spec postgresqlv1alpha1.PostgreSQLUserSpec, now time.Time) time.Duration {
+	boundary, ok := nextAccessBoundary(spec, now)
+	if !ok {
+		return 0
+	}
+	return min(boundary.Sub(now)+accessBoundaryMargin, userRetryDelay)
+}
+
+// nextAccessBoundary returns the earliest start or stop time after now across
+// all read and write access requests of spec.
+func nextAccessBoundary(spec postgresqlv1alpha1.PostgreSQLUserSpec, now time.Time) (time.Time, bool) {
+	var accesses []postgresqlv1alpha1.AccessSpec
+	if spec.Read != nil {
+		accesses = append(accesses, *spec.Read...)
+	}
+	if spec.Write != nil {
+		for _, write := range *spec.Write {
+			accesses = append(accesses, write.AccessSpec)
+		}
+	}
+
+	var next time.Time
+	for _, access := range accesses {
+		for _, boundary := range []*metav1.Time{access.Start, access.Stop} {
+			if boundary.IsZero() || !boundary.After(now) {
+				continue
+			}
+			if next.IsZero() || boundary.Time.Before(next) {
+				next = boundary.Time
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func (r *PostgreSQLUserReconciler) persistStatus(ctx context.Context, reqLogger logr.Logger, user *postgresqlv1alpha1.PostgreSQLUser, result grants.SyncResult, policyName string, reconcileErr error) {
+	status, changed := userStatus(user.Status, user.Generation, result, policyName, reconcileErr, metav1.Now())
+	if !changed {
+		return
+	}
+	user.Status = status
+	if err := r.Client.Status().Update(ctx, user); err != nil {
+		reqLogger.Error(err, "failed to update PostgreSQLUser status")
+	}
+}
+
+// userStatus returns the status of a PostgreSQLUser based on the outcome of a
+// reconciliation and whether it differs from current. PhaseUpdated is only
+// changed when the phase changes.
+//
+// The policy name is kept from current if policyName is empty as the IAM
+// policy is left untouched when it cannot be ensured or the user has no hosts
+// using AWS IAM authentication.
+func userStatus(current postgresqlv1alpha1.PostgreSQLUserStatus, generation int64, result grants.SyncResult, policyName string, err error, now metav1.Time) (postgresqlv1alpha1.PostgreSQLUserStatus, bool) {
+	status := postgresqlv1alpha1.PostgreSQLUserStatus{
+		ObservedGeneration: generation,
+		Phase:              postgresqlv1alpha1.PostgreSQLUserPhaseRunning,
+		PhaseUpdated:       current.PhaseUpdated,
+		RoleName:           result.RoleName,
+		PolicyName:         policyName,
+		Hosts:              result.Hosts,
+		Accesses:           result.Accesses,
+	}
+	if status.PolicyName == "" {
+		status.PolicyName = current.PolicyName
+	}
+
+	failedAccesses := 0
+	for _, access := range result.Accesses {
+		if access.Phase == postgresqlv1alpha1.PostgreSQLUserAccessPhaseFailed {
+			failedAccesses++
+		}
 	}
-	return awsCredentials
+	switch {
+	case err != nil:
+		status.Phase = postgresqlv1alpha1.PostgreSQLUserPhaseFailed
+		status.Error = err.Error()
+	case failedAccesses != 0:
+		// failing access requests are not blocking the remaining ones so they are
+		// not reported as errors by the granter
+		status.Phase = postgresqlv1alpha1.PostgreSQLUserPhaseFailed
+		status.Error = fmt.Sprintf("%d access requests failed", failedAccesses)
+	}
+	if status.Phase != current.Phase {
+		status.PhaseUpdated = now
+	}
+
+	if equality.Semantic.DeepEqual(current, status) {
+		return current, false
+	}
+	return status, true
 }
 
-func (r *PostgreSQLUserReconciler) finalizeUser(reqLogger logr.Logger, client *iam.Client, user *postgresqlv1alpha1.PostgreSQLUser) error {
+func (r *PostgreSQLUserReconciler) finalizeUser(ctx context.Context, reqLogger logr.Logger, user *postgresqlv1alpha1.PostgreSQLUser) error {
+	// revoke database access before the authentication so a failure is
+	// retried while the user is still known
+	sanitized := sanitizedUser(user)
+	err := r.Granter.RemoveUser(reqLogger, r.RolePrefix, *sanitized)
+	if err != nil {
+		return fmt.Errorf("remove user from hosts: %w", err)
+	}
 
-	err := r.RemoveIAMUser(client, r.AWSLoginRoles, user.Spec.Name)
+	err = r.Authentication.RemoveUser(ctx, reqLogger, auth.Login{
+		User:     user,
+		Name:     sanitized.Spec.Name,
+		RoleName: fmt.Sprintf("%s%s", r.RolePrefix, sanitized.Spec.Name),
+	})
 	if err != nil {
 		return err
 	}
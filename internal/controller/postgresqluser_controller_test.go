@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -12,8 +13,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/auth"
 	"go.lunarway.com/postgresql-controller/pkg/grants"
-	"go.lunarway.com/postgresql-controller/pkg/iam"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
 	"go.lunarway.com/postgresql-controller/pkg/kube"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 	"go.lunarway.com/postgresql-controller/test"
@@ -136,12 +138,12 @@ func TestReconcile_badConfigmapReference(t *testing.T) {
 		Log:    ctrl.Log.WithName(t.Name()),
 		Granter: grants.Granter{
 			Now: time.Now,
-			HostCredentials: map[string]postgres.Credentials{
+			HostCredentials: hostcredentials.NewRegistry(map[string]postgres.Credentials{
 				host: {
 					User:     "iam_creator",
 					Password: "iam_creator",
 				},
-			},
+			}),
 			AllDatabasesReadEnabled:  true,
 			AllDatabasesWriteEnabled: true,
 			AllDatabases: func(namespace string) ([]lunarwayv1alpha1.PostgreSQLDatabase, error) {
@@ -151,9 +153,6 @@ func TestReconcile_badConfigmapReference(t *testing.T) {
 				return kube.ResourceValue(cl, resource, namespace)
 			},
 		},
-		EnsureIAMUser: func(client *iam.Client, logger logr.Logger, config iam.EnsureUserConfig, username, rolename string) error {
-			return nil
-		},
 	}
 
 	// seed database1 into the postgres host
@@ -253,12 +252,12 @@ func TestReconcile_rolePrefix(t *testing.T) {
 		RolePrefix: rolePrefix,
 		Granter: grants.Granter{
 			Now: time.Now,
-			HostCredentials: map[string]postgres.Credentials{
+			HostCredentials: hostcredentials.NewRegistry(map[string]postgres.Credentials{
 				host: {
 					User:     "iam_creator",
 					Password: "iam_creator",
 				},
-			},
+			}),
 			AllDatabasesReadEnabled:  true,
 			AllDatabasesWriteEnabled: true,
 			AllDatabases: func(namespace string) ([]lunarwayv1alpha1.PostgreSQLDatabase, error) {
@@ -268,9 +267,6 @@ func TestReconcile_rolePrefix(t *testing.T) {
 				return kube.ResourceValue(cl, resource, namespace)
 			},
 		},
-		EnsureIAMUser: func(client *iam.Client, logger logr.Logger, config iam.EnsureUserConfig, username, rolename string) error {
-			return nil
-		},
 	}
 
 	// seed database1 into the postgres host
@@ -372,12 +368,12 @@ func TestReconcile_dotInName(t *testing.T) {
 		RolePrefix: "",
 		Granter: grants.Granter{
 			Now: time.Now,
-			HostCredentials: map[string]postgres.Credentials{
+			HostCredentials: hostcredentials.NewRegistry(map[string]postgres.Credentials{
 				host: {
 					User:     "iam_creator",
 					Password: "iam_creator",
 				},
-			},
+			}),
 			AllDatabasesReadEnabled:  true,
 			AllDatabasesWriteEnabled: true,
 			AllDatabases: func(namespace string) ([]lunarwayv1alpha1.PostgreSQLDatabase, error) {
@@ -387,11 +383,10 @@ func TestReconcile_dotInName(t *testing.T) {
 				return kube.ResourceValue(cl, resource, namespace)
 			},
 		},
-		EnsureIAMUser: func(client *iam.Client, logger logr.Logger, config iam.EnsureUserConfig, username, rolename string) error {
-			assert.Equal(t, userName, username, "iam username must be the original")
-			assert.Equal(t, rolename, userNameSanitized, "iam rolename must be the sanitized")
-			return nil
-		},
+		Authentication: testSelector(t, ensureUserFunc(func(login auth.Login) {
+			assert.Equal(t, userName, login.User.Spec.Name, "iam username must be the original")
+			assert.Equal(t, userNameSanitized, login.Name, "iam rolename must be the sanitized")
+		})),
 	}
 
 	// seed database1 into the postgres host
@@ -520,12 +515,12 @@ func TestReconcile_multipleDatabaseResources(t *testing.T) {
 		Log:    ctrl.Log.WithName(t.Name()),
 		Granter: grants.Granter{
 			Now: time.Now,
-			HostCredentials: map[string]postgres.Credentials{
+			HostCredentials: hostcredentials.NewRegistry(map[string]postgres.Credentials{
 				host: {
 					User:     "iam_creator",
 					Password: "iam_creator",
 				},
-			},
+			}),
 			AllDatabasesReadEnabled:  true,
 			AllDatabasesWriteEnabled: true,
 			AllDatabases: func(namespace string) ([]lunarwayv1alpha1.PostgreSQLDatabase, error) {
@@ -535,9 +530,6 @@ func TestReconcile_multipleDatabaseResources(t *testing.T) {
 				return kube.ResourceValue(cl, resource, namespace)
 			},
 		},
-		EnsureIAMUser: func(client *iam.Client, logger logr.Logger, config iam.EnsureUserConfig, username, rolename string) error {
-			return nil
-		},
 	}
 
 	// seed database1 into the postgres host
@@ -561,6 +553,221 @@ func TestReconcile_multipleDatabaseResources(t *testing.T) {
 
 // seededDatabase creates a database with name along with a 'movies' table owned
 // by the database role.
+func TestUserStatus(t *testing.T) {
+	before := metav1.Time{
+		Time: time.Date(2019, time.December, 18, 17, 7, 3, 0, time.UTC),
+	}
+	now := metav1.Time{
+		Time: time.Date(2019, time.December, 18, 18, 7, 3, 0, time.UTC),
+	}
+	granted := lunarwayv1alpha1.PostgreSQLUserAccessStatus{
+		Host:      "host1:5432",
+		Database:  "database",
+		Schema:    "database",
+		Privilege: "read",
+		Phase:     lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted,
+	}
+	failed := lunarwayv1alpha1.PostgreSQLUserAccessStatus{
+		Host:      "unknown",
+		Privilege: "read",
+		Phase:     lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed,
+		Message:   "resolve host: access to host unknown: unknown host",
+	}
+	host := lunarwayv1alpha1.PostgreSQLUserHostStatus{
+		Host:  "host1:5432",
+		Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted,
+	}
+	result := func(accesses ...lunarwayv1alpha1.PostgreSQLUserAccessStatus) grants.SyncResult {
+		return grants.SyncResult{
+			RoleName: "iam_developer_user",
+			Accesses: accesses,
+			Hosts:    []lunarwayv1alpha1.PostgreSQLUserHostStatus{host},
+		}
+	}
+	tt := []struct {
+		name       string
+		current    lunarwayv1alpha1.PostgreSQLUserStatus
+		result     grants.SyncResult
+		policyName string
+		err        error
+		changes    bool
+		after      lunarwayv1alpha1.PostgreSQLUserStatus
+	}{
+		{
+			name:       "no status and no error",
+			current:    lunarwayv1alpha1.PostgreSQLUserStatus{},
+			result:     result(granted),
+			policyName: "policy_0",
+			changes:    true,
+			after: lunarwayv1alpha1.PostgreSQLUserStatus{
+				ObservedGeneration: 1,
+				Phase:              lunarwayv1alpha1.PostgreSQLUserPhaseRunning,
+				PhaseUpdated:       now,
+				RoleName:           "iam_developer_user",
+				PolicyName:         "policy_0",
+				Hosts:              []lunarwayv1alpha1.PostgreSQLUserHostStatus{host},
+				Accesses:           []lunarwayv1alpha1.PostgreSQLUserAccessStatus{granted},
+			},
+		},
+		{
+			name: "unchanged",
+			current: lunarwayv1alpha1.PostgreSQLUserStatus{
+				ObservedGeneration: 1,
+				Phase:              lunarwayv1alpha1.PostgreSQLUserPhaseRunning,
+				PhaseUpdated:       before,
+				RoleName:           "iam_developer_user",
+				PolicyName:         "policy_0",
+				Hosts:              []lunarwayv1alpha1.PostgreSQLUserHostStatus{host},
+				Accesses:           []lunarwayv1alpha1.PostgreSQLUserAccessStatus{granted},
+			},
+			result:     result(granted),
+			policyName: "policy_0",
+			changes:    false,
+			after: lunarwayv1alpha1.PostgreSQLUserStatus{
+				ObservedGeneration: 1,
+				Phase:              lunarwayv1alpha1.PostgreSQLUserPhaseRunning,
+				PhaseUpdated:       before,
+				RoleName:           "iam_developer_user",
+				PolicyName:         "policy_0",
+				Hosts:              []lunarwayv1alpha1.PostgreSQLUserHostStatus{host},
+				Accesses:           []lunarwayv1alpha1.PostgreSQLUserAccessStatus{granted},
+			},
+		},
+		{
+			name: "failed access request",
+			current: lunarwayv1alpha1.PostgreSQLUserStatus{
+				ObservedGeneration: 1,
+				Phase:              lunarwayv1alpha1.PostgreSQLUserPhaseRunning,
+				PhaseUpdated:       before,
+				RoleName:           "iam_developer_user",
+				PolicyName:         "policy_0",
+				Hosts:              []lunarwayv1alpha1.PostgreSQLUserHostStatus{host},
+				Accesses:           []lunarwayv1alpha1.PostgreSQLUserAccessStatus{granted},
+			},
+			result:     result(granted, failed),
+			policyName: "policy_0",
+			changes:    true,
+			after: lunarwayv1alpha1.PostgreSQLUserStatus{
+				ObservedGeneration: 1,
+				Phase:              lunarwayv1alpha1.PostgreSQLUserPhaseFailed,
+				PhaseUpdated:       now,
+				Error:              "1 access requests failed",
+				RoleName:           "iam_developer_user",
+				PolicyName:         "policy_0",
+				Hosts:              []lunarwayv1alpha1.PostgreSQLUserHostStatus{host},
+				Accesses:           []lunarwayv1alpha1.PostgreSQLUserAccessStatus{granted, failed},
+			},
+		},
+		{
+			name: "iam policy error keeps policy name",
+			current: lunarwayv1alpha1.PostgreSQLUserStatus{
+				ObservedGeneration: 1,
+				Phase:              lunarwayv1alpha1.PostgreSQLUserPhaseRunning,
+				PhaseUpdated:       before,
+				RoleName:           "iam_developer_user",
+				PolicyName:         "policy_0",
+				Hosts:              []lunarwayv1alpha1.PostgreSQLUserHostStatus{host},
+				Accesses:           []lunarwayv1alpha1.PostgreSQLUserAccessStatus{granted},
+			},
+			result:     result(granted),
+			policyName: "",
+			err:        errors.New("grantErr: <nil>, awsPolicyErr: throttled"),
+			changes:    true,
+			after: lunarwayv1alpha1.PostgreSQLUserStatus{
+				ObservedGeneration: 1,
+				Phase:              lunarwayv1alpha1.PostgreSQLUserPhaseFailed,
+				PhaseUpdated:       now,
+				Error:              "grantErr: <nil>, awsPolicyErr: throttled",
+				RoleName:           "iam_developer_user",
+				PolicyName:         "policy_0",
+				Hosts:              []lunarwayv1alpha1.PostgreSQLUserHostStatus{host},
+				Accesses:           []lunarwayv1alpha1.PostgreSQLUserAccessStatus{granted},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			after, changes := userStatus(tc.current, 1, tc.result, tc.policyName, tc.err, now)
+			assert.Equal(t, tc.changes, changes, "change indication not as expected")
+			assert.Equal(t, tc.after, after, "user status not as expected")
+		})
+	}
+}
+
+func TestNextAccessBoundary(t *testing.T) {
+	now := time.Date(2020, 4, 30, 13, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(d))
+		return &t
+	}
+	access := func(start, stop *metav1.Time) lunarwayv1alpha1.AccessSpec {
+		return lunarwayv1alpha1.AccessSpec{
+			Reason: "A good reason",
+			Start:  start,
+			Stop:   stop,
+		}
+	}
+	tt := []struct {
+		name     string
+		spec     lunarwayv1alpha1.PostgreSQLUserSpec
+		boundary time.Time
+		ok       bool
+	}{
+		{
+			name: "no accesses",
+			spec: lunarwayv1alpha1.PostgreSQLUserSpec{},
+			ok:   false,
+		},
+		{
+			name: "no start and stop times",
+			spec: lunarwayv1alpha1.PostgreSQLUserSpec{
+				Read: &[]lunarwayv1alpha1.AccessSpec{access(nil, nil)},
+			},
+			ok: false,
+		},
+		{
+			name: "only past boundaries",
+			spec: lunarwayv1alpha1.PostgreSQLUserSpec{
+				Read: &[]lunarwayv1alpha1.AccessSpec{access(at(-2*time.Hour), at(-1*time.Hour))},
+			},
+			ok: false,
+		},
+		{
+			name: "boundary at now is passed",
+			spec: lunarwayv1alpha1.PostgreSQLUserSpec{
+				Read: &[]lunarwayv1alpha1.AccessSpec{access(at(0), nil)},
+			},
+			ok: false,
+		},
+		{
+			name: "active read stops",
+			spec: lunarwayv1alpha1.PostgreSQLUserSpec{
+				Read: &[]lunarwayv1alpha1.AccessSpec{access(at(-1*time.Hour), at(2*time.Hour))},
+			},
+			boundary: now.Add(2 * time.Hour),
+			ok:       true,
+		},
+		{
+			name: "write starts before read stops",
+			spec: lunarwayv1alpha1.PostgreSQLUserSpec{
+				Read: &[]lunarwayv1alpha1.AccessSpec{access(nil, at(2*time.Hour))},
+				Write: &[]lunarwayv1alpha1.WriteAccessSpec{
+					{AccessSpec: access(at(30*time.Minute), at(3*time.Hour))},
+				},
+			},
+			boundary: now.Add(30 * time.Minute),
+			ok:       true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			boundary, ok := nextAccessBoundary(tc.spec, now)
+			assert.Equal(t, tc.ok, ok, "boundary indication not as expected")
+			assert.Equal(t, tc.boundary, boundary, "boundary not as expected")
+		})
+	}
+}
+
 func seededDatabase(t *testing.T, host, databaseName, userName string, managerRole string) {
 	t.Helper()
 
@@ -640,3 +847,73 @@ func createManagerRole(log logr.Logger, db *sql.DB, roleName string) error {
 	}
 	return nil
 }
+
+// ensureUserFunc is an auth.Authenticator calling itself on EnsureUser.
+type ensureUserFunc func(login auth.Login)
+
+func (ensureUserFunc) Roles() []string {
+	return nil
+}
+
+func (f ensureUserFunc) EnsureUser(_ context.Context, _ logr.Logger, login auth.Login) (auth.Result, error) {
+	f(login)
+	return auth.Result{}, nil
+}
+
+func (ensureUserFunc) RemoveUser(context.Context, logr.Logger, auth.Login) error {
+	return nil
+}
+
+// testSelector returns an auth.Selector using authenticator for every host.
+func testSelector(t *testing.T, authenticator auth.Authenticator) *auth.Selector {
+	t.Helper()
+	selector, err := auth.NewSelector(auth.MethodAWSIAM, map[auth.Method]auth.Authenticator{
+		auth.MethodAWSIAM: authenticator,
+	}, nil)
+	require.NoError(t, err)
+	return selector
+}
+
+func TestErrorRequeueAfter(t *testing.T) {
+	now := time.Date(2020, 4, 30, 13, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(d))
+		return &t
+	}
+	spec := func(stop *metav1.Time) lunarwayv1alpha1.PostgreSQLUserSpec {
+		return lunarwayv1alpha1.PostgreSQLUserSpec{
+			Read: &[]lunarwayv1alpha1.AccessSpec{
+				{
+					Reason: "A good reason",
+					Stop:   stop,
+				},
+			},
+		}
+	}
+	tt := []struct {
+		name         string
+		spec         lunarwayv1alpha1.PostgreSQLUserSpec
+		requeueAfter time.Duration
+	}{
+		{
+			name:         "no boundary",
+			spec:         spec(nil),
+			requeueAfter: 0,
+		},
+		{
+			name:         "boundary after retry delay",
+			spec:         spec(at(2 * time.Hour)),
+			requeueAfter: userRetryDelay,
+		},
+		{
+			name:         "boundary before retry delay",
+			spec:         spec(at(3 * time.Second)),
+			requeueAfter: 3*time.Second + accessBoundaryMargin,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.requeueAfter, errorRequeueAfter(tc.spec, now))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	postgresqlv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+)
+
+const (
+	// secretRefIndexKey indexes resources by the names of the Secrets their
+	// ResourceVars reference.
+	secretRefIndexKey = ".spec.valueFrom.secretKeyRef.name"
+	// configMapRefIndexKey indexes resources by the names of the ConfigMaps
+	// their ResourceVars reference.
+	configMapRefIndexKey = ".spec.valueFrom.configMapKeyRef.name"
+)
+
+// indexReferences registers field indexes of the names of the Secrets and
+// ConfigMaps referenced by the ResourceVars of obj. Together with
+// mapReferencing this allows a controller to reconcile its resources when a
+// referenced value, eg. a password, changes instead of waiting for the next
+// resync.
+func indexReferences(mgr ctrl.Manager, obj client.Object, vars func(client.Object) []postgresqlv1alpha1.ResourceVar) error {
+	indexer := mgr.GetFieldIndexer()
+	err := indexer.IndexField(context.Background(), obj, secretRefIndexKey, func(o client.Object) []string {
+		secrets, _ := referencedNames(vars(o))
+		return secrets
+	})
+	if err != nil {
+		return fmt.Errorf("index referenced secrets: %w", err)
+	}
+	err = indexer.IndexField(context.Background(), obj, configMapRefIndexKey, func(o client.Object) []string {
+		_, configMaps := referencedNames(vars(o))
+		return configMaps
+	})
+	if err != nil {
+		return fmt.Errorf("index referenced config maps: %w", err)
+	}
+	return nil
+}
+
+// referencedNames returns the names of the Secrets and ConfigMaps referenced by
+// vars.
+func referencedNames(vars []postgresqlv1alpha1.ResourceVar) (secrets, configMaps []string) {
+	for _, v := range vars {
+		if v.ValueFrom == nil {
+			continue
+		}
+		if v.ValueFrom.SecretKeyRef != nil && v.ValueFrom.SecretKeyRef.Name != "" {
+			secrets = append(secrets, v.ValueFrom.SecretKeyRef.Name)
+		}
+		if v.ValueFrom.ConfigMapKeyRef != nil && v.ValueFrom.ConfigMapKeyRef.Name != "" {
+			configMaps = append(configMaps, v.ValueFrom.ConfigMapKeyRef.Name)
+		}
+	}
+	return secrets, configMaps
+}
+
+// mapReferencing returns a handler.MapFunc that enqueues all resources of list
+// in the namespace of the changed object that reference it by indexKey.
+func mapReferencing(c client.Client, list client.ObjectList, indexKey string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		items := list.DeepCopyObject().(client.ObjectList)
+		err := c.List(ctx, items, client.InNamespace(obj.GetNamespace()), client.MatchingFields{indexKey: obj.GetName()})
+		if err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		_ = meta.EachListItem(items, func(item runtime.Object) error {
+			o, ok := item.(client.Object)
+			if !ok {
+				return nil
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Namespace: o.GetNamespace(),
+					Name:      o.GetName(),
+				},
+			})
+			return nil
+		})
+		return requests
+	}
+}
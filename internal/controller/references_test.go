@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMapReferencing(t *testing.T) {
+	secretRef := func(name string) *lunarwayv1alpha1.ResourceVar {
+		return &lunarwayv1alpha1.ResourceVar{
+			ValueFrom: &lunarwayv1alpha1.ResourceVarSource{
+				SecretKeyRef: &lunarwayv1alpha1.KeySelector{Name: name, Key: "password"},
+			},
+		}
+	}
+	database := func(namespace, name string, password *lunarwayv1alpha1.ResourceVar) *lunarwayv1alpha1.PostgreSQLDatabase {
+		return &lunarwayv1alpha1.PostgreSQLDatabase{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: lunarwayv1alpha1.PostgreSQLDatabaseSpec{
+				Name: name,
+				Host: lunarwayv1alpha1.ResourceVar{
+					ValueFrom: &lunarwayv1alpha1.ResourceVarSource{
+						ConfigMapKeyRef: &lunarwayv1alpha1.KeySelector{Name: "database", Key: "host"},
+					},
+				},
+				Password: password,
+			},
+		}
+	}
+
+	s := runtime.NewScheme()
+	require.NoError(t, lunarwayv1alpha1.AddToScheme(s))
+	cl := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(
+			database("default", "user", secretRef("user-db")),
+			database("default", "plain", &lunarwayv1alpha1.ResourceVar{Value: "secret"}),
+			database("other", "user", secretRef("user-db")),
+		).
+		WithIndex(&lunarwayv1alpha1.PostgreSQLDatabase{}, secretRefIndexKey, func(o client.Object) []string {
+			secrets, _ := referencedNames(databaseReferences(o))
+			return secrets
+		}).
+		WithIndex(&lunarwayv1alpha1.PostgreSQLDatabase{}, configMapRefIndexKey, func(o client.Object) []string {
+			_, configMaps := referencedNames(databaseReferences(o))
+			return configMaps
+		}).
+		Build()
+
+	t.Run("secret", func(t *testing.T) {
+		requests := mapReferencing(cl, &lunarwayv1alpha1.PostgreSQLDatabaseList{}, secretRefIndexKey)(context.Background(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "user-db"},
+		})
+		assert.Equal(t, []reconcile.Request{
+			{NamespacedName: types.NamespacedName{Namespace: "default", Name: "user"}},
+		}, requests, "requests not as expected")
+	})
+
+	t.Run("config map", func(t *testing.T) {
+		requests := mapReferencing(cl, &lunarwayv1alpha1.PostgreSQLDatabaseList{}, configMapRefIndexKey)(context.Background(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "database"},
+		})
+		assert.ElementsMatch(t, []reconcile.Request{
+			{NamespacedName: types.NamespacedName{Namespace: "default", Name: "user"}},
+			{NamespacedName: types.NamespacedName{Namespace: "default", Name: "plain"}},
+		}, requests, "requests not as expected")
+	})
+
+	t.Run("unreferenced secret", func(t *testing.T) {
+		requests := mapReferencing(cl, &lunarwayv1alpha1.PostgreSQLDatabaseList{}, secretRefIndexKey)(context.Background(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "unknown"},
+		})
+		assert.Empty(t, requests, "requests not as expected")
+	})
+}
@@ -0,0 +1,350 @@
+// Package auth provides the ways developers authenticate as the roles of
+// PostgreSQLUser resources.
+//
+// The role itself is managed by the grants package on every host. An
+// Authenticator makes sure the developer can log in as it, eg. by allowing it
+// in an AWS IAM policy or by generating a password. Each host picks its
+// Authenticator through a Selector.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
+
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+)
+
+// Method names an Authenticator.
+type Method string
+
+const (
+	// MethodAWSIAM lets developers log in with AWS IAM database
+	// authentication.
+	MethodAWSIAM Method = "AWSIAM"
+	// MethodNone only manages the role. Developers log in through means
+	// managed outside of the controller, eg. trust or certificate
+	// authentication in pg_hba.conf.
+	MethodNone Method = "None"
+	// MethodPassword generates short-lived passwords delivered in a Secret.
+	MethodPassword Method = "Password"
+)
+
+// ParseMethod parses s as a Method.
+func ParseMethod(s string) (Method, error) {
+	switch method := Method(s); method {
+	case MethodAWSIAM, MethodNone, MethodPassword:
+		return method, nil
+	default:
+		return "", fmt.Errorf("unknown authentication method '%s': must be one of %s, %s or %s", s, MethodAWSIAM, MethodNone, MethodPassword)
+	}
+}
+
+// Login describes how a PostgreSQLUser logs in on a set of hosts.
+type Login struct {
+	// User is the PostgreSQLUser resource.
+	User *lunarwayv1alpha1.PostgreSQLUser
+	// Name is the sanitized name of the user without the role prefix.
+	Name string
+	// RoleName is the name of the role the user logs in as.
+	RoleName string
+	// Hosts are the hosts where the role is synchronized.
+	Hosts []Host
+}
+
+// Host is a host where a role is synchronized.
+type Host struct {
+	// Name is the host name including any port.
+	Name string
+	// Granted reports whether the user has granted accesses on the host. Hosts
+	// without are only synchronized to revoke the roles of expired accesses.
+	Granted bool
+	// Stop is the time the last granted access of the user on the host stops.
+	// It is zero if an access does not stop.
+	Stop time.Time
+	// Failed reports whether synchronizing the role on the host failed.
+	// Authenticators should not revoke existing means to log in on failed
+	// hosts.
+	Failed bool
+	// DBIResourceID is the DbiResourceId of the RDS instance of the host if
+	// known.
+	DBIResourceID string
+}
+
+// HostConfig is the authentication configuration of a host.
+type HostConfig struct {
+	// Method is the Method of the host. If empty the host uses the Method of
+	// a lower precedence configuration.
+	Method Method
+	// DBIResourceID is the DbiResourceId of the RDS instance of the host. AWS
+	// IAM statements are scoped to the instance if it is set.
+	DBIResourceID string
+}
+
+// Result describes the outcome of an EnsureUser call.
+type Result struct {
+	// PolicyName is the name of the IAM policy holding the user.
+	PolicyName string
+	// RequeueAfter is the duration after which the user must be ensured again,
+	// eg. to renew a password. It is zero if not needed.
+	RequeueAfter time.Duration
+}
+
+// merge combines r with the result of another Authenticator.
+func (r Result) merge(other Result) Result {
+	if r.PolicyName == "" {
+		r.PolicyName = other.PolicyName
+	}
+	if other.RequeueAfter != 0 && (r.RequeueAfter == 0 || other.RequeueAfter < r.RequeueAfter) {
+		r.RequeueAfter = other.RequeueAfter
+	}
+	return r
+}
+
+// Authenticator lets developers log in as the role of a PostgreSQLUser.
+type Authenticator interface {
+	// Roles returns the roles granted to users on hosts using the
+	// Authenticator, eg. rds_iam.
+	Roles() []string
+	// EnsureUser makes sure that the user can log in as its role on the hosts
+	// of login.
+	EnsureUser(ctx context.Context, log logr.Logger, login Login) (Result, error)
+	// RemoveUser removes the means of a user to log in when it is deleted or
+	// none of its hosts use the Authenticator. The hosts of login are not
+	// known on removal.
+	RemoveUser(ctx context.Context, log logr.Logger, login Login) error
+}
+
+// None is the Authenticator of MethodNone.
+type None struct{}
+
+var _ Authenticator = None{}
+
+func (None) Roles() []string {
+	return nil
+}
+
+func (None) EnsureUser(context.Context, logr.Logger, Login) (Result, error) {
+	return Result{}, nil
+}
+
+func (None) RemoveUser(context.Context, logr.Logger, Login) error {
+	return nil
+}
+
+// Selector picks the Authenticator of each host.
+//
+// Host configurations registered dynamically, eg. from
+// PostgreSQLHostCredentials resources, take precedence over static ones
+// configured at startup. Hosts with neither use the default Method. If more
+// than one source registers a configuration for the same host, the source
+// with the lowest name wins like in the hostcredentials registry. Each field of
+// HostConfig is resolved on its own so a source may only set some of them.
+//
+// A nil Selector is valid and uses MethodNone for every host.
+type Selector struct {
+	mu             sync.RWMutex
+	defaultMethod  Method
+	authenticators map[Method]Authenticator
+	static         map[string]HostConfig
+	dynamic        map[string]hostConfig
+}
+
+type hostConfig struct {
+	host   string
+	config HostConfig
+}
+
+// NewSelector returns a Selector using authenticators by Method. Hosts of
+// static use the configuration they are mapped to and any other host uses
+// defaultMethod. Every Method used must have an Authenticator.
+func NewSelector(defaultMethod Method, authenticators map[Method]Authenticator, static map[string]HostConfig) (*Selector, error) {
+	s := &Selector{
+		defaultMethod:  defaultMethod,
+		authenticators: make(map[Method]Authenticator, len(authenticators)),
+		static:         make(map[string]HostConfig, len(static)),
+		dynamic:        make(map[string]hostConfig),
+	}
+	for method, authenticator := range authenticators {
+		s.authenticators[method] = authenticator
+	}
+	if _, ok := s.authenticators[defaultMethod]; !ok {
+		return nil, fmt.Errorf("no authenticator for default method %s", defaultMethod)
+	}
+	for host, config := range static {
+		if _, ok := s.authenticators[config.Method]; config.Method != "" && !ok {
+			return nil, fmt.Errorf("no authenticator for method %s of host %s", config.Method, host)
+		}
+		s.static[host] = config
+	}
+	return s, nil
+}
+
+// Set registers config for host from source. Any configuration previously
+// registered by source is replaced. An empty config removes the registration
+// of source.
+func (s *Selector) Set(source, host string, config HostConfig) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if config == (HostConfig{}) {
+		delete(s.dynamic, source)
+		return
+	}
+	s.dynamic[source] = hostConfig{
+		host:   host,
+		config: config,
+	}
+}
+
+// Remove removes any configuration registered by source.
+func (s *Selector) Remove(source string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.dynamic, source)
+}
+
+// Method returns the Method of host.
+func (s *Selector) Method(host string) Method {
+	return s.Config(host).Method
+}
+
+// Config returns the resolved configuration of host.
+func (s *Selector) Config(host string) HostConfig {
+	if s == nil {
+		return HostConfig{Method: MethodNone}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sources := make([]string, 0, len(s.dynamic))
+	for source, registered := range s.dynamic {
+		if registered.host == host {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+	configs := make([]HostConfig, 0, len(sources)+1)
+	for _, source := range sources {
+		configs = append(configs, s.dynamic[source].config)
+	}
+	configs = append(configs, s.static[host])
+
+	resolved := HostConfig{Method: s.defaultMethod}
+	for i := len(configs) - 1; i >= 0; i-- {
+		if configs[i].Method != "" {
+			resolved.Method = configs[i].Method
+		}
+		if configs[i].DBIResourceID != "" {
+			resolved.DBIResourceID = configs[i].DBIResourceID
+		}
+	}
+	return resolved
+}
+
+// Roles returns the roles granted to users on host by its Authenticator.
+func (s *Selector) Roles(host string) []string {
+	authenticator, err := s.authenticator(s.Method(host))
+	if err != nil {
+		return nil
+	}
+	return authenticator.Roles()
+}
+
+// EnsureUser ensures the user on the hosts of login with the Authenticator of
+// each host. Every Authenticator is called once with the hosts using it.
+// Authenticators without any hosts remove the user instead, eg. when its
+// accesses are removed or its hosts moved to another Method.
+func (s *Selector) EnsureUser(ctx context.Context, log logr.Logger, login Login) (Result, error) {
+	byMethod := make(map[Method][]Host)
+	for _, host := range login.Hosts {
+		config := s.Config(host.Name)
+		host.DBIResourceID = config.DBIResourceID
+		byMethod[config.Method] = append(byMethod[config.Method], host)
+	}
+	methods := make([]Method, 0, len(byMethod))
+	for method := range byMethod {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i] < methods[j]
+	})
+
+	var (
+		result Result
+		errs   error
+	)
+	for _, method := range methods {
+		authenticator, err := s.authenticator(method)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		methodLogin := login
+		methodLogin.Hosts = byMethod[method]
+		methodResult, err := authenticator.EnsureUser(ctx, log.WithValues("authentication", method), methodLogin)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s authentication: %w", method, err))
+		}
+		result = result.merge(methodResult)
+	}
+	for _, method := range s.methods() {
+		if _, ok := byMethod[method]; ok {
+			continue
+		}
+		err := s.authenticators[method].RemoveUser(ctx, log.WithValues("authentication", method), login)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s authentication: %w", method, err))
+		}
+	}
+	return result, errs
+}
+
+// RemoveUser removes the user from every Authenticator as the hosts it was
+// authenticated on are not known on removal.
+func (s *Selector) RemoveUser(ctx context.Context, log logr.Logger, login Login) error {
+	var errs error
+	for _, method := range s.methods() {
+		err := s.authenticators[method].RemoveUser(ctx, log.WithValues("authentication", method), login)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s authentication: %w", method, err))
+		}
+	}
+	return errs
+}
+
+// methods returns the sorted Methods with an Authenticator.
+func (s *Selector) methods() []Method {
+	if s == nil {
+		return nil
+	}
+	methods := make([]Method, 0, len(s.authenticators))
+	for method := range s.authenticators {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i] < methods[j]
+	})
+	return methods
+}
+
+// authenticator returns the Authenticator of method.
+func (s *Selector) authenticator(method Method) (Authenticator, error) {
+	if s == nil {
+		return None{}, nil
+	}
+	authenticator, ok := s.authenticators[method]
+	if !ok {
+		return nil, fmt.Errorf("no authenticator for method %s", method)
+	}
+	return authenticator, nil
+}
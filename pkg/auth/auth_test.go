@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is an Authenticator recording the logins it ensures.
+type recorder struct {
+	roles   []string
+	result  Result
+	err     error
+	ensured []Login
+	removed []Login
+}
+
+func (r *recorder) Roles() []string {
+	return r.roles
+}
+
+func (r *recorder) EnsureUser(_ context.Context, _ logr.Logger, login Login) (Result, error) {
+	r.ensured = append(r.ensured, login)
+	return r.result, r.err
+}
+
+func (r *recorder) RemoveUser(_ context.Context, _ logr.Logger, login Login) error {
+	r.removed = append(r.removed, login)
+	return r.err
+}
+
+func TestParseMethod(t *testing.T) {
+	method, err := ParseMethod("Password")
+	require.NoError(t, err)
+	assert.Equal(t, MethodPassword, method)
+
+	_, err = ParseMethod("password")
+	assert.EqualError(t, err, "unknown authentication method 'password': must be one of AWSIAM, None or Password")
+}
+
+func TestNewSelector(t *testing.T) {
+	_, err := NewSelector(MethodAWSIAM, map[Method]Authenticator{MethodNone: None{}}, nil)
+	assert.EqualError(t, err, "no authenticator for default method AWSIAM")
+
+	_, err = NewSelector(MethodNone, map[Method]Authenticator{MethodNone: None{}}, map[string]HostConfig{"host:5432": {Method: MethodPassword}})
+	assert.EqualError(t, err, "no authenticator for method Password of host host:5432")
+}
+
+func TestSelector_Method(t *testing.T) {
+	s, err := NewSelector(MethodAWSIAM, map[Method]Authenticator{
+		MethodAWSIAM:   &recorder{},
+		MethodNone:     None{},
+		MethodPassword: &recorder{},
+	}, map[string]HostConfig{
+		"static:5432": {Method: MethodNone, DBIResourceID: "db-STATIC"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, MethodAWSIAM, s.Method("other:5432"), "default")
+	assert.Equal(t, MethodNone, s.Method("static:5432"), "static")
+
+	s.Set("default/b", "static:5432", HostConfig{Method: MethodPassword})
+	assert.Equal(t, MethodPassword, s.Method("static:5432"), "dynamic takes precedence over static")
+	assert.Equal(t, HostConfig{Method: MethodPassword, DBIResourceID: "db-STATIC"}, s.Config("static:5432"), "fields are resolved on their own")
+
+	s.Set("default/a", "static:5432", HostConfig{Method: MethodAWSIAM})
+	assert.Equal(t, MethodAWSIAM, s.Method("static:5432"), "lowest source wins")
+
+	s.Set("default/c", "static:5432", HostConfig{DBIResourceID: "db-DYNAMIC"})
+	assert.Equal(t, HostConfig{Method: MethodAWSIAM, DBIResourceID: "db-DYNAMIC"}, s.Config("static:5432"), "dynamic resource id")
+
+	s.Set("default/a", "static:5432", HostConfig{})
+	s.Remove("default/c")
+	assert.Equal(t, MethodPassword, s.Method("static:5432"), "empty config removes source")
+
+	s.Remove("default/b")
+	assert.Equal(t, MethodNone, s.Method("static:5432"), "removed source falls back to static")
+
+	var nilSelector *Selector
+	assert.Equal(t, MethodNone, nilSelector.Method("other:5432"), "nil selector")
+	assert.Empty(t, nilSelector.Roles("other:5432"), "nil selector roles")
+}
+
+func TestSelector_EnsureUser(t *testing.T) {
+	iam := &recorder{
+		roles:  []string{RDSIAMRole},
+		result: Result{PolicyName: "policy", RequeueAfter: time.Hour},
+	}
+	password := &recorder{
+		result: Result{RequeueAfter: time.Minute},
+		err:    errors.New("boom"),
+	}
+	s, err := NewSelector(MethodAWSIAM, map[Method]Authenticator{
+		MethodAWSIAM:   iam,
+		MethodNone:     None{},
+		MethodPassword: password,
+	}, map[string]HostConfig{
+		"plain:5432": {Method: MethodPassword},
+		"rds:5432":   {DBIResourceID: "db-RDS"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{RDSIAMRole}, s.Roles("rds:5432"), "roles of default")
+	assert.Empty(t, s.Roles("plain:5432"), "roles of password")
+
+	result, err := s.EnsureUser(context.Background(), logr.Discard(), Login{
+		RoleName: "iam_developer_user",
+		Hosts: []Host{
+			{Name: "rds:5432", Granted: true},
+			{Name: "plain:5432", Granted: true},
+			{Name: "rds2:5432"},
+		},
+	})
+	assert.EqualError(t, err, "Password authentication: boom")
+	assert.Equal(t, Result{PolicyName: "policy", RequeueAfter: time.Minute}, result, "merged result")
+	require.Len(t, iam.ensured, 1, "iam calls")
+	assert.Equal(t, []Host{{Name: "rds:5432", Granted: true, DBIResourceID: "db-RDS"}, {Name: "rds2:5432"}}, iam.ensured[0].Hosts, "iam hosts")
+	require.Len(t, password.ensured, 1, "password calls")
+	assert.Equal(t, []Host{{Name: "plain:5432", Granted: true}}, password.ensured[0].Hosts, "password hosts")
+
+	err = s.RemoveUser(context.Background(), logr.Discard(), Login{RoleName: "iam_developer_user"})
+	assert.EqualError(t, err, "Password authentication: boom")
+	assert.Len(t, iam.removed, 1, "iam should be removed")
+	assert.Len(t, password.removed, 1, "password should be removed")
+}
+
+func TestSelector_EnsureUser_removesUnusedMethods(t *testing.T) {
+	iam := &recorder{roles: []string{RDSIAMRole}}
+	password := &recorder{}
+	s, err := NewSelector(MethodAWSIAM, map[Method]Authenticator{
+		MethodAWSIAM:   iam,
+		MethodPassword: password,
+	}, map[string]HostConfig{
+		"plain:5432": {Method: MethodPassword},
+	})
+	require.NoError(t, err)
+
+	_, err = s.EnsureUser(context.Background(), logr.Discard(), Login{
+		RoleName: "iam_developer_user",
+		Hosts:    []Host{{Name: "plain:5432", Granted: true}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, iam.ensured, "iam should not be ensured without hosts")
+	require.Len(t, iam.removed, 1, "iam should be removed without hosts")
+	assert.Equal(t, "iam_developer_user", iam.removed[0].RoleName, "removed login")
+	assert.Len(t, password.ensured, 1, "password calls")
+	assert.Empty(t, password.removed, "password should not be removed")
+
+	_, err = s.EnsureUser(context.Background(), logr.Discard(), Login{RoleName: "iam_developer_user"})
+	require.NoError(t, err)
+	assert.Len(t, iam.removed, 2, "iam should be removed without any hosts")
+	assert.Len(t, password.removed, 1, "password should be removed without any hosts")
+}
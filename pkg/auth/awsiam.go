@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-logr/logr"
+
+	"go.lunarway.com/postgresql-controller/pkg/iam"
+)
+
+// RDSIAMRole is the role that allows a user to log in to an RDS instance with
+// AWS IAM database authentication.
+const RDSIAMRole = "rds_iam"
+
+// AWSIAM is the Authenticator of MethodAWSIAM. Users are allowed to connect as
+// their role in one of the IAM policies attached to the login roles and are
+// granted RDSIAMRole on the hosts.
+type AWSIAM struct {
+	// Client manages the policies. It is shared by all calls.
+	Client     *iam.Client
+	PolicyName string
+	Region     string
+	AccountID  string
+	LoginRoles []string
+	RolePrefix string
+	// Principal maps user names to their AWS principal. It defaults to
+	// iam.DefaultPrincipal.
+	Principal iam.Principal
+	// PreviousPrincipals are migrated to Principal in existing policies.
+	PreviousPrincipals []iam.Principal
+}
+
+var _ Authenticator = &AWSIAM{}
+
+func (a *AWSIAM) Roles() []string {
+	return []string{RDSIAMRole}
+}
+
+// EnsureUser adds the user to a managed IAM policy allowing it to connect to
+// the RDS instances of the hosts where it has granted accesses. Hosts without a
+// DBIResourceID allow connecting to every instance. Users without granted
+// accesses on any host are removed from the policies.
+func (a *AWSIAM) EnsureUser(_ context.Context, log logr.Logger, login Login) (Result, error) {
+	resourceIDs := dbiResourceIDs(login.Hosts)
+	if len(resourceIDs) == 0 {
+		log.V(1).Info("Removing user from IAM policies as it has no granted accesses")
+		return Result{}, iam.RemoveUser(a.Client, log, a.config(), login.User.Spec.Name)
+	}
+	policyName, err := iam.EnsureUser(a.Client, log, a.config(), login.User.Spec.Name, login.Name, resourceIDs...)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{PolicyName: policyName}, nil
+}
+
+// dbiResourceIDs returns the sorted DbiResourceIds of the RDS instances of
+// hosts with granted accesses. Hosts without one are represented by
+// iam.AllInstances. Failed hosts are included so a failure to synchronize a
+// host does not revoke access to it.
+func dbiResourceIDs(hosts []Host) []string {
+	seen := make(map[string]bool, len(hosts))
+	var resourceIDs []string
+	for _, host := range hosts {
+		if !host.Granted {
+			continue
+		}
+		resourceID := host.DBIResourceID
+		if resourceID == "" {
+			resourceID = iam.AllInstances
+		}
+		if seen[resourceID] {
+			continue
+		}
+		seen[resourceID] = true
+		resourceIDs = append(resourceIDs, resourceID)
+	}
+	sort.Strings(resourceIDs)
+	return resourceIDs
+}
+
+// RemoveUser removes the user from the managed IAM policies.
+func (a *AWSIAM) RemoveUser(_ context.Context, log logr.Logger, login Login) error {
+	return iam.RemoveUser(a.Client, log, a.config(), login.User.Spec.Name)
+}
+
+// config returns the policy configuration. Policies are only limited by the
+// IAM policy size limit.
+func (a *AWSIAM) config() iam.EnsureUserConfig {
+	return iam.EnsureUserConfig{
+		PolicyBaseName:     a.PolicyName,
+		Region:             a.Region,
+		AccountID:          a.AccountID,
+		RolePrefix:         a.RolePrefix,
+		AWSLoginRoles:      a.LoginRoles,
+		Principal:          a.Principal,
+		PreviousPrincipals: a.PreviousPrincipals,
+	}
+}
+
+// Sweep removes statements of users not returned by owners and duplicate
+// statements of a user from the managed IAM policies. With reportOnly the
+// statements are only reported.
+func (a *AWSIAM) Sweep(log logr.Logger, owners func() (map[string]bool, error), reportOnly bool) (iam.SweepResult, error) {
+	return iam.Sweep(a.Client, log, a.config(), owners, reportOnly)
+}
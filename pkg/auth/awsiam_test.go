@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBIResourceIDs(t *testing.T) {
+	assert.Empty(t, dbiResourceIDs([]Host{{Name: "expired:5432", DBIResourceID: "db-EXPIRED"}}), "no granted hosts")
+
+	assert.Equal(t, []string{"db-A", "db-B"}, dbiResourceIDs([]Host{
+		{Name: "b:5432", Granted: true, DBIResourceID: "db-B"},
+		{Name: "a:5432", Granted: true, DBIResourceID: "db-A"},
+		{Name: "failed:5432", Granted: true, Failed: true, DBIResourceID: "db-A"},
+		{Name: "expired:5432", DBIResourceID: "db-EXPIRED"},
+	}), "granted instances")
+
+	assert.Equal(t, []string{"*", "db-A"}, dbiResourceIDs([]Host{
+		{Name: "a:5432", Granted: true, DBIResourceID: "db-A"},
+		{Name: "unknown:5432", Granted: true},
+	}), "hosts without resource id allow every instance")
+}
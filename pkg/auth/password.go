@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
+	"go.lunarway.com/postgresql-controller/pkg/password"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+)
+
+// passwordLength is the length of generated passwords.
+const passwordLength = 32
+
+// Password is the Authenticator of MethodPassword. It generates a password for
+// the role of a user on every host where the user has granted accesses and
+// delivers them in a Secret owned by the PostgreSQLUser.
+//
+// A password expires with the last access on its host if that stops within
+// Validity. Otherwise it expires after Validity and is renewed when half of it
+// has passed.
+type Password struct {
+	Client          client.Client
+	Scheme          *runtime.Scheme
+	HostCredentials *hostcredentials.Registry
+	Validity        time.Duration
+	Now             func() time.Time
+
+	// SetPassword sets the password of a role on a host. It defaults to
+	// postgres.SetRolePassword.
+	SetPassword func(log logr.Logger, host string, adminCredentials postgres.Credentials, name, password string, validUntil time.Time) error
+}
+
+var _ Authenticator = &Password{}
+
+// PasswordSecretName returns the name of the Secret holding the passwords of
+// user.
+func PasswordSecretName(user *lunarwayv1alpha1.PostgreSQLUser) string {
+	return fmt.Sprintf("%s-postgresql-password", user.Name)
+}
+
+// PasswordSecretKeys returns the keys of the password and its expiry in RFC
+// 3339 format of host in the password Secret. Colons are not allowed in keys so
+// the port separator is replaced by an underscore, eg. localhost_5432.password.
+func PasswordSecretKeys(host string) (string, string) {
+	key := strings.ReplaceAll(host, ":", "_")
+	return key + ".password", key + ".validUntil"
+}
+
+func (p *Password) Roles() []string {
+	return nil
+}
+
+// hostPassword is a password to set on a host.
+type hostPassword struct {
+	host       string
+	password   string
+	validUntil time.Time
+}
+
+// EnsureUser makes sure that the password Secret holds a valid password for
+// every host with granted accesses and sets them on the hosts. Passwords of
+// hosts without granted accesses or where the role failed to synchronize are
+// removed from the Secret and left to expire.
+//
+// The Secret is the source of truth of the passwords. It is written before the
+// passwords are set so a failure to set them is recovered on the next call.
+func (p *Password) EnsureUser(ctx context.Context, log logr.Logger, login Login) (Result, error) {
+	if p.Validity <= 0 {
+		return Result{}, fmt.Errorf("password validity must be positive")
+	}
+	now := p.now().Truncate(time.Second)
+	user := login.User
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: user.Namespace,
+			Name:      PasswordSecretName(user),
+		},
+	}
+	var (
+		passwords []hostPassword
+		result    Result
+	)
+	op, err := controllerutil.CreateOrUpdate(ctx, p.Client, secret, func() error {
+		// never take over a Secret created by someone else as that would
+		// overwrite their data.
+		if secret.ResourceVersion != "" && !metav1.IsControlledBy(secret, user) {
+			return ctlerrors.NewInvalid(fmt.Errorf("secret %s exists and is not owned by this resource", secret.Name))
+		}
+		err := controllerutil.SetControllerReference(user, secret, p.Scheme)
+		if err != nil {
+			return fmt.Errorf("set owner: %w", err)
+		}
+
+		passwords = nil
+		result = Result{}
+		data := map[string][]byte{
+			"user": []byte(login.RoleName),
+		}
+		for _, host := range login.Hosts {
+			if !host.Granted || host.Failed {
+				continue
+			}
+			passwordKey, validUntilKey := PasswordSecretKeys(host.Name)
+			pass := string(secret.Data[passwordKey])
+			stored, err := time.Parse(time.RFC3339, string(secret.Data[validUntilKey]))
+			if err != nil {
+				stored = time.Time{}
+			}
+			validUntil, keep := p.validUntil(host, now, stored)
+			if pass == "" || !keep {
+				pass, err = password.Generate(passwordLength)
+				if err != nil {
+					return fmt.Errorf("generate password: %w", err)
+				}
+				log.Info("Generated new password", "host", host.Name, "validUntil", validUntil)
+			}
+			// passwords not aligned with a stop time are renewed when half of
+			// their validity has passed
+			if !validUntil.Equal(host.Stop) {
+				result = result.merge(Result{RequeueAfter: validUntil.Add(-p.Validity / 2).Sub(now)})
+			}
+			data[passwordKey] = []byte(pass)
+			data[validUntilKey] = []byte(validUntil.UTC().Format(time.RFC3339))
+			passwords = append(passwords, hostPassword{
+				host:       host.Name,
+				password:   pass,
+				validUntil: validUntil,
+			})
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = data
+		return nil
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("ensure secret %s: %w", secret.Name, err)
+	}
+	if op != controllerutil.OperationResultNone {
+		log.Info(fmt.Sprintf("Password secret %s", op), "secret", secret.Name)
+	}
+
+	setPassword := p.SetPassword
+	if setPassword == nil {
+		setPassword = postgres.SetRolePassword
+	}
+	var errs error
+	for _, hostPassword := range passwords {
+		credentials, ok := p.HostCredentials.Get(hostPassword.host)
+		if !ok {
+			errs = multierr.Append(errs, fmt.Errorf("no credentials for host '%s'", hostPassword.host))
+			continue
+		}
+		err := setPassword(log.WithValues("host", hostPassword.host), hostPassword.host, credentials, login.RoleName, hostPassword.password, hostPassword.validUntil)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("host %s: %w", hostPassword.host, err))
+		}
+	}
+	return result, errs
+}
+
+// validUntil returns when the password of host must expire and whether a
+// password stored with expiry stored can be kept.
+func (p *Password) validUntil(host Host, now, stored time.Time) (time.Time, bool) {
+	limit := now.Add(p.Validity)
+	if !host.Stop.IsZero() && !host.Stop.After(limit) {
+		return host.Stop, stored.Equal(host.Stop)
+	}
+	keep := stored.After(now.Add(p.Validity/2)) && (host.Stop.IsZero() || !stored.After(host.Stop))
+	if keep {
+		return stored, true
+	}
+	return limit, false
+}
+
+// RemoveUser is a noop. The password Secret is owned by the PostgreSQLUser and
+// garbage collected with it and the role is locked on the hosts by the
+// granter. Passwords of hosts moved to another Method are left to expire.
+func (p *Password) RemoveUser(context.Context, logr.Logger, Login) error {
+	return nil
+}
+
+func (p *Password) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+)
+
+func TestPassword_EnsureUser(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	user := &lunarwayv1alpha1.PostgreSQLUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "user",
+			Namespace: "default",
+			UID:       "user-uid",
+		},
+		Spec: lunarwayv1alpha1.PostgreSQLUserSpec{
+			Name: "user",
+		},
+	}
+	type setPassword struct {
+		host       string
+		password   string
+		validUntil time.Time
+	}
+	setup := func(t *testing.T, objs ...client.Object) (*Password, client.Client, *[]setPassword) {
+		t.Helper()
+		s := runtime.NewScheme()
+		require.NoError(t, clientgoscheme.AddToScheme(s))
+		require.NoError(t, lunarwayv1alpha1.AddToScheme(s))
+		cl := fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+		var set []setPassword
+		return &Password{
+			Client: cl,
+			Scheme: s,
+			HostCredentials: hostcredentials.NewRegistry(map[string]postgres.Credentials{
+				"stops:5432":   {User: "admin"},
+				"endless:5432": {User: "admin"},
+			}),
+			Validity: 12 * time.Hour,
+			Now: func() time.Time {
+				return now
+			},
+			SetPassword: func(_ logr.Logger, host string, _ postgres.Credentials, name, password string, validUntil time.Time) error {
+				assert.Equal(t, "iam_developer_user", name, "role name not as expected")
+				set = append(set, setPassword{host: host, password: password, validUntil: validUntil})
+				return nil
+			},
+		}, cl, &set
+	}
+	getSecret := func(t *testing.T, cl client.Client) *corev1.Secret {
+		t.Helper()
+		var secret corev1.Secret
+		err := cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "user-postgresql-password"}, &secret)
+		require.NoError(t, err)
+		return &secret
+	}
+	stop := now.Add(time.Hour)
+	login := Login{
+		User:     user,
+		Name:     "user",
+		RoleName: "iam_developer_user",
+		Hosts: []Host{
+			{Name: "stops:5432", Granted: true, Stop: stop},
+			{Name: "endless:5432", Granted: true},
+			{Name: "expired:5432"},
+			{Name: "failed:5432", Granted: true, Failed: true},
+		},
+	}
+
+	t.Run("generates passwords", func(t *testing.T) {
+		p, cl, set := setup(t, user)
+
+		result, err := p.EnsureUser(context.Background(), logr.Discard(), login)
+		require.NoError(t, err)
+		assert.Equal(t, 6*time.Hour, result.RequeueAfter, "endless password should be renewed after half its validity")
+
+		secret := getSecret(t, cl)
+		assert.True(t, metav1.IsControlledBy(secret, user), "secret should be owned by the user")
+		require.Len(t, *set, 2, "passwords should be set on granted hosts")
+		assert.Equal(t, setPassword{host: "stops:5432", password: string(secret.Data["stops_5432.password"]), validUntil: stop}, (*set)[0], "password aligned with stop")
+		assert.Equal(t, setPassword{host: "endless:5432", password: string(secret.Data["endless_5432.password"]), validUntil: now.Add(12 * time.Hour)}, (*set)[1], "password valid for validity")
+		assert.Len(t, secret.Data["stops_5432.password"], passwordLength)
+		assert.Equal(t, "2024-01-01T13:00:00Z", string(secret.Data["stops_5432.validUntil"]))
+		assert.Equal(t, "2024-01-02T00:00:00Z", string(secret.Data["endless_5432.validUntil"]))
+		assert.Equal(t, "iam_developer_user", string(secret.Data["user"]))
+		assert.NotContains(t, secret.Data, "expired_5432.password", "hosts without granted accesses should not get a password")
+		assert.NotContains(t, secret.Data, "failed_5432.password", "failed hosts should not get a password")
+
+		// passwords are kept until half the validity has passed
+		now = now.Add(5 * time.Hour)
+		defer func() { now = now.Add(-5 * time.Hour) }()
+		*set = nil
+		result, err = p.EnsureUser(context.Background(), logr.Discard(), login)
+		require.NoError(t, err)
+		assert.Equal(t, time.Hour, result.RequeueAfter, "renewal not as expected")
+		again := getSecret(t, cl)
+		assert.Equal(t, secret.Data, again.Data, "passwords should be kept")
+		assert.Len(t, *set, 2, "passwords should be set again")
+	})
+
+	t.Run("renews passwords", func(t *testing.T) {
+		p, cl, _ := setup(t, user)
+		_, err := p.EnsureUser(context.Background(), logr.Discard(), login)
+		require.NoError(t, err)
+		secret := getSecret(t, cl)
+
+		now = now.Add(7 * time.Hour)
+		defer func() { now = now.Add(-7 * time.Hour) }()
+		extended := login
+		extended.Hosts = []Host{
+			{Name: "stops:5432", Granted: true, Stop: stop.Add(24 * time.Hour)},
+			{Name: "endless:5432", Granted: true},
+		}
+		_, err = p.EnsureUser(context.Background(), logr.Discard(), extended)
+		require.NoError(t, err)
+		renewed := getSecret(t, cl)
+		assert.NotEqual(t, secret.Data["endless_5432.password"], renewed.Data["endless_5432.password"], "endless password should be renewed")
+		assert.NotEqual(t, secret.Data["stops_5432.password"], renewed.Data["stops_5432.password"], "password should be renewed when the stop changes")
+		assert.Equal(t, "2024-01-02T07:00:00Z", string(renewed.Data["stops_5432.validUntil"]), "password should be capped by the validity")
+	})
+
+	t.Run("secret not owned", func(t *testing.T) {
+		p, _, _ := setup(t, user, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "user-postgresql-password"},
+		})
+
+		_, err := p.EnsureUser(context.Background(), logr.Discard(), login)
+		assert.True(t, ctlerrors.IsInvalid(err), "expected an invalid error: %v", err)
+	})
+}
@@ -0,0 +1,143 @@
+// Package customrole validates the functions and grants of custom roles. It has
+// no database dependencies so the API webhooks can apply the same checks as the
+// reconciler.
+package customrole
+
+import (
+	"fmt"
+	"strings"
+
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+)
+
+// Function defines a SECURITY DEFINER function to create in a database.
+type Function struct {
+	// Name is the function name (created in the public schema).
+	Name string
+	// Args is the argument list (e.g. "role_name text"). Empty means no arguments.
+	Args string
+	// Returns is the return type (e.g. "void", "boolean", "TABLE(plan text)").
+	Returns string
+	// OwningRole is the PostgreSQL role that will own the function. If empty,
+	// the database owner is used.
+	OwningRole string
+	// Body is the PL/pgSQL statements (without BEGIN/END).
+	Body string
+}
+
+// allowedTablePrivileges is the set of valid PostgreSQL table-level privilege keywords.
+var allowedTablePrivileges = map[string]struct{}{
+	"SELECT":     {},
+	"INSERT":     {},
+	"UPDATE":     {},
+	"DELETE":     {},
+	"TRUNCATE":   {},
+	"REFERENCES": {},
+	"TRIGGER":    {},
+}
+
+// IsTablePrivilege reports whether p is a recognised PostgreSQL table-level
+// privilege keyword. Comparison is case-sensitive as the catalog reports
+// privileges in upper case.
+func IsTablePrivilege(p string) bool {
+	_, ok := allowedTablePrivileges[p]
+	return ok
+}
+
+// ValidatePrivileges returns an error if privs is empty or contains any value
+// that is not a recognised PostgreSQL table-level privilege keyword.
+// Comparison is case-insensitive.
+func ValidatePrivileges(privs []string) error {
+	if len(privs) == 0 {
+		return ctlerrors.NewInvalid(fmt.Errorf("privileges must not be empty"))
+	}
+	for _, p := range privs {
+		if _, ok := allowedTablePrivileges[strings.ToUpper(p)]; !ok {
+			return ctlerrors.NewInvalid(fmt.Errorf("invalid privilege %q: must be one of SELECT, INSERT, UPDATE, DELETE, TRUNCATE, REFERENCES, TRIGGER", p))
+		}
+	}
+	return nil
+}
+
+// ValidateFunction checks that a Function has the required fields
+// and that its args and return type are safe to interpolate.
+func ValidateFunction(f Function) error {
+	if f.Name == "" {
+		return ctlerrors.NewInvalid(fmt.Errorf("function name must not be empty"))
+	}
+	// "__" is the separator between the role prefix and the function name in the
+	// generated PostgreSQL identifier. Allowing it in the user-supplied name would
+	// break the cleanup query that uses the absence of "__" after the prefix to
+	// distinguish functions owned by this role from those of longer-prefixed roles.
+	if strings.Contains(f.Name, "__") {
+		return ctlerrors.NewInvalid(fmt.Errorf("function %q: name must not contain \"__\"", f.Name))
+	}
+	if f.Returns == "" {
+		return ctlerrors.NewInvalid(fmt.Errorf("function %q: returns must not be empty", f.Name))
+	}
+	if !isSafeArgs(f.Args) {
+		return ctlerrors.NewInvalid(fmt.Errorf("function %q: args contains unsafe SQL characters or unbalanced parentheses", f.Name))
+	}
+	if !isSafeReturns(f.Returns) {
+		return ctlerrors.NewInvalid(fmt.Errorf("function %q: returns contains unsafe SQL characters or spaces outside parentheses", f.Name))
+	}
+	if f.Body == "" {
+		return ctlerrors.NewInvalid(fmt.Errorf("function %q: body must not be empty", f.Name))
+	}
+	return nil
+}
+
+// isSafeArgs reports whether s is safe to interpolate as the argument list of a
+// CREATE FUNCTION statement. A closing parenthesis at depth 0 would escape the
+// argument list, enabling injection. Statement terminators and comment markers
+// are also rejected.
+func isSafeArgs(s string) bool {
+	if strings.ContainsAny(s, ";'") || strings.Contains(s, "--") || strings.Contains(s, "/*") {
+		return false
+	}
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return false
+			}
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+// isSafeReturns reports whether s is safe to interpolate as the RETURNS type
+// expression of a CREATE FUNCTION statement. Spaces outside balanced
+// parentheses could inject extra function options (e.g. "SET search_path TO
+// public" would override the hardcoded search_path). Only a leading "SETOF "
+// prefix is permitted to carry a space outside parentheses.
+func isSafeReturns(s string) bool {
+	if strings.ContainsAny(s, ";'") || strings.Contains(s, "--") || strings.Contains(s, "/*") {
+		return false
+	}
+	remaining := s
+	if strings.HasPrefix(strings.ToUpper(remaining), "SETOF ") {
+		remaining = remaining[6:]
+	}
+	depth := 0
+	for _, r := range remaining {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case ' ', '\t', '\n', '\r':
+			if depth == 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
@@ -0,0 +1,52 @@
+package customrole_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.lunarway.com/postgresql-controller/pkg/customrole"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+)
+
+func TestValidatePrivileges(t *testing.T) {
+	assert.NoError(t, customrole.ValidatePrivileges([]string{"select", "INSERT"}))
+
+	err := customrole.ValidatePrivileges(nil)
+	assert.True(t, ctlerrors.IsInvalid(err), "empty privileges: %v", err)
+
+	err = customrole.ValidatePrivileges([]string{"SELECT", "ALL"})
+	assert.True(t, ctlerrors.IsInvalid(err), "unknown privilege: %v", err)
+}
+
+func TestValidateFunction(t *testing.T) {
+	valid := customrole.Function{
+		Name:    "reset_plan",
+		Args:    "role_name text, opts numeric(10, 2)",
+		Returns: "SETOF TABLE(plan text)",
+		Body:    "RETURN;",
+	}
+	assert.NoError(t, customrole.ValidateFunction(valid))
+
+	tt := []struct {
+		name   string
+		modify func(f *customrole.Function)
+	}{
+		{"empty name", func(f *customrole.Function) { f.Name = "" }},
+		{"name with separator", func(f *customrole.Function) { f.Name = "reset__plan" }},
+		{"empty returns", func(f *customrole.Function) { f.Returns = "" }},
+		{"empty body", func(f *customrole.Function) { f.Body = "" }},
+		{"args escaping the list", func(f *customrole.Function) { f.Args = "a text) RETURNS void AS $$ $$; --" }},
+		{"args with unbalanced parentheses", func(f *customrole.Function) { f.Args = "a numeric(10" }},
+		{"returns with options", func(f *customrole.Function) { f.Returns = "void SET search_path TO public" }},
+		{"returns with comment", func(f *customrole.Function) { f.Returns = "void/*" }},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f := valid
+			tc.modify(&f)
+			err := customrole.ValidateFunction(f)
+			assert.True(t, ctlerrors.IsInvalid(err), "expected an invalid error but got: %v", err)
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/go-logr/logr"
 	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
 	"go.lunarway.com/postgresql-controller/pkg/kube"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 	"go.uber.org/multierr"
@@ -20,9 +21,59 @@ type Granter struct {
 	AllUsers                 func(namespace string) ([]lunarwayv1alpha1.PostgreSQLUser, error)
 	ResourceResolver         func(resource lunarwayv1alpha1.ResourceVar, namespace string) (string, error)
 
-	StaticRoles     []string
-	HostCredentials map[string]postgres.Credentials
+	StaticRoles []string
+	// HostRoles returns roles granted to users on a host in addition to
+	// StaticRoles, eg. the roles required by the authentication of the host. It
+	// may be nil.
+	HostRoles       func(host string) []string
+	HostCredentials *hostcredentials.Registry
 	Now             func() time.Time
+
+	// DeletionPolicy controls how the roles of deleted users are removed. It
+	// defaults to UserDeletionPolicyRevokeLogin.
+	DeletionPolicy UserDeletionPolicy
+	// DeletionReassignRole receives the objects owned by dropped roles. The
+	// connecting user of the host is used if it is empty.
+	DeletionReassignRole string
+	// SessionTermination controls whether open sessions of a user are
+	// terminated after roles are revoked from it. Sessions are never
+	// terminated if it is empty.
+	SessionTermination SessionTermination
+
+	// ReadParameters are runtime parameters set on users in each database
+	// they have read access to, eg. default_transaction_read_only=on.
+	ReadParameters postgres.Parameters
+	// WriteParameters are runtime parameters set on users in each database
+	// they have write access to. They replace ReadParameters in these
+	// databases. The settings of users in databases are left untouched if
+	// both ReadParameters and WriteParameters are empty.
+	WriteParameters postgres.Parameters
+}
+
+// userRoles returns the static and host specific roles granted to users on
+// host without duplicates.
+func (g *Granter) userRoles(host string) []string {
+	roles := g.StaticRoles
+	if g.HostRoles != nil {
+		roles = append(append([]string(nil), roles...), g.HostRoles(host)...)
+	}
+	var unique []string
+	for _, role := range roles {
+		if role == "" || contains(unique, role) {
+			continue
+		}
+		unique = append(unique, role)
+	}
+	return unique
+}
+
+func contains(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
 
 // HostAccess represents a map of read and write access requests on host names
@@ -35,47 +86,49 @@ type ReadWriteAccess struct {
 	Access   lunarwayv1alpha1.AccessSpec
 }
 
-func (g *Granter) groupAccesses(log logr.Logger, namespace string, reads []lunarwayv1alpha1.AccessSpec, writes []lunarwayv1alpha1.WriteAccessSpec) (HostAccess, error) {
+func (g *Granter) groupAccesses(log logr.Logger, namespace string, reads []lunarwayv1alpha1.AccessSpec, writes []lunarwayv1alpha1.WriteAccessSpec) (HostAccess, []lunarwayv1alpha1.PostgreSQLUserAccessStatus, error) {
 	if len(reads) == 0 && len(writes) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	hosts := make(HostAccess)
+	var statuses []lunarwayv1alpha1.PostgreSQLUserAccessStatus
 	var errs error
-	err := g.groupReadsByHosts(log, hosts, namespace, reads)
+	err := g.groupReadsByHosts(log, hosts, &statuses, namespace, reads)
 	if err != nil {
 		errs = multierr.Append(errs, err)
 	}
-	err = g.groupWritesByHosts(log, hosts, namespace, writes)
+	err = g.groupWritesByHosts(log, hosts, &statuses, namespace, writes)
 	if err != nil {
 		errs = multierr.Append(errs, err)
 	}
 
 	if len(hosts) == 0 {
-		return nil, errs
+		return nil, statuses, errs
 	}
-	return hosts, errs
+	return hosts, statuses, errs
 }
 
 // groupReadsByHosts groups accesses by host setting read privilege an all
 // resolved HostAccess instances.
-func (g *Granter) groupReadsByHosts(log logr.Logger, hosts HostAccess, namespace string, accesses []lunarwayv1alpha1.AccessSpec) error {
-	return g.groupByHosts(log, hosts, namespace, accesses, func(_ int) postgres.Privilege { return postgres.PrivilegeRead }, g.AllDatabasesReadEnabled)
+func (g *Granter) groupReadsByHosts(log logr.Logger, hosts HostAccess, statuses *[]lunarwayv1alpha1.PostgreSQLUserAccessStatus, namespace string, accesses []lunarwayv1alpha1.AccessSpec) error {
+	privilegeLookup := func(_ int) (postgres.Privilege, string) { return postgres.PrivilegeRead, "" }
+	return g.groupByHosts(log, hosts, statuses, namespace, accesses, privilegeLookup, g.AllDatabasesReadEnabled)
 }
 
 // groupWritesByHosts groups accesses by host setting write or owningWrite
 // privilege an all resolved HostAccess instances based on the Extended field of
-// WriteAccessSpec.
-func (g *Granter) groupWritesByHosts(log logr.Logger, hosts HostAccess, namespace string, accesses []lunarwayv1alpha1.WriteAccessSpec) error {
-	privilegeLookup := func(i int) postgres.Privilege {
+// WriteAccessSpec. Extended writes are skipped if they are not enabled.
+func (g *Granter) groupWritesByHosts(log logr.Logger, hosts HostAccess, statuses *[]lunarwayv1alpha1.PostgreSQLUserAccessStatus, namespace string, accesses []lunarwayv1alpha1.WriteAccessSpec) error {
+	privilegeLookup := func(i int) (postgres.Privilege, string) {
 		if accesses[i].Extended {
 			if g.ExtendedWritesEnabled {
-				return postgres.PrivilegeOwningWrite
+				return postgres.PrivilegeOwningWrite, ""
 			}
-			log.WithValues("spec", accesses[i]).Info("Skipping access spec: extended writes not enabled")
+			return postgres.PrivilegeOwningWrite, "Extended writes are not enabled"
 		}
-		return postgres.PrivilegeWrite
+		return postgres.PrivilegeWrite, ""
 	}
-	return g.groupByHosts(log, hosts, namespace, mapToAccessSpec(accesses), privilegeLookup, g.AllDatabasesWriteEnabled)
+	return g.groupByHosts(log, hosts, statuses, namespace, mapToAccessSpec(accesses), privilegeLookup, g.AllDatabasesWriteEnabled)
 }
 
 func mapToAccessSpec(accesses []lunarwayv1alpha1.WriteAccessSpec) []lunarwayv1alpha1.AccessSpec {
@@ -88,63 +141,108 @@ func mapToAccessSpec(accesses []lunarwayv1alpha1.WriteAccessSpec) []lunarwayv1al
 
 // groupByHosts groups accesses by host setting the ReadWriteAccess privilege
 // according to the result of func privilegeLookup. The index integer i provided
-// in the lookup function is the index of slice accesses being processed.
-func (g *Granter) groupByHosts(log logr.Logger, hosts HostAccess, namespace string, accesses []lunarwayv1alpha1.AccessSpec, privilegeLookup func(i int) postgres.Privilege, allDatabasesEnabled bool) error {
+// in the lookup function is the index of slice accesses being processed. The
+// lookup function can return a reason to skip the access that is reported in
+// the access status. The host of a skipped access is synchronized to revoke
+// the access if it was granted before.
+//
+// The outcome of every access is appended to statuses. Accesses grouped on a
+// host are reported as granted as the actual grant happens later on.
+func (g *Granter) groupByHosts(log logr.Logger, hosts HostAccess, statuses *[]lunarwayv1alpha1.PostgreSQLUserAccessStatus, namespace string, accesses []lunarwayv1alpha1.AccessSpec, privilegeLookup func(i int) (postgres.Privilege, string), allDatabasesEnabled bool) error {
 	var errs error
 	for i, access := range accesses {
-		privilege := privilegeLookup(i)
+		privilege, skipReason := privilegeLookup(i)
 		reqLogger := log.WithValues("spec", access, "privilege", privilege)
+		status := lunarwayv1alpha1.PostgreSQLUserAccessStatus{
+			Host:         access.Host.Value,
+			Database:     access.Database.Value,
+			Schema:       access.Schema.Value,
+			AllDatabases: access.AllDatabases != nil && *access.AllDatabases,
+			Privilege:    privilege.String(),
+			Reason:       access.Reason,
+		}
+		report := func(phase lunarwayv1alpha1.PostgreSQLUserAccessPhase, message string) {
+			status.Phase = phase
+			status.Message = message
+			*statuses = append(*statuses, status)
+		}
 
 		// access it not requested to be granted yet
 		if !access.Start.IsZero() && g.Now().Before(access.Start.Time) {
 			reqLogger.V(1).Info("Skipping access spec: start time is in the future")
+			report(lunarwayv1alpha1.PostgreSQLUserAccessPhasePending, fmt.Sprintf("Access starts at %s", access.Start.UTC().Format(time.RFC3339)))
 			continue
 		}
 		// access request has expired
 		if !access.Stop.IsZero() && g.Now().After(access.Stop.Time) {
 			reqLogger.V(1).Info("Skipping access spec: stop time is in the past")
+			report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseExpired, fmt.Sprintf("Access stopped at %s", access.Stop.UTC().Format(time.RFC3339)))
+			g.keepHost(reqLogger, hosts, namespace, access)
 			continue
 		}
 		host, err := g.ResourceResolver(access.Host, namespace)
 		if err != nil {
-			errs = multierr.Append(errs, fmt.Errorf("resolve host: %w", &AccessError{
+			err = fmt.Errorf("resolve host: %w", &AccessError{
 				Access: accesses[i],
 				Err:    err,
-			}))
+			})
+			errs = multierr.Append(errs, err)
+			report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed, err.Error())
 			continue
 		}
+		status.Host = host
 		reqLogger = reqLogger.WithValues("host", host)
+		if skipReason != "" {
+			reqLogger.V(1).Info(fmt.Sprintf("Skipping access spec: %s", skipReason))
+			report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseSkipped, skipReason)
+			if _, ok := hosts[host]; !ok {
+				hosts[host] = nil
+			}
+			continue
+		}
 		if access.AllDatabases != nil && *access.AllDatabases {
 			if !allDatabasesEnabled {
 				reqLogger.V(1).Info("Skipping access spec: allDatabases feature not enabled")
+				report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseSkipped, "The allDatabases feature is not enabled")
 				continue
 			}
 			reqLogger.V(1).Info("Grouping access for all databases on host")
+			databaseCount := len(hosts[host])
 			err := g.groupAllDatabasesByHost(reqLogger, hosts, host, namespace, access, privilege)
 			if err != nil {
-				errs = multierr.Append(errs, fmt.Errorf("all databases: %w", &AccessError{
+				err = fmt.Errorf("all databases: %w", &AccessError{
 					Access: accesses[i],
 					Err:    err,
-				}))
+				})
+				errs = multierr.Append(errs, err)
+				report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed, err.Error())
+				continue
 			}
+			report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted, fmt.Sprintf("Access covers %d databases", len(hosts[host])-databaseCount))
 			continue
 		}
 		database, err := g.ResourceResolver(access.Database, namespace)
 		if err != nil {
-			errs = multierr.Append(errs, fmt.Errorf("resolve database: %w", &AccessError{
+			err = fmt.Errorf("resolve database: %w", &AccessError{
 				Access: accesses[i],
 				Err:    err,
-			}))
+			})
+			errs = multierr.Append(errs, err)
+			report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed, err.Error())
 			continue
 		}
+		status.Database = database
 		schema, err := g.ResourceResolver(access.Schema, namespace)
 		if err != nil {
-			errs = multierr.Append(errs, fmt.Errorf("resolve schema: %w", &AccessError{
+			err = fmt.Errorf("resolve schema: %w", &AccessError{
 				Access: accesses[i],
 				Err:    err,
-			}))
+			})
+			errs = multierr.Append(errs, err)
+			report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed, err.Error())
 			continue
 		}
+		status.Schema = schema
 		hosts[host] = append(hosts[host], ReadWriteAccess{
 			Host: host,
 			Database: postgres.DatabaseSchema{
@@ -154,10 +252,25 @@ func (g *Granter) groupByHosts(log logr.Logger, hosts HostAccess, namespace stri
 			},
 			Access: accesses[i],
 		})
+		report(lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted, "")
 	}
 	return errs
 }
 
+// keepHost adds the host of an access that is not granted to hosts without any
+// accesses. This makes sure roles are synchronized on the host so the roles of
+// an expired access are revoked even if the user has no other access to it.
+func (g *Granter) keepHost(log logr.Logger, hosts HostAccess, namespace string, access lunarwayv1alpha1.AccessSpec) {
+	host, err := g.ResourceResolver(access.Host, namespace)
+	if err != nil {
+		log.V(1).Info(fmt.Sprintf("Could not resolve host of access spec: %v", err))
+		return
+	}
+	if _, ok := hosts[host]; !ok {
+		hosts[host] = nil
+	}
+}
+
 // groupAllDatabasesByHost groups read write accesses for all known databases in the hosts access map.
 func (g *Granter) groupAllDatabasesByHost(reqLogger logr.Logger, hosts HostAccess, host string, namespace string, access lunarwayv1alpha1.AccessSpec, privilege postgres.Privilege) error {
 	databases, err := g.AllDatabases(namespace)
@@ -193,16 +306,20 @@ func (g *Granter) groupAllDatabasesByHost(reqLogger logr.Logger, hosts HostAcces
 		if schema == "" {
 			schema = database
 		}
-		reqLogger.V(1).Info(fmt.Sprintf("Resolved database '%s' with schema '%s'", database, schema))
-		hosts[host] = append(hosts[host], ReadWriteAccess{
-			Host: host,
-			Database: postgres.DatabaseSchema{
-				Name:       database,
-				Schema:     schema,
-				Privileges: privilege,
-			},
-			Access: access,
-		})
+		reqLogger.V(1).Info(fmt.Sprintf("Resolved database '%s' with schema '%s'", database, schema), "schemas", databaseResource.Spec.Schemas)
+		// additional schemas of the database are covered as well
+		schemas := append([]string{schema}, databaseResource.Spec.Schemas...)
+		for _, schema := range schemas {
+			hosts[host] = append(hosts[host], ReadWriteAccess{
+				Host: host,
+				Database: postgres.DatabaseSchema{
+					Name:       database,
+					Schema:     schema,
+					Privileges: privilege,
+				},
+				Access: access,
+			})
+		}
 	}
 	if errs != nil {
 		return errs
@@ -231,3 +348,19 @@ func (err *AccessError) Error() string {
 func (err *AccessError) Unwrap() error {
 	return err.Err
 }
+
+// HostError is an error related to a single host.
+type HostError struct {
+	Host string
+	Err  error
+}
+
+var _ error = &HostError{}
+
+func (err *HostError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *HostError) Unwrap() error {
+	return err.Err
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
 	"go.lunarway.com/postgresql-controller/pkg/kube"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 	"go.lunarway.com/postgresql-controller/test"
@@ -167,7 +168,7 @@ func TestGranter_groupAccesses(t *testing.T) {
 				ExtendedWritesEnabled: true,
 			}
 
-			output, err := r.groupAccesses(logger, "namespace", tc.reads, tc.writes)
+			output, _, err := r.groupAccesses(logger, "namespace", tc.reads, tc.writes)
 
 			assert.NoError(t, err, "unexpected output error")
 			assert.Equal(t, tc.output, output, "output map not as expected")
@@ -226,6 +227,8 @@ func TestGranter_groupAccesses_startStopHandling(t *testing.T) {
 		name   string
 		access lunarwayv1alpha1.AccessSpec
 		output *ReadWriteAccess
+		// keptHost is set if the host is kept without accesses
+		keptHost bool
 	}{
 		{
 			name:   "read starting in the future",
@@ -238,9 +241,10 @@ func TestGranter_groupAccesses_startStopHandling(t *testing.T) {
 			output: access(past1Hour, future1Hour),
 		},
 		{
-			name:   "read started and ends in the past",
-			access: accessSpec(past2Hours, past1Hour),
-			output: nil,
+			name:     "read started and ends in the past",
+			access:   accessSpec(past2Hours, past1Hour),
+			output:   nil,
+			keptHost: true,
 		},
 		{
 			name:   "empty start time",
@@ -269,7 +273,7 @@ func TestGranter_groupAccesses_startStopHandling(t *testing.T) {
 				},
 			}
 
-			output, err := r.groupAccesses(logger, "namespace", []lunarwayv1alpha1.AccessSpec{tc.access}, nil)
+			output, _, err := r.groupAccesses(logger, "namespace", []lunarwayv1alpha1.AccessSpec{tc.access}, nil)
 
 			assert.NoError(t, err, "unexpected output error")
 			var hostAccess HostAccess
@@ -280,6 +284,11 @@ func TestGranter_groupAccesses_startStopHandling(t *testing.T) {
 					},
 				}
 			}
+			if tc.keptHost {
+				hostAccess = HostAccess{
+					host: nil,
+				}
+			}
 			assert.Equal(t, hostAccess, output, "output map not as expected")
 		})
 	}
@@ -442,6 +451,29 @@ func TestGranter_groupAccesses_withAllDatabases(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "allDatabases read with additional schemas",
+			databases: func() []lunarwayv1alpha1.PostgreSQLDatabase {
+				d := database("host1:5432", "database")
+				d.Spec.Schemas = []string{"billing", "audit"}
+				return []lunarwayv1alpha1.PostgreSQLDatabase{d}
+			}(),
+			reads: []lunarwayv1alpha1.AccessSpec{
+				spec("host1:5432", "I am a developer"),
+			},
+			writes: nil,
+			output: HostAccess{
+				"host1:5432": func() []ReadWriteAccess {
+					var accesses []ReadWriteAccess
+					for _, schema := range []string{"user", "billing", "audit"} {
+						a := access("host1:5432", "database", postgres.PrivilegeRead, "I am a developer")
+						a.Database.Schema = schema
+						accesses = append(accesses, a)
+					}
+					return accesses
+				}(),
+			},
+		},
 		{
 			name: "database in invalid phase",
 			databases: []lunarwayv1alpha1.PostgreSQLDatabase{
@@ -482,7 +514,7 @@ func TestGranter_groupAccesses_withAllDatabases(t *testing.T) {
 				},
 			}
 
-			output, err := r.groupAccesses(logger, "namespace", tc.reads, tc.writes)
+			output, _, err := r.groupAccesses(logger, "namespace", tc.reads, tc.writes)
 
 			assert.NoError(t, err, "unexpected output error")
 			assert.Equal(t, tc.output, output, "output map not as expected")
@@ -597,7 +629,7 @@ func TestGranter_groupAccesses_allDatabasesFeatureFlags(t *testing.T) {
 				},
 			}
 
-			output, err := r.groupAccesses(logger, "namespace", tc.reads, tc.writes)
+			output, _, err := r.groupAccesses(logger, "namespace", tc.reads, tc.writes)
 
 			assert.NoError(t, err, "unexpected output error")
 			assert.Equal(t, tc.output, output, "output map not as expected")
@@ -712,7 +744,7 @@ func TestGranter_groupAccesses_mixedSpecs(t *testing.T) {
 				},
 			}
 
-			output, err := r.groupAccesses(logger, "namespace", tc.reads, tc.writes)
+			output, _, err := r.groupAccesses(logger, "namespace", tc.reads, tc.writes)
 
 			assert.NoError(t, err, "unexpected output error")
 			assert.Equal(t, tc.output, output, "output map not as expected")
@@ -760,7 +792,7 @@ func TestGranter_groupAccesses_errors(t *testing.T) {
 			return r.Value, fmt.Errorf("no value")
 		},
 	}
-	output, err := r.groupAccesses(logger, "namespace", reads, nil)
+	output, _, err := r.groupAccesses(logger, "namespace", reads, nil)
 
 	assert.EqualError(t, err, expectedError, "output error not as exepcted")
 	assert.Equal(t, HostAccess(nil), output, "output map not as expected")
@@ -850,7 +882,7 @@ func TestGranter_connectToHosts(t *testing.T) {
 
 			r := Granter{
 				Now:             time.Now,
-				HostCredentials: tc.credentials,
+				HostCredentials: hostcredentials.NewRegistry(tc.credentials),
 			}
 
 			// act
@@ -962,7 +994,7 @@ func TestGranter_groupAccesses_partialErrors(t *testing.T) {
 					return r.Value, nil
 				},
 			}
-			output, err := r.groupAccesses(logger, "namespace", tc.reads, nil)
+			output, _, err := r.groupAccesses(logger, "namespace", tc.reads, nil)
 
 			if tc.err != nil {
 				assert.EqualError(t, err, tc.err.Error(), "output error not as exepcted")
@@ -1039,8 +1071,159 @@ func TestGranter_groupAccesses_noUserSchemaFallback_allDatabases(t *testing.T) {
 			return r.Value, nil
 		},
 	}
-	output, err := r.groupAccesses(logger, "namespace", reads, nil)
+	output, _, err := r.groupAccesses(logger, "namespace", reads, nil)
 
 	assert.NoError(t, err, "unexpected output error")
 	assert.Equal(t, expectedHostAccesses, output, "output map not as expected")
 }
+
+// TestGranter_groupAccesses_statuses tests that groupAccesses reports the
+// outcome of every access request.
+func TestGranter_groupAccesses_statuses(t *testing.T) {
+	var (
+		now         = time.Date(2020, 4, 30, 13, 0, 0, 0, time.UTC)
+		past1Hour   = v1.NewTime(now.Add(-1 * time.Hour))
+		future1Hour = v1.NewTime(now.Add(1 * time.Hour))
+	)
+	spec := func(host, database, reason string) lunarwayv1alpha1.AccessSpec {
+		return lunarwayv1alpha1.AccessSpec{
+			Host: lunarwayv1alpha1.ResourceVar{
+				Value: host,
+			},
+			Database: lunarwayv1alpha1.ResourceVar{
+				Value: database,
+			},
+			Schema: lunarwayv1alpha1.ResourceVar{
+				Value: database,
+			},
+			Reason: reason,
+		}
+	}
+	pending := spec("host1:5432", "pending", "Pending")
+	pending.Start = &future1Hour
+	expired := spec("host1:5432", "expired", "Expired")
+	expired.Stop = &past1Hour
+	allDatabases := lunarwayv1alpha1.AccessSpec{
+		Host: lunarwayv1alpha1.ResourceVar{
+			Value: "host1:5432",
+		},
+		AllDatabases: &trueValue,
+		Reason:       "All databases",
+	}
+	reads := []lunarwayv1alpha1.AccessSpec{
+		spec("host1:5432", "granted", "Granted"),
+		pending,
+		expired,
+		spec("unknown", "failed", "Failed"),
+		allDatabases,
+	}
+	writes := []lunarwayv1alpha1.WriteAccessSpec{
+		{
+			AccessSpec: spec("host1:5432", "extended", "Extended"),
+			Extended:   true,
+		},
+	}
+	r := Granter{
+		Now: func() time.Time {
+			return now
+		},
+		ResourceResolver: func(r lunarwayv1alpha1.ResourceVar, ns string) (string, error) {
+			if r.Value == "unknown" {
+				return "", errors.New("unknown host")
+			}
+			return r.Value, nil
+		},
+		AllDatabases: func(namespace string) ([]lunarwayv1alpha1.PostgreSQLDatabase, error) {
+			t.Fatalf("allDatabases was not expected to be used")
+			return nil, nil
+		},
+	}
+
+	hosts, statuses, err := r.groupAccesses(test.NewLogger(t), "namespace", reads, writes)
+
+	assert.EqualError(t, err, "resolve host: access to host unknown: unknown host", "output error not as expected")
+	assert.Equal(t, HostAccess{
+		"host1:5432": []ReadWriteAccess{
+			{
+				Host: "host1:5432",
+				Database: postgres.DatabaseSchema{
+					Name:       "granted",
+					Schema:     "granted",
+					Privileges: postgres.PrivilegeRead,
+				},
+				Access: reads[0],
+			},
+		},
+	}, hosts, "skipped extended writes should not be granted")
+	assert.Equal(t, []lunarwayv1alpha1.PostgreSQLUserAccessStatus{
+		{
+			Host:      "host1:5432",
+			Database:  "granted",
+			Schema:    "granted",
+			Privilege: "read",
+			Reason:    "Granted",
+			Phase:     lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted,
+		},
+		{
+			Host:      "host1:5432",
+			Database:  "pending",
+			Schema:    "pending",
+			Privilege: "read",
+			Reason:    "Pending",
+			Phase:     lunarwayv1alpha1.PostgreSQLUserAccessPhasePending,
+			Message:   "Access starts at 2020-04-30T14:00:00Z",
+		},
+		{
+			Host:      "host1:5432",
+			Database:  "expired",
+			Schema:    "expired",
+			Privilege: "read",
+			Reason:    "Expired",
+			Phase:     lunarwayv1alpha1.PostgreSQLUserAccessPhaseExpired,
+			Message:   "Access stopped at 2020-04-30T12:00:00Z",
+		},
+		{
+			Host:      "unknown",
+			Database:  "failed",
+			Schema:    "failed",
+			Privilege: "read",
+			Reason:    "Failed",
+			Phase:     lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed,
+			Message:   "resolve host: access to host unknown: unknown host",
+		},
+		{
+			Host:         "host1:5432",
+			AllDatabases: true,
+			Privilege:    "read",
+			Reason:       "All databases",
+			Phase:        lunarwayv1alpha1.PostgreSQLUserAccessPhaseSkipped,
+			Message:      "The allDatabases feature is not enabled",
+		},
+		{
+			Host:      "host1:5432",
+			Database:  "extended",
+			Schema:    "extended",
+			Privilege: "owningwrite",
+			Reason:    "Extended",
+			Phase:     lunarwayv1alpha1.PostgreSQLUserAccessPhaseSkipped,
+			Message:   "Extended writes are not enabled",
+		},
+	}, statuses, "statuses not as expected")
+}
+
+func TestGranter_userRoles(t *testing.T) {
+	g := Granter{
+		StaticRoles: []string{"", "iam_developer", "rds_iam"},
+		HostRoles: func(host string) []string {
+			if host == "rds:5432" {
+				return []string{"rds_iam"}
+			}
+			return nil
+		},
+	}
+
+	assert.Equal(t, []string{"iam_developer", "rds_iam"}, g.userRoles("rds:5432"), "rds host")
+	assert.Equal(t, []string{"iam_developer", "rds_iam"}, g.userRoles("plain:5432"), "plain host")
+	assert.Equal(t, []string{"rds_iam"}, (&Granter{HostRoles: g.HostRoles}).userRoles("rds:5432"), "host roles only")
+	assert.Empty(t, (&Granter{}).userRoles("plain:5432"), "no roles")
+}
@@ -0,0 +1,103 @@
+package grants
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+	"go.uber.org/multierr"
+)
+
+// UserDeletionPolicy controls what happens to the role of a PostgreSQLUser on
+// the hosts when it is deleted.
+type UserDeletionPolicy string
+
+const (
+	// UserDeletionPolicyRevokeLogin revokes the managed memberships and the
+	// login privilege of the role and terminates its sessions. The role is kept
+	// on the hosts.
+	UserDeletionPolicyRevokeLogin UserDeletionPolicy = "RevokeLogin"
+	// UserDeletionPolicyDrop revokes access like UserDeletionPolicyRevokeLogin,
+	// reassigns objects owned by the role and drops it.
+	UserDeletionPolicyDrop UserDeletionPolicy = "Drop"
+)
+
+// ParseUserDeletionPolicy parses s as a UserDeletionPolicy.
+func ParseUserDeletionPolicy(s string) (UserDeletionPolicy, error) {
+	switch policy := UserDeletionPolicy(s); policy {
+	case UserDeletionPolicyRevokeLogin, UserDeletionPolicyDrop:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown user deletion policy '%s': must be one of %s or %s", s, UserDeletionPolicyRevokeLogin, UserDeletionPolicyDrop)
+	}
+}
+
+// RemoveUser removes the database access of a deleted PostgreSQL user on every
+// host recorded in its status according to the DeletionPolicy of the Granter.
+// Hosts where the role does not exist are skipped.
+//
+// Every host is attempted even if some fail. The returned error contains a
+// HostError for every failed host, including hosts whose credentials are not
+// registered, eg. right after a restart of the controller, so the removal is
+// retried.
+func (g *Granter) RemoveUser(log logr.Logger, rolePrefix string, user lunarwayv1alpha1.PostgreSQLUser) error {
+	roleName := fmt.Sprintf("%s%s", rolePrefix, user.Spec.Name)
+	policy := g.DeletionPolicy
+	if policy == "" {
+		policy = UserDeletionPolicyRevokeLogin
+	}
+	log = log.WithValues("role", roleName, "deletionPolicy", policy)
+	log.Info(fmt.Sprintf("Removing user %s", roleName))
+
+	var errs error
+	for _, host := range userHosts(user) {
+		credentials, ok := g.HostCredentials.Get(host)
+		if !ok {
+			errs = multierr.Append(errs, &HostError{
+				Host: host,
+				Err:  fmt.Errorf("no credentials for host '%s'", host),
+			})
+			continue
+		}
+		var err error
+		switch policy {
+		case UserDeletionPolicyRevokeLogin:
+			err = postgres.LockRole(log.WithValues("host", host), host, credentials, roleName, g.userRoles(host))
+		case UserDeletionPolicyDrop:
+			err = postgres.DropRole(log.WithValues("host", host), host, credentials, roleName, g.userRoles(host), g.DeletionReassignRole)
+		default:
+			return fmt.Errorf("unknown user deletion policy '%s'", policy)
+		}
+		if err != nil {
+			errs = multierr.Append(errs, &HostError{
+				Host: host,
+				Err:  fmt.Errorf("host %s: %w", host, err),
+			})
+		}
+	}
+	return errs
+}
+
+// userHosts returns the sorted hosts recorded in the status of user, ie. the
+// hosts where the user had access.
+func userHosts(user lunarwayv1alpha1.PostgreSQLUser) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	add := func(host string) {
+		if host == "" || seen[host] {
+			return
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	for _, host := range user.Status.Hosts {
+		add(host.Host)
+	}
+	for _, access := range user.Status.Accesses {
+		add(access.Host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
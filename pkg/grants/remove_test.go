@@ -0,0 +1,55 @@
+package grants
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.lunarway.com/postgresql-controller/pkg/hostcredentials"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+	"go.lunarway.com/postgresql-controller/test"
+)
+
+func TestUserHosts(t *testing.T) {
+	user := lunarwayv1alpha1.PostgreSQLUser{
+		Status: lunarwayv1alpha1.PostgreSQLUserStatus{
+			Hosts: []lunarwayv1alpha1.PostgreSQLUserHostStatus{
+				{Host: "b:5432", Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted},
+				{Host: "a:5432", Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed},
+			},
+			Accesses: []lunarwayv1alpha1.PostgreSQLUserAccessStatus{
+				{Host: "a:5432", Privilege: "read"},
+				{Host: "c:5432", Privilege: "write"},
+				{Privilege: "read", Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed},
+			},
+		},
+	}
+	assert.Equal(t, []string{"a:5432", "b:5432", "c:5432"}, userHosts(user))
+	assert.Empty(t, userHosts(lunarwayv1alpha1.PostgreSQLUser{}), "user without status")
+}
+
+func TestGranter_RemoveUser_unknownCredentials(t *testing.T) {
+	log := test.SetLogger(t)
+	granter := Granter{
+		// the unreachable host was never used by the user so it must not be
+		// touched
+		HostCredentials: hostcredentials.NewRegistry(map[string]postgres.Credentials{
+			"unreachable:5432": {User: "admin"},
+		}),
+	}
+	user := lunarwayv1alpha1.PostgreSQLUser{
+		Spec: lunarwayv1alpha1.PostgreSQLUserSpec{Name: "alice"},
+		Status: lunarwayv1alpha1.PostgreSQLUserStatus{
+			Hosts: []lunarwayv1alpha1.PostgreSQLUserHostStatus{
+				{Host: "unregistered:5432", Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted},
+			},
+		},
+	}
+
+	err := granter.RemoveUser(log, "iam_developer_", user)
+	assert.EqualError(t, err, "no credentials for host 'unregistered:5432'")
+	var hostErr *HostError
+	if assert.ErrorAs(t, err, &hostErr) {
+		assert.Equal(t, "unregistered:5432", hostErr.Host, "host of error")
+	}
+}
@@ -0,0 +1,80 @@
+package grants
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+)
+
+// SessionTermination controls whether the open sessions of a user are
+// terminated when roles are revoked from it. A revoke does not affect a running
+// session that already uses the revoked privileges.
+type SessionTermination string
+
+const (
+	// SessionTerminationNever never terminates sessions.
+	SessionTerminationNever SessionTermination = "Never"
+	// SessionTerminationWrite terminates sessions when a write or owning write
+	// role is revoked, eg. when a write access expires.
+	SessionTerminationWrite SessionTermination = "Write"
+	// SessionTerminationAny terminates sessions when any role is revoked.
+	SessionTerminationAny SessionTermination = "Any"
+)
+
+// ParseSessionTermination parses s as a SessionTermination.
+func ParseSessionTermination(s string) (SessionTermination, error) {
+	switch termination := SessionTermination(s); termination {
+	case SessionTerminationNever, SessionTerminationWrite, SessionTerminationAny:
+		return termination, nil
+	default:
+		return "", fmt.Errorf("unknown session termination '%s': must be one of %s, %s or %s", s, SessionTerminationNever, SessionTerminationWrite, SessionTerminationAny)
+	}
+}
+
+// terminates reports whether sessions must be terminated after revoking
+// revoked.
+func (t SessionTermination) terminates(revoked []string) bool {
+	switch t {
+	case SessionTerminationAny:
+		return len(revoked) != 0
+	case SessionTerminationWrite:
+		for _, role := range revoked {
+			if postgres.IsWriteRole(role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TerminatedSessions describes sessions of a user terminated on a host after
+// roles were revoked.
+type TerminatedSessions struct {
+	Host     string
+	Revoked  []string
+	Sessions int
+}
+
+// terminateSessions terminates the sessions of the role name on db if required
+// by the SessionTermination of the Granter after revoking revoked. It returns
+// nil if no sessions were terminated.
+func (g *Granter) terminateSessions(log logr.Logger, db *sql.DB, host, name string, revoked []string) (*TerminatedSessions, error) {
+	if !g.SessionTermination.terminates(revoked) {
+		return nil, nil
+	}
+	sessions, err := postgres.TerminateSessions(db, name)
+	if err != nil {
+		return nil, fmt.Errorf("terminate sessions: %w", err)
+	}
+	if sessions == 0 {
+		return nil, nil
+	}
+	log.Info(fmt.Sprintf("Terminated %d sessions of %s after revoking roles", sessions, name), "revoked", revoked)
+	return &TerminatedSessions{
+		Host:     host,
+		Revoked:  revoked,
+		Sessions: sessions,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package grants
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionTermination_terminates(t *testing.T) {
+	tt := []struct {
+		name        string
+		termination SessionTermination
+		revoked     []string
+		output      bool
+	}{
+		{
+			name:        "empty",
+			termination: "",
+			revoked:     []string{"user_readwrite"},
+			output:      false,
+		},
+		{
+			name:        "never",
+			termination: SessionTerminationNever,
+			revoked:     []string{"user_readwrite"},
+			output:      false,
+		},
+		{
+			name:        "write on read revoke",
+			termination: SessionTerminationWrite,
+			revoked:     []string{"user_read"},
+			output:      false,
+		},
+		{
+			name:        "write on write revoke",
+			termination: SessionTerminationWrite,
+			revoked:     []string{"user_read", "user_readwrite"},
+			output:      true,
+		},
+		{
+			name:        "write on owning write revoke",
+			termination: SessionTerminationWrite,
+			revoked:     []string{"user_readowningwrite"},
+			output:      true,
+		},
+		{
+			name:        "any on read revoke",
+			termination: SessionTerminationAny,
+			revoked:     []string{"user_read"},
+			output:      true,
+		},
+		{
+			name:        "any without revoke",
+			termination: SessionTerminationAny,
+			revoked:     nil,
+			output:      false,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.output, tc.termination.terminates(tc.revoked))
+		})
+	}
+}
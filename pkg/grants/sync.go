@@ -2,7 +2,11 @@ package grants
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
@@ -10,11 +14,35 @@ import (
 	"go.uber.org/multierr"
 )
 
+// SyncResult describes the outcome of a SyncUser call.
+type SyncResult struct {
+	// RoleName is the name of the role synchronized on the hosts.
+	RoleName string
+	// Accesses contains the outcome of every read and write access request.
+	Accesses []lunarwayv1alpha1.PostgreSQLUserAccessStatus
+	// Hosts contains the outcome of synchronizing roles on each host sorted by
+	// host name.
+	Hosts []lunarwayv1alpha1.PostgreSQLUserHostStatus
+	// TerminatedSessions contains the sessions terminated after revoking roles
+	// on each host sorted by host name.
+	TerminatedSessions []TerminatedSessions
+	// Stops holds the time the last granted access on each host stops. It is
+	// zero for hosts with an access that does not stop. Hosts without granted
+	// accesses are not included.
+	Stops map[string]time.Time
+}
+
 // SyncUser syncronizes a PostgreSQL user's access requests against the roles
 // defined in the host instances. Any excessive roles are removed and missing
 // ones are added.
-func (g *Granter) SyncUser(log logr.Logger, namespace, rolePrefix string, user lunarwayv1alpha1.PostgreSQLUser) error {
+//
+// The returned SyncResult describes the outcome of every access request and
+// host even if an error is returned.
+func (g *Granter) SyncUser(log logr.Logger, namespace, rolePrefix string, user lunarwayv1alpha1.PostgreSQLUser) (SyncResult, error) {
 	prefixedUsername := fmt.Sprintf("%s%s", rolePrefix, user.Spec.Name)
+	result := SyncResult{
+		RoleName: prefixedUsername,
+	}
 	log.Info(fmt.Sprintf("Syncing user %s", prefixedUsername), "user", user)
 	//   resolve required grants taking expiration into account
 	//   diff against existing
@@ -27,18 +55,22 @@ func (g *Granter) SyncUser(log logr.Logger, namespace, rolePrefix string, user l
 	if user.Spec.Write != nil {
 		write = *user.Spec.Write
 	}
-	accesses, err := g.groupAccesses(log, namespace, read, write)
+	accesses, statuses, err := g.groupAccesses(log, namespace, read, write)
+	result.Accesses = statuses
 	if err != nil {
 		if len(accesses) == 0 {
-			return fmt.Errorf("group accesses: %w", err)
+			return result, fmt.Errorf("group accesses: %w", err)
 		}
 		log.Error(err, "Some access requests could not be resolved. Continuating with the resolved ones")
 	}
 	log.Info(fmt.Sprintf("Found access requests for %d hosts", len(accesses)))
+	result.Stops = accessStops(accesses)
 
-	hosts, err := g.connectToHosts(log, accesses)
-	if err != nil {
-		return fmt.Errorf("connect to hosts: %w", err)
+	var errs error
+	hosts, connectErr := g.connectToHosts(log, accesses)
+	if connectErr != nil {
+		log.Error(connectErr, "Some hosts could not be connected to. Continuing with the connected ones")
+		errs = multierr.Append(errs, fmt.Errorf("connect to hosts: %w", connectErr))
 	}
 	defer func() {
 		err := closeConnectionToHosts(hosts)
@@ -47,24 +79,97 @@ func (g *Granter) SyncUser(log logr.Logger, namespace, rolePrefix string, user l
 		}
 	}()
 
-	err = g.setRolesOnHosts(log, prefixedUsername, accesses, hosts)
-	if err != nil {
-		return fmt.Errorf("grant access on host: %w", err)
+	terminated, grantErr := g.setRolesOnHosts(log, prefixedUsername, accesses, hosts)
+	result.TerminatedSessions = terminated
+	if grantErr != nil {
+		errs = multierr.Append(errs, fmt.Errorf("grant access on host: %w", grantErr))
 	}
 
-	return nil
+	result.Hosts, result.Accesses = hostStatuses(accesses, result.Accesses, multierr.Combine(connectErr, grantErr))
+	return result, errs
+}
+
+// accessStops returns the time the last access on each host in accesses stops.
+// It is zero for hosts with an access that does not stop.
+func accessStops(accesses HostAccess) map[string]time.Time {
+	stops := make(map[string]time.Time)
+	for host, access := range accesses {
+		if len(access) == 0 {
+			continue
+		}
+		var stop time.Time
+		for _, a := range access {
+			if a.Access.Stop.IsZero() {
+				stop = time.Time{}
+				break
+			}
+			if a.Access.Stop.After(stop) {
+				stop = a.Access.Stop.Time
+			}
+		}
+		stops[host] = stop
+	}
+	return stops
+}
+
+// hostStatuses returns the status of every host in accesses based on the
+// HostErrors found in err. Granted access statuses on failed hosts are marked
+// as failed as well.
+func hostStatuses(accesses HostAccess, statuses []lunarwayv1alpha1.PostgreSQLUserAccessStatus, err error) ([]lunarwayv1alpha1.PostgreSQLUserHostStatus, []lunarwayv1alpha1.PostgreSQLUserAccessStatus) {
+	hostErrs := make(map[string][]string)
+	for _, err := range multierr.Errors(err) {
+		var hostErr *HostError
+		if errors.As(err, &hostErr) {
+			hostErrs[hostErr.Host] = append(hostErrs[hostErr.Host], hostErr.Error())
+		}
+	}
+
+	var hosts []lunarwayv1alpha1.PostgreSQLUserHostStatus
+	for host := range accesses {
+		status := lunarwayv1alpha1.PostgreSQLUserHostStatus{
+			Host:  host,
+			Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted,
+		}
+		if messages, ok := hostErrs[host]; ok {
+			status.Phase = lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed
+			status.Message = strings.Join(messages, "; ")
+		}
+		hosts = append(hosts, status)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Host < hosts[j].Host
+	})
+
+	for i := range statuses {
+		if statuses[i].Phase != lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted {
+			continue
+		}
+		messages, ok := hostErrs[statuses[i].Host]
+		if !ok {
+			continue
+		}
+		statuses[i].Phase = lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed
+		statuses[i].Message = fmt.Sprintf("host %s: %s", statuses[i].Host, strings.Join(messages, "; "))
+	}
+	return hosts, statuses
 }
 
 func (g *Granter) connectToHosts(log logr.Logger, accesses HostAccess) (map[string]*sql.DB, error) {
 	hosts := make(map[string]*sql.DB)
 	var errs error
 	for host, access := range accesses {
-		// the zero index is safe as accesses are grouped by access requests so any
-		// host in the map has at least one ReadWriteAccess item
-		database := access[0].Database.Name
-		credentials, ok := g.HostCredentials[host]
+		// hosts of expired accesses have no ReadWriteAccess items. Roles are
+		// shared by all databases so any database can be used.
+		database := "postgres"
+		if len(access) != 0 {
+			database = access[0].Database.Name
+		}
+		credentials, ok := g.HostCredentials.Get(host)
 		if !ok {
-			errs = multierr.Append(errs, fmt.Errorf("no credentials for host '%s'", host))
+			errs = multierr.Append(errs, &HostError{
+				Host: host,
+				Err:  fmt.Errorf("no credentials for host '%s'", host),
+			})
 			continue
 		}
 		connectionString := postgres.ConnectionString{
@@ -72,10 +177,14 @@ func (g *Granter) connectToHosts(log logr.Logger, accesses HostAccess) (map[stri
 			Database: database,
 			User:     credentials.User,
 			Password: credentials.Password,
+			Params:   credentials.Params,
 		}
 		db, err := postgres.Connect(connectionString)
 		if err != nil {
-			errs = multierr.Append(errs, fmt.Errorf("connect to %s: %w", connectionString, err))
+			errs = multierr.Append(errs, &HostError{
+				Host: host,
+				Err:  fmt.Errorf("connect to %s: %w", connectionString, err),
+			})
 			continue
 		}
 		hosts[host] = db
@@ -94,23 +203,55 @@ func closeConnectionToHosts(hosts map[string]*sql.DB) error {
 	return errs
 }
 
-func (g *Granter) setRolesOnHosts(log logr.Logger, name string, accesses HostAccess, hosts map[string]*sql.DB) error {
-	var errs error
+func (g *Granter) setRolesOnHosts(log logr.Logger, name string, accesses HostAccess, hosts map[string]*sql.DB) ([]TerminatedSessions, error) {
+	var (
+		errs       error
+		terminated []TerminatedSessions
+	)
 	for host, access := range accesses {
 		log = log.WithValues("host", host)
 		connection, ok := hosts[host]
 		if !ok {
-			return fmt.Errorf("connection for host %s not found", host)
+			// the connection error is reported by connectToHosts so skip the host
+			log.Info("Skipping host as no connection is available")
+			continue
 		}
-		err := postgres.Role(log, connection, name, g.StaticRoles, databaseSchemas(access))
+		revoked, err := postgres.Role(log, connection, name, g.userRoles(host), databaseSchemas(access))
 		if err != nil {
-			errs = multierr.Append(errs, fmt.Errorf("grant roles: %w", err))
+			errs = multierr.Append(errs, &HostError{
+				Host: host,
+				Err:  fmt.Errorf("grant roles: %w", err),
+			})
+			continue
+		}
+		if len(g.ReadParameters) != 0 || len(g.WriteParameters) != 0 {
+			err := postgres.SetRoleParameters(log, connection, name, databaseSchemas(access), g.ReadParameters, g.WriteParameters)
+			if err != nil {
+				errs = multierr.Append(errs, &HostError{
+					Host: host,
+					Err:  fmt.Errorf("set parameters: %w", err),
+				})
+			}
+		}
+		sessions, err := g.terminateSessions(log, connection, host, name, revoked)
+		if err != nil {
+			errs = multierr.Append(errs, &HostError{
+				Host: host,
+				Err:  err,
+			})
+			continue
+		}
+		if sessions != nil {
+			terminated = append(terminated, *sessions)
 		}
 	}
+	sort.Slice(terminated, func(i, j int) bool {
+		return terminated[i].Host < terminated[j].Host
+	})
 	if errs != nil {
-		return errs
+		return terminated, errs
 	}
-	return nil
+	return terminated, nil
 }
 
 func databaseSchemas(accesses []ReadWriteAccess) []postgres.DatabaseSchema {
@@ -0,0 +1,90 @@
+package grants
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	lunarwayv1alpha1 "go.lunarway.com/postgresql-controller/api/v1alpha1"
+	"go.uber.org/multierr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHostStatuses(t *testing.T) {
+	accesses := HostAccess{
+		"host2:5432": []ReadWriteAccess{{Host: "host2:5432"}},
+		"host1:5432": []ReadWriteAccess{{Host: "host1:5432"}},
+	}
+	statuses := []lunarwayv1alpha1.PostgreSQLUserAccessStatus{
+		{
+			Host:  "host1:5432",
+			Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted,
+		},
+		{
+			Host:  "host2:5432",
+			Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted,
+		},
+		{
+			Host:    "host2:5432",
+			Phase:   lunarwayv1alpha1.PostgreSQLUserAccessPhasePending,
+			Message: "Access starts at 2020-04-30T14:00:00Z",
+		},
+	}
+	err := multierr.Combine(
+		&HostError{Host: "host2:5432", Err: errors.New("connection refused")},
+		errors.New("unrelated"),
+	)
+
+	hosts, statuses := hostStatuses(accesses, statuses, err)
+
+	assert.Equal(t, []lunarwayv1alpha1.PostgreSQLUserHostStatus{
+		{
+			Host:  "host1:5432",
+			Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted,
+		},
+		{
+			Host:    "host2:5432",
+			Phase:   lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed,
+			Message: "connection refused",
+		},
+	}, hosts, "host statuses not as expected")
+	assert.Equal(t, []lunarwayv1alpha1.PostgreSQLUserAccessStatus{
+		{
+			Host:  "host1:5432",
+			Phase: lunarwayv1alpha1.PostgreSQLUserAccessPhaseGranted,
+		},
+		{
+			Host:    "host2:5432",
+			Phase:   lunarwayv1alpha1.PostgreSQLUserAccessPhaseFailed,
+			Message: "host host2:5432: connection refused",
+		},
+		{
+			Host:    "host2:5432",
+			Phase:   lunarwayv1alpha1.PostgreSQLUserAccessPhasePending,
+			Message: "Access starts at 2020-04-30T14:00:00Z",
+		},
+	}, statuses, "access statuses not as expected")
+}
+
+func TestAccessStops(t *testing.T) {
+	early := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	access := func(stop time.Time) ReadWriteAccess {
+		var spec lunarwayv1alpha1.AccessSpec
+		if !stop.IsZero() {
+			spec.Stop = &metav1.Time{Time: stop}
+		}
+		return ReadWriteAccess{Access: spec}
+	}
+	accesses := HostAccess{
+		"stops:5432":   []ReadWriteAccess{access(late), access(early)},
+		"endless:5432": []ReadWriteAccess{access(early), access(time.Time{}), access(late)},
+		"expired:5432": nil,
+	}
+
+	assert.Equal(t, map[string]time.Time{
+		"stops:5432":   late,
+		"endless:5432": {},
+	}, accessStops(accesses))
+}
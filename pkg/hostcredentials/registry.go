@@ -0,0 +1,140 @@
+// Package hostcredentials provides a registry of admin credentials for the
+// PostgreSQL hosts managed by the controller.
+//
+// Credentials come from two sources: a static set configured with the
+// --host-credentials flag at startup and a dynamic set registered by the
+// PostgreSQLHostCredentials reconciler while the controller is running. All
+// controllers read from the same registry so new hosts can be onboarded without
+// restarting the controller.
+package hostcredentials
+
+import (
+	"sort"
+	"sync"
+
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+)
+
+// Registry is a concurrency safe store of admin credentials keyed by host name.
+//
+// Dynamically registered credentials take precedence over static ones for the
+// same host. If more than one source registers credentials for the same host,
+// the source with the lowest name wins to keep lookups deterministic.
+//
+// A nil Registry is valid and holds no credentials.
+type Registry struct {
+	mu          sync.RWMutex
+	static      map[string]postgres.Credentials
+	dynamic     map[string]entry
+	subscribers []chan struct{}
+}
+
+type entry struct {
+	host        string
+	credentials postgres.Credentials
+}
+
+// NewRegistry returns a Registry seeded with static credentials keyed by host
+// name. The map is copied so later changes to it are not reflected.
+func NewRegistry(static map[string]postgres.Credentials) *Registry {
+	r := &Registry{
+		static:  make(map[string]postgres.Credentials, len(static)),
+		dynamic: make(map[string]entry),
+	}
+	for host, credentials := range static {
+		r.static[host] = credentials
+	}
+	return r
+}
+
+// Set registers credentials for host from source. Any credentials previously
+// registered by source are replaced, also if they were for another host.
+// Subscribers are notified on every call.
+func (r *Registry) Set(source, host string, credentials postgres.Credentials) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dynamic[source] = entry{
+		host:        host,
+		credentials: credentials,
+	}
+	for _, subscriber := range r.subscribers {
+		// a pending notification already covers this one
+		select {
+		case subscriber <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving a value when credentials are
+// registered with Set. Notifications not yet received are coalesced so a
+// receiver sees the credentials of every Set before it. The channel is never
+// closed.
+func (r *Registry) Subscribe() <-chan struct{} {
+	subscriber := make(chan struct{}, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, subscriber)
+	return subscriber
+}
+
+// Remove removes any credentials registered by source. Static credentials are
+// never removed.
+func (r *Registry) Remove(source string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.dynamic, source)
+}
+
+// Get returns the credentials for host and whether any are known.
+func (r *Registry) Get(host string) (postgres.Credentials, bool) {
+	if r == nil {
+		return postgres.Credentials{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	credentials, ok := r.resolved()[host]
+	return credentials, ok
+}
+
+// All returns a snapshot of the credentials of every known host keyed by host
+// name.
+func (r *Registry) All() map[string]postgres.Credentials {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolved()
+}
+
+// Hosts returns the sorted names of every known host.
+func (r *Registry) Hosts() []string {
+	all := r.All()
+	hosts := make([]string, 0, len(all))
+	for host := range all {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// resolved merges static and dynamic credentials. The caller must hold the
+// read lock.
+func (r *Registry) resolved() map[string]postgres.Credentials {
+	all := make(map[string]postgres.Credentials, len(r.static)+len(r.dynamic))
+	for host, credentials := range r.static {
+		all[host] = credentials
+	}
+	sources := make([]string, 0, len(r.dynamic))
+	for source := range r.dynamic {
+		sources = append(sources, source)
+	}
+	// apply in reverse order so the lowest source name is applied last and wins
+	sort.Sort(sort.Reverse(sort.StringSlice(sources)))
+	for _, source := range sources {
+		e := r.dynamic[source]
+		all[e.host] = e.credentials
+	}
+	return all
+}
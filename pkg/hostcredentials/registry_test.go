@@ -0,0 +1,73 @@
+package hostcredentials
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+)
+
+func TestRegistry(t *testing.T) {
+	static := map[string]postgres.Credentials{
+		"static:5432": {User: "static", Password: "static"},
+		"shared:5432": {User: "flag", Password: "flag"},
+	}
+	r := NewRegistry(static)
+
+	// changes to the seed map must not leak into the registry
+	static["leaked:5432"] = postgres.Credentials{User: "leaked"}
+	_, ok := r.Get("leaked:5432")
+	assert.False(t, ok, "seed map changes should not be visible")
+
+	r.Set("default/b", "shared:5432", postgres.Credentials{User: "b"})
+	r.Set("default/a", "shared:5432", postgres.Credentials{User: "a"})
+	r.Set("default/c", "dynamic:5432", postgres.Credentials{User: "c"})
+
+	creds, ok := r.Get("shared:5432")
+	assert.True(t, ok)
+	assert.Equal(t, "a", creds.User, "lowest source should win over static and other sources")
+
+	assert.Equal(t, []string{"dynamic:5432", "shared:5432", "static:5432"}, r.Hosts())
+
+	// moving a source to another host removes it from the old one
+	r.Set("default/c", "moved:5432", postgres.Credentials{User: "c"})
+	_, ok = r.Get("dynamic:5432")
+	assert.False(t, ok, "source should no longer provide credentials for its old host")
+
+	r.Remove("default/a")
+	creds, _ = r.Get("shared:5432")
+	assert.Equal(t, "b", creds.User)
+
+	r.Remove("default/b")
+	creds, _ = r.Get("shared:5432")
+	assert.Equal(t, "flag", creds.User, "static credentials should be used when no source remains")
+
+	r.Remove("unknown")
+	assert.Len(t, r.All(), 3)
+}
+
+func TestRegistry_nil(t *testing.T) {
+	var r *Registry
+	_, ok := r.Get("host")
+	assert.False(t, ok)
+	assert.Empty(t, r.All())
+	assert.Empty(t, r.Hosts())
+}
+
+func TestRegistry_Subscribe(t *testing.T) {
+	r := NewRegistry(nil)
+	registered := r.Subscribe()
+	assert.Empty(t, registered, "no notification before credentials are set")
+
+	// notifications are coalesced until they are received
+	r.Set("default/a", "a:5432", postgres.Credentials{User: "a"})
+	r.Set("default/b", "b:5432", postgres.Credentials{User: "b"})
+	assert.Len(t, registered, 1, "pending notifications")
+	<-registered
+
+	r.Remove("default/a")
+	assert.Empty(t, registered, "removals should not notify")
+
+	r.Set("default/b", "b:5432", postgres.Credentials{User: "b"})
+	assert.Len(t, registered, 1, "unchanged credentials should notify")
+}
@@ -0,0 +1,274 @@
+package iam
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/go-logr/logr"
+)
+
+// maxFlushBackoff caps the delay between retries of failed batch writes.
+const maxFlushBackoff = 5 * time.Minute
+
+// CacheConfig configures how a Client caches the managed policies and batches
+// changes to them.
+type CacheConfig struct {
+	// TTL is how long the policies and the policies attached to the login
+	// roles are cached before they are read from IAM again. Zero disables the
+	// cache.
+	TTL time.Duration
+	// BatchInterval is how long changes are collected before they are written
+	// to IAM. Every policy is written at most once per batch. Zero writes
+	// changes right away and returns any error to the caller. Removed users
+	// are always written right away.
+	BatchInterval time.Duration
+}
+
+// cacheState holds the cached policies of a Client.
+type cacheState struct {
+	// stored holds the policies as written to IAM.
+	stored []*Policy
+	// fetched is the time stored was read from IAM. It is zero if the
+	// policies are not known, eg. after a failed write.
+	fetched time.Time
+	// desired holds the policies with the pending changes applied. It is nil
+	// if there are no pending changes.
+	desired []*Policy
+	// config is the configuration of the latest change used to write the
+	// pending changes.
+	config EnsureUserConfig
+	// attached holds the names of the managed policies attached to each login
+	// role by role name.
+	attached map[string]map[string]bool
+	// pending holds the names of the users with changes not yet written.
+	pending map[string]bool
+	// failed holds the names of the users with changes pending when a write
+	// failed. They are reported by EnsureUser until a write succeeds.
+	failed   map[string]error
+	flush    *time.Timer
+	failures int
+}
+
+// policies returns the managed policies including pending changes. They are
+// read from IAM if the cache is disabled or expired. The caller must hold mu
+// and must not modify the policies.
+func (c *Client) policies() ([]*Policy, error) {
+	if c.state.desired != nil {
+		return c.state.desired, nil
+	}
+	if !c.state.fetched.IsZero() && c.cache.TTL > 0 && c.now().Sub(c.state.fetched) < c.cache.TTL {
+		return c.state.stored, nil
+	}
+	return c.refresh()
+}
+
+// refresh reads the managed policies from IAM. The policies attached to the
+// login roles are read again on their next use. The caller must hold mu.
+func (c *Client) refresh() ([]*Policy, error) {
+	c.log.V(1).Info("listing iam policies")
+	policies, err := c.ListPolicies()
+	if err != nil {
+		c.invalidate()
+		return nil, err
+	}
+	c.state.stored = policies
+	c.state.fetched = c.now()
+	c.state.attached = nil
+	return policies, nil
+}
+
+// invalidate forgets the cached state of IAM. Pending changes are kept. The
+// caller must hold mu.
+func (c *Client) invalidate() {
+	c.state.stored = nil
+	c.state.fetched = time.Time{}
+	c.state.attached = nil
+}
+
+// commit records the changes of plan made for users. Without a batch interval
+// they are written right away. Otherwise a write of all changes collected
+// within the interval is scheduled. The caller must hold mu.
+func (c *Client) commit(log logr.Logger, config EnsureUserConfig, plan *Plan, users ...string) error {
+	c.state.config = config
+	if !plan.Empty() {
+		// desired is never nil with pending changes, even if every policy is
+		// deleted
+		c.state.desired = append([]*Policy{}, plan.Policies...)
+	}
+	observePolicies(plan.Policies, config)
+	if c.cache.BatchInterval <= 0 {
+		return c.flush(log)
+	}
+	if !plan.Empty() {
+		if c.state.pending == nil {
+			c.state.pending = make(map[string]bool)
+		}
+		for _, user := range users {
+			c.state.pending[user] = true
+		}
+	}
+	if c.state.flush == nil {
+		c.scheduleFlush(c.cache.BatchInterval)
+	}
+	return nil
+}
+
+// written reports whether the policies written to IAM may hold a statement of
+// username. It is true if they are not known. The caller must hold mu.
+func (c *Client) written(config EnsureUserConfig, username string) bool {
+	if c.state.fetched.IsZero() {
+		return true
+	}
+	p := newPlanner(config, c.state.stored)
+	for _, policy := range p.policies {
+		if policy.Document.Exists(p.principal, username) {
+			return true
+		}
+	}
+	for _, statement := range p.overflow {
+		if name, ok := statement.user(p.principal); ok && name == username {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush writes any pending changes to IAM right away.
+func (c *Client) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushNow(c.log)
+}
+
+// flushNow cancels any scheduled write and writes the pending changes right
+// away. The caller must hold mu.
+func (c *Client) flushNow(log logr.Logger) error {
+	if c.state.flush != nil {
+		c.state.flush.Stop()
+		c.state.flush = nil
+	}
+	err := c.flush(log)
+	c.flushed(log, err)
+	return err
+}
+
+// scheduleFlush writes the pending changes after delay. The caller must hold
+// mu.
+func (c *Client) scheduleFlush(delay time.Duration) {
+	c.state.flush = time.AfterFunc(delay, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.state.flush = nil
+		c.flushed(c.log, c.flush(c.log))
+	})
+}
+
+// flushed records the outcome err of a batched write. The users with pending
+// changes are marked as failed and the write is retried with exponential
+// backoff. The caller must hold mu.
+func (c *Client) flushed(log logr.Logger, err error) {
+	if err == nil {
+		c.state.failures = 0
+		c.state.pending = nil
+		c.state.failed = nil
+		return
+	}
+	if c.cache.BatchInterval <= 0 {
+		return
+	}
+	if c.state.failed == nil {
+		c.state.failed = make(map[string]error)
+	}
+	for user := range c.state.pending {
+		c.state.failed[user] = err
+	}
+	c.state.failures++
+	backoff := c.cache.BatchInterval << c.state.failures
+	if backoff <= 0 || backoff > maxFlushBackoff {
+		backoff = maxFlushBackoff
+	}
+	log.Error(err, "Failed to write batched IAM policy changes", "retryIn", backoff, "users", len(c.state.pending))
+	c.scheduleFlush(backoff)
+}
+
+// flush writes the pending changes to IAM and makes sure that the policies are
+// attached to the login roles. The caller must hold mu.
+func (c *Client) flush(log logr.Logger) error {
+	config := c.state.config
+	if c.state.desired != nil {
+		if c.state.fetched.IsZero() {
+			_, err := c.refresh()
+			if err != nil {
+				return err
+			}
+		}
+		plan := diffPlan(config, c.state.stored, c.state.desired)
+		err := applyPlan(c, log, config, plan)
+		if err != nil {
+			// the policies written before the failure are unknown so they are
+			// read again on the next attempt
+			c.invalidate()
+			return err
+		}
+		c.state.stored = c.state.desired
+		c.state.desired = nil
+	}
+	owned := ownedPolicies(config.PolicyBaseName, c.state.stored)
+	names := make([]string, 0, len(owned))
+	for _, policy := range owned {
+		names = append(names, policy.Name)
+	}
+	return c.attach(config, names...)
+}
+
+// attach attaches the policies named names to the login roles of config
+// unless they are known to be attached. The caller must hold mu.
+func (c *Client) attach(config EnsureUserConfig, names ...string) error {
+	for _, roleName := range config.AWSLoginRoles {
+		attached, err := c.attachedPolicies(roleName)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if attached[name] {
+				continue
+			}
+			_, err := c.svc.AttachRolePolicy(&iam.AttachRolePolicyInput{
+				PolicyArn: aws.String(c.policyARN(name)),
+				RoleName:  aws.String(roleName),
+			})
+			if err != nil {
+				return fmt.Errorf("unable to attach policy %s to role %s: %w", name, roleName, err)
+			}
+			attached[name] = true
+		}
+	}
+	return nil
+}
+
+// attachedPolicies returns the names of the managed policies attached to the
+// role named roleName. The caller must hold mu.
+func (c *Client) attachedPolicies(roleName string) (map[string]bool, error) {
+	if attached, ok := c.state.attached[roleName]; ok {
+		return attached, nil
+	}
+	role, err := c.GetRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := c.ListManagedAttachedPolicies(role)
+	if err != nil {
+		return nil, err
+	}
+	attached := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		attached[*policy.PolicyName] = true
+	}
+	if c.state.attached == nil {
+		c.state.attached = make(map[string]map[string]bool)
+	}
+	c.state.attached[roleName] = attached
+	return attached, nil
+}
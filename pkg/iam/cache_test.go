@@ -0,0 +1,442 @@
+package iam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.lunarway.com/postgresql-controller/test"
+)
+
+// fakeIAM is an in-memory IAM holding managed policies and their attachments
+// to roles. It counts the calls by operation.
+type fakeIAM struct {
+	iamiface.IAMAPI
+
+	calls map[string]int
+	// documents holds the JSON document of the default version of every
+	// policy by name.
+	documents map[string]string
+	versions  map[string]int
+	attached  map[string]map[string]bool
+	// fail fails the next call of an operation.
+	fail map[string]error
+}
+
+func newFakeIAM(roles ...string) *fakeIAM {
+	f := &fakeIAM{
+		calls:     make(map[string]int),
+		documents: make(map[string]string),
+		versions:  make(map[string]int),
+		attached:  make(map[string]map[string]bool),
+		fail:      make(map[string]error),
+	}
+	for _, role := range roles {
+		f.attached[role] = make(map[string]bool)
+	}
+	return f
+}
+
+func (f *fakeIAM) call(operation string) error {
+	f.calls[operation]++
+	err := f.fail[operation]
+	delete(f.fail, operation)
+	return err
+}
+
+func policyName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+func (f *fakeIAM) ListPoliciesPages(_ *iam.ListPoliciesInput, fn func(*iam.ListPoliciesOutput, bool) bool) error {
+	if err := f.call("ListPolicies"); err != nil {
+		return err
+	}
+	var policies []*iam.Policy
+	for name, version := range f.versions {
+		policies = append(policies, &iam.Policy{
+			PolicyName:       aws.String(name),
+			DefaultVersionId: aws.String(fmt.Sprintf("v%d", version)),
+		})
+	}
+	fn(&iam.ListPoliciesOutput{Policies: policies}, true)
+	return nil
+}
+
+func (f *fakeIAM) GetPolicyVersion(input *iam.GetPolicyVersionInput) (*iam.GetPolicyVersionOutput, error) {
+	if err := f.call("GetPolicyVersion"); err != nil {
+		return nil, err
+	}
+	return &iam.GetPolicyVersionOutput{PolicyVersion: &iam.PolicyVersion{
+		Document: aws.String(url.QueryEscape(f.documents[policyName(*input.PolicyArn)])),
+	}}, nil
+}
+
+func (f *fakeIAM) CreatePolicy(input *iam.CreatePolicyInput) (*iam.CreatePolicyOutput, error) {
+	if err := f.call("CreatePolicy"); err != nil {
+		return nil, err
+	}
+	f.documents[*input.PolicyName] = *input.PolicyDocument
+	f.versions[*input.PolicyName] = 1
+	return &iam.CreatePolicyOutput{Policy: &iam.Policy{PolicyName: input.PolicyName}}, nil
+}
+
+func (f *fakeIAM) CreatePolicyVersion(input *iam.CreatePolicyVersionInput) (*iam.CreatePolicyVersionOutput, error) {
+	if err := f.call("CreatePolicyVersion"); err != nil {
+		return nil, err
+	}
+	name := policyName(*input.PolicyArn)
+	f.documents[name] = *input.PolicyDocument
+	f.versions[name]++
+	return &iam.CreatePolicyVersionOutput{}, nil
+}
+
+func (f *fakeIAM) ListEntitiesForPolicyPages(input *iam.ListEntitiesForPolicyInput, fn func(*iam.ListEntitiesForPolicyOutput, bool) bool) error {
+	if err := f.call("ListEntitiesForPolicy"); err != nil {
+		return err
+	}
+	var roles []*iam.PolicyRole
+	for role, attached := range f.attached {
+		if attached[policyName(*input.PolicyArn)] {
+			roles = append(roles, &iam.PolicyRole{RoleName: aws.String(role)})
+		}
+	}
+	fn(&iam.ListEntitiesForPolicyOutput{PolicyRoles: roles}, true)
+	return nil
+}
+
+func (f *fakeIAM) DetachRolePolicy(input *iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error) {
+	if err := f.call("DetachRolePolicy"); err != nil {
+		return nil, err
+	}
+	delete(f.attached[*input.RoleName], policyName(*input.PolicyArn))
+	return &iam.DetachRolePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) ListPolicyVersions(*iam.ListPolicyVersionsInput) (*iam.ListPolicyVersionsOutput, error) {
+	if err := f.call("ListPolicyVersions"); err != nil {
+		return nil, err
+	}
+	return &iam.ListPolicyVersionsOutput{}, nil
+}
+
+func (f *fakeIAM) DeletePolicy(input *iam.DeletePolicyInput) (*iam.DeletePolicyOutput, error) {
+	if err := f.call("DeletePolicy"); err != nil {
+		return nil, err
+	}
+	name := policyName(*input.PolicyArn)
+	delete(f.documents, name)
+	delete(f.versions, name)
+	return &iam.DeletePolicyOutput{}, nil
+}
+
+func (f *fakeIAM) GetRole(input *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	if err := f.call("GetRole"); err != nil {
+		return nil, err
+	}
+	return &iam.GetRoleOutput{Role: &iam.Role{RoleName: input.RoleName}}, nil
+}
+
+func (f *fakeIAM) ListAttachedRolePoliciesPages(input *iam.ListAttachedRolePoliciesInput, fn func(*iam.ListAttachedRolePoliciesOutput, bool) bool) error {
+	if err := f.call("ListAttachedRolePolicies"); err != nil {
+		return err
+	}
+	var policies []*iam.AttachedPolicy
+	for name := range f.attached[*input.RoleName] {
+		policies = append(policies, &iam.AttachedPolicy{PolicyName: aws.String(name)})
+	}
+	fn(&iam.ListAttachedRolePoliciesOutput{AttachedPolicies: policies}, true)
+	return nil
+}
+
+func (f *fakeIAM) AttachRolePolicy(input *iam.AttachRolePolicyInput) (*iam.AttachRolePolicyOutput, error) {
+	if err := f.call("AttachRolePolicy"); err != nil {
+		return nil, err
+	}
+	f.attached[*input.RoleName][policyName(*input.PolicyArn)] = true
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+// users returns the users of every stored policy by policy name.
+func (f *fakeIAM) users(t *testing.T) map[string][]string {
+	t.Helper()
+	users := make(map[string][]string, len(f.documents))
+	for name, document := range f.documents {
+		var d PolicyDocument
+		require.NoError(t, json.Unmarshal([]byte(document), &d))
+		users[name] = d.ListUsers(DefaultPrincipal)
+	}
+	return users
+}
+
+// fakeClock is a settable clock.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newFakeClient(t *testing.T, svc *fakeIAM, clock *fakeClock, cache CacheConfig) *Client {
+	return &Client{
+		svc:          svc,
+		log:          test.NewLogger(t),
+		awsAccountID: accountID,
+		iamPrefix:    "/",
+		cache:        cache,
+		now:          clock.Now,
+	}
+}
+
+func TestClient_cache(t *testing.T) {
+	svc := newFakeIAM("login")
+	clock := &fakeClock{now: time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	client := newFakeClient(t, svc, clock, CacheConfig{TTL: time.Minute})
+	logger := test.NewLogger(t)
+	config := EnsureUserConfig{
+		Region:         region,
+		AccountID:      accountID,
+		PolicyBaseName: "base",
+		RolePrefix:     rolePrefix,
+		AWSLoginRoles:  []string{"login"},
+	}
+
+	for _, user := range []string{"user1", "user2", "user3"} {
+		_, err := EnsureUser(client, logger, config, user, user)
+		require.NoError(t, err, "unexpected error when adding %s", user)
+	}
+	_, err := EnsureUser(client, logger, config, "user1", "user1")
+	require.NoError(t, err, "unexpected error when ensuring user1 again")
+
+	assert.Equal(t, 1, svc.calls["ListPolicies"], "policies should be listed once")
+	assert.Equal(t, 1, svc.calls["ListAttachedRolePolicies"], "attached policies should be listed once")
+	assert.Equal(t, 1, svc.calls["CreatePolicy"], "created policies")
+	assert.Equal(t, 2, svc.calls["CreatePolicyVersion"], "written policy versions")
+	assert.Equal(t, 1, svc.calls["AttachRolePolicy"], "attached policies")
+	assert.Equal(t, map[string][]string{"base_0": {"user1", "user2", "user3"}}, svc.users(t))
+
+	// a policy detached out of band is attached again once the cache expires
+	delete(svc.attached["login"], "base_0")
+	clock.now = clock.now.Add(time.Minute)
+	_, err = EnsureUser(client, logger, config, "user1", "user1")
+	require.NoError(t, err, "unexpected error when ensuring user1 after expiry")
+
+	assert.Equal(t, 2, svc.calls["ListPolicies"], "policies should be listed again")
+	assert.Equal(t, 2, svc.calls["CreatePolicyVersion"], "unchanged policies should not be written")
+	assert.True(t, svc.attached["login"]["base_0"], "policy should be attached again")
+}
+
+func TestClient_batch(t *testing.T) {
+	svc := newFakeIAM("login")
+	clock := &fakeClock{now: time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	// the interval is long enough for batches to only be written by Flush
+	client := newFakeClient(t, svc, clock, CacheConfig{TTL: time.Hour, BatchInterval: time.Hour})
+	logger := test.NewLogger(t)
+	config := EnsureUserConfig{
+		Region:            region,
+		AccountID:         accountID,
+		PolicyBaseName:    "base",
+		MaxUsersPerPolicy: 2,
+		RolePrefix:        rolePrefix,
+		AWSLoginRoles:     []string{"login"},
+	}
+
+	for _, user := range []string{"user1", "user2", "user3"} {
+		policy, err := EnsureUser(client, logger, config, user, user)
+		require.NoError(t, err, "unexpected error when adding %s", user)
+		assert.NotEmpty(t, policy, "policy of %s", user)
+	}
+	assert.Empty(t, svc.documents, "changes should not be written before the batch is flushed")
+
+	require.NoError(t, client.Flush(), "unexpected error when flushing")
+	assert.Equal(t, map[string][]string{
+		"base_0": {"user1", "user2"},
+		"base_1": {"user3"},
+	}, svc.users(t))
+	assert.Equal(t, 2, svc.calls["CreatePolicy"], "created policies")
+	assert.Equal(t, 0, svc.calls["CreatePolicyVersion"], "written policy versions")
+	assert.Equal(t, 2, svc.calls["AttachRolePolicy"], "attached policies")
+
+	for _, user := range []string{"user4", "user1"} {
+		_, err := EnsureUser(client, logger, config, user, user+"_role")
+		require.NoError(t, err, "unexpected error when changing %s", user)
+	}
+	require.NoError(t, RemoveUser(client, logger, config, "user2"), "unexpected error when removing user2")
+	require.NoError(t, client.Flush(), "unexpected error when flushing")
+
+	assert.Equal(t, map[string][]string{
+		"base_0": {"user1"},
+		"base_1": {"user3", "user4"},
+	}, svc.users(t))
+	assert.Equal(t, 2, svc.calls["CreatePolicyVersion"], "every policy should be written once")
+	assert.Equal(t, 1, svc.calls["ListPolicies"], "policies should be listed once")
+}
+
+func TestClient_batchRetry(t *testing.T) {
+	svc := newFakeIAM("login")
+	clock := &fakeClock{now: time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	client := newFakeClient(t, svc, clock, CacheConfig{TTL: time.Hour, BatchInterval: time.Hour})
+	logger := test.NewLogger(t)
+	config := EnsureUserConfig{
+		Region:            region,
+		AccountID:         accountID,
+		PolicyBaseName:    "base",
+		MaxUsersPerPolicy: 2,
+		RolePrefix:        rolePrefix,
+		AWSLoginRoles:     []string{"login"},
+	}
+
+	for _, user := range []string{"user1", "user2", "user3"} {
+		_, err := EnsureUser(client, logger, config, user, user)
+		require.NoError(t, err, "unexpected error when adding %s", user)
+	}
+	svc.fail["AttachRolePolicy"] = errors.New("throttled")
+	err := client.Flush()
+	assert.Error(t, err, "flush should fail")
+
+	// the pending changes are written on the next flush from the actual state
+	require.NoError(t, client.Flush(), "unexpected error when flushing again")
+	assert.Equal(t, map[string][]string{
+		"base_0": {"user1", "user2"},
+		"base_1": {"user3"},
+	}, svc.users(t))
+	assert.Equal(t, 2, svc.calls["ListPolicies"], "policies should be listed again after the failure")
+	assert.Equal(t, map[string]bool{"base_0": true, "base_1": true}, svc.attached["login"], "attached policies")
+}
+
+func TestClient_batchFailureReported(t *testing.T) {
+	svc := newFakeIAM("login")
+	clock := &fakeClock{now: time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	client := newFakeClient(t, svc, clock, CacheConfig{TTL: time.Hour, BatchInterval: time.Hour})
+	logger := test.NewLogger(t)
+	config := EnsureUserConfig{
+		Region:         region,
+		AccountID:      accountID,
+		PolicyBaseName: "base",
+		RolePrefix:     rolePrefix,
+		AWSLoginRoles:  []string{"login"},
+	}
+
+	_, err := EnsureUser(client, logger, config, "user1", "user1")
+	require.NoError(t, err, "unexpected error when adding user1")
+	svc.fail["AttachRolePolicy"] = errors.New("throttled")
+	assert.Error(t, client.Flush(), "flush should fail")
+	assert.NotNil(t, client.state.flush, "failed write should be retried")
+
+	_, err = EnsureUser(client, logger, config, "user1", "user1")
+	assert.Error(t, err, "user with a failed write should be reported")
+	_, err = EnsureUser(client, logger, config, "user2", "user2")
+	assert.NoError(t, err, "user added after the failed write should not be reported")
+
+	require.NoError(t, client.Flush(), "unexpected error when flushing again")
+	_, err = EnsureUser(client, logger, config, "user1", "user1")
+	assert.NoError(t, err, "user should not be reported after a successful write")
+	assert.Equal(t, map[string][]string{"base_0": {"user1", "user2"}}, svc.users(t))
+}
+
+func TestClient_batchFailureRetried(t *testing.T) {
+	svc := newFakeIAM("login")
+	clock := &fakeClock{now: time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	client := newFakeClient(t, svc, clock, CacheConfig{TTL: time.Hour, BatchInterval: time.Millisecond})
+	logger := test.NewLogger(t)
+	config := EnsureUserConfig{
+		Region:         region,
+		AccountID:      accountID,
+		PolicyBaseName: "base",
+		RolePrefix:     rolePrefix,
+		AWSLoginRoles:  []string{"login"},
+	}
+
+	svc.fail["AttachRolePolicy"] = errors.New("throttled")
+	_, err := EnsureUser(client, logger, config, "user1", "user1")
+	require.NoError(t, err, "unexpected error when adding user1")
+
+	// the scheduled write fails once and is written by the retry
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.state.desired == nil && client.state.failed == nil
+	}, time.Second, time.Millisecond, "changes should be written by the retry")
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.Equal(t, 2, svc.calls["AttachRolePolicy"], "attach should be retried")
+	assert.Equal(t, map[string][]string{"base_0": {"user1"}}, svc.users(t))
+}
+
+func TestClient_removeUserWritesRightAway(t *testing.T) {
+	svc := newFakeIAM("login")
+	clock := &fakeClock{now: time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	client := newFakeClient(t, svc, clock, CacheConfig{TTL: time.Hour, BatchInterval: time.Hour})
+	logger := test.NewLogger(t)
+	config := EnsureUserConfig{
+		Region:         region,
+		AccountID:      accountID,
+		PolicyBaseName: "base",
+		RolePrefix:     rolePrefix,
+		AWSLoginRoles:  []string{"login"},
+	}
+
+	_, err := EnsureUser(client, logger, config, "user1", "user1")
+	require.NoError(t, err, "unexpected error when adding user1")
+	require.NoError(t, client.Flush(), "unexpected error when flushing")
+	require.Contains(t, svc.documents, "base_0", "policy of user1")
+
+	svc.fail["DetachRolePolicy"] = errors.New("throttled")
+	err = RemoveUser(client, logger, config, "user1")
+	assert.Error(t, err, "a failed write should be returned")
+	assert.Contains(t, svc.documents, "base_0", "policy should not be deleted after a failed write")
+
+	err = RemoveUser(client, logger, config, "user1")
+	require.NoError(t, err, "unexpected error when removing user1 again")
+	assert.NotContains(t, svc.documents, "base_0", "empty policy should be deleted without a flush")
+	assert.False(t, svc.attached["login"]["base_0"], "empty policy should be detached")
+
+	_, err = EnsureUser(client, logger, config, "user2", "user2")
+	require.NoError(t, err, "unexpected error when adding user2")
+	err = RemoveUser(client, logger, config, "user3")
+	require.NoError(t, err, "unexpected error when removing unknown user3")
+	assert.Empty(t, svc.documents, "batched changes should not be written when removing a user without statements")
+}
+
+func TestClient_foreignPolicies(t *testing.T) {
+	svc := newFakeIAM("login")
+	foreign, err := json.Marshal(foreignPolicy("S3ReadOnlyForCI").Document)
+	require.NoError(t, err)
+	svc.documents["S3ReadOnlyForCI"] = string(foreign)
+	svc.versions["S3ReadOnlyForCI"] = 1
+	clock := &fakeClock{now: time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	client := newFakeClient(t, svc, clock, CacheConfig{})
+	logger := test.NewLogger(t)
+	config := EnsureUserConfig{
+		Region:         region,
+		AccountID:      accountID,
+		PolicyBaseName: "base",
+		RolePrefix:     rolePrefix,
+		AWSLoginRoles:  []string{"login"},
+	}
+
+	for _, user := range []string{"user1", "user2"} {
+		_, err := EnsureUser(client, logger, config, user, user)
+		require.NoError(t, err, "unexpected error when adding %s", user)
+	}
+	err = RemoveUser(client, logger, config, "user1")
+	require.NoError(t, err, "unexpected error when removing user1")
+	_, err = Sweep(client, logger, config, func() (map[string]bool, error) { return map[string]bool{"user2": true}, nil }, false)
+	require.NoError(t, err, "unexpected error when sweeping")
+
+	assert.Equal(t, string(foreign), svc.documents["S3ReadOnlyForCI"], "foreign policy should not be modified")
+	assert.Equal(t, 1, svc.versions["S3ReadOnlyForCI"], "foreign policy should not get new versions")
+	assert.False(t, svc.attached["login"]["S3ReadOnlyForCI"], "foreign policy should not be attached")
+	assert.Equal(t, []string{"user2"}, svc.users(t)["base_0"], "managed policy users")
+}
@@ -2,29 +2,58 @@ package iam
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsclient "github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	"github.com/go-logr/logr"
 )
 
+// throttleRetryer retries throttled IAM calls with exponential backoff. IAM
+// has low request rate limits per account so resyncs of many users may be
+// throttled.
+var throttleRetryer = awsclient.DefaultRetryer{
+	NumMaxRetries:    8,
+	MinRetryDelay:    awsclient.DefaultRetryerMinRetryDelay,
+	MaxRetryDelay:    5 * time.Second,
+	MinThrottleDelay: time.Second,
+	MaxThrottleDelay: 30 * time.Second,
+}
+
+// Client manages the IAM policies of the controller. It is safe for concurrent
+// use and meant to be created once and reused.
 type Client struct {
-	session      *session.Session
+	// mu serializes the read-modify-write cycles of EnsureUser, RemoveUser and
+	// Sweep on the policies and guards the cache.
+	mu           sync.Mutex
+	svc          iamiface.IAMAPI
 	log          logr.Logger
 	awsAccountID string
 	iamPrefix    string
+	cache        CacheConfig
+	now          func() time.Time
+	state        cacheState
 }
 
-func NewClient(session *session.Session, log logr.Logger, awsAccountID, iamPrefix string) *Client {
+// NewClient returns a Client managing the policies under iamPrefix in
+// awsAccountID. The policies are cached and changes to them batched as
+// configured by cache.
+func NewClient(session *session.Session, log logr.Logger, awsAccountID, iamPrefix string, cache CacheConfig) *Client {
 	return &Client{
-		session:      session,
+		svc:          iam.New(session, &aws.Config{Retryer: throttleRetryer}),
 		log:          log,
 		awsAccountID: awsAccountID,
 		iamPrefix:    iamPrefix,
+		cache:        cache,
+		now:          time.Now,
 	}
 }
 
@@ -36,10 +65,6 @@ func (c *Client) policyARN(policyName string) string {
 	return fmt.Sprintf("arn:aws:iam::%s:policy%s%s", c.awsAccountID, c.iamPrefix, policyName)
 }
 
-func (c *Client) listIAMPolicies() ([]*iam.Policy, error) {
-	return c.listPolicies()
-}
-
 func (c *Client) ListPolicies() ([]*Policy, error) {
 
 	iamPolicies, err := c.listPolicies()
@@ -70,10 +95,9 @@ func (c *Client) ListPolicies() ([]*Policy, error) {
 
 func (c *Client) listPolicies() ([]*iam.Policy, error) {
 	var result []*iam.Policy
-	iamClient := iam.New(c.session)
 	maxItems := int64(500)
 
-	err := iamClient.ListPoliciesPages(&iam.ListPoliciesInput{
+	err := c.svc.ListPoliciesPages(&iam.ListPoliciesInput{
 		MaxItems:   &maxItems,
 		PathPrefix: aws.String(c.iamPrefix),
 	}, func(page *iam.ListPoliciesOutput, lastPage bool) bool {
@@ -90,10 +114,8 @@ func (c *Client) listPolicies() ([]*iam.Policy, error) {
 
 func (c *Client) getPolicyDocument(policy *iam.Policy) (*PolicyDocument, error) {
 
-	svc := iam.New(c.session)
-
 	policyARN := c.policyARN(*policy.PolicyName)
-	currentVersion, err := svc.GetPolicyVersion(&iam.GetPolicyVersionInput{VersionId: policy.DefaultVersionId, PolicyArn: aws.String(policyARN)})
+	currentVersion, err := c.svc.GetPolicyVersion(&iam.GetPolicyVersionInput{VersionId: policy.DefaultVersionId, PolicyArn: aws.String(policyARN)})
 	if err != nil {
 		return nil, fmt.Errorf("retrieve policy version %s with policy ARN %s failed: %w", *policy.DefaultVersionId, policyARN, err)
 	}
@@ -115,10 +137,8 @@ func (c *Client) getPolicyDocument(policy *iam.Policy) (*PolicyDocument, error)
 }
 
 func (c *Client) UpdatePolicy(policy *Policy) error {
-	svc := iam.New(c.session)
-
 	// Create the new version of the Policy
-	err := c.updatePolicy(policy, svc)
+	err := c.updatePolicy(policy)
 	if err != nil {
 		return fmt.Errorf("update policy: %s: %w", policy.Name, err)
 	}
@@ -126,10 +146,10 @@ func (c *Client) UpdatePolicy(policy *Policy) error {
 	return nil
 }
 
-func (c *Client) deleteOldPolicyVersions(policy *Policy, svc *iam.IAM) error {
+func (c *Client) deleteOldPolicyVersions(policy *Policy) error {
 	policyARN := c.strPtr(c.policyARN(policy.Name))
 
-	policyVersionOutput, err := svc.ListPolicyVersions(&iam.ListPolicyVersionsInput{
+	policyVersionOutput, err := c.svc.ListPolicyVersions(&iam.ListPolicyVersionsInput{
 		PolicyArn: policyARN,
 	})
 	if err != nil {
@@ -140,7 +160,7 @@ func (c *Client) deleteOldPolicyVersions(policy *Policy, svc *iam.IAM) error {
 			continue
 		}
 
-		_, err := svc.DeletePolicyVersion(&iam.DeletePolicyVersionInput{
+		_, err := c.svc.DeletePolicyVersion(&iam.DeletePolicyVersionInput{
 			PolicyArn: policyARN,
 			VersionId: version.VersionId,
 		})
@@ -164,15 +184,13 @@ func (c *Client) deleteOldPolicyVersions(policy *Policy, svc *iam.IAM) error {
 
 func (c *Client) CreatePolicy(policy *Policy) (*iam.Policy, error) {
 
-	svc := iam.New(c.session)
-
 	jsonMarshal, err := json.Marshal(*policy.Document)
 	if err != nil {
 		c.log.Error(err, "json marshalling failed", "document", policy.Document)
 		return nil, fmt.Errorf("unable to marshal document: %s: %w", policy.Name, err)
 	}
 
-	response, err := svc.CreatePolicy(&iam.CreatePolicyInput{
+	response, err := c.svc.CreatePolicy(&iam.CreatePolicyInput{
 		Description:    aws.String("Created by postgresql controller"),
 		Path:           aws.String(c.iamPrefix),
 		PolicyDocument: aws.String(string(jsonMarshal)),
@@ -189,10 +207,9 @@ func (c *Client) CreatePolicy(policy *Policy) (*iam.Policy, error) {
 func (c *Client) listAttachedPolicies(role *iam.Role, prefix string) ([]*iam.AttachedPolicy, error) {
 
 	var result []*iam.AttachedPolicy
-	svc := iam.New(c.session)
 	maxItems := int64(500)
 
-	err := svc.ListAttachedRolePoliciesPages(&iam.ListAttachedRolePoliciesInput{
+	err := c.svc.ListAttachedRolePoliciesPages(&iam.ListAttachedRolePoliciesInput{
 		MaxItems:   &maxItems,
 		PathPrefix: &prefix,
 		RoleName:   role.RoleName,
@@ -214,8 +231,6 @@ func (c *Client) ListManagedAttachedPolicies(role *iam.Role) ([]*iam.AttachedPol
 
 func (c *Client) AttachPolicy(role *iam.Role, policy *iam.Policy) error {
 
-	svc := iam.New(c.session)
-
 	attachedPolicies, err := c.ListManagedAttachedPolicies(role)
 
 	if err != nil {
@@ -223,7 +238,7 @@ func (c *Client) AttachPolicy(role *iam.Role, policy *iam.Policy) error {
 	}
 
 	if !c.hasAttachedPolicy(attachedPolicies, *policy.PolicyName) {
-		_, err := svc.AttachRolePolicy(&iam.AttachRolePolicyInput{
+		_, err := c.svc.AttachRolePolicy(&iam.AttachRolePolicyInput{
 			PolicyArn: policy.Arn,
 			RoleName:  role.RoleName,
 		})
@@ -247,9 +262,7 @@ func (c *Client) hasAttachedPolicy(policies []*iam.AttachedPolicy, name string)
 
 func (c *Client) GetRole(roleName string) (*iam.Role, error) {
 
-	svc := iam.New(c.session)
-
-	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: &roleName})
+	role, err := c.svc.GetRole(&iam.GetRoleInput{RoleName: &roleName})
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to list attached policies: %w", err)
@@ -258,52 +271,87 @@ func (c *Client) GetRole(roleName string) (*iam.Role, error) {
 	return role.Role, nil
 }
 
-func (c *Client) DeleteAndDetachPolicy(policy *Policy, roleNames []string) error {
-	svc := iam.New(c.session)
-
-	policies, err := c.listPolicies()
-
+// DeletePolicy deletes policy. IAM refuses to delete policies that are
+// attached or have multiple versions so the policy is first detached from
+// every role, user and group and its non-default versions are deleted. It is a
+// noop if the policy does not exist.
+func (c *Client) DeletePolicy(policy *Policy) error {
+	policyARN := aws.String(c.policyARN(policy.Name))
+
+	var (
+		roles  []*iam.PolicyRole
+		users  []*iam.PolicyUser
+		groups []*iam.PolicyGroup
+	)
+	err := c.svc.ListEntitiesForPolicyPages(&iam.ListEntitiesForPolicyInput{
+		PolicyArn: policyARN,
+	}, func(page *iam.ListEntitiesForPolicyOutput, lastPage bool) bool {
+		roles = append(roles, page.PolicyRoles...)
+		users = append(users, page.PolicyUsers...)
+		groups = append(groups, page.PolicyGroups...)
+		return true
+	})
 	if err != nil {
-		return fmt.Errorf("unable to list policies: %w", err)
+		if isNoSuchEntity(err) {
+			return nil
+		}
+		return fmt.Errorf("list entities of policy %s: %w", policy.Name, err)
 	}
 
-	existing := c.lookupPolicy(policies, policy.Name)
-
-	if existing == nil {
-		return nil
+	for _, role := range roles {
+		_, err := c.svc.DetachRolePolicy(&iam.DetachRolePolicyInput{
+			PolicyArn: policyARN,
+			RoleName:  role.RoleName,
+		})
+		if err != nil && !isNoSuchEntity(err) {
+			return fmt.Errorf("detach policy %s from role %s: %w", policy.Name, *role.RoleName, err)
+		}
+		delete(c.state.attached[*role.RoleName], policy.Name)
 	}
-
-	for _, name := range roleNames {
-		_, err := svc.DetachRolePolicy(&iam.DetachRolePolicyInput{
-			PolicyArn: existing.Arn,
-			RoleName:  aws.String(name),
+	for _, user := range users {
+		_, err := c.svc.DetachUserPolicy(&iam.DetachUserPolicyInput{
+			PolicyArn: policyARN,
+			UserName:  user.UserName,
 		})
-		if err != nil {
-			return fmt.Errorf("unable to delete policy %s: %w", policy.Name, err)
+		if err != nil && !isNoSuchEntity(err) {
+			return fmt.Errorf("detach policy %s from user %s: %w", policy.Name, *user.UserName, err)
+		}
+	}
+	for _, group := range groups {
+		_, err := c.svc.DetachGroupPolicy(&iam.DetachGroupPolicyInput{
+			PolicyArn: policyARN,
+			GroupName: group.GroupName,
+		})
+		if err != nil && !isNoSuchEntity(err) {
+			return fmt.Errorf("detach policy %s from group %s: %w", policy.Name, *group.GroupName, err)
 		}
 	}
 
-	_, err = svc.DeletePolicy(&iam.DeletePolicyInput{
-		PolicyArn: aws.String(*existing.Arn),
-	})
-
+	err = c.deleteOldPolicyVersions(policy)
 	if err != nil {
+		if isNoSuchEntity(err) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = c.svc.DeletePolicy(&iam.DeletePolicyInput{
+		PolicyArn: policyARN,
+	})
+	if err != nil && !isNoSuchEntity(err) {
 		return fmt.Errorf("unable to delete policy %s: %w", policy.Name, err)
 	}
 
 	return nil
 }
 
-func (c *Client) lookupPolicy(policies []*iam.Policy, name string) *iam.Policy {
-	for _, r := range policies {
-		if *r.PolicyName == name {
-			return r
-		}
-	}
-	return nil
+// isNoSuchEntity reports whether err is an IAM error about a missing entity.
+func isNoSuchEntity(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == iam.ErrCodeNoSuchEntityException
 }
 
-func (c *Client) updatePolicy(policy *Policy, svc *iam.IAM) error {
+func (c *Client) updatePolicy(policy *Policy) error {
 	// Marshal the updated policy document back to something AWS understands
 	jsonMarshal, err := json.Marshal(policy.Document)
 	if err != nil {
@@ -313,19 +361,19 @@ func (c *Client) updatePolicy(policy *Policy, svc *iam.IAM) error {
 
 	arn := c.policyARN(policy.Name)
 	setAsDefault := true
-	_, err = svc.CreatePolicyVersion(&iam.CreatePolicyVersionInput{PolicyArn: aws.String(arn), PolicyDocument: aws.String(string(jsonMarshal)), SetAsDefault: &setAsDefault})
+	_, err = c.svc.CreatePolicyVersion(&iam.CreatePolicyVersionInput{PolicyArn: aws.String(arn), PolicyDocument: aws.String(string(jsonMarshal)), SetAsDefault: &setAsDefault})
 	if err != nil {
 		if awsErr, ok := err.(awserr.Error); ok {
 			// process SDK error
 			switch awsErr.Code() {
 			case iam.ErrCodeLimitExceededException:
 				// Check if we have hit the policy version limit
-				err = c.deleteOldPolicyVersions(policy, svc)
+				err = c.deleteOldPolicyVersions(policy)
 				if err != nil {
 					return fmt.Errorf("delete old policy versions: %s: %w", policy.Name, err)
 				}
 
-				_, err = svc.CreatePolicyVersion(&iam.CreatePolicyVersionInput{PolicyArn: aws.String(arn), PolicyDocument: aws.String(string(jsonMarshal)), SetAsDefault: &setAsDefault})
+				_, err = c.svc.CreatePolicyVersion(&iam.CreatePolicyVersionInput{PolicyArn: aws.String(arn), PolicyDocument: aws.String(string(jsonMarshal)), SetAsDefault: &setAsDefault})
 				if err != nil {
 					return fmt.Errorf("create policy version: %s: %w", policy.Name, err)
 				}
@@ -0,0 +1,114 @@
+package iam
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+
+	"go.lunarway.com/postgresql-controller/pkg/metrics"
+)
+
+// SweepResult describes the outcome of a sweep of the managed policies.
+type SweepResult struct {
+	// Orphaned holds the sorted names of users with statements but no owner.
+	Orphaned []string
+	// Duplicated holds the sorted names of users with more than one
+	// statement.
+	Duplicated []string
+	// Plan holds the changes removing the orphaned and duplicate statements.
+	Plan *Plan
+}
+
+// PlanSweep returns the changes that remove statements of users not in owners
+// and duplicate statements of a user from policies. The first statement of a
+// user in policy order is kept. Statements not matching the configured
+// principals and policies not named after the policy base name are left
+// untouched as they are not managed by the controller.
+func PlanSweep(config EnsureUserConfig, policies []*Policy, owners map[string]bool) (SweepResult, error) {
+	policies = ownedPolicies(config.PolicyBaseName, policies)
+	p := newPlanner(config, nil)
+	statements := make(map[string]int)
+	for _, policy := range policies {
+		for _, statement := range policy.Document.Statement {
+			_, username, ok := p.migrate(statement)
+			if ok {
+				statements[username]++
+			}
+		}
+	}
+	var result SweepResult
+	for username, count := range statements {
+		if !owners[username] {
+			result.Orphaned = append(result.Orphaned, username)
+		}
+		if count > 1 {
+			result.Duplicated = append(result.Duplicated, username)
+		}
+	}
+	sort.Strings(result.Orphaned)
+	sort.Strings(result.Duplicated)
+
+	// duplicates are removed when the planner is created
+	p = newPlanner(config, policies)
+	for _, username := range result.Orphaned {
+		for _, policy := range p.policies {
+			policy.Document.Remove(p.principal, username)
+		}
+	}
+	overflow := p.overflow[:0:0]
+	for _, s := range p.overflow {
+		if name, ok := s.user(p.principal); !ok || owners[name] {
+			overflow = append(overflow, s)
+		}
+	}
+	p.overflow = overflow
+	err := p.addOverflow()
+	if err != nil {
+		return SweepResult{}, err
+	}
+	p.compact()
+	result.Plan = p.plan()
+	return result, nil
+}
+
+// Sweep removes statements of users without an owner and duplicate statements
+// of a user from the managed policies. owners is called after the policies are
+// listed and returns the names of the users that may have statements.
+//
+// With reportOnly the changes are computed but not applied.
+func Sweep(client *Client, log logr.Logger, config EnsureUserConfig, owners func() (map[string]bool, error), reportOnly bool) (SweepResult, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	// pending changes are written and the policies read again as the sweep
+	// should not act on a stale cache
+	err := client.flush(log)
+	if err != nil {
+		return SweepResult{}, err
+	}
+	policies, err := client.refresh()
+	if err != nil {
+		return SweepResult{}, err
+	}
+	// owners are listed after the policies so statements of users created
+	// meanwhile are not in the listed policies
+	owned, err := owners()
+	if err != nil {
+		return SweepResult{}, fmt.Errorf("list owners: %w", err)
+	}
+
+	result, err := PlanSweep(config, policies, owned)
+	if err != nil {
+		return SweepResult{}, fmt.Errorf("plan sweep: %w", err)
+	}
+	metrics.SetIAMSweep(len(result.Orphaned), len(result.Duplicated))
+	if reportOnly {
+		return result, nil
+	}
+	err = client.commit(log, config, result.Plan)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
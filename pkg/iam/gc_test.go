@@ -0,0 +1,96 @@
+package iam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanSweep(t *testing.T) {
+	config := EnsureUserConfig{
+		Region:         region,
+		AccountID:      accountID,
+		PolicyBaseName: "base",
+		RolePrefix:     rolePrefix,
+		MaxPolicySize:  sizeFor(t, 4),
+	}
+	owners := func(users ...string) map[string]bool {
+		m := make(map[string]bool, len(users))
+		for _, user := range users {
+			m[user] = true
+		}
+		return m
+	}
+
+	t.Run("nothing to sweep", func(t *testing.T) {
+		result, err := PlanSweep(config, []*Policy{testPolicy("base_0", "aaa", "baa")}, owners("aaa", "baa", "caa"))
+		require.NoError(t, err)
+		assert.Empty(t, result.Orphaned, "orphaned users")
+		assert.Empty(t, result.Duplicated, "duplicated users")
+		assert.True(t, result.Plan.Empty(), "plan should be empty")
+	})
+
+	t.Run("removes orphaned statements", func(t *testing.T) {
+		result, err := PlanSweep(config, []*Policy{
+			testPolicy("base_0", "aaa", "baa", "caa"),
+			testPolicy("base_1", "daa"),
+		}, owners("aaa", "caa"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"baa", "daa"}, result.Orphaned, "orphaned users")
+		assert.Equal(t, map[string][]string{"base_0": {"aaa", "caa"}}, policyUsers(result.Plan.Policies))
+		assert.Equal(t, []string{"base_0"}, policyNames(result.Plan.Shrink), "shrunk policies")
+		assert.Equal(t, []string{"base_1"}, policyNames(result.Plan.Delete), "deleted policies")
+	})
+
+	t.Run("removes duplicate statements", func(t *testing.T) {
+		result, err := PlanSweep(config, []*Policy{
+			testPolicy("base_0", "aaa", "baa", "caa"),
+			testPolicy("base_1", "aaa", "daa", "eaa"),
+		}, owners("aaa", "baa", "caa", "daa", "eaa"))
+		require.NoError(t, err)
+		assert.Empty(t, result.Orphaned, "orphaned users")
+		assert.Equal(t, []string{"aaa"}, result.Duplicated, "duplicated users")
+		assert.Equal(t, map[string][]string{
+			"base_0": {"aaa", "baa", "caa"},
+			"base_1": {"daa", "eaa"},
+		}, policyUsers(result.Plan.Policies))
+		assert.Equal(t, []string{"base_1"}, policyNames(result.Plan.Shrink), "shrunk policies")
+	})
+
+	t.Run("removes duplicates of orphans", func(t *testing.T) {
+		result, err := PlanSweep(config, []*Policy{
+			testPolicy("base_0", "aaa", "baa"),
+			testPolicy("base_1", "aaa", "caa"),
+		}, owners("baa", "caa"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"aaa"}, result.Orphaned, "orphaned users")
+		assert.Equal(t, []string{"aaa"}, result.Duplicated, "duplicated users")
+		assert.Equal(t, map[string][]string{"base_0": {"baa", "caa"}}, policyUsers(result.Plan.Policies))
+		assert.Equal(t, []string{"base_1"}, policyNames(result.Plan.Delete), "deleted policies")
+	})
+
+	t.Run("leaves foreign policies untouched", func(t *testing.T) {
+		result, err := PlanSweep(config, []*Policy{
+			testPolicy("base_0", "aaa"),
+			foreignPolicy("S3ReadOnlyForCI"),
+			testPolicy("other", "baa"),
+		}, owners("aaa"))
+		require.NoError(t, err)
+		assert.Empty(t, result.Orphaned, "orphaned users")
+		assert.True(t, result.Plan.Empty(), "plan should be empty")
+		assert.Equal(t, []string{"base_0"}, policyNames(result.Plan.Policies))
+	})
+
+	t.Run("keeps unmanaged statements", func(t *testing.T) {
+		other := Principal{Key: PrincipalKeyUsername, Template: PrincipalNamePlaceholder}
+		policy := testPolicy("base_0", "aaa", "baa")
+		policy.Document.Add(other, region, accountID, rolePrefix, "caa", "caa")
+
+		result, err := PlanSweep(config, []*Policy{policy}, owners("aaa"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"baa"}, result.Orphaned, "orphaned users")
+		require.Len(t, result.Plan.Policies, 1)
+		assert.Equal(t, []string{"caa"}, result.Plan.Policies[0].Document.ListUsers(other), "unmanaged users")
+	})
+}
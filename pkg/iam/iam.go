@@ -3,122 +3,151 @@ package iam
 import (
 	"fmt"
 
-	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/go-logr/logr"
 	"go.uber.org/multierr"
+
+	"go.lunarway.com/postgresql-controller/pkg/metrics"
 )
 
 type EnsureUserConfig struct {
-	Region            string
-	AccountID         string
-	PolicyBaseName    string
+	Region         string
+	AccountID      string
+	PolicyBaseName string
+	// MaxPolicySize is the maximum size of a policy document. It defaults to
+	// MaxPolicySize.
+	MaxPolicySize int
+	// MaxUsersPerPolicy optionally caps the number of users in a policy. Zero
+	// means that policies are only limited by their size.
 	MaxUsersPerPolicy int
 	RolePrefix        string
 	AWSLoginRoles     []string
+	// Principal maps user names to their AWS principal. It defaults to
+	// DefaultPrincipal.
+	Principal Principal
+	// PreviousPrincipals are principals used earlier. Statements matching them
+	// are migrated to Principal.
+	PreviousPrincipals []Principal
+}
+
+func (c EnsureUserConfig) principal() Principal {
+	if c.Principal == (Principal{}) {
+		return DefaultPrincipal
+	}
+	return c.Principal
 }
 
-func EnsureUser(client *Client, log logr.Logger, config EnsureUserConfig, userName, rolename string) error {
-	users := make(map[string]struct{})
-	log.V(1).Info("listing iam policies")
-	policies, err := client.ListPolicies()
+// EnsureUser ensures that userName is allowed to connect as rolename on the RDS
+// instances with resourceIDs in one of the managed IAM policies. Without
+// resourceIDs the user may connect to every instance. It returns the name of
+// the policy holding the user.
+//
+// Users are packed into policies by the size of their rendered documents. See
+// PlanEnsureUser for details. With a batch interval configured on client the
+// change is written with the other changes of the interval. If writing changes
+// of the user failed, an error is returned until a retried write succeeds.
+func EnsureUser(client *Client, log logr.Logger, config EnsureUserConfig, userName, rolename string, resourceIDs ...string) (string, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	policies, err := client.policies()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	for _, policy := range policies {
-		usersInPolicy := policy.Document.ListUsers()
-		for _, user := range usersInPolicy {
-			users[user] = struct{}{}
-		}
+	plan, err := PlanEnsureUser(config, policies, userName, rolename, resourceIDs...)
+	if err != nil {
+		return "", fmt.Errorf("plan policies for user %s: %w", userName, err)
+	}
+	err = client.commit(log, config, plan, userName)
+	if err != nil {
+		return "", err
+	}
+	// the change is kept and retried but the caller must not consider the user
+	// allowed to connect before it is written
+	if err := client.state.failed[userName]; err != nil {
+		return "", fmt.Errorf("write batched policy changes of user %s: %w", userName, err)
 	}
 
-	userHandled := false
-	if _, ok := users[userName]; ok {
-		for _, policy := range policies {
-			if !policy.Document.Exists(userName) {
-				continue
-			}
-
-			// Try to update the document where the user is present to ensure correct roleName.
-			updated := policy.Document.Update(config.Region, config.AccountID, config.RolePrefix, userName, rolename)
-			if updated {
-				log.V(1).Info("updating policies for user", "userName", userName, "roleName", rolename)
-				err = updatePolicies(client, policies)
-				if err != nil {
-					return err
-				}
-			}
-
-			userHandled = true
-		}
-		// If the user does not exists, then see if we can find room in an existing policy document
-	} else {
-		for _, policy := range policies {
-			if policy.Document.Count() < config.MaxUsersPerPolicy {
-				log.V(1).Info("adding user to policy document", "userName", userName, "roleName", rolename)
-				policy.Document.Add(config.Region, config.AccountID, config.RolePrefix, userName, rolename)
-				err = updatePolicies(client, policies)
-				if err != nil {
-					return err
-				}
-
-				userHandled = true
-			}
-		}
+	return plan.PolicyOf(userName), nil
+}
+
+// RemoveUser removes username from the managed IAM policies. Policies left
+// empty are detached and deleted and sparse policies are compacted. If the
+// policies written to IAM may hold the user, the changes are written right away
+// together with any batched changes.
+func RemoveUser(client *Client, log logr.Logger, config EnsureUserConfig, username string) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	policies, err := client.policies()
+	if err != nil {
+		return err
 	}
 
-	// User could not be handled in an existing policy so we create a new one instead.
-	if !userHandled {
-		log.V(1).Info("creating a new policy document because of user", "userName", userName, "roleName", rolename)
-		// TODO : There is a bug where where the new name might exist. This could for instance be the case where a policy i is deleted but i+1 exists. Then len(policies) = i+1 and there is a clash.
-		newPolicy := &Policy{
-			Name:     fmt.Sprintf("%s_%d", config.PolicyBaseName, len(policies)),
-			Document: &PolicyDocument{Version: "2012-10-17"},
-		}
+	plan, err := PlanRemoveUser(config, policies, username)
+	if err != nil {
+		return fmt.Errorf("plan policies for user %s: %w", username, err)
+	}
+	err = client.commit(log, config, plan, username)
+	if err != nil || client.cache.BatchInterval <= 0 || !client.written(config, username) {
+		return err
+	}
+	// removals are written right away as they are not retried once the
+	// finalizer of the user is removed
+	return client.flushNow(log)
+}
 
-		newPolicy.Document.Add(config.Region, config.AccountID, config.RolePrefix, userName, rolename)
-		newAwsPolicy, err := client.CreatePolicy(newPolicy)
+// applyPlan applies the changes of plan in order. New policies are attached to
+// the login roles before any user is removed from an existing policy so users
+// moved between policies keep their access.
+func applyPlan(client *Client, log logr.Logger, config EnsureUserConfig, plan *Plan) error {
+	for _, policy := range plan.Create {
+		log.V(1).Info("creating policy", "policy", policy.Name, "users", policy.Document.Count())
+		_, err := client.CreatePolicy(policy)
 		if err != nil {
 			return err
 		}
 
-		err = attachPolicyToAwsLoginRoles(client, config, newAwsPolicy)
+		err = client.attach(config, policy.Name)
 		if err != nil {
 			return err
 		}
 	}
-
-	iamPolicies, err := client.listIAMPolicies()
+	for _, policy := range plan.Grow {
+		log.V(1).Info("adding users to policy", "policy", policy.Name, "users", policy.Document.Count())
+	}
+	err := updatePolicies(client, plan.Grow)
 	if err != nil {
 		return err
 	}
-
-	err = attachPolicyToAwsLoginRoles(client, config, iamPolicies...)
+	for _, policy := range plan.Shrink {
+		log.V(1).Info("removing users from policy", "policy", policy.Name, "users", policy.Document.Count())
+	}
+	err = updatePolicies(client, plan.Shrink)
 	if err != nil {
 		return err
 	}
-
-	return nil
-}
-
-func attachPolicyToAwsLoginRoles(client *Client, config EnsureUserConfig, policies ...*iam.Policy) error {
-	for _, roleName := range config.AWSLoginRoles {
-		role, err := client.GetRole(roleName)
+	for _, policy := range plan.Delete {
+		log.V(1).Info("deleting empty policy", "policy", policy.Name)
+		err := client.DeletePolicy(policy)
 		if err != nil {
 			return err
 		}
-
-		for _, policy := range policies {
-			err = client.AttachPolicy(role, policy)
-			if err != nil {
-				return err
-			}
-		}
 	}
-
 	return nil
 }
 
+// observePolicies records the number of managed policies and how full they
+// are in the metrics.
+func observePolicies(policies []*Policy, config EnsureUserConfig) {
+	p := newPlanner(config, nil)
+	fill := make(map[string]float64, len(policies))
+	for _, policy := range policies {
+		fill[policy.Name] = p.fill(policy.Document)
+	}
+	metrics.SetIAMPolicies(fill)
+}
+
 func updatePolicies(client *Client, policies []*Policy) error {
 	var errs error
 	for _, policy := range policies {
@@ -134,30 +163,3 @@ func updatePolicies(client *Client, policies []*Policy) error {
 
 	return nil
 }
-
-func RemoveUser(client *Client, awsLoginRoles []string, username string) error {
-	policies, err := client.ListPolicies()
-	if err != nil {
-		return err
-	}
-
-	for _, policy := range policies {
-		if policy.Document.Exists(username) {
-			policy.Document.Remove(username)
-
-			if policy.Document.Count() == 0 {
-				err := client.DeleteAndDetachPolicy(policy, awsLoginRoles)
-				if err != nil {
-					return err
-				}
-			} else {
-				err := client.UpdatePolicy(policy)
-				if err != nil {
-					return err
-				}
-			}
-		}
-	}
-
-	return nil
-}
@@ -62,7 +62,7 @@ func TestEnsureUser_roleChange(t *testing.T) {
 
 	session := CreateSession()
 	svc := iam.New(session)
-	client := NewClient(session, logger, accountID, iamPrefix)
+	client := NewClient(session, logger, accountID, iamPrefix, CacheConfig{})
 
 	createRole(t, svc, accountID, role)
 	addUserConfig := EnsureUserConfig{
@@ -77,11 +77,11 @@ func TestEnsureUser_roleChange(t *testing.T) {
 	}
 
 	// add a user
-	err := EnsureUser(client, logger, addUserConfig, "user1", "role1")
+	_, err := EnsureUser(client, logger, addUserConfig, "user1", "role1")
 	require.NoError(t, err, "unexpected error when adding the first user")
 
 	// update with a new role
-	err = EnsureUser(client, logger, addUserConfig, "user1", "role2")
+	_, err = EnsureUser(client, logger, addUserConfig, "user1", "role2")
 	require.NoError(t, err, "unexpected error when updating the first user")
 
 	expectedPolicies := []*Policy{
@@ -97,8 +97,8 @@ func TestEnsureUser_roleChange(t *testing.T) {
 						},
 						Effect: "Allow",
 						Condition: StringLike{
-							StringLike: UserID{
-								AWSUserID: "*:user1@lunar.app",
+							StringLike: map[string]string{
+								"aws:userid": "*:user1@lunar.app",
 							},
 						},
 						Resource: []string{
@@ -126,7 +126,7 @@ func TestEnsureUser_AWSLoginRole_Added(t *testing.T) {
 
 	session := CreateSession()
 	svc := iam.New(session)
-	client := NewClient(session, logger, accountID, iamPrefix)
+	client := NewClient(session, logger, accountID, iamPrefix, CacheConfig{})
 
 	createRole(t, svc, accountID, existingRole)
 	existingUserConfig := EnsureUserConfig{
@@ -141,7 +141,7 @@ func TestEnsureUser_AWSLoginRole_Added(t *testing.T) {
 	}
 
 	// add a user
-	err := EnsureUser(client, logger, existingUserConfig, "user1", "role1")
+	_, err := EnsureUser(client, logger, existingUserConfig, "user1", "role1")
 	require.NoError(t, err, "unexpected error when adding the first user")
 
 	assertPolicyOnAWSLoginRole(t, client, existingRole)
@@ -161,12 +161,233 @@ func TestEnsureUser_AWSLoginRole_Added(t *testing.T) {
 		},
 	}
 
-	err = EnsureUser(client, logger, newUserConfig, "user1", "role1")
+	_, err = EnsureUser(client, logger, newUserConfig, "user1", "role1")
 	require.NoError(t, err, "unexpected error when adding the user to the new AWSLoginRole")
 
 	assertPolicyOnAWSLoginRole(t, client, newRole)
 }
 
+// TestEnsureUser_lowestFreeIndex tests that new policies reuse the index of a
+// deleted policy.
+func TestEnsureUser_lowestFreeIndex(t *testing.T) {
+	test.Integration(t)
+
+	logger := test.NewLogger(t)
+
+	var (
+		policyBaseName = t.Name()
+		iamPrefix      = GenerateRandomString(10)
+		role           = fmt.Sprintf("GoogleDevLogin_%s", GenerateRandomString(5))
+	)
+
+	session := CreateSession()
+	svc := iam.New(session)
+	client := NewClient(session, logger, accountID, iamPrefix, CacheConfig{})
+
+	createRole(t, svc, accountID, role)
+	config := EnsureUserConfig{
+		Region:            "eu-west-1",
+		AccountID:         accountID,
+		PolicyBaseName:    policyBaseName,
+		MaxUsersPerPolicy: 1,
+		RolePrefix:        "iam_developer_",
+		AWSLoginRoles: []string{
+			role,
+		},
+	}
+
+	for i, user := range []string{"user1", "user2", "user3"} {
+		policyName, err := EnsureUser(client, logger, config, user, user)
+		require.NoError(t, err, "unexpected error when adding %s", user)
+		assert.Equal(t, fmt.Sprintf("%s_%d", policyBaseName, i), policyName, "policy of %s", user)
+	}
+
+	err := RemoveUser(client, logger, config, "user2")
+	require.NoError(t, err, "unexpected error when removing user2")
+
+	policyName, err := EnsureUser(client, logger, config, "user4", "user4")
+	require.NoError(t, err, "unexpected error when adding user4")
+	assert.Equal(t, fmt.Sprintf("%s_1", policyBaseName), policyName, "policy of user4")
+
+	assertPolicyUsers(t, client, map[string][]string{
+		fmt.Sprintf("%s_0", policyBaseName): {"user1"},
+		fmt.Sprintf("%s_1", policyBaseName): {"user4"},
+		fmt.Sprintf("%s_2", policyBaseName): {"user3"},
+	})
+	assertAttachedPolicies(t, client, role, 3)
+}
+
+// TestRemoveUser_compaction tests that a sparse policy is emptied into other
+// policies and deleted.
+func TestRemoveUser_compaction(t *testing.T) {
+	test.Integration(t)
+
+	logger := test.NewLogger(t)
+
+	var (
+		policyBaseName = t.Name()
+		iamPrefix      = GenerateRandomString(10)
+		role           = fmt.Sprintf("GoogleDevLogin_%s", GenerateRandomString(5))
+	)
+
+	session := CreateSession()
+	svc := iam.New(session)
+	client := NewClient(session, logger, accountID, iamPrefix, CacheConfig{})
+
+	createRole(t, svc, accountID, role)
+	config := EnsureUserConfig{
+		Region:            "eu-west-1",
+		AccountID:         accountID,
+		PolicyBaseName:    policyBaseName,
+		MaxUsersPerPolicy: 4,
+		RolePrefix:        "iam_developer_",
+		AWSLoginRoles: []string{
+			role,
+		},
+	}
+
+	for _, user := range []string{"user1", "user2", "user3", "user4", "user5"} {
+		_, err := EnsureUser(client, logger, config, user, user)
+		require.NoError(t, err, "unexpected error when adding %s", user)
+	}
+	assertAttachedPolicies(t, client, role, 2)
+
+	err := RemoveUser(client, logger, config, "user1")
+	require.NoError(t, err, "unexpected error when removing user1")
+
+	assertPolicyUsers(t, client, map[string][]string{
+		fmt.Sprintf("%s_0", policyBaseName): {"user2", "user3", "user4", "user5"},
+	})
+	assertAttachedPolicies(t, client, role, 1)
+}
+
+// TestClient_DeletePolicy tests that policies attached to roles and users with
+// multiple versions are deleted.
+func TestClient_DeletePolicy(t *testing.T) {
+	test.Integration(t)
+
+	logger := test.NewLogger(t)
+
+	var (
+		iamPrefix = GenerateRandomString(10)
+		role      = fmt.Sprintf("GoogleDevLogin_%s", GenerateRandomString(5))
+		user      = fmt.Sprintf("user_%s", GenerateRandomString(5))
+	)
+
+	session := CreateSession()
+	svc := iam.New(session)
+	client := NewClient(session, logger, accountID, iamPrefix, CacheConfig{})
+
+	createRole(t, svc, accountID, role)
+	_, err := svc.CreateUser(&iam.CreateUserInput{UserName: &user})
+	require.NoError(t, err)
+
+	policy := &Policy{
+		Name:     t.Name(),
+		Document: NewPolicyDocument("2012-10-17"),
+	}
+	policy.Document.Add(DefaultPrincipal, region, accountID, rolePrefix, "user1", "role1")
+	iamPolicy, err := client.CreatePolicy(policy)
+	require.NoError(t, err)
+	policy.Document.Add(DefaultPrincipal, region, accountID, rolePrefix, "user2", "role2")
+	require.NoError(t, client.UpdatePolicy(policy))
+
+	_, err = svc.AttachRolePolicy(&iam.AttachRolePolicyInput{PolicyArn: iamPolicy.Arn, RoleName: &role})
+	require.NoError(t, err)
+	_, err = svc.AttachUserPolicy(&iam.AttachUserPolicyInput{PolicyArn: iamPolicy.Arn, UserName: &user})
+	require.NoError(t, err)
+
+	err = client.DeletePolicy(policy)
+	require.NoError(t, err, "unexpected error when deleting the policy")
+
+	policies, err := client.ListPolicies()
+	require.NoError(t, err)
+	assert.Empty(t, policies, "policy should be deleted")
+	assertAttachedPolicies(t, client, role, 0)
+
+	err = client.DeletePolicy(policy)
+	assert.NoError(t, err, "deleting an unknown policy should be a noop")
+}
+
+// TestSweep tests that orphaned statements are only removed outside of report
+// only mode.
+func TestSweep(t *testing.T) {
+	test.Integration(t)
+
+	logger := test.NewLogger(t)
+
+	var (
+		policyBaseName = t.Name()
+		iamPrefix      = GenerateRandomString(10)
+		role           = fmt.Sprintf("GoogleDevLogin_%s", GenerateRandomString(5))
+	)
+
+	session := CreateSession()
+	svc := iam.New(session)
+	client := NewClient(session, logger, accountID, iamPrefix, CacheConfig{})
+
+	createRole(t, svc, accountID, role)
+	config := EnsureUserConfig{
+		Region:            "eu-west-1",
+		AccountID:         accountID,
+		PolicyBaseName:    policyBaseName,
+		MaxUsersPerPolicy: 2,
+		RolePrefix:        "iam_developer_",
+		AWSLoginRoles: []string{
+			role,
+		},
+	}
+
+	for _, user := range []string{"user1", "user2", "user3"} {
+		_, err := EnsureUser(client, logger, config, user, user)
+		require.NoError(t, err, "unexpected error when adding %s", user)
+	}
+	owners := func() (map[string]bool, error) {
+		return map[string]bool{"user1": true}, nil
+	}
+
+	result, err := Sweep(client, logger, config, owners, true)
+	require.NoError(t, err, "unexpected error when sweeping in report only mode")
+	assert.Equal(t, []string{"user2", "user3"}, result.Orphaned, "orphaned users")
+	assertAttachedPolicies(t, client, role, 2)
+
+	_, err = Sweep(client, logger, config, owners, false)
+	require.NoError(t, err, "unexpected error when sweeping")
+	assertPolicyUsers(t, client, map[string][]string{
+		fmt.Sprintf("%s_0", policyBaseName): {"user1"},
+	})
+	assertAttachedPolicies(t, client, role, 1)
+}
+
+// assertPolicyUsers asserts that the stored policies hold the expected users
+// by policy name.
+func assertPolicyUsers(t *testing.T, client *Client, expected map[string][]string) {
+	t.Helper()
+
+	policies, err := client.ListPolicies()
+	require.NoError(t, err, "unexpected error listing policies for validation in test")
+
+	users := make(map[string][]string, len(policies))
+	for _, policy := range policies {
+		users[policy.Name] = policy.Document.ListUsers(DefaultPrincipal)
+	}
+	assert.Equal(t, expected, users, "policy users does not match with the expected")
+}
+
+// assertAttachedPolicies asserts the number of managed policies attached to
+// awsLoginRole.
+func assertAttachedPolicies(t *testing.T, client *Client, awsLoginRole string, count int) {
+	t.Helper()
+
+	role, err := client.GetRole(awsLoginRole)
+	require.NoError(t, err)
+
+	policies, err := client.ListManagedAttachedPolicies(role)
+	require.NoError(t, err)
+
+	assert.Len(t, policies, count, "attached policies does not match with the expected")
+}
+
 // assertPolicies asserts that the stored policies match those of the expected.
 func assertPolicies(t *testing.T, client *Client, expectedPolicies []*Policy) {
 	t.Helper()
@@ -298,7 +519,7 @@ func Test_AddRemoveUser(t *testing.T) {
 			iamPrefix := GenerateRandomString(10)
 			session := CreateSession()
 			svc := iam.New(session)
-			client := NewClient(session, logger, accountID, iamPrefix)
+			client := NewClient(session, logger, accountID, iamPrefix, CacheConfig{})
 
 			_, err := svc.CreateRole(&iam.CreateRoleInput{
 				RoleName:                 &awsLoginRole,
@@ -366,10 +587,10 @@ func Test_AddRemoveUser(t *testing.T) {
 			}
 
 			if tt.operation == EnsureUserOperation {
-				err = EnsureUser(client, logger, config, tt.user, tt.user)
+				_, err = EnsureUser(client, logger, config, tt.user, tt.user)
 				assert.NoError(err)
 			} else if tt.operation == RemoveUserOperation {
-				err = RemoveUser(client, []string{awsLoginRole}, tt.user)
+				err = RemoveUser(client, logger, config, tt.user)
 				assert.NoError(err)
 			}
 
@@ -0,0 +1,502 @@
+package iam
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxPolicySize is the maximum size of a customer managed IAM policy document
+// in characters. IAM does not count whitespace so the size is measured on the
+// compact JSON rendering.
+const MaxPolicySize = 6144
+
+// sparseFill is the fill ratio below which a policy is considered sparse. The
+// users of sparse policies are moved to other policies if they all fit so the
+// policy can be deleted.
+const sparseFill = 0.5
+
+// Plan is the set of changes required to bring the managed policies to a
+// desired state. Changes must be applied in order: created policies first,
+// then policies gaining users, then policies only losing users and finally
+// the deleted ones. That way a user moved between policies is always allowed
+// in at least one of them.
+type Plan struct {
+	// Create holds new policies.
+	Create []*Policy
+	// Grow holds existing policies that gain users.
+	Grow []*Policy
+	// Shrink holds existing policies that change without gaining users.
+	Shrink []*Policy
+	// Delete holds existing policies left without users.
+	Delete []*Policy
+	// Policies holds the resulting non-empty policies sorted by name.
+	Policies []*Policy
+
+	principal Principal
+}
+
+// Empty reports whether the plan has no changes.
+func (p *Plan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Grow) == 0 && len(p.Shrink) == 0 && len(p.Delete) == 0
+}
+
+// PolicyOf returns the name of the resulting policy holding username. It is
+// empty if no policy holds the user.
+func (p *Plan) PolicyOf(username string) string {
+	for _, policy := range p.Policies {
+		if policy.Document.Exists(p.principal, username) {
+			return policy.Name
+		}
+	}
+	return ""
+}
+
+// planner computes a Plan on copies of the current policies.
+type planner struct {
+	config    EnsureUserConfig
+	principal Principal
+	policies  []*Policy
+	// originals holds the statements of each existing policy by name.
+	originals map[string][]StatementEntry
+	created   map[string]bool
+	// overflow holds statements removed from policies exceeding the limits
+	// that must be added again.
+	overflow []StatementEntry
+}
+
+// newPlanner returns a planner of policies. Statements of previous principals
+// are migrated to the current principal, duplicate statements of a user are
+// removed and statements of policies exceeding the limits are moved to the
+// overflow.
+//
+// Only policies named after the policy base name are planned. Other policies
+// under the IAM prefix are not managed by the controller and left untouched.
+func newPlanner(config EnsureUserConfig, policies []*Policy) *planner {
+	policies = ownedPolicies(config.PolicyBaseName, policies)
+	p := &planner{
+		config:    config,
+		principal: config.principal(),
+		originals: make(map[string][]StatementEntry, len(policies)),
+		created:   make(map[string]bool),
+	}
+	for _, policy := range policies {
+		p.originals[policy.Name] = policy.Document.Statement
+		p.policies = append(p.policies, &Policy{
+			Name:             policy.Name,
+			CurrentVersionId: policy.CurrentVersionId,
+			Document: &PolicyDocument{
+				Version:   policy.Document.Version,
+				Statement: append([]StatementEntry(nil), policy.Document.Statement...),
+			},
+		})
+	}
+	sortPolicies(p.config.PolicyBaseName, p.policies)
+
+	seen := make(map[string]bool)
+	for _, policy := range p.policies {
+		statements := policy.Document.Statement[:0:0]
+		for _, statement := range policy.Document.Statement {
+			statement, username, ok := p.migrate(statement)
+			if ok && seen[username] {
+				continue
+			}
+			seen[username] = ok
+			statements = append(statements, statement)
+		}
+		policy.Document.Statement = statements
+		for policy.Document.Count() != 0 && !p.fits(policy.Document) {
+			last := policy.Document.Count() - 1
+			p.overflow = append(p.overflow, policy.Document.Statement[last])
+			policy.Document.Statement = policy.Document.Statement[:last]
+		}
+	}
+	return p
+}
+
+// migrate returns statement matching the current principal and the name of
+// its user. Statements of a previous principal are rewritten to the current
+// one. ok is false if statement does not belong to any known principal.
+func (p *planner) migrate(statement StatementEntry) (StatementEntry, string, bool) {
+	if username, ok := statement.user(p.principal); ok {
+		return statement, username, true
+	}
+	for _, previous := range p.config.PreviousPrincipals {
+		username, ok := statement.user(previous)
+		if !ok {
+			continue
+		}
+		statement.Condition = StringLike{StringLike: map[string]string{
+			p.principal.Key: p.principal.Value(username),
+		}}
+		return statement, username, true
+	}
+	return statement, "", false
+}
+
+// userKey returns a key identifying the user of statement across principals.
+func (p *planner) userKey(statement StatementEntry) string {
+	_, username, ok := p.migrate(statement)
+	if ok {
+		return "user:" + username
+	}
+	key, value, _ := statement.principal()
+	return key + "=" + value
+}
+
+// addOverflow adds the statements of the overflow to other policies.
+func (p *planner) addOverflow() error {
+	for _, statement := range p.overflow {
+		err := p.add(statement)
+		if err != nil {
+			return err
+		}
+	}
+	p.overflow = nil
+	return nil
+}
+
+// PlanEnsureUser returns the changes that allow username to connect as
+// rolename on the RDS instances with resourceIDs in exactly one of policies.
+// Without resourceIDs the user may connect to every instance.
+//
+// An existing statement of the user is updated in place if it still fits.
+// Otherwise the user is added to the first policy with room for it or to a new
+// policy named with the lowest free index of the policy base name. Sparse
+// policies are compacted afterwards.
+func PlanEnsureUser(config EnsureUserConfig, policies []*Policy, username, rolename string, resourceIDs ...string) (*Plan, error) {
+	p := newPlanner(config, policies)
+	statement := newStatementEntry(p.principal, config.Region, config.AccountID, config.RolePrefix, rolename, username, resourceIDs)
+
+	// an overflowing statement of the user is replaced
+	overflow := p.overflow[:0:0]
+	for _, s := range p.overflow {
+		if name, ok := s.user(p.principal); !ok || name != username {
+			overflow = append(overflow, s)
+		}
+	}
+	p.overflow = overflow
+
+	var holder *Policy
+	for _, policy := range p.policies {
+		if policy.Document.Exists(p.principal, username) {
+			holder = policy
+			policy.Document.Update(p.principal, config.Region, config.AccountID, config.RolePrefix, username, rolename, resourceIDs...)
+		}
+	}
+	if holder != nil && !p.fits(holder.Document) {
+		holder.Document.Remove(p.principal, username)
+		holder = nil
+	}
+	if holder == nil {
+		err := p.add(statement)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := p.addOverflow()
+	if err != nil {
+		return nil, err
+	}
+	p.compact()
+	return p.plan(), nil
+}
+
+// PlanRemoveUser returns the changes that remove username from policies.
+// Sparse policies are compacted afterwards.
+func PlanRemoveUser(config EnsureUserConfig, policies []*Policy, username string) (*Plan, error) {
+	p := newPlanner(config, policies)
+	for _, policy := range p.policies {
+		policy.Document.Remove(p.principal, username)
+	}
+	overflow := p.overflow[:0:0]
+	for _, s := range p.overflow {
+		if name, ok := s.user(p.principal); !ok || name != username {
+			overflow = append(overflow, s)
+		}
+	}
+	p.overflow = overflow
+	err := p.addOverflow()
+	if err != nil {
+		return nil, err
+	}
+	p.compact()
+	return p.plan(), nil
+}
+
+// diffPlan returns the changes that turn the stored policies into the desired
+// ones. Stored policies missing from desired are deleted. Policies not named
+// after the policy base name are ignored.
+func diffPlan(config EnsureUserConfig, stored, desired []*Policy) *Plan {
+	stored = ownedPolicies(config.PolicyBaseName, stored)
+	desired = ownedPolicies(config.PolicyBaseName, desired)
+	p := &planner{
+		config:    config,
+		principal: config.principal(),
+		originals: make(map[string][]StatementEntry, len(stored)),
+		created:   make(map[string]bool),
+	}
+	for _, policy := range stored {
+		p.originals[policy.Name] = policy.Document.Statement
+	}
+	kept := make(map[string]bool, len(desired))
+	for _, policy := range desired {
+		kept[policy.Name] = true
+		if _, ok := p.originals[policy.Name]; !ok {
+			p.created[policy.Name] = true
+		}
+		p.policies = append(p.policies, policy)
+	}
+	for _, policy := range stored {
+		if !kept[policy.Name] {
+			p.policies = append(p.policies, &Policy{
+				Name:             policy.Name,
+				CurrentVersionId: policy.CurrentVersionId,
+				Document:         NewPolicyDocument(policy.Document.Version),
+			})
+		}
+	}
+	sortPolicies(config.PolicyBaseName, p.policies)
+	return p.plan()
+}
+
+// add adds statement to the first policy with room for it or to a new
+// policy.
+func (p *planner) add(statement StatementEntry) error {
+	for _, policy := range p.policies {
+		if p.fits(policy.Document, statement) {
+			policy.Document.Statement = append(policy.Document.Statement, statement)
+			return nil
+		}
+	}
+	policy := &Policy{
+		Name:     p.nextName(),
+		Document: NewPolicyDocument("2012-10-17"),
+	}
+	if !p.fits(policy.Document, statement) {
+		_, value, _ := statement.principal()
+		return fmt.Errorf("statement of %s does not fit in an empty policy", value)
+	}
+	policy.Document.Statement = append(policy.Document.Statement, statement)
+	p.created[policy.Name] = true
+	p.policies = append(p.policies, policy)
+	sortPolicies(p.config.PolicyBaseName, p.policies)
+	return nil
+}
+
+// compact moves all statements of sparse policies to other policies if they
+// fit. The sparsest policies are emptied first and of equally sparse policies
+// the one with the highest index. Only whole policies are moved so every step
+// reduces the number of policies.
+func (p *planner) compact() {
+	for {
+		var candidates []*Policy
+		for i := len(p.policies) - 1; i >= 0; i-- {
+			policy := p.policies[i]
+			if policy.Document.Count() != 0 && p.fill(policy.Document) < sparseFill {
+				candidates = append(candidates, policy)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return p.fill(candidates[i].Document) < p.fill(candidates[j].Document)
+		})
+		moved := false
+		for _, candidate := range candidates {
+			if p.moveAll(candidate) {
+				moved = true
+				break
+			}
+		}
+		if !moved {
+			return
+		}
+	}
+}
+
+// moveAll moves every statement of source to the other policies if they all
+// fit. It reports whether the statements were moved.
+func (p *planner) moveAll(source *Policy) bool {
+	targets := make(map[string][]StatementEntry)
+	for _, statement := range source.Document.Statement {
+		placed := false
+		for _, target := range p.policies {
+			if target == source || target.Document.Count() == 0 {
+				continue
+			}
+			document := &PolicyDocument{
+				Version:   target.Document.Version,
+				Statement: append(append([]StatementEntry(nil), target.Document.Statement...), targets[target.Name]...),
+			}
+			if p.fits(document, statement) {
+				targets[target.Name] = append(targets[target.Name], statement)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			return false
+		}
+	}
+	for _, target := range p.policies {
+		target.Document.Statement = append(target.Document.Statement, targets[target.Name]...)
+	}
+	source.Document.Statement = nil
+	return true
+}
+
+// fits reports whether document with statements appended stays within the
+// size and user limits.
+func (p *planner) fits(document *PolicyDocument, statements ...StatementEntry) bool {
+	candidate := &PolicyDocument{
+		Version:   document.Version,
+		Statement: append(append([]StatementEntry(nil), document.Statement...), statements...),
+	}
+	if p.config.MaxUsersPerPolicy > 0 && candidate.Count() > p.config.MaxUsersPerPolicy {
+		return false
+	}
+	size, err := candidate.Size()
+	if err != nil {
+		return false
+	}
+	return size <= p.maxSize()
+}
+
+// fill returns how full document is relative to the size and user limits.
+func (p *planner) fill(document *PolicyDocument) float64 {
+	size, err := document.Size()
+	if err != nil {
+		return 1
+	}
+	fill := float64(size) / float64(p.maxSize())
+	if p.config.MaxUsersPerPolicy > 0 {
+		users := float64(document.Count()) / float64(p.config.MaxUsersPerPolicy)
+		if users > fill {
+			fill = users
+		}
+	}
+	return fill
+}
+
+func (p *planner) maxSize() int {
+	if p.config.MaxPolicySize > 0 {
+		return p.config.MaxPolicySize
+	}
+	return MaxPolicySize
+}
+
+// nextName returns the name of the policy base name with the lowest index not
+// used by any policy.
+func (p *planner) nextName() string {
+	used := make(map[int]bool, len(p.policies))
+	for _, policy := range p.policies {
+		if index, ok := policyIndex(p.config.PolicyBaseName, policy.Name); ok {
+			used[index] = true
+		}
+	}
+	index := 0
+	for used[index] {
+		index++
+	}
+	return fmt.Sprintf("%s_%d", p.config.PolicyBaseName, index)
+}
+
+// plan classifies the policies by their changes.
+func (p *planner) plan() *Plan {
+	plan := &Plan{principal: p.principal}
+	for _, policy := range p.policies {
+		if p.created[policy.Name] {
+			if policy.Document.Count() != 0 {
+				plan.Create = append(plan.Create, policy)
+				plan.Policies = append(plan.Policies, policy)
+			}
+			continue
+		}
+		if policy.Document.Count() == 0 {
+			plan.Delete = append(plan.Delete, policy)
+			continue
+		}
+		plan.Policies = append(plan.Policies, policy)
+		original := p.originals[policy.Name]
+		switch {
+		case p.gainsUsers(original, policy.Document.Statement):
+			plan.Grow = append(plan.Grow, policy)
+		case statementSet(original) != statementSet(policy.Document.Statement):
+			plan.Shrink = append(plan.Shrink, policy)
+		}
+	}
+	return plan
+}
+
+// gainsUsers reports whether statements hold users not in original.
+func (p *planner) gainsUsers(original, statements []StatementEntry) bool {
+	users := make(map[string]bool, len(original))
+	for _, statement := range original {
+		users[p.userKey(statement)] = true
+	}
+	for _, statement := range statements {
+		if !users[p.userKey(statement)] {
+			return true
+		}
+	}
+	return false
+}
+
+// statementSet returns a canonical rendering of statements independent of
+// their order.
+func statementSet(statements []StatementEntry) string {
+	rendered := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		b, err := json.Marshal(statement)
+		if err != nil {
+			return ""
+		}
+		rendered = append(rendered, string(b))
+	}
+	sort.Strings(rendered)
+	return strings.Join(rendered, "\n")
+}
+
+// policyIndex returns the index of a policy named after baseName and whether
+// name is such a policy.
+func policyIndex(baseName, name string) (int, bool) {
+	suffix, ok := strings.CutPrefix(name, baseName+"_")
+	if !ok {
+		return 0, false
+	}
+	index, err := strconv.Atoi(suffix)
+	if err != nil || index < 0 || strconv.Itoa(index) != suffix {
+		return 0, false
+	}
+	return index, true
+}
+
+// ownedPolicies returns the policies named after baseName, ie. the policies
+// managed by the controller.
+func ownedPolicies(baseName string, policies []*Policy) []*Policy {
+	var owned []*Policy
+	for _, policy := range policies {
+		if _, ok := policyIndex(baseName, policy.Name); ok {
+			owned = append(owned, policy)
+		}
+	}
+	return owned
+}
+
+// sortPolicies sorts policies named after baseName by their index followed by
+// any other policies by name. Policies with low indices are filled first.
+func sortPolicies(baseName string, policies []*Policy) {
+	sort.SliceStable(policies, func(i, j int) bool {
+		indexI, okI := policyIndex(baseName, policies[i].Name)
+		indexJ, okJ := policyIndex(baseName, policies[j].Name)
+		switch {
+		case okI && okJ:
+			return indexI < indexJ
+		case okI != okJ:
+			return okI
+		default:
+			return policies[i].Name < policies[j].Name
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package iam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPolicy returns a policy named name allowing users to connect as a role
+// of the same name.
+func testPolicy(name string, users ...string) *Policy {
+	document := NewPolicyDocument("2012-10-17")
+	for _, user := range users {
+		document.Add(DefaultPrincipal, region, accountID, rolePrefix, user, user)
+	}
+	return &Policy{Name: name, Document: document}
+}
+
+// foreignPolicy returns a policy named name that is not managed by the
+// controller.
+func foreignPolicy(name string) *Policy {
+	document := NewPolicyDocument("2012-10-17")
+	document.Statement = append(document.Statement, StatementEntry{
+		Effect:   "Allow",
+		Action:   []string{"s3:GetObject"},
+		Resource: []string{"arn:aws:s3:::ci-artifacts/*"},
+	})
+	return &Policy{Name: name, Document: document}
+}
+
+// policyUsers returns the users of policies by policy name.
+func policyUsers(policies []*Policy) map[string][]string {
+	return principalUsers(DefaultPrincipal, policies)
+}
+
+// principalUsers returns the users of principal in policies by policy name.
+func principalUsers(principal Principal, policies []*Policy) map[string][]string {
+	users := make(map[string][]string, len(policies))
+	for _, policy := range policies {
+		users[policy.Name] = policy.Document.ListUsers(principal)
+	}
+	return users
+}
+
+func policyNames(policies []*Policy) []string {
+	var names []string
+	for _, policy := range policies {
+		names = append(names, policy.Name)
+	}
+	return names
+}
+
+// sizeFor returns a policy size limit that fits exactly the given number of
+// users with three letter names.
+func sizeFor(t *testing.T, users int) int {
+	t.Helper()
+	var names []string
+	for i := 0; i < users; i++ {
+		names = append(names, string(rune('a'+i))+"aa")
+	}
+	size, err := testPolicy("", names...).Document.Size()
+	require.NoError(t, err)
+	return size
+}
+
+func TestPlanEnsureUser(t *testing.T) {
+	config := EnsureUserConfig{
+		Region:         region,
+		AccountID:      accountID,
+		PolicyBaseName: "base",
+		RolePrefix:     rolePrefix,
+		MaxPolicySize:  sizeFor(t, 2),
+	}
+
+	t.Run("packs by size", func(t *testing.T) {
+		plan, err := PlanEnsureUser(config, []*Policy{testPolicy("base_0", "aaa")}, "baa", "baa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Grow), "grown policies")
+		assert.Equal(t, "base_0", plan.PolicyOf("baa"))
+
+		plan, err = PlanEnsureUser(config, []*Policy{testPolicy("base_0", "aaa", "baa")}, "caa", "caa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_1"}, policyNames(plan.Create), "created policies")
+		assert.Empty(t, plan.Grow, "grown policies")
+		assert.Equal(t, "base_1", plan.PolicyOf("caa"))
+	})
+
+	t.Run("lowest free index", func(t *testing.T) {
+		plan, err := PlanEnsureUser(config, []*Policy{
+			testPolicy("base_2", "aaa", "baa"),
+			testPolicy("base_0", "caa", "daa"),
+			testPolicy("other", "gaa", "haa"),
+		}, "eaa", "eaa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_1"}, policyNames(plan.Create), "created policies")
+		assert.Equal(t, []string{"base_0", "base_1", "base_2"}, policyNames(plan.Policies))
+	})
+
+	t.Run("unchanged user", func(t *testing.T) {
+		plan, err := PlanEnsureUser(config, []*Policy{testPolicy("base_0", "aaa", "baa")}, "aaa", "aaa")
+		require.NoError(t, err)
+		assert.True(t, plan.Empty(), "plan should be empty")
+		assert.Equal(t, "base_0", plan.PolicyOf("aaa"))
+	})
+
+	t.Run("role change in place", func(t *testing.T) {
+		plan, err := PlanEnsureUser(config, []*Policy{testPolicy("base_0", "aaa", "baa")}, "aaa", "bbb")
+		require.NoError(t, err)
+		assert.Empty(t, plan.Grow, "grown policies")
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Shrink), "changed policies")
+		assert.Equal(t, "arn:aws:rds-db:eu-west-1:000000000000:dbuser:*/iam_developer_bbb", plan.Shrink[0].Document.Statement[0].Resource[0])
+	})
+
+	t.Run("role change moves user when too big", func(t *testing.T) {
+		plan, err := PlanEnsureUser(config, []*Policy{
+			testPolicy("base_0", "aaa", "baa"),
+			testPolicy("base_1", "c"),
+		}, "aaa", "aaaa")
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{
+			"base_0": {"baa"},
+			"base_1": {"c", "aaa"},
+		}, policyUsers(plan.Policies))
+		assert.Equal(t, []string{"base_1"}, policyNames(plan.Grow), "grown policies")
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Shrink), "shrunk policies")
+	})
+
+	t.Run("duplicate users", func(t *testing.T) {
+		plan, err := PlanEnsureUser(config, []*Policy{
+			testPolicy("base_0", "aaa", "baa"),
+			testPolicy("base_1", "aaa"),
+		}, "aaa", "aaa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_1"}, policyNames(plan.Delete), "deleted policies")
+		assert.Equal(t, map[string][]string{"base_0": {"aaa", "baa"}}, policyUsers(plan.Policies))
+	})
+
+	t.Run("statement too big", func(t *testing.T) {
+		small := config
+		small.MaxPolicySize = 10
+		_, err := PlanEnsureUser(small, nil, "aaa", "aaa")
+		assert.EqualError(t, err, "statement of *:aaa@lunar.app does not fit in an empty policy")
+	})
+
+	t.Run("migrates previous principal", func(t *testing.T) {
+		migrating := config
+		migrating.MaxPolicySize = 0
+		migrating.Principal = Principal{Key: "aws:PrincipalTag/email", Template: "{name}@example.com"}
+		migrating.PreviousPrincipals = []Principal{DefaultPrincipal}
+		plan, err := PlanEnsureUser(migrating, []*Policy{testPolicy("base_0", "aaa", "baa")}, "aaa", "aaa")
+		require.NoError(t, err)
+		assert.Empty(t, plan.Grow, "grown policies")
+		require.Equal(t, []string{"base_0"}, policyNames(plan.Shrink), "migrated policies")
+		assert.Equal(t, []string{"aaa", "baa"}, plan.Shrink[0].Document.ListUsers(migrating.Principal))
+		assert.Empty(t, plan.Shrink[0].Document.ListUsers(DefaultPrincipal), "previous principal should be migrated")
+		assert.Equal(t, map[string]string{"aws:PrincipalTag/email": "aaa@example.com"}, plan.Shrink[0].Document.Statement[0].Condition.StringLike)
+		assert.Equal(t, "base_0", plan.PolicyOf("aaa"))
+	})
+
+	t.Run("migration overflows", func(t *testing.T) {
+		migrating := config
+		migrating.Principal = Principal{Key: "aws:userid", Template: "*:{name}@lunar.example.com"}
+		migrating.PreviousPrincipals = []Principal{DefaultPrincipal}
+		plan, err := PlanEnsureUser(migrating, []*Policy{testPolicy("base_0", "aaa", "baa")}, "caa", "caa")
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{
+			"base_0": {"aaa"},
+			"base_1": {"caa"},
+			"base_2": {"baa"},
+		}, principalUsers(migrating.Principal, plan.Policies))
+		assert.Equal(t, []string{"base_1", "base_2"}, policyNames(plan.Create), "created policies")
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Shrink), "migrated policies")
+	})
+
+	t.Run("migration and deduplication skip foreign policies", func(t *testing.T) {
+		migrating := config
+		migrating.MaxPolicySize = 0
+		migrating.Principal = Principal{Key: "aws:PrincipalTag/email", Template: "{name}@example.com"}
+		migrating.PreviousPrincipals = []Principal{DefaultPrincipal}
+		foreign := testPolicy("AdminAccess", "aaa", "baa", "caa")
+		plan, err := PlanEnsureUser(migrating, []*Policy{testPolicy("base_0", "aaa"), foreign}, "aaa", "aaa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Policies))
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Shrink), "migrated policies")
+		assert.Empty(t, plan.Create, "created policies")
+		assert.Equal(t, testPolicy("AdminAccess", "aaa", "baa", "caa"), foreign, "foreign policy should not be modified")
+	})
+
+	t.Run("user cap", func(t *testing.T) {
+		capped := config
+		capped.MaxUsersPerPolicy = 1
+		plan, err := PlanEnsureUser(capped, []*Policy{testPolicy("base_0", "aaa")}, "baa", "baa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_1"}, policyNames(plan.Create), "created policies")
+	})
+}
+
+func TestPlanRemoveUser(t *testing.T) {
+	config := EnsureUserConfig{
+		Region:         region,
+		AccountID:      accountID,
+		PolicyBaseName: "base",
+		RolePrefix:     rolePrefix,
+		MaxPolicySize:  sizeFor(t, 4),
+	}
+
+	t.Run("deletes empty policy", func(t *testing.T) {
+		plan, err := PlanRemoveUser(config, []*Policy{testPolicy("base_0", "aaa")}, "aaa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Delete), "deleted policies")
+		assert.Empty(t, plan.Policies, "remaining policies")
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		plan, err := PlanRemoveUser(config, []*Policy{testPolicy("base_0", "aaa", "baa", "caa")}, "who")
+		require.NoError(t, err)
+		assert.True(t, plan.Empty(), "plan should be empty")
+	})
+
+	t.Run("compacts sparse policies", func(t *testing.T) {
+		plan, err := PlanRemoveUser(config, []*Policy{
+			testPolicy("base_0", "aaa", "baa"),
+			testPolicy("base_1", "caa", "daa"),
+		}, "daa")
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"base_0": {"aaa", "baa", "caa"}}, policyUsers(plan.Policies))
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Grow), "grown policies")
+		assert.Equal(t, []string{"base_1"}, policyNames(plan.Delete), "deleted policies")
+	})
+
+	t.Run("empties highest index of equally sparse policies", func(t *testing.T) {
+		plan, err := PlanRemoveUser(config, []*Policy{
+			testPolicy("base_0", "aaa"),
+			testPolicy("base_1", "baa"),
+			testPolicy("base_2", "caa", "daa"),
+		}, "daa")
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"base_0": {"aaa", "caa", "baa"}}, policyUsers(plan.Policies))
+		assert.Equal(t, []string{"base_1", "base_2"}, policyNames(plan.Delete), "deleted policies")
+	})
+
+	t.Run("leaves foreign policies untouched", func(t *testing.T) {
+		foreign := foreignPolicy("S3ReadOnlyForCI")
+		plan, err := PlanRemoveUser(config, []*Policy{
+			testPolicy("base_0", "aaa", "baa"),
+			foreign,
+			testPolicy("base_10", "caa"),
+			testPolicy("base", "daa"),
+		}, "baa")
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"base_0": {"aaa", "caa"}}, policyUsers(plan.Policies))
+		assert.Equal(t, []string{"base_10"}, policyNames(plan.Delete), "deleted policies")
+		assert.Equal(t, []string{"base_0"}, policyNames(plan.Grow), "grown policies")
+		assert.Empty(t, plan.Shrink, "shrunk policies")
+		assert.Equal(t, foreignPolicy("S3ReadOnlyForCI"), foreign, "foreign policy should not be modified")
+	})
+
+	t.Run("keeps sparse policies that do not fit elsewhere", func(t *testing.T) {
+		plan, err := PlanRemoveUser(config, []*Policy{
+			testPolicy("base_0", "aaa", "baa", "caa", "daa"),
+			testPolicy("base_1", "eaa", "faa"),
+		}, "faa")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_1"}, policyNames(plan.Shrink), "shrunk policies")
+		assert.Empty(t, plan.Delete, "deleted policies")
+	})
+}
@@ -1,8 +1,9 @@
 package iam
 
 import (
+	"encoding/json"
 	"fmt"
-	"strings"
+	"sort"
 )
 
 type Policy struct {
@@ -31,37 +32,49 @@ type StatementEntry struct {
 }
 
 type StringLike struct {
-	StringLike UserID `json:"StringLike,omitempty"`
+	StringLike map[string]string `json:"StringLike,omitempty"`
 }
 
-type UserID struct {
-	AWSUserID string `json:"aws:userid,omitempty"`
-}
-
-func usernameToUserId(username string) string {
-	return fmt.Sprintf("*:%s@lunar.app", username)
+// principal returns the condition key and value identifying the principal of
+// the statement. ok is false if the statement does not have exactly one
+// condition.
+func (s StatementEntry) principal() (key, value string, ok bool) {
+	if len(s.Condition.StringLike) != 1 {
+		return "", "", false
+	}
+	for key, value := range s.Condition.StringLike {
+		return key, value, true
+	}
+	return "", "", false
 }
 
-func userIdToUsername(userID string) string {
-	return strings.TrimSuffix(
-		strings.TrimPrefix(userID, "*:"),
-		"@lunar.app")
+// user returns the name of the user of the statement and whether it belongs
+// to principal.
+func (s StatementEntry) user(principal Principal) (string, bool) {
+	key, value, ok := s.principal()
+	if !ok {
+		return "", false
+	}
+	return principal.Name(key, value)
 }
 
-func (p *PolicyDocument) ListUsers() []string {
+func (p *PolicyDocument) ListUsers(principal Principal) []string {
 	var users []string
 	for _, statement := range p.Statement {
-		userName := userIdToUsername(statement.Condition.StringLike.AWSUserID)
+		userName, ok := statement.user(principal)
+		if !ok {
+			continue
+		}
 		users = append(users, userName)
 	}
 
 	return users
 }
 
-func (p *PolicyDocument) Exists(username string) bool {
-	awsUserID := usernameToUserId(username)
+func (p *PolicyDocument) Exists(principal Principal, username string) bool {
 	return any(p.Statement, func(s StatementEntry) bool {
-		return s.Condition.StringLike.AWSUserID == awsUserID
+		name, ok := s.user(principal)
+		return ok && name == username
 	})
 }
 
@@ -69,31 +82,36 @@ func (p *PolicyDocument) Count() int {
 	return len(p.Statement)
 }
 
-func (p *PolicyDocument) Add(region, accountID, rolePrefix, username, rolename string) {
-	awsUserID := usernameToUserId(username)
-	p.Statement = append(p.Statement, newStatementEntry(region, accountID, rolePrefix, rolename, awsUserID))
+// Size returns the size of the document as counted against the IAM policy size
+// limit, ie. its JSON rendering without whitespace.
+func (p *PolicyDocument) Size() (int, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Add adds a statement allowing username to connect as rolename on the RDS
+// instances with resourceIDs. Without resourceIDs it allows every instance.
+func (p *PolicyDocument) Add(principal Principal, region, accountID, rolePrefix, username, rolename string, resourceIDs ...string) {
+	p.Statement = append(p.Statement, newStatementEntry(principal, region, accountID, rolePrefix, rolename, username, resourceIDs))
 }
 
 // Update updates the policy document statements for the provided username. If
 // the username is not found this is a noop and false is returned.
-func (p *PolicyDocument) Update(region, accountID, rolePrefix, username, rolename string) bool {
-	awsUserID := usernameToUserId(username)
+func (p *PolicyDocument) Update(principal Principal, region, accountID, rolePrefix, username, rolename string, resourceIDs ...string) bool {
+	statement := newStatementEntry(principal, region, accountID, rolePrefix, rolename, username, resourceIDs)
 
 	var updated bool
 	var statements []StatementEntry
-statement_loop:
 	for i := range p.Statement {
-		if p.Statement[i].Condition.StringLike.AWSUserID == awsUserID {
-			for _, resource := range p.Statement[i].Resource {
-				if resource == formatStatementResource(region, accountID, rolePrefix, rolename, awsUserID) {
-					statements = append(statements, p.Statement[i])
-					continue statement_loop
-				}
+		if name, ok := p.Statement[i].user(principal); ok && name == username {
+			if !equalStrings(p.Statement[i].Resource, statement.Resource) {
+				statements = append(statements, statement)
+				updated = true
+				continue
 			}
-
-			statements = append(statements, newStatementEntry(region, accountID, rolePrefix, rolename, awsUserID))
-			updated = true
-			continue
 		}
 
 		statements = append(statements, p.Statement[i])
@@ -103,26 +121,55 @@ statement_loop:
 	return updated
 }
 
-func newStatementEntry(region, accountID, rolePrefix, rolename, awsUserID string) StatementEntry {
+func newStatementEntry(principal Principal, region, accountID, rolePrefix, rolename, username string, resourceIDs []string) StatementEntry {
+	if len(resourceIDs) == 0 {
+		resourceIDs = []string{AllInstances}
+	}
+	resourceIDs = append([]string(nil), resourceIDs...)
+	sort.Strings(resourceIDs)
+	var resources []string
+	for i, resourceID := range resourceIDs {
+		if i > 0 && resourceID == resourceIDs[i-1] {
+			continue
+		}
+		resources = append(resources, formatStatementResource(region, accountID, rolePrefix, rolename, resourceID))
+	}
 	return StatementEntry{
-		Effect:    "Allow",
-		Action:    []string{"rds-db:connect"},
-		Resource:  []string{formatStatementResource(region, accountID, rolePrefix, rolename, awsUserID)},
-		Condition: StringLike{StringLike: UserID{AWSUserID: awsUserID}},
+		Effect:   "Allow",
+		Action:   []string{"rds-db:connect"},
+		Resource: resources,
+		Condition: StringLike{StringLike: map[string]string{
+			principal.Key: principal.Value(username),
+		}},
 	}
 }
 
-func formatStatementResource(region, accountID, rolePrefix, rolename, awsUserID string) string {
-	return fmt.Sprintf("arn:aws:rds-db:%s:%s:dbuser:*/%s%s", region, accountID, rolePrefix, rolename)
+// AllInstances is the resource ID matching every RDS instance.
+const AllInstances = "*"
+
+// formatStatementResource returns the ARN of rolename on the RDS instance with
+// the DbiResourceId resourceID.
+func formatStatementResource(region, accountID, rolePrefix, rolename, resourceID string) string {
+	return fmt.Sprintf("arn:aws:rds-db:%s:%s:dbuser:%s/%s%s", region, accountID, resourceID, rolePrefix, rolename)
 }
 
-func (p *PolicyDocument) Remove(username string) {
-	awsUserID := usernameToUserId(username)
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
 
+func (p *PolicyDocument) Remove(principal Principal, username string) {
 	newStatements := []StatementEntry{}
 
 	for _, entry := range p.Statement {
-		if entry.Condition.StringLike.AWSUserID != awsUserID {
+		if name, ok := entry.user(principal); !ok || name != username {
 			newStatements = append(newStatements, entry)
 		}
 	}
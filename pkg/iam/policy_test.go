@@ -18,13 +18,13 @@ func Test_AddUsersToDocument(t *testing.T) {
 	assert := assert.New(t)
 
 	document := NewPolicyDocument("2012-10-17")
-	document.Add(region, accountID, rolePrefix, "user1", "role1")
-	document.Add(region, accountID, rolePrefix, "user2", "role2")
+	document.Add(DefaultPrincipal, region, accountID, rolePrefix, "user1", "role1")
+	document.Add(DefaultPrincipal, region, accountID, rolePrefix, "user2", "role2")
 
 	require.Equal(t, 2, document.Count())
-	assert.True(document.Exists("user1"))
+	assert.True(document.Exists(DefaultPrincipal, "user1"))
 	assert.Equal("arn:aws:rds-db:eu-west-1:000000000000:dbuser:*/iam_developer_role1", document.Statement[0].Resource[0])
-	assert.True(document.Exists("user2"))
+	assert.True(document.Exists(DefaultPrincipal, "user2"))
 }
 
 func Test_RemoveUsersFromDocument(t *testing.T) {
@@ -32,13 +32,32 @@ func Test_RemoveUsersFromDocument(t *testing.T) {
 	assert := assert.New(t)
 
 	document := NewPolicyDocument("2012-10-17")
-	document.Add(region, accountID, rolePrefix, "user1", "role1")
-	document.Add(region, accountID, rolePrefix, "user2", "role2")
-	document.Add(region, accountID, rolePrefix, "user3", "role3")
-	document.Remove("user2")
+	document.Add(DefaultPrincipal, region, accountID, rolePrefix, "user1", "role1")
+	document.Add(DefaultPrincipal, region, accountID, rolePrefix, "user2", "role2")
+	document.Add(DefaultPrincipal, region, accountID, rolePrefix, "user3", "role3")
+	document.Remove(DefaultPrincipal, "user2")
 
 	assert.Equal(2, document.Count())
-	assert.True(document.Exists("user1"))
-	assert.False(document.Exists("user2"))
-	assert.True(document.Exists("user3"))
+	assert.True(document.Exists(DefaultPrincipal, "user1"))
+	assert.False(document.Exists(DefaultPrincipal, "user2"))
+	assert.True(document.Exists(DefaultPrincipal, "user3"))
+}
+
+func Test_ScopeUsersToInstances(t *testing.T) {
+
+	assert := assert.New(t)
+
+	document := NewPolicyDocument("2012-10-17")
+	document.Add(DefaultPrincipal, region, accountID, rolePrefix, "user1", "role1", "db-B", "db-A", "db-B")
+	assert.Equal([]string{
+		"arn:aws:rds-db:eu-west-1:000000000000:dbuser:db-A/iam_developer_role1",
+		"arn:aws:rds-db:eu-west-1:000000000000:dbuser:db-B/iam_developer_role1",
+	}, document.Statement[0].Resource)
+
+	assert.False(document.Update(DefaultPrincipal, region, accountID, rolePrefix, "user1", "role1", "db-A", "db-B"), "same instances")
+	assert.True(document.Update(DefaultPrincipal, region, accountID, rolePrefix, "user1", "role1", "db-A"), "instance removed")
+	assert.Equal([]string{"arn:aws:rds-db:eu-west-1:000000000000:dbuser:db-A/iam_developer_role1"}, document.Statement[0].Resource)
+
+	assert.True(document.Update(DefaultPrincipal, region, accountID, rolePrefix, "user1", "role1"), "all instances")
+	assert.Equal([]string{"arn:aws:rds-db:eu-west-1:000000000000:dbuser:*/iam_developer_role1"}, document.Statement[0].Resource)
 }
@@ -0,0 +1,89 @@
+package iam
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PrincipalNamePlaceholder is replaced by the name of a user in the template
+// of a Principal.
+const PrincipalNamePlaceholder = "{name}"
+
+const (
+	PrincipalKeyUserID       = "aws:userid"
+	PrincipalKeyUsername     = "aws:username"
+	PrincipalKeyPrincipalTag = "aws:PrincipalTag/"
+)
+
+// DefaultPrincipal matches the assumed role sessions of users named
+// <name>@lunar.app.
+var DefaultPrincipal = Principal{
+	Key:      PrincipalKeyUserID,
+	Template: "*:" + PrincipalNamePlaceholder + "@lunar.app",
+}
+
+// Principal maps the name of a user to the AWS principal allowed to connect as
+// the role of the user. Policy statements match the principal with a
+// StringLike condition on Key with the value of Template where
+// PrincipalNamePlaceholder is replaced by the name.
+type Principal struct {
+	// Key is the condition key. It is aws:userid, aws:username or
+	// aws:PrincipalTag/<tag>.
+	Key string
+	// Template is the condition value holding PrincipalNamePlaceholder exactly
+	// once, eg. *:{name}@example.com for aws:userid.
+	Template string
+}
+
+// ParsePrincipal parses a principal formatted as key=template, eg.
+// aws:userid=*:{name}@example.com.
+func ParsePrincipal(s string) (Principal, error) {
+	key, template, ok := strings.Cut(strings.TrimSpace(s), "=")
+	if !ok {
+		return Principal{}, fmt.Errorf("principal '%s' must be formatted as key=template", s)
+	}
+	principal := Principal{Key: key, Template: template}
+	err := principal.Validate()
+	if err != nil {
+		return Principal{}, err
+	}
+	return principal, nil
+}
+
+// Validate returns an error if the key is not supported or the template does
+// not hold PrincipalNamePlaceholder exactly once.
+func (p Principal) Validate() error {
+	switch {
+	case p.Key == PrincipalKeyUserID, p.Key == PrincipalKeyUsername:
+	case strings.HasPrefix(p.Key, PrincipalKeyPrincipalTag) && len(p.Key) > len(PrincipalKeyPrincipalTag):
+	default:
+		return fmt.Errorf("unsupported principal key '%s': must be one of %s, %s or %s<tag>", p.Key, PrincipalKeyUserID, PrincipalKeyUsername, PrincipalKeyPrincipalTag)
+	}
+	if strings.Count(p.Template, PrincipalNamePlaceholder) != 1 {
+		return fmt.Errorf("principal template '%s' must hold %s exactly once", p.Template, PrincipalNamePlaceholder)
+	}
+	return nil
+}
+
+// String returns the principal formatted as key=template.
+func (p Principal) String() string {
+	return p.Key + "=" + p.Template
+}
+
+// Value returns the condition value matching the principal of username.
+func (p Principal) Value(username string) string {
+	return strings.Replace(p.Template, PrincipalNamePlaceholder, username, 1)
+}
+
+// Name returns the name of the user whose principal is matched by the
+// condition key and value and whether they belong to this principal.
+func (p Principal) Name(key, value string) (string, bool) {
+	if key != p.Key {
+		return "", false
+	}
+	prefix, suffix, _ := strings.Cut(p.Template, PrincipalNamePlaceholder)
+	if len(value) <= len(prefix)+len(suffix) || !strings.HasPrefix(value, prefix) || !strings.HasSuffix(value, suffix) {
+		return "", false
+	}
+	return value[len(prefix) : len(value)-len(suffix)], true
+}
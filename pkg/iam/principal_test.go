@@ -0,0 +1,79 @@
+package iam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrincipal(t *testing.T) {
+	tt := []struct {
+		name      string
+		input     string
+		principal Principal
+		err       string
+	}{
+		{
+			name:      "user id",
+			input:     "aws:userid=*:{name}@example.com",
+			principal: Principal{Key: "aws:userid", Template: "*:{name}@example.com"},
+		},
+		{
+			name:      "principal tag",
+			input:     "aws:PrincipalTag/email={name}@example.com",
+			principal: Principal{Key: "aws:PrincipalTag/email", Template: "{name}@example.com"},
+		},
+		{
+			name:  "missing template",
+			input: "aws:userid",
+			err:   "principal 'aws:userid' must be formatted as key=template",
+		},
+		{
+			name:  "unsupported key",
+			input: "aws:sourceIp={name}",
+			err:   "unsupported principal key 'aws:sourceIp': must be one of aws:userid, aws:username or aws:PrincipalTag/<tag>",
+		},
+		{
+			name:  "tag without name",
+			input: "aws:PrincipalTag/={name}",
+			err:   "unsupported principal key 'aws:PrincipalTag/': must be one of aws:userid, aws:username or aws:PrincipalTag/<tag>",
+		},
+		{
+			name:  "missing placeholder",
+			input: "aws:username=static",
+			err:   "principal template 'static' must hold {name} exactly once",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			principal, err := ParsePrincipal(tc.input)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.principal, principal)
+			assert.Equal(t, tc.input, principal.String())
+		})
+	}
+}
+
+func TestPrincipal_Name(t *testing.T) {
+	principal := Principal{Key: "aws:userid", Template: "*:{name}@example.com"}
+
+	assert.Equal(t, "*:user@example.com", principal.Value("user"))
+
+	name, ok := principal.Name("aws:userid", "*:user@example.com")
+	assert.True(t, ok, "matching value")
+	assert.Equal(t, "user", name)
+
+	_, ok = principal.Name("aws:username", "*:user@example.com")
+	assert.False(t, ok, "other key")
+
+	_, ok = principal.Name("aws:userid", "*:user@lunar.app")
+	assert.False(t, ok, "other suffix")
+
+	_, ok = principal.Name("aws:userid", "*:@example.com")
+	assert.False(t, ok, "empty name")
+}
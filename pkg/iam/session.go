@@ -0,0 +1,73 @@
+package iam
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// assumeRoleSessionName is the session name of assumed roles. It shows up in
+// CloudTrail as the principal of changes made by the controller.
+const assumeRoleSessionName = "postgresql-controller"
+
+// SessionConfig configures the credentials of an AWS session.
+type SessionConfig struct {
+	Region string
+	// Profile is a shared config profile to use. Profiles assuming roles and
+	// using web identities are supported.
+	Profile string
+	// AccessKeyID and SecretAccessKey are static credentials. They take
+	// precedence over Profile.
+	AccessKeyID     string
+	SecretAccessKey string
+	// AssumeRoleARN is an optional role to assume with the credentials, eg. in
+	// the account holding the policies.
+	AssumeRoleARN string
+	// ExternalID is the external ID required to assume AssumeRoleARN if any.
+	ExternalID string
+}
+
+// NewSession returns an AWS session for config.
+//
+// Without static credentials or a profile the default credential chain is
+// used. It resolves credentials from the environment, web identity tokens as
+// used by IRSA, the container credentials endpoint as used by ECS and EKS Pod
+// Identity and finally EC2 instance metadata.
+func NewSession(config SessionConfig) (*session.Session, error) {
+	options := session.Options{
+		Config: aws.Config{
+			Region: aws.String(config.Region),
+		},
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	switch {
+	case config.AccessKeyID != "":
+		options.Config.Credentials = credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, "")
+	case config.Profile != "":
+		options.Profile = config.Profile
+	}
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, fmt.Errorf("session initialization for region %s: %w", config.Region, err)
+	}
+	if config.AssumeRoleARN == "" {
+		return sess, nil
+	}
+	assumed := assumeRoleCredentials(sts.New(sess), config)
+	return sess.Copy(&aws.Config{Credentials: assumed}), nil
+}
+
+// assumeRoleCredentials returns the credentials of config.AssumeRoleARN
+// assumed with client. The role is assumed again once the credentials expire.
+func assumeRoleCredentials(client stscreds.AssumeRoler, config SessionConfig) *credentials.Credentials {
+	return stscreds.NewCredentialsWithClient(client, config.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = assumeRoleSessionName
+		if config.ExternalID != "" {
+			p.ExternalID = aws.String(config.ExternalID)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package iam
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSTS hands out credentials expiring after expiresIn and records the
+// AssumeRole calls.
+type fakeSTS struct {
+	stsiface.STSAPI
+
+	expiresIn time.Duration
+	inputs    []*sts.AssumeRoleInput
+}
+
+func (f *fakeSTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	f.inputs = append(f.inputs, input)
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String(fmt.Sprintf("key-%d", len(f.inputs))),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(f.expiresIn)),
+		},
+	}, nil
+}
+
+func (f *fakeSTS) AssumeRoleWithContext(_ aws.Context, input *sts.AssumeRoleInput, _ ...request.Option) (*sts.AssumeRoleOutput, error) {
+	return f.AssumeRole(input)
+}
+
+func TestAssumeRoleCredentials(t *testing.T) {
+	config := SessionConfig{
+		AssumeRoleARN: "arn:aws:iam::123456789012:role/policies",
+		ExternalID:    "external",
+	}
+
+	t.Run("valid credentials are reused", func(t *testing.T) {
+		client := &fakeSTS{expiresIn: time.Hour}
+		credentials := assumeRoleCredentials(client, config)
+
+		for i := 0; i < 2; i++ {
+			value, err := credentials.Get()
+			require.NoError(t, err)
+			assert.Equal(t, "key-1", value.AccessKeyID, "access key of get %d", i)
+		}
+		require.Len(t, client.inputs, 1, "role should be assumed once")
+		assert.Equal(t, config.AssumeRoleARN, aws.StringValue(client.inputs[0].RoleArn), "role ARN")
+		assert.Equal(t, assumeRoleSessionName, aws.StringValue(client.inputs[0].RoleSessionName), "session name")
+		assert.Equal(t, config.ExternalID, aws.StringValue(client.inputs[0].ExternalId), "external ID")
+	})
+
+	t.Run("expired credentials are refreshed", func(t *testing.T) {
+		client := &fakeSTS{expiresIn: -time.Minute}
+		credentials := assumeRoleCredentials(client, config)
+
+		value, err := credentials.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "key-1", value.AccessKeyID, "first access key")
+		assert.True(t, credentials.IsExpired(), "credentials should be expired")
+
+		value, err = credentials.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "key-2", value.AccessKeyID, "refreshed access key")
+		assert.Len(t, client.inputs, 2, "role should be assumed again")
+	})
+
+	t.Run("no external ID", func(t *testing.T) {
+		client := &fakeSTS{expiresIn: time.Hour}
+		_, err := assumeRoleCredentials(client, SessionConfig{AssumeRoleARN: config.AssumeRoleARN}).Get()
+		require.NoError(t, err)
+		require.Len(t, client.inputs, 1, "role should be assumed once")
+		assert.Nil(t, client.inputs[0].ExternalId, "external ID")
+	})
+}
+
+func TestNewSession_staticCredentials(t *testing.T) {
+	sess, err := NewSession(SessionConfig{
+		Region:          "eu-west-1",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+	require.NoError(t, err)
+	value, err := sess.Config.Credentials.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "key", value.AccessKeyID, "access key")
+	assert.Equal(t, "secret", value.SecretAccessKey, "secret key")
+}
@@ -0,0 +1,186 @@
+// Package metrics defines the Prometheus metrics of the controller. They are
+// registered with the controller-runtime registry and served by the metrics
+// server of the manager.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+)
+
+const namespace = "postgresql_controller"
+
+// Outcomes of a reconcile. They match the phases reported on the resources.
+const (
+	OutcomeRunning = "Running"
+	OutcomeFailed  = "Failed"
+	OutcomeInvalid = "Invalid"
+)
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Number of reconciles by controller and outcome.",
+	}, []string{"controller", "outcome"})
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of reconciles by controller and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"controller", "outcome"})
+
+	sqlStatementsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sql_statements_total",
+		Help:      "Number of SQL statements executed by host, object type and result.",
+	}, []string{"host", "object_type", "result"})
+
+	sqlStatementDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sql_statement_duration_seconds",
+		Help:      "Duration of SQL statements by host and object type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "object_type"})
+
+	managedRoles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_roles",
+		Help:      "Number of PostgreSQL roles managed by the controller by host and kind of resource.",
+	}, []string{"host", "kind"})
+
+	iamPolicies = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "iam_policies",
+		Help:      "Number of managed IAM policies.",
+	})
+
+	iamPolicyFillRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "iam_policy_fill_ratio",
+		Help:      "Size of a managed IAM policy document relative to the IAM policy size limit.",
+	}, []string{"policy"})
+
+	iamUnownedStatements = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "iam_unowned_statements",
+		Help:      "Number of users with orphaned or duplicate statements in the managed IAM policies found by the last sweep.",
+	}, []string{"reason"})
+
+	preflightFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "preflight_failures_total",
+		Help:      "Number of failed preflight checks by host.",
+	}, []string{"host"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		reconcileTotal,
+		reconcileDuration,
+		sqlStatementsTotal,
+		sqlStatementDuration,
+		managedRoles,
+		iamPolicies,
+		iamPolicyFillRatio,
+		iamUnownedStatements,
+		preflightFailuresTotal,
+	)
+}
+
+// Outcome returns the outcome of a reconcile that returned err.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeRunning
+	case ctlerrors.IsInvalid(err):
+		return OutcomeInvalid
+	default:
+		return OutcomeFailed
+	}
+}
+
+// ObserveReconcile records a reconcile of controller that started at start and
+// returned err.
+func ObserveReconcile(controller string, start time.Time, err error) {
+	outcome := Outcome(err)
+	reconcileTotal.WithLabelValues(controller, outcome).Inc()
+	reconcileDuration.WithLabelValues(controller, outcome).Observe(time.Since(start).Seconds())
+}
+
+// ObserveSQL records a SQL statement on host that started at start and
+// returned err.
+func ObserveSQL(host, objectType string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	sqlStatementsTotal.WithLabelValues(host, objectType, result).Inc()
+	sqlStatementDuration.WithLabelValues(host, objectType).Observe(time.Since(start).Seconds())
+}
+
+// PreflightFailed records a failed preflight check on host.
+func PreflightFailed(host string) {
+	preflightFailuresTotal.WithLabelValues(host).Inc()
+}
+
+// SetIAMPolicies records the managed IAM policies. fill holds how full each
+// policy is relative to its limits by policy name.
+func SetIAMPolicies(fill map[string]float64) {
+	iamPolicies.Set(float64(len(fill)))
+	iamPolicyFillRatio.Reset()
+	for policy, ratio := range fill {
+		iamPolicyFillRatio.WithLabelValues(policy).Set(ratio)
+	}
+}
+
+// SetIAMSweep records the number of users with orphaned and duplicate
+// statements found by the last sweep of the managed IAM policies.
+func SetIAMSweep(orphaned, duplicated int) {
+	iamUnownedStatements.WithLabelValues("orphaned").Set(float64(orphaned))
+	iamUnownedStatements.WithLabelValues("duplicated").Set(float64(duplicated))
+}
+
+// roles holds the number of roles by host of every resource managing roles.
+// It is keyed by kind and resource.
+var roles = struct {
+	sync.Mutex
+	byResource map[[2]string]map[string]int
+}{
+	byResource: make(map[[2]string]map[string]int),
+}
+
+// TrackRoles records that resource of kind manages the given number of roles
+// by host. It replaces any roles previously tracked for the resource.
+func TrackRoles(kind, resource string, hosts map[string]int) {
+	roles.Lock()
+	defer roles.Unlock()
+	roles.byResource[[2]string{kind, resource}] = hosts
+	updateManagedRoles()
+}
+
+// UntrackRoles removes the roles tracked for resource of kind, eg. when it is
+// deleted.
+func UntrackRoles(kind, resource string) {
+	roles.Lock()
+	defer roles.Unlock()
+	delete(roles.byResource, [2]string{kind, resource})
+	updateManagedRoles()
+}
+
+// updateManagedRoles sets the managed roles gauge from the tracked roles. The
+// caller must hold the roles lock.
+func updateManagedRoles() {
+	managedRoles.Reset()
+	for key, hosts := range roles.byResource {
+		for host, count := range hosts {
+			managedRoles.WithLabelValues(host, key[0]).Add(float64(count))
+		}
+	}
+}
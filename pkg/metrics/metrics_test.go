@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+)
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, OutcomeRunning, Outcome(nil))
+	assert.Equal(t, OutcomeFailed, Outcome(errors.New("connection refused")))
+	assert.Equal(t, OutcomeInvalid, Outcome(ctlerrors.NewInvalid(errors.New("no value"))))
+}
+
+func TestTrackRoles(t *testing.T) {
+	TrackRoles("PostgreSQLDatabase", "default/user", map[string]int{"host1": 4})
+	TrackRoles("PostgreSQLDatabase", "default/order", map[string]int{"host1": 4})
+	TrackRoles("PostgreSQLUser", "default/dev", map[string]int{"host1": 1, "host2": 1})
+
+	assert.Equal(t, 8.0, testutil.ToFloat64(managedRoles.WithLabelValues("host1", "PostgreSQLDatabase")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(managedRoles.WithLabelValues("host2", "PostgreSQLUser")))
+
+	// the user is moved to a single host
+	TrackRoles("PostgreSQLUser", "default/dev", map[string]int{"host1": 1})
+	UntrackRoles("PostgreSQLDatabase", "default/order")
+
+	assert.Equal(t, 4.0, testutil.ToFloat64(managedRoles.WithLabelValues("host1", "PostgreSQLDatabase")))
+	assert.Equal(t, 2, testutil.CollectAndCount(managedRoles), "series not as expected")
+}
+
+func TestSetIAMPolicies(t *testing.T) {
+	SetIAMPolicies(map[string]float64{"policy_0": 1, "policy_1": 0.5})
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(iamPolicies))
+	assert.Equal(t, 1.0, testutil.ToFloat64(iamPolicyFillRatio.WithLabelValues("policy_0")))
+	assert.Equal(t, 0.5, testutil.ToFloat64(iamPolicyFillRatio.WithLabelValues("policy_1")))
+}
+
+func TestSetIAMSweep(t *testing.T) {
+	SetIAMSweep(2, 1)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(iamUnownedStatements.WithLabelValues("orphaned")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(iamUnownedStatements.WithLabelValues("duplicated")))
+}
@@ -0,0 +1,34 @@
+// Package password generates passwords for PostgreSQL roles.
+package password
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// alphabet holds the characters of generated passwords. It is limited to
+// letters and digits so passwords can be used in connection strings and shell
+// environments without escaping.
+const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// MinLength is the shortest password Generate will produce.
+const MinLength = 16
+
+// Generate returns a password of length characters read from a
+// cryptographically secure random source.
+func Generate(length int) (string, error) {
+	if length < MinLength {
+		return "", fmt.Errorf("password length %d is shorter than %d", length, MinLength)
+	}
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("read random: %w", err)
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,28 @@
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lunarway.com/postgresql-controller/pkg/password"
+)
+
+func TestGenerate(t *testing.T) {
+	first, err := password.Generate(32)
+	require.NoError(t, err)
+	assert.Len(t, first, 32)
+	for _, c := range first {
+		assert.True(t, strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789", c), "unexpected character %q", c)
+	}
+
+	second, err := password.Generate(32)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "passwords should differ")
+}
+
+func TestGenerate_tooShort(t *testing.T) {
+	_, err := password.Generate(8)
+	assert.EqualError(t, err, "password length 8 is shorter than 16")
+}
@@ -5,83 +5,15 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
-	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/lib/pq"
 
-	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/customrole"
 )
 
 // CustomRoleFunction defines a SECURITY DEFINER function to create in a database.
-type CustomRoleFunction struct {
-	// Name is the function name (created in the public schema).
-	Name string
-	// Args is the argument list (e.g. "role_name text"). Empty means no arguments.
-	Args string
-	// Returns is the return type (e.g. "void", "boolean", "TABLE(plan text)").
-	Returns string
-	// OwningRole is the PostgreSQL role that will own the function. If empty,
-	// the database owner is used.
-	OwningRole string
-	// Body is the PL/pgSQL statements (without BEGIN/END).
-	Body string
-}
-
-// isSafeArgs reports whether s is safe to interpolate as the argument list of a
-// CREATE FUNCTION statement. A closing parenthesis at depth 0 would escape the
-// argument list, enabling injection. Statement terminators and comment markers
-// are also rejected.
-func isSafeArgs(s string) bool {
-	if strings.ContainsAny(s, ";'") || strings.Contains(s, "--") || strings.Contains(s, "/*") {
-		return false
-	}
-	depth := 0
-	for _, r := range s {
-		switch r {
-		case '(':
-			depth++
-		case ')':
-			if depth == 0 {
-				return false
-			}
-			depth--
-		}
-	}
-	return depth == 0
-}
-
-// isSafeReturns reports whether s is safe to interpolate as the RETURNS type
-// expression of a CREATE FUNCTION statement. Spaces outside balanced
-// parentheses could inject extra function options (e.g. "SET search_path TO
-// public" would override the hardcoded search_path). Only a leading "SETOF "
-// prefix is permitted to carry a space outside parentheses.
-func isSafeReturns(s string) bool {
-	if strings.ContainsAny(s, ";'") || strings.Contains(s, "--") || strings.Contains(s, "/*") {
-		return false
-	}
-	remaining := s
-	if strings.HasPrefix(strings.ToUpper(remaining), "SETOF ") {
-		remaining = remaining[6:]
-	}
-	depth := 0
-	for _, r := range remaining {
-		switch r {
-		case '(':
-			depth++
-		case ')':
-			if depth == 0 {
-				return false
-			}
-			depth--
-		case ' ', '\t', '\n', '\r':
-			if depth == 0 {
-				return false
-			}
-		}
-	}
-	return depth == 0
-}
+type CustomRoleFunction = customrole.Function
 
 // randomDollarTag returns a random dollar-quoting tag of the form $f_<hex>$
 // that is safe to use as a PL/pgSQL function body delimiter.
@@ -184,7 +116,7 @@ func databaseOwner(db *sql.DB) (string, error) {
 // into the connection pool on error.
 func SyncDatabaseFunctions(log logr.Logger, db *sql.DB, roleName string, functions []CustomRoleFunction) error {
 	for _, f := range functions {
-		if err := validateFunction(f); err != nil {
+		if err := customrole.ValidateFunction(f); err != nil {
 			return err
 		}
 	}
@@ -356,30 +288,3 @@ func DropManagedFunctions(log logr.Logger, db *sql.DB, roleName string) error {
 	}
 	return nil
 }
-
-// validateFunction checks that a CustomRoleFunction has the required fields.
-func validateFunction(f CustomRoleFunction) error {
-	if f.Name == "" {
-		return ctlerrors.NewInvalid(fmt.Errorf("function name must not be empty"))
-	}
-	// "__" is the separator between the role prefix and the function name in the
-	// generated PostgreSQL identifier. Allowing it in the user-supplied name would
-	// break the cleanup query that uses the absence of "__" after the prefix to
-	// distinguish functions owned by this role from those of longer-prefixed roles.
-	if strings.Contains(f.Name, "__") {
-		return ctlerrors.NewInvalid(fmt.Errorf("function %q: name must not contain \"__\"", f.Name))
-	}
-	if f.Returns == "" {
-		return ctlerrors.NewInvalid(fmt.Errorf("function %q: returns must not be empty", f.Name))
-	}
-	if !isSafeArgs(f.Args) {
-		return ctlerrors.NewInvalid(fmt.Errorf("function %q: args contains unsafe SQL characters or unbalanced parentheses", f.Name))
-	}
-	if !isSafeReturns(f.Returns) {
-		return ctlerrors.NewInvalid(fmt.Errorf("function %q: returns contains unsafe SQL characters or spaces outside parentheses", f.Name))
-	}
-	if f.Body == "" {
-		return ctlerrors.NewInvalid(fmt.Errorf("function %q: body must not be empty", f.Name))
-	}
-	return nil
-}
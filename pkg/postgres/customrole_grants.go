@@ -9,7 +9,7 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/lib/pq"
 
-	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/customrole"
 )
 
 // CustomRoleGrant defines schema/table privileges to apply to a role within a database.
@@ -22,32 +22,6 @@ type CustomRoleGrant struct {
 	Privileges []string
 }
 
-// allowedTablePrivileges is the set of valid PostgreSQL table-level privilege keywords.
-var allowedTablePrivileges = map[string]struct{}{
-	"SELECT":     {},
-	"INSERT":     {},
-	"UPDATE":     {},
-	"DELETE":     {},
-	"TRUNCATE":   {},
-	"REFERENCES": {},
-	"TRIGGER":    {},
-}
-
-// validatePrivileges returns an error if privs is empty or contains any value
-// that is not a recognised PostgreSQL table-level privilege keyword.
-// Comparison is case-insensitive.
-func validatePrivileges(privs []string) error {
-	if len(privs) == 0 {
-		return ctlerrors.NewInvalid(fmt.Errorf("privileges must not be empty"))
-	}
-	for _, p := range privs {
-		if _, ok := allowedTablePrivileges[strings.ToUpper(p)]; !ok {
-			return ctlerrors.NewInvalid(fmt.Errorf("invalid privilege %q: must be one of SELECT, INSERT, UPDATE, DELETE, TRUNCATE, REFERENCES, TRIGGER", p))
-		}
-	}
-	return nil
-}
-
 // grantKey identifies a single privilege on a specific table.
 type grantKey struct {
 	schema    string
@@ -72,7 +46,7 @@ func isPermissionDenied(err error) bool {
 // objects and the role resets automatically on any exit path.
 func SyncDatabaseGrants(log logr.Logger, db *sql.DB, roleName string, grants []CustomRoleGrant) error {
 	for _, g := range grants {
-		if err := validatePrivileges(g.Privileges); err != nil {
+		if err := customrole.ValidatePrivileges(g.Privileges); err != nil {
 			return err
 		}
 	}
@@ -185,7 +159,7 @@ func SyncDatabaseGrants(log logr.Logger, db *sql.DB, roleName string, grants []C
 	}
 	for tk, privs := range toRevoke {
 		for _, p := range privs {
-			if _, ok := allowedTablePrivileges[p]; !ok {
+			if !customrole.IsTablePrivilege(p) {
 				log.Info("Revoking unrecognized privilege type from database catalog", "privilege", p, "schema", tk.schema, "table", tk.table)
 			}
 		}
@@ -28,6 +28,13 @@ func EnsureCustomRole(log logr.Logger, db *sql.DB, roleName string, grantRoles [
 		log.Info("Role created")
 	}
 
+	return syncRoleMembership(log, db, roleName, grantRoles)
+}
+
+// syncRoleMembership synchronises server-level role grants of roleName to
+// exactly match grantRoles: roles no longer in the list are revoked and missing
+// ones are granted.
+func syncRoleMembership(log logr.Logger, db *sql.DB, roleName string, grantRoles []string) error {
 	current, err := currentGrantedRoles(db, roleName)
 	if err != nil {
 		return fmt.Errorf("query granted roles for %s: %w", roleName, err)
@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/lib/pq"
 	"go.uber.org/multierr"
+
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/metrics"
 )
 
 // Credentials represents connection credentials for a user on a
@@ -53,7 +57,10 @@ func ParseUsernamePassword(s string) (Credentials, error) {
 // Database ensures that a user with provided password exists on the host and
 // that read and readwrite roles are created with default privileges on a
 // schema named after the database name.
-func Database(log logr.Logger, host string, adminCredentials, serviceCredentials Credentials, managerRole string, extensions Extensions) error {
+//
+// Additional schemas are owned by the user as well and get their own read,
+// readwrite and readowningwrite roles named after the schema.
+func Database(log logr.Logger, host string, adminCredentials, serviceCredentials Credentials, managerRole string, extensions Extensions, schemas ...string) error {
 	if host == "" {
 		return fmt.Errorf("host is required")
 	}
@@ -66,7 +73,7 @@ func Database(log logr.Logger, host string, adminCredentials, serviceCredentials
 	}
 
 	// Create the database
-	err = createDatabase(log, host, adminCredentials, serviceCredentials.Name)
+	err = CreateDatabase(log, host, adminCredentials, serviceCredentials.Name, DatabaseOptions{})
 	if err != nil {
 		return fmt.Errorf("create service database '%s': %w", serviceCredentials.Name, err)
 	}
@@ -101,7 +108,7 @@ func Database(log logr.Logger, host string, adminCredentials, serviceCredentials
 	// support services using a shared database with mixed owners of the resources.
 	if serviceCredentials.Shared {
 		// ensures access to existing schemas and tables
-		err = execf(serviceConnection, "GRANT %s TO %s", serviceCredentials.Name, serviceCredentials.User)
+		err = execf(serviceConnection, "GRANT %s TO %s", identifier(serviceCredentials.Name), identifier(serviceCredentials.User))
 		if err != nil {
 			return fmt.Errorf("grant %s to service user %s: %w", serviceCredentials.Name, serviceCredentials.User, err)
 		}
@@ -116,11 +123,11 @@ func Database(log logr.Logger, host string, adminCredentials, serviceCredentials
 
 	// Create read and readwrite roles that can be used to grant users access to
 	// the objects in this database.
-	var (
-		readRole            = fmt.Sprintf("%s_%s", serviceCredentials.User, roleSuffixRead)
-		readWriteRole       = fmt.Sprintf("%s_%s", serviceCredentials.User, roleSuffixWrite)
-		readOwningWriteRole = fmt.Sprintf("%s_%s", serviceCredentials.User, roleSuffixOwningWrite)
-	)
+	readRole, readWriteRole, readOwningWriteRole := schemaRoles(serviceCredentials.User)
+	err = checkSchemaRoles(serviceConnection, serviceCredentials.User, serviceCredentials.User)
+	if err != nil {
+		return err
+	}
 	err = createRoles(log, serviceConnection, readRole, readWriteRole, readOwningWriteRole)
 	if err != nil {
 		return fmt.Errorf("create service read, readwrite and readowningwrite roles: %w", err)
@@ -128,12 +135,12 @@ func Database(log logr.Logger, host string, adminCredentials, serviceCredentials
 
 	// Alter ownership of the database to the database user. The current user
 	// needs to belong to the new role before owner ship can be changed.
-	err = execf(serviceConnection, "GRANT %s TO CURRENT_USER", serviceCredentials.User)
+	err = execf(serviceConnection, "GRANT %s TO CURRENT_USER", identifier(serviceCredentials.User))
 	if err != nil {
 		return fmt.Errorf("grant new role '%s' to creator role: %w", serviceCredentials.User, err)
 	}
 	defer func() {
-		err = execf(serviceConnection, "REVOKE %s FROM CURRENT_USER", serviceCredentials.User)
+		err = execf(serviceConnection, "REVOKE %s FROM CURRENT_USER", identifier(serviceCredentials.User))
 		if err != nil {
 			log.Error(err, fmt.Sprintf("revoke new role '%s' to creator role", serviceCredentials.User))
 		}
@@ -142,14 +149,14 @@ func Database(log logr.Logger, host string, adminCredentials, serviceCredentials
 	// if the database is shared we cannot grant the service user ownership of the
 	// database as that would break the actual owners rights.
 	if !serviceCredentials.Shared {
-		err = execf(serviceConnection, "ALTER DATABASE %s OWNER TO %s", serviceCredentials.Name, serviceCredentials.User)
+		err = execf(serviceConnection, "ALTER DATABASE %s OWNER TO %s", identifier(serviceCredentials.Name), identifier(serviceCredentials.User))
 		if err != nil {
 			return fmt.Errorf("alter owner of database %s to %s: %w", serviceCredentials.Name, serviceCredentials.User, err)
 		}
 	}
 
 	// Grant the service role (which is owner) to the readowningwrite role
-	err = execf(serviceConnection, "GRANT %s TO %s", serviceCredentials.User, readOwningWriteRole)
+	err = execf(serviceConnection, "GRANT %s TO %s", identifier(serviceCredentials.User), identifier(readOwningWriteRole))
 	if err != nil {
 		return fmt.Errorf("grant owner %s to readowningwrite for role %s: %w", serviceCredentials.User, readOwningWriteRole, err)
 	}
@@ -163,11 +170,18 @@ func Database(log logr.Logger, host string, adminCredentials, serviceCredentials
 	}
 
 	// Set default privileges for the service user
-	err = setDefaultPrivileges(serviceConnection, serviceCredentials.User, readRole, readWriteRole, readOwningWriteRole)
+	err = setDefaultPrivileges(serviceConnection, serviceCredentials.User, serviceCredentials.User, true)
 	if err != nil {
 		return fmt.Errorf("set default privileges for service user '%s': %w", serviceCredentials.User, err)
 	}
 
+	for _, schema := range additionalSchemas(serviceCredentials.User, schemas) {
+		err = ensureSchema(log, serviceConnection, schema, serviceCredentials.User)
+		if err != nil {
+			return fmt.Errorf("ensure schema '%s': %w", schema, err)
+		}
+	}
+
 	// This revokation ensures that the user cannot create any objects in the
 	// PUBLIC role that is assigned to all roles by default.
 	err = revokeAllOnPublic(log, serviceConnection, serviceCredentials)
@@ -193,54 +207,26 @@ func createServiceRole(log logr.Logger, db *sql.DB, user, password string) error
 	err := tryExec(log, db, tryExecReq{
 		objectType: "service user",
 		errorCode:  "duplicate_object",
-		query:      fmt.Sprintf("CREATE ROLE %s NOCREATEROLE", user),
+		query:      formatStatement("CREATE ROLE %s NOCREATEROLE", identifier(user)),
 	})
 	if err != nil {
 		return err
 	}
 
 	if password != "" {
-		err = execf(db, "ALTER ROLE %s LOGIN PASSWORD '%s' VALID UNTIL 'infinity'", user, password)
+		err = execf(db, "ALTER ROLE %s LOGIN PASSWORD %s VALID UNTIL 'infinity'", identifier(user), literal(password))
 	} else {
-		err = execf(db, "ALTER ROLE %s NOLOGIN PASSWORD NULL", user)
+		err = execf(db, "ALTER ROLE %s NOLOGIN PASSWORD NULL", identifier(user))
 	}
 	return err
 }
 
-func createDatabase(log logr.Logger, host string, adminCredentials Credentials, name string) error {
-	log = log.WithValues("database", name)
-
-	connectionString := ConnectionString{
-		Host:     host,
-		Database: "postgres",
-		User:     adminCredentials.User,
-		Password: adminCredentials.Password,
-		Params:   adminCredentials.Params,
-	}
-	db, err := Connect(connectionString)
-	if err != nil {
-		return fmt.Errorf("connect to host %s: %w", connectionString, err)
-	}
-	defer func() {
-		err := db.Close()
-		if err != nil {
-			log.Error(err, "failed to close database connection", "host", connectionString.Host, "database", "postgres", "user", connectionString.User)
-		}
-	}()
-
-	return tryExec(log, db, tryExecReq{
-		objectType: "database",
-		errorCode:  "duplicate_database",
-		query:      fmt.Sprintf("CREATE DATABASE %s", name),
-	})
-}
-
 func createSchemaAs(log logr.Logger, db *sql.DB, schema, actor string) error {
 	log = log.WithValues("schema", schema)
 	return tryExec(log, db, tryExecReq{
 		objectType: "schema",
 		errorCode:  "duplicate_schema",
-		query:      prependSetRole(fmt.Sprintf("CREATE SCHEMA %s", schema), actor),
+		query:      prependSetRole(formatStatement("CREATE SCHEMA %s", identifier(schema)), actor),
 	})
 }
 
@@ -251,7 +237,7 @@ func createRoles(log logr.Logger, db *sql.DB, roles ...string) error {
 		err := tryExec(log, db, tryExecReq{
 			objectType: "service role",
 			errorCode:  "duplicate_object",
-			query:      fmt.Sprintf("CREATE ROLE %s", role),
+			query:      formatStatement("CREATE ROLE %s", identifier(role)),
 		})
 		if err != nil {
 			errs = multierr.Append(errs, fmt.Errorf("create role %s: %w", role, err))
@@ -267,24 +253,143 @@ func grantAdminOption(log logr.Logger, db *sql.DB, serviceRole string, managerRo
 	return tryExec(log, db, tryExecReq{
 		objectType: "service role",
 		errorCode:  "undefined_object",
-		query:      fmt.Sprintf("GRANT %s TO %s WITH ADMIN OPTION", serviceRole, managerRole),
+		query:      formatStatement("GRANT %s TO %s WITH ADMIN OPTION", identifier(serviceRole), identifier(managerRole)),
 	})
 }
 
-func setDefaultPrivileges(serviceConnection *sql.DB, serviceRole, readRole, readWriteRole, readOwningWriteRole string) error {
-	err := setReadPrivilegesAs(serviceConnection, serviceRole, readRole, serviceRole)
+// schemaRoles returns the names of the read, readwrite and readowningwrite
+// roles of schema.
+func schemaRoles(schema string) (read, readWrite, readOwningWrite string) {
+	return fmt.Sprintf("%s_%s", schema, roleSuffixRead),
+		fmt.Sprintf("%s_%s", schema, roleSuffixWrite),
+		fmt.Sprintf("%s_%s", schema, roleSuffixOwningWrite)
+}
+
+// additionalSchemas returns schemas without duplicates, the public schema and
+// the schema of the service user as those are managed separately.
+func additionalSchemas(serviceRole string, schemas []string) []string {
+	seen := map[string]bool{serviceRole: true, "public": true}
+	var additional []string
+	for _, schema := range schemas {
+		if schema == "" || seen[schema] {
+			continue
+		}
+		seen[schema] = true
+		additional = append(additional, schema)
+	}
+	return additional
+}
+
+// checkSchemaRoles returns an Invalid error if the access roles of schema
+// belong to another database than the one of serviceRole. The roles are shared
+// by all databases on the host so a schema must neither share the roles of a
+// schema of another database nor be named after another role, eg. the service
+// user of another database, as its readowningwrite role would be granted
+// serviceRole.
+func checkSchemaRoles(db *sql.DB, schema, serviceRole string) error {
+	_, _, readOwningWriteRole := schemaRoles(schema)
+	if schema != serviceRole {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", schema).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("select role %s: %w", schema, err)
+		}
+		if exists {
+			return ctlerrors.NewInvalid(fmt.Errorf("schema %s is named after an existing role: schema names must be unique on the host", schema))
+		}
+	}
+	owners, err := memberOf(db, readOwningWriteRole)
 	if err != nil {
-		return fmt.Errorf("set default read privileges for role %s: %w, as %s", readRole, err, serviceRole)
+		return fmt.Errorf("select roles of %s: %w", readOwningWriteRole, err)
+	}
+	for _, owner := range owners {
+		if owner != serviceRole {
+			return ctlerrors.NewInvalid(fmt.Errorf("role %s of schema %s belongs to role %s of another database: schema names must be unique on the host", readOwningWriteRole, schema, owner))
+		}
 	}
+	return nil
+}
 
-	err = setReadWritePrivilegesAs(serviceConnection, serviceRole, readWriteRole, serviceRole)
+// memberOf returns the names of the roles that role is a member of.
+func memberOf(db *sql.DB, role string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT r.rolname
+		FROM pg_auth_members m
+		JOIN pg_roles r ON r.oid = m.roleid
+		JOIN pg_roles u ON u.oid = m.member
+		WHERE u.rolname = $1
+		ORDER BY r.rolname`, role)
 	if err != nil {
-		return fmt.Errorf("set default readwrite privileges for role %s: %w, as %s", readWriteRole, err, serviceRole)
+		return nil, err
+	}
+	defer rows.Close()
+	var roles []string
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, name)
 	}
+	return roles, rows.Err()
+}
 
-	err = setReadWritePrivilegesAs(serviceConnection, serviceRole, readOwningWriteRole, serviceRole)
+// ensureSchema creates schema owned by serviceRole along with its read,
+// readwrite and readowningwrite roles. The readowningwrite role is a member of
+// serviceRole like the one of the service user schema.
+func ensureSchema(log logr.Logger, db *sql.DB, schema, serviceRole string) error {
+	log = log.WithValues("schema", schema)
+	readRole, readWriteRole, readOwningWriteRole := schemaRoles(schema)
+	err := checkSchemaRoles(db, schema, serviceRole)
+	if err != nil {
+		return err
+	}
+	err = createRoles(log, db, readRole, readWriteRole, readOwningWriteRole)
+	if err != nil {
+		return fmt.Errorf("create read, readwrite and readowningwrite roles: %w", err)
+	}
+	err = execf(db, "GRANT %s TO %s", identifier(serviceRole), identifier(readOwningWriteRole))
 	if err != nil {
-		return fmt.Errorf("set default readowningwrite privileges for role %s: %w, as %s", readOwningWriteRole, err, serviceRole)
+		return fmt.Errorf("grant owner %s to readowningwrite for role %s: %w", serviceRole, readOwningWriteRole, err)
+	}
+	err = createSchemaAs(log, db, schema, serviceRole)
+	if err != nil {
+		return fmt.Errorf("create schema as service user '%s': %w", serviceRole, err)
+	}
+	err = setDefaultPrivileges(db, schema, serviceRole, false)
+	if err != nil {
+		return fmt.Errorf("set default privileges: %w", err)
+	}
+	return nil
+}
+
+// setDefaultPrivileges grants the read, readwrite and readowningwrite roles of
+// schema their privileges on the objects of schema created by serviceRole.
+// With public the roles get default privileges on the public schema as well.
+func setDefaultPrivileges(serviceConnection *sql.DB, schema, serviceRole string, public bool) error {
+	readRole, readWriteRole, readOwningWriteRole := schemaRoles(schema)
+	roles := []struct {
+		name       string
+		role       string
+		privileges objectPrivileges
+	}{
+		{name: roleSuffixRead, role: readRole, privileges: readPrivileges},
+		{name: roleSuffixWrite, role: readWriteRole, privileges: readWritePrivileges},
+		{name: roleSuffixOwningWrite, role: readOwningWriteRole, privileges: readWritePrivileges},
+	}
+	for _, r := range roles {
+		err := setDefaultPrivilegesAs(serviceConnection, schema, r.role, r.privileges, serviceRole)
+		if err != nil {
+			return fmt.Errorf("set default %s privileges for role %s: %w, as %s", r.name, r.role, err, serviceRole)
+		}
+		if !public {
+			continue
+		}
+		err = setPublicDefaultPrivilegesAs(serviceConnection, r.role, r.privileges, serviceRole)
+		if err != nil {
+			return fmt.Errorf("set default %s privileges for role %s: %w, as %s", r.name, r.role, err, serviceRole)
+		}
 	}
 	return nil
 }
@@ -294,7 +399,7 @@ func revokeAllOnPublic(log logr.Logger, serviceConnection *sql.DB, serviceCreden
 	err := execAsf(serviceConnection, serviceCredentials.User, `
 		REVOKE ALL ON DATABASE %s from PUBLIC;
 		REVOKE ALL ON SCHEMA public from PUBLIC;
-		REVOKE ALL ON ALL TABLES IN SCHEMA public from PUBLIC;`, serviceCredentials.Name)
+		REVOKE ALL ON ALL TABLES IN SCHEMA public from PUBLIC;`, identifier(serviceCredentials.Name))
 	if err != nil {
 		return fmt.Errorf("revoke all for role PUBLIC on database '%s': %w, as %s", serviceCredentials.Name, err, serviceCredentials.User)
 	}
@@ -304,13 +409,13 @@ func revokeAllOnPublic(log logr.Logger, serviceConnection *sql.DB, serviceCreden
 func grantConnectAndUsage(log logr.Logger, serviceConnection *sql.DB, serviceCredentials Credentials) error {
 	// Grant CONNECT privileges to PUBLIC again to ensure new roles are allowed to connect.
 	log.V(1).Info("Grant CONNECT to PUBLIC")
-	err := execAsf(serviceConnection, serviceCredentials.User, "GRANT CONNECT ON DATABASE %s TO PUBLIC", serviceCredentials.Name)
+	err := execAsf(serviceConnection, serviceCredentials.User, "GRANT CONNECT ON DATABASE %s TO PUBLIC", identifier(serviceCredentials.Name))
 	if err != nil {
 		return fmt.Errorf("grant connect to database '%s' to PUBLIC: %w as %s", serviceCredentials.Name, err, serviceCredentials.User)
 	}
 
 	log.V(1).Info(fmt.Sprintf("Grant usage on schema '%s' to PUBLIC", serviceCredentials.User))
-	err = execAsf(serviceConnection, serviceCredentials.User, "GRANT USAGE ON SCHEMA %s TO PUBLIC", serviceCredentials.User)
+	err = execAsf(serviceConnection, serviceCredentials.User, "GRANT USAGE ON SCHEMA %s TO PUBLIC", identifier(serviceCredentials.User))
 	if err != nil {
 		return fmt.Errorf("grant usage on schema '%s' to PUBLIC: %w as %s", serviceCredentials.User, err, serviceCredentials.User)
 	}
@@ -325,69 +430,202 @@ type tryExecReq struct {
 }
 
 func tryExec(log logr.Logger, db *sql.DB, args tryExecReq) error {
+	start := time.Now()
 	_, err := db.Exec(args.query)
 	if err != nil {
 		pqError, ok := err.(*pq.Error)
 		if !ok || pqError.Code.Name() != args.errorCode {
+			metrics.ObserveSQL(hostOf(db), args.objectType, start, err)
 			return err
 		}
 		log.V(1).Info(fmt.Sprintf("expected err '%s' occured. Ignoring for objectType '%s'", args.errorCode, args.objectType), "errorCode", pqError.Code, "errorName", pqError.Code.Name())
 	} else {
 		log.V(1).Info(fmt.Sprintf("%s created", args.objectType))
 	}
+	metrics.ObserveSQL(hostOf(db), args.objectType, start, nil)
 	return nil
 }
 
-func setReadPrivilegesAs(db *sql.DB, schema, role, actor string) error {
-	return setDefaultPrivilegesAs(db, schema, role, "SELECT", actor)
+// objectPrivileges are the privileges of a generated role on each kind of
+// object in a schema.
+type objectPrivileges struct {
+	tables    keywords
+	sequences keywords
+	functions keywords
+	types     keywords
 }
 
-func setReadWritePrivilegesAs(db *sql.DB, schema, role, actor string) error {
-	return setDefaultPrivilegesAs(db, schema, role, "SELECT, INSERT, UPDATE, DELETE", actor)
+var (
+	// readPrivileges allows reading tables and sequences, eg. with currval,
+	// calling functions and using types.
+	readPrivileges = objectPrivileges{
+		tables:    "SELECT",
+		sequences: "SELECT",
+		functions: "EXECUTE",
+		types:     "USAGE",
+	}
+	// readWritePrivileges additionally allows writing tables and advancing
+	// sequences, eg. with nextval when inserting into serial columns.
+	readWritePrivileges = objectPrivileges{
+		tables:    "SELECT, INSERT, UPDATE, DELETE",
+		sequences: "USAGE, SELECT, UPDATE",
+		functions: "EXECUTE",
+		types:     "USAGE",
+	}
+)
+
+// objectKinds returns the privileges on each kind of object in a schema.
+func (p objectPrivileges) objectKinds() []objectKindPrivileges {
+	return []objectKindPrivileges{
+		{kind: "TABLES", privileges: p.tables},
+		{kind: "SEQUENCES", privileges: p.sequences},
+		{kind: "FUNCTIONS", privileges: p.functions},
+		{kind: "TYPES", privileges: p.types},
+	}
 }
 
-func setDefaultPrivilegesAs(db *sql.DB, schema, role, privileges, actor string) error {
-	// ensures access to future schemas and tables
-	err := execAsf(db, actor, "ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT %s ON TABLES TO %s;", schema, privileges, role)
-	if err != nil {
-		return fmt.Errorf("alter default privileges of schema: %w, as %s", err, actor)
+type objectKindPrivileges struct {
+	kind       keywords
+	privileges keywords
+}
+
+// setDefaultPrivilegesAs grants privileges on the tables, sequences, functions
+// and types of schema to role. Objects created by actor in the future get them
+// by default and existing objects are granted them right away so databases
+// created before are backfilled.
+func setDefaultPrivilegesAs(db *sql.DB, schema, role string, privileges objectPrivileges, actor string) error {
+	objects := privileges.objectKinds()
+	// ensures access to future schemas and objects
+	for _, object := range objects {
+		err := execAsf(db, actor, "ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT %s ON %s TO %s;", identifier(schema), object.privileges, object.kind, identifier(role))
+		if err != nil {
+			return fmt.Errorf("alter default privileges on %s of schema: %w, as %s", strings.ToLower(string(object.kind)), err, actor)
+		}
 	}
-	err = execAsf(db, actor, "ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT %s ON TABLES TO %s;", privileges, role)
+	// ensures access to existing schemas and objects
+	err := execAsf(db, actor, "GRANT USAGE ON SCHEMA %s TO %s", identifier(schema), identifier(role))
 	if err != nil {
-		return fmt.Errorf("alter default privileges of public schema: %w, as %s", err, actor)
+		return fmt.Errorf("grant usage privileges on existing schema: %w, as %s", err, actor)
 	}
-	// ensures access to existing schemas and tables
-	err = execAsf(db, actor, fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", schema, role))
-	if err != nil {
-		return fmt.Errorf("grant %s privileges on existing schema: %w, as %s", privileges, err, actor)
+	// there is no GRANT ON ALL TYPES so types are granted one by one below
+	for _, object := range objects[:3] {
+		err = execAsf(db, actor, "GRANT %s ON ALL %s IN SCHEMA %s TO %s", object.privileges, object.kind, identifier(schema), identifier(role))
+		if err != nil {
+			return fmt.Errorf("grant %s privileges on existing %s: %w, as %s", object.privileges, strings.ToLower(string(object.kind)), err, actor)
+		}
 	}
-	err = execAsf(db, actor, fmt.Sprintf("GRANT %s ON ALL TABLES IN SCHEMA %s TO %s", privileges, schema, role))
+	types, err := ownedTypes(db, schema, actor)
 	if err != nil {
-		return fmt.Errorf("grant %s privileges on existing tables: %w, as %s", privileges, err, actor)
+		return fmt.Errorf("list existing types: %w", err)
+	}
+	for _, typ := range types {
+		err = execAsf(db, actor, "GRANT %s ON TYPE %s.%s TO %s", privileges.types, identifier(schema), identifier(typ), identifier(role))
+		if err != nil {
+			return fmt.Errorf("grant %s privileges on existing type %s: %w, as %s", privileges.types, typ, err, actor)
+		}
+	}
+	return nil
+}
+
+// setPublicDefaultPrivilegesAs grants privileges on the objects created by
+// actor in the public schema in the future to role.
+func setPublicDefaultPrivilegesAs(db *sql.DB, role string, privileges objectPrivileges, actor string) error {
+	for _, object := range privileges.objectKinds() {
+		err := execAsf(db, actor, "ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT %s ON %s TO %s;", object.privileges, object.kind, identifier(role))
+		if err != nil {
+			return fmt.Errorf("alter default privileges on %s of public schema: %w, as %s", strings.ToLower(string(object.kind)), err, actor)
+		}
 	}
 	return nil
 }
 
-// execf executes a formatted query on db.
-func execf(db *sql.DB, query string, args ...interface{}) error {
-	_, err := db.Exec(fmt.Sprintf(query, args...))
+// ownedTypes returns the names of the types in schema owned by owner that
+// privileges can be granted on, ie. domains, enums, ranges and standalone
+// composite types. Row types of tables and array types follow their table and
+// element type.
+func ownedTypes(db *sql.DB, schema, owner string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT t.typname
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		LEFT JOIN pg_class c ON c.oid = t.typrelid
+		WHERE n.nspname = $1
+		AND pg_get_userbyid(t.typowner) = $2
+		AND (t.typtype IN ('d', 'e', 'r') OR (t.typtype = 'c' AND c.relkind = 'c'))
+		ORDER BY t.typname`, schema, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var types []string
+	for rows.Next() {
+		var typ string
+		err := rows.Scan(&typ)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, typ)
+	}
+	return types, rows.Err()
+}
+
+// execf executes query formatted with the quoted args on db.
+func execf(db *sql.DB, query string, args ...sqlArg) error {
+	return exec(db, statementObjectType(query), formatStatement(query, args...))
+}
+
+// exec executes statement on db. objectType labels the metrics of the
+// statement.
+func exec(db *sql.DB, objectType, statement string) error {
+	start := time.Now()
+	_, err := db.Exec(statement)
+	metrics.ObserveSQL(hostOf(db), objectType, start, err)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// execf executes a formatted query on db as given role.
-func execAsf(db *sql.DB, role string, query string, args ...interface{}) error {
-	err := execf(db, prependSetRole(query, role), args...)
+// statementObjectType returns the leading keywords of the last statement in
+// query, eg. GRANT or ALTER ROLE, to label metrics of statements without an
+// explicit object type. Only keywords are used so the label does not include
+// object names.
+func statementObjectType(query string) string {
+	statements := strings.Split(strings.TrimSpace(query), ";")
+	statement := ""
+	for i := len(statements) - 1; i >= 0 && statement == ""; i-- {
+		statement = strings.TrimSpace(statements[i])
+	}
+	fields := strings.Fields(strings.ToUpper(statement))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	switch fields[0] {
+	case "ALTER", "CREATE", "DROP":
+		if len(fields) > 1 && fields[1] == "DEFAULT" {
+			return fields[0] + " DEFAULT PRIVILEGES"
+		}
+		if len(fields) > 1 {
+			return fields[0] + " " + fields[1]
+		}
+	}
+	return fields[0]
+}
+
+// execAsf executes query formatted with the quoted args on db as given role.
+func execAsf(db *sql.DB, role string, query string, args ...sqlArg) error {
+	statement := prependSetRole(formatStatement(query, args...), role)
+	err := exec(db, statementObjectType(query), statement)
 	if err != nil {
-		return fmt.Errorf("unable to execute query '%s', with args %v. %w", prependSetRole(query, role), args, err)
+		return fmt.Errorf("unable to execute query '%s'. %w", statement, err)
 	}
 	return nil
 }
 
-func prependSetRole(query, role string) string {
+// prependSetRole prepends a SET ROLE statement to statement so it is executed
+// as role.
+func prependSetRole(statement, role string) string {
 	return fmt.Sprintf(`
 		SET ROLE %s;
-		%s`, role, query)
+		%s`, identifier(role).sql(), statement)
 }
@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/go-logr/logr"
+
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+)
+
+// RevokeDatabaseLogin removes the login privilege of the service user created
+// by Database and terminates its open sessions. The database and its roles are
+// left on the host.
+func RevokeDatabaseLogin(log logr.Logger, host string, adminCredentials, serviceCredentials Credentials) error {
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if serviceCredentials.User == "" {
+		return fmt.Errorf("serviceCredentials not valid: user is empty")
+	}
+	log = log.WithValues("user", serviceCredentials.User)
+
+	db, closeDB, err := connectAdmin(log, host, adminCredentials)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	err = tryExec(log, db, tryExecReq{
+		objectType: "service user",
+		errorCode:  "undefined_object",
+		query:      formatStatement("ALTER ROLE %s NOLOGIN", identifier(serviceCredentials.User)),
+	})
+	if err != nil {
+		return fmt.Errorf("revoke login of service user %s: %w", serviceCredentials.User, err)
+	}
+
+	terminated, err := terminateBackends(db, "usename = $1", serviceCredentials.User)
+	if err != nil {
+		return fmt.Errorf("terminate sessions of service user %s: %w", serviceCredentials.User, err)
+	}
+	log.Info("Revoked login of service user", "terminatedSessions", terminated)
+	return nil
+}
+
+// DropDatabase drops the database created by Database along with its service
+// user and the read, readwrite and readowningwrite roles of the service user
+// schema and of schemas. All connections to the database are terminated before
+// it is dropped and on PostgreSQL 13 and later the drop is forced.
+//
+// Shared databases are used by other services as well and are never dropped.
+func DropDatabase(log logr.Logger, host string, adminCredentials, serviceCredentials Credentials, schemas ...string) error {
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+	err := serviceCredentials.Validate()
+	if err != nil {
+		return fmt.Errorf("serviceCredentials not valid: %w", err)
+	}
+	if serviceCredentials.Shared {
+		return fmt.Errorf("refusing to drop shared database %s", serviceCredentials.Name)
+	}
+	log = log.WithValues("database", serviceCredentials.Name, "user", serviceCredentials.User)
+
+	db, closeDB, err := connectAdmin(log, host, adminCredentials)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	// The current user needs to belong to the owning role of the database to
+	// revoke privileges on and drop it.
+	err = tryExec(log, db, tryExecReq{
+		objectType: "service user",
+		errorCode:  "undefined_object",
+		query:      formatStatement("GRANT %s TO CURRENT_USER", identifier(serviceCredentials.User)),
+	})
+	if err != nil {
+		return fmt.Errorf("grant role '%s' to creator role: %w", serviceCredentials.User, err)
+	}
+
+	// Prevent new connections while the existing ones are terminated.
+	err = tryExec(log, db, tryExecReq{
+		objectType: "database",
+		errorCode:  "invalid_catalog_name",
+		query:      formatStatement("REVOKE CONNECT ON DATABASE %s FROM PUBLIC", identifier(serviceCredentials.Name)),
+	})
+	if err != nil {
+		return fmt.Errorf("revoke connect on database %s: %w", serviceCredentials.Name, err)
+	}
+	terminated, err := terminateBackends(db, "datname = $1", serviceCredentials.Name)
+	if err != nil {
+		return fmt.Errorf("terminate connections to database %s: %w", serviceCredentials.Name, err)
+	}
+	log.V(1).Info("Terminated connections to database", "terminatedSessions", terminated)
+
+	// sessions may reconnect between the termination and the drop, eg. of
+	// superusers not affected by the revoked CONNECT privilege. FORCE terminates
+	// them as part of the drop on hosts supporting it.
+	version, err := serverVersion(db)
+	if err != nil {
+		return err
+	}
+	if version >= 130000 {
+		err = execf(db, "DROP DATABASE IF EXISTS %s WITH (FORCE)", identifier(serviceCredentials.Name))
+	} else {
+		err = execf(db, "DROP DATABASE IF EXISTS %s", identifier(serviceCredentials.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("drop database %s: %w", serviceCredentials.Name, err)
+	}
+
+	var roles []string
+	for _, schema := range append([]string{serviceCredentials.User}, additionalSchemas(serviceCredentials.User, schemas)...) {
+		// roles of a schema of another database are left alone
+		err = checkSchemaRoles(db, schema, serviceCredentials.User)
+		if ctlerrors.IsInvalid(err) {
+			log.Info("Keeping roles of schema", "schema", schema, "reason", err.Error())
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("check roles of schema %s: %w", schema, err)
+		}
+		readRole, readWriteRole, readOwningWriteRole := schemaRoles(schema)
+		roles = append(roles, readRole, readWriteRole, readOwningWriteRole)
+	}
+	roles = append(roles, serviceCredentials.User)
+	for _, role := range roles {
+		err = execf(db, "DROP ROLE IF EXISTS %s", identifier(role))
+		if err != nil {
+			return fmt.Errorf("drop role %s: %w", role, err)
+		}
+	}
+	log.Info("Dropped database and roles")
+	return nil
+}
+
+// connectAdmin connects to the postgres database on host with the admin
+// credentials. The returned function closes the connection.
+func connectAdmin(log logr.Logger, host string, adminCredentials Credentials) (*sql.DB, func(), error) {
+	return connectAdminTo(log, host, adminCredentials, "postgres")
+}
+
+// connectAdminTo connects to database on host with the admin credentials. The
+// returned function closes the connection.
+func connectAdminTo(log logr.Logger, host string, adminCredentials Credentials, database string) (*sql.DB, func(), error) {
+	connectionString := ConnectionString{
+		Host:     host,
+		Database: database,
+		User:     adminCredentials.User,
+		Password: adminCredentials.Password,
+		Params:   adminCredentials.Params,
+	}
+	db, err := Connect(connectionString)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to host %s: %w", connectionString, err)
+	}
+	return db, func() {
+		err := db.Close()
+		if err != nil {
+			log.Error(err, "failed to close database connection", "host", connectionString.Host, "database", database, "user", connectionString.User)
+		}
+	}, nil
+}
+
+// serverVersion returns the version of the host as reported by
+// server_version_num, eg. 130004 for 13.4.
+func serverVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT current_setting('server_version_num')::int").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("get server version: %w", err)
+	}
+	return version, nil
+}
+
+// terminateBackends terminates all backends matching the pg_stat_activity
+// condition except the one of the current connection. It returns the number of
+// terminated backends.
+func terminateBackends(db *sql.DB, condition string, args ...interface{}) (int, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE %s AND pid <> pg_backend_pid()", condition), args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var terminated int
+	for rows.Next() {
+		var ok bool
+		if err := rows.Scan(&ok); err != nil {
+			return terminated, err
+		}
+		if ok {
+			terminated++
+		}
+	}
+	return terminated, rows.Err()
+}
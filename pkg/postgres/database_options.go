@@ -0,0 +1,190 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// DatabaseOptions are the options a database is created with. Empty options
+// use the defaults of the host.
+type DatabaseOptions struct {
+	Encoding   string
+	LCCollate  string
+	LCCtype    string
+	ICULocale  string
+	Template   string
+	Tablespace string
+	// ConnectionLimit is the number of concurrent connections allowed to the
+	// database. -1 means no limit. It is the only option applied to existing
+	// databases and is left unchanged if nil.
+	ConnectionLimit *int
+}
+
+// ErrDatabaseOptionChanged is returned by CreateDatabase if the options of an
+// existing database differ from the requested ones and can only be set when
+// the database is created.
+var ErrDatabaseOptionChanged = errors.New("options cannot be changed after the database is created")
+
+// CreateDatabase creates the database name on host with options unless it
+// exists. The options of an existing database are compared with options and
+// ErrDatabaseOptionChanged is returned if any of them differ. The template of an
+// existing database is not known so it is never compared. The connection limit
+// is applied to existing databases.
+func CreateDatabase(log logr.Logger, host string, adminCredentials Credentials, name string, options DatabaseOptions) error {
+	log = log.WithValues("database", name)
+	db, closeDB, err := connectAdmin(log, host, adminCredentials)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	existing, err := databaseOptions(db, name)
+	if err != nil {
+		return fmt.Errorf("read options of database %s: %w", name, err)
+	}
+	if existing == nil {
+		return tryExec(log, db, tryExecReq{
+			objectType: "database",
+			errorCode:  "duplicate_database",
+			query:      createDatabaseStatement(name, options),
+		})
+	}
+
+	if options.Encoding != "" {
+		encoding, err := canonicalEncoding(db, options.Encoding)
+		if err != nil {
+			return fmt.Errorf("resolve encoding %s: %w", options.Encoding, err)
+		}
+		options.Encoding = encoding
+	}
+	changed := changedOptions(*existing, options)
+	if len(changed) != 0 {
+		return fmt.Errorf("%w: %s", ErrDatabaseOptionChanged, strings.Join(changed, ", "))
+	}
+
+	if options.ConnectionLimit != nil && *options.ConnectionLimit != *existing.ConnectionLimit {
+		log.Info("Changing connection limit of database", "from", *existing.ConnectionLimit, "to", *options.ConnectionLimit)
+		err = execf(db, "ALTER DATABASE %s CONNECTION LIMIT %s", identifier(name), integer(*options.ConnectionLimit))
+		if err != nil {
+			return fmt.Errorf("alter connection limit of database %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// createDatabaseStatement returns the CREATE DATABASE statement of database
+// name with options.
+func createDatabaseStatement(name string, options DatabaseOptions) string {
+	query := "CREATE DATABASE %s"
+	args := []sqlArg{identifier(name)}
+	add := func(option string, arg sqlArg) {
+		query += " " + option + " %s"
+		args = append(args, arg)
+	}
+	if options.Template != "" {
+		add("TEMPLATE", identifier(options.Template))
+	}
+	if options.Encoding != "" {
+		add("ENCODING", literal(options.Encoding))
+	}
+	if options.LCCollate != "" {
+		add("LC_COLLATE", literal(options.LCCollate))
+	}
+	if options.LCCtype != "" {
+		add("LC_CTYPE", literal(options.LCCtype))
+	}
+	if options.ICULocale != "" {
+		add("LOCALE_PROVIDER icu ICU_LOCALE", literal(options.ICULocale))
+	}
+	if options.Tablespace != "" {
+		add("TABLESPACE", identifier(options.Tablespace))
+	}
+	if options.ConnectionLimit != nil {
+		add("CONNECTION LIMIT", integer(*options.ConnectionLimit))
+	}
+	return formatStatement(query, args...)
+}
+
+// databaseOptions returns the options of database name or nil if it does not
+// exist. The ICU locale is read from datlocale on PostgreSQL 17 and later and
+// from daticulocale before that.
+func databaseOptions(db *sql.DB, name string) (*DatabaseOptions, error) {
+	var (
+		options         DatabaseOptions
+		connectionLimit int
+	)
+	err := db.QueryRow(`
+		SELECT
+			pg_encoding_to_char(d.encoding),
+			d.datcollate,
+			d.datctype,
+			COALESCE(to_jsonb(d) ->> 'datlocale', to_jsonb(d) ->> 'daticulocale', ''),
+			t.spcname,
+			d.datconnlimit
+		FROM pg_database d
+		JOIN pg_tablespace t ON t.oid = d.dattablespace
+		WHERE d.datname = $1`, name).Scan(
+		&options.Encoding,
+		&options.LCCollate,
+		&options.LCCtype,
+		&options.ICULocale,
+		&options.Tablespace,
+		&connectionLimit,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	options.ConnectionLimit = &connectionLimit
+	return &options, nil
+}
+
+// canonicalEncoding returns the name of encoding used by the host, eg. UTF8
+// for utf-8. Unknown encodings are returned as is.
+func canonicalEncoding(db *sql.DB, encoding string) (string, error) {
+	var canonical string
+	err := db.QueryRow("SELECT COALESCE(NULLIF(pg_encoding_to_char(pg_char_to_encoding($1::text)), ''), $1::text)", encoding).Scan(&canonical)
+	return canonical, err
+}
+
+// changedOptions describes the options that can only be set when a database
+// is created and differ between existing and requested. Options that are not
+// requested are not compared. Locales are compared with normalizeLocale.
+//
+// The tablespace is deliberately not changed on existing databases as moving
+// a database requires exclusive access to it and copies all of its data.
+func changedOptions(existing, requested DatabaseOptions) []string {
+	var changed []string
+	compare := func(option, existing, requested string, normalize func(string) string) {
+		if requested != "" && normalize(requested) != normalize(existing) {
+			changed = append(changed, fmt.Sprintf("%s is %q and not %q", option, existing, requested))
+		}
+	}
+	same := func(s string) string { return s }
+	compare("encoding", existing.Encoding, requested.Encoding, same)
+	compare("lcCollate", existing.LCCollate, requested.LCCollate, normalizeLocale)
+	compare("lcCtype", existing.LCCtype, requested.LCCtype, normalizeLocale)
+	compare("icuLocale", existing.ICULocale, requested.ICULocale, normalizeLocale)
+	compare("tablespace", existing.Tablespace, requested.Tablespace, same)
+	return changed
+}
+
+// normalizeLocale returns locale in a form where spellings accepted by the
+// host for the same locale are equal. Locales are compared case-insensitively,
+// the language and territory may be separated by - or _ and dashes in the
+// codeset are ignored, so en_US.utf8 equals en-US.UTF-8.
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(locale)
+	name, codeset, ok := strings.Cut(locale, ".")
+	name = strings.ReplaceAll(name, "-", "_")
+	if !ok {
+		return name
+	}
+	return name + "." + strings.ReplaceAll(codeset, "-", "")
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 	"go.lunarway.com/postgresql-controller/test"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -382,6 +383,62 @@ func TestDatabase_HasExtensionsGiveEmptyDeclarativeExtensionsShouldDoNothing(t *
 		actualExtensions,
 	)
 }
+func TestDatabase_extensionLifecycle(t *testing.T) {
+	postgresqlHost := test.Integration(t)
+	log := test.SetLogger(t)
+
+	managerRole := "postgres_role_name"
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err, "connect to database failed")
+	defer db.Close()
+
+	err = createManagerRole(log, db, managerRole)
+	require.NoError(t, err, "create manager role failed")
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	service := postgres.Credentials{
+		Name:     name,
+		User:     name,
+		Password: "test",
+	}
+
+	// install a pinned version
+	err = postgres.Database(log, postgresqlHost, admin, service, managerRole, []postgres.Extension{
+		{Name: "pg_trgm", Version: "1.5"},
+	})
+	require.NoError(t, err, "EnsurePostgreSQLDatabase failed")
+	installed, err := postgres.InstalledExtensions(log, postgresqlHost, admin, name)
+	require.NoError(t, err, "InstalledExtensions failed")
+	assert.Contains(t, installed, postgres.Extension{Name: "pg_trgm", Version: "1.5", Schema: name})
+
+	// update the version and move the extension
+	err = postgres.Database(log, postgresqlHost, admin, service, managerRole, []postgres.Extension{
+		{Name: "pg_trgm", Version: "1.6", Schema: "public"},
+	})
+	require.NoError(t, err, "EnsurePostgreSQLDatabase failed")
+	installed, err = postgres.InstalledExtensions(log, postgresqlHost, admin, name)
+	require.NoError(t, err, "InstalledExtensions failed")
+	assert.Contains(t, installed, postgres.Extension{Name: "pg_trgm", Version: "1.6", Schema: "public"})
+
+	// drop the extension
+	err = postgres.Database(log, postgresqlHost, admin, service, managerRole, []postgres.Extension{
+		{Name: "pg_trgm", Drop: true},
+	})
+	require.NoError(t, err, "EnsurePostgreSQLDatabase failed")
+	installed, err = postgres.InstalledExtensions(log, postgresqlHost, admin, name)
+	require.NoError(t, err, "InstalledExtensions failed")
+	assert.Equal(t, postgres.Extensions{{Name: "plpgsql", Version: "1.0", Schema: "pg_catalog"}}, installed)
+}
+
 func TestDatabase_noPassword(t *testing.T) {
 	postgresqlHost := test.Integration(t)
 	log := test.SetLogger(t)
@@ -441,6 +498,70 @@ func TestDatabase_noPassword(t *testing.T) {
 	assert.Equal(t, []string{name}, owners, "owner not as expected")
 }
 
+// TestDatabase_quotedNames tests that names that must be quoted, eg. upper case
+// and dashes, and passwords with quotes are handled.
+func TestDatabase_quotedNames(t *testing.T) {
+	postgresqlHost := test.Integration(t)
+	log := test.SetLogger(t)
+	managerRole := "postgres_role_name"
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	if err != nil {
+		t.Fatalf("connect to database failed: %v", err)
+	}
+	err = createManagerRole(log, db, managerRole)
+	if err != nil {
+		t.Fatalf("create manager role failed: %v", err)
+	}
+	defer db.Close()
+
+	name := fmt.Sprintf("Test-%d", time.Now().UnixNano())
+	password := `it's a "password"; DROP ROLE iam_creator; --`
+
+	err = postgres.Database(logf.Log, postgresqlHost,
+		postgres.Credentials{
+			User:     "iam_creator",
+			Password: "iam_creator",
+		}, postgres.Credentials{
+			Name:     name,
+			User:     name,
+			Password: password,
+		}, managerRole, []postgres.Extension{postgres.NewExtension("pg_stat_statements")})
+	if err != nil {
+		t.Fatalf("EnsurePostgreSQLDatabase failed: %v", err)
+	}
+
+	assert.True(t, roleCanLogin(t, db, name))
+	assert.Equal(t, []string{name}, validateOwner(t, db, name), "owner not as expected")
+
+	serviceDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: name,
+		User:     name,
+		Password: password,
+	})
+	if err != nil {
+		t.Fatalf("connect to database as service user failed: %v", err)
+	}
+	defer serviceDB.Close()
+	assert.Equal(t, []string{name}, storedSchema(t, serviceDB, name), "schema not as expected")
+
+	developer := fmt.Sprintf("Dev.Eloper-%d", time.Now().UnixNano())
+	_, err = postgres.Role(log, db, developer, nil, []postgres.DatabaseSchema{{
+		Name:       name,
+		Schema:     name,
+		Privileges: postgres.PrivilegeRead,
+	}})
+	if err != nil {
+		t.Fatalf("Role failed: %v", err)
+	}
+	assert.Equal(t, []string{name + "_read"}, storedRoles(t, db, developer), "roles not as expected")
+}
+
 func TestDatabase_switchFromLoginToNoLoginAndBack(t *testing.T) {
 	postgresqlHost := test.Integration(t)
 	log := test.SetLogger(t)
@@ -605,7 +726,7 @@ func TestDatabase_existingResourcePrivilegesForReadWriteRoles(t *testing.T) {
 	}
 
 	log.Info("TC: Run controller user creation")
-	err = postgres.Role(log, db, developerName, nil, []postgres.DatabaseSchema{{
+	_, err = postgres.Role(log, db, developerName, nil, []postgres.DatabaseSchema{{
 		Name:       name,
 		Schema:     name,
 		Privileges: postgres.PrivilegeRead,
@@ -632,6 +753,259 @@ func TestDatabase_existingResourcePrivilegesForReadWriteRoles(t *testing.T) {
 	dbExec(t, developerDB, fmt.Sprintf(`SELECT * FROM %[1]s.%[1]s`, name))
 }
 
+// TestDatabase_sequenceFunctionAndTypePrivileges tests that the readwrite role
+// can use the sequences, functions and types of the service role, both those
+// existing before the database is reconciled and those created afterwards.
+func TestDatabase_sequenceFunctionAndTypePrivileges(t *testing.T) {
+	postgresqlHost := test.Integration(t)
+	log := test.SetLogger(t)
+	managerRole := "postgres_role_name"
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	if err != nil {
+		t.Fatalf("connect to database failed: %v", err)
+	}
+	defer db.Close()
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	developerName := fmt.Sprintf("%s_developer", name)
+	password := "test"
+	adminCredentials := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	serviceCredentials := postgres.Credentials{
+		Name:     name,
+		User:     name,
+		Password: password,
+	}
+
+	log.Info("TC: Run controller database creation")
+	err = postgres.Database(log, postgresqlHost, adminCredentials, serviceCredentials, managerRole, nil)
+	if err != nil {
+		t.Fatalf("Create service database failed: %v", err)
+	}
+
+	log.Info("TC: Connect as service user")
+	serviceDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: name,
+		User:     name,
+		Password: password,
+	})
+	if err != nil {
+		t.Fatalf("Connect as service user failed: %v", err)
+	}
+	defer serviceDB.Close()
+	// the default privileges are revoked to create objects like databases
+	// reconciled by earlier versions that only covered tables. PUBLIC may use
+	// functions and types by default so that is revoked as well.
+	log.Info("TC: Create existing sequences, functions and types")
+	dbExec(t, serviceDB, fmt.Sprintf(`
+	ALTER DEFAULT PRIVILEGES IN SCHEMA %[1]s REVOKE ALL ON SEQUENCES FROM %[1]s_readwrite;
+	ALTER DEFAULT PRIVILEGES IN SCHEMA %[1]s REVOKE ALL ON FUNCTIONS FROM %[1]s_readwrite;
+	ALTER DEFAULT PRIVILEGES IN SCHEMA %[1]s REVOKE ALL ON TYPES FROM %[1]s_readwrite;
+	CREATE TYPE %[1]s.mood_existing AS ENUM ('happy', 'sad');
+	REVOKE ALL ON TYPE %[1]s.mood_existing FROM PUBLIC;
+	CREATE TABLE %[1]s.orders_existing (id serial PRIMARY KEY, mood %[1]s.mood_existing);
+	CREATE FUNCTION %[1]s.answer_existing() RETURNS integer AS 'SELECT 42' LANGUAGE SQL;
+	REVOKE ALL ON FUNCTION %[1]s.answer_existing() FROM PUBLIC;
+	`, name))
+
+	log.Info("TC: Run controller database reconcile")
+	err = postgres.Database(log, postgresqlHost, adminCredentials, serviceCredentials, managerRole, nil)
+	if err != nil {
+		t.Fatalf("Reconcile service database failed: %v", err)
+	}
+
+	log.Info("TC: Create new sequences, functions and types")
+	dbExec(t, serviceDB, fmt.Sprintf(`
+	CREATE TYPE %[1]s.mood AS ENUM ('happy', 'sad');
+	REVOKE ALL ON TYPE %[1]s.mood FROM PUBLIC;
+	CREATE TABLE %[1]s.orders (id serial PRIMARY KEY, mood %[1]s.mood);
+	CREATE FUNCTION %[1]s.answer() RETURNS integer AS 'SELECT 42' LANGUAGE SQL;
+	REVOKE ALL ON FUNCTION %[1]s.answer() FROM PUBLIC;
+	`, name))
+
+	log.Info("TC: Run controller user creation")
+	_, err = postgres.Role(log, db, developerName, nil, []postgres.DatabaseSchema{{
+		Name:       name,
+		Schema:     name,
+		Privileges: postgres.PrivilegeWrite,
+	}})
+	if err != nil {
+		t.Fatalf("Create new developer role failed: %v", err)
+	}
+
+	log.Info("TC: Connect as developer")
+	developerDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: name,
+		User:     developerName,
+		Password: password,
+	})
+	if err != nil {
+		t.Fatalf("Connect as developer user failed: %v", err)
+	}
+	defer developerDB.Close()
+
+	log.Info("TC: Insert into serial tables and call functions")
+	dbExec(t, developerDB, fmt.Sprintf(`
+	INSERT INTO %[1]s.orders (mood) VALUES ('happy'::%[1]s.mood);
+	INSERT INTO %[1]s.orders_existing (mood) VALUES ('sad'::%[1]s.mood_existing);
+	SELECT %[1]s.answer(), %[1]s.answer_existing();
+	`, name))
+}
+
+// TestDatabase_additionalSchemas tests that additional schemas get their own
+// roles and that access to one schema does not cover the others.
+func TestDatabase_additionalSchemas(t *testing.T) {
+	postgresqlHost := test.Integration(t)
+	log := test.SetLogger(t)
+	managerRole := "postgres_role_name"
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	if err != nil {
+		t.Fatalf("connect to database failed: %v", err)
+	}
+	defer db.Close()
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	billing := name + "_billing"
+	audit := name + "_audit"
+	developerName := fmt.Sprintf("%s_developer", name)
+	password := "test"
+	adminCredentials := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	serviceCredentials := postgres.Credentials{
+		Name:     name,
+		User:     name,
+		Password: password,
+	}
+
+	log.Info("TC: Run controller database creation")
+	err = postgres.Database(log, postgresqlHost, adminCredentials, serviceCredentials, managerRole, nil, billing, audit, billing, name)
+	if err != nil {
+		t.Fatalf("Create service database failed: %v", err)
+	}
+	for _, schema := range []string{billing, audit} {
+		for _, suffix := range []string{"read", "readwrite", "readowningwrite"} {
+			assert.True(t, roleExists(t, db, schema+"_"+suffix), "role %s_%s should exist", schema, suffix)
+		}
+	}
+
+	log.Info("TC: Create tables as service user")
+	serviceDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: name,
+		User:     name,
+		Password: password,
+	})
+	if err != nil {
+		t.Fatalf("Connect as service user failed: %v", err)
+	}
+	defer serviceDB.Close()
+	dbExec(t, serviceDB, fmt.Sprintf(`
+	CREATE TABLE %[1]s.invoices (id serial PRIMARY KEY);
+	CREATE TABLE %[2]s.events (id serial PRIMARY KEY);
+	`, billing, audit))
+
+	log.Info("TC: Run controller database reconcile")
+	err = postgres.Database(log, postgresqlHost, adminCredentials, serviceCredentials, managerRole, nil, billing, audit)
+	if err != nil {
+		t.Fatalf("Reconcile service database failed: %v", err)
+	}
+
+	log.Info("TC: Run controller user creation")
+	_, err = postgres.Role(log, db, developerName, nil, []postgres.DatabaseSchema{{
+		Name:       name,
+		Schema:     billing,
+		Privileges: postgres.PrivilegeWrite,
+	}})
+	if err != nil {
+		t.Fatalf("Create new developer role failed: %v", err)
+	}
+
+	log.Info("TC: Connect as developer")
+	developerDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: name,
+		User:     developerName,
+		Password: password,
+	})
+	if err != nil {
+		t.Fatalf("Connect as developer user failed: %v", err)
+	}
+	defer developerDB.Close()
+
+	dbExec(t, developerDB, fmt.Sprintf("INSERT INTO %s.invoices DEFAULT VALUES", billing))
+	_, err = developerDB.Exec(fmt.Sprintf("SELECT * FROM %s.events", audit))
+	assert.Error(t, err, "developer should not be able to read other schemas")
+
+	log.Info("TC: Drop database")
+	require.NoError(t, postgres.DropDatabase(log, postgresqlHost, adminCredentials, serviceCredentials, billing, audit))
+	for _, schema := range []string{billing, audit} {
+		for _, suffix := range []string{"read", "readwrite", "readowningwrite"} {
+			assert.False(t, roleExists(t, db, schema+"_"+suffix), "role %s_%s should be dropped", schema, suffix)
+		}
+	}
+}
+
+// TestDatabase_additionalSchemasOfOtherDatabases tests that a schema cannot
+// take over the roles of another database.
+func TestDatabase_additionalSchemasOfOtherDatabases(t *testing.T) {
+	postgresqlHost := test.Integration(t)
+	log := test.SetLogger(t)
+	managerRole := "postgres_role_name"
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	adminCredentials := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	prefix := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	audit := prefix + "_audit"
+	owner := postgres.Credentials{Name: prefix + "_owner", User: prefix + "_owner", Password: "test"}
+	other := postgres.Credentials{Name: prefix + "_other", User: prefix + "_other", Password: "test"}
+
+	require.NoError(t, postgres.Database(log, postgresqlHost, adminCredentials, owner, managerRole, nil, audit))
+
+	err = postgres.Database(log, postgresqlHost, adminCredentials, other, managerRole, nil, audit)
+	assert.True(t, ctlerrors.IsInvalid(err), "schema of another database should be invalid: %v", err)
+
+	err = postgres.Database(log, postgresqlHost, adminCredentials, other, managerRole, nil, owner.User)
+	assert.True(t, ctlerrors.IsInvalid(err), "schema named after the service user of another database should be invalid: %v", err)
+	memberships := dbQuery(t, db, `
+		SELECT r.rolname
+		FROM pg_auth_members m
+		JOIN pg_roles r ON r.oid = m.roleid
+		JOIN pg_roles u ON u.oid = m.member
+		WHERE u.rolname = '%s'`, owner.User+"_readowningwrite")
+	assert.Equal(t, []string{owner.User}, memberships, "service role of the other database should not be granted")
+
+	require.NoError(t, postgres.DropDatabase(log, postgresqlHost, adminCredentials, other, audit))
+	for _, suffix := range []string{"read", "readwrite", "readowningwrite"} {
+		assert.True(t, roleExists(t, db, audit+"_"+suffix), "role %s_%s of another database should be kept", audit, suffix)
+	}
+}
+
 // TestDatabase_defaultDatabaseName tests that we can handle database resources
 // referencing the default name of the database instance.
 func TestDatabase_defaultDatabaseName(t *testing.T) {
@@ -801,7 +1175,7 @@ func TestDatabase_mixedOwnershipOnSharedDatabase(t *testing.T) {
 	assert.Equal(t, []string{"value-from-new-user", "value-from-shared-user"}, nonOwned, "nonowned rows not as expected")
 
 	// request access to the new user schema of the shared database
-	err = postgres.Role(log, db, developer, nil, []postgres.DatabaseSchema{
+	_, err = postgres.Role(log, db, developer, nil, []postgres.DatabaseSchema{
 		{
 			Name:       sharedDatabaseName,
 			Privileges: postgres.PrivilegeRead,
@@ -883,6 +1257,138 @@ func TestDatabase_idempotency(t *testing.T) {
 	}
 }
 
+func TestCreateDatabase_options(t *testing.T) {
+	postgresqlHost := test.Integration(t)
+	log := test.SetLogger(t)
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	connectionLimit := 5
+	options := postgres.DatabaseOptions{
+		Encoding:        "LATIN1",
+		LCCollate:       "C",
+		LCCtype:         "C",
+		Template:        "template0",
+		ConnectionLimit: &connectionLimit,
+	}
+	require.NoError(t, postgres.CreateDatabase(log, postgresqlHost, admin, name, options))
+	assert.Equal(t, []string{"LATIN1 C C 5"}, dbQuery(t, db, "SELECT pg_encoding_to_char(encoding) || ' ' || datcollate || ' ' || datctype || ' ' || datconnlimit FROM pg_database WHERE datname = '%s'", name))
+
+	// aliases of the encoding are the same encoding
+	connectionLimit = -1
+	options.Encoding = "iso-8859-1"
+	require.NoError(t, postgres.CreateDatabase(log, postgresqlHost, admin, name, options), "connection limit should be changed")
+	assert.Equal(t, []string{"-1"}, dbQuery(t, db, "SELECT datconnlimit::text FROM pg_database WHERE datname = '%s'", name))
+
+	options.Encoding = "UTF8"
+	err = postgres.CreateDatabase(log, postgresqlHost, admin, name, options)
+	assert.ErrorIs(t, err, postgres.ErrDatabaseOptionChanged, "encoding should not be changed")
+}
+
+func TestDropDatabase_sharedIsRefused(t *testing.T) {
+	log := test.SetLogger(t)
+	err := postgres.DropDatabase(log, "localhost:5432", postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}, postgres.Credentials{
+		Name:   "shared",
+		User:   "user",
+		Shared: true,
+	})
+	assert.EqualError(t, err, "refusing to drop shared database shared")
+}
+
+func TestDropDatabase(t *testing.T) {
+	postgresqlHost := test.Integration(t)
+	log := test.SetLogger(t)
+	managerRole := "postgres_role_name"
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, createManagerRole(log, db, managerRole))
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	service := postgres.Credentials{
+		Name:     name,
+		User:     name,
+		Password: "test",
+	}
+	require.NoError(t, postgres.Database(log, postgresqlHost, admin, service, managerRole, nil))
+
+	// keep a connection open as the service user to ensure it is terminated
+	serviceDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: name,
+		User:     name,
+		Password: "test",
+	})
+	require.NoError(t, err)
+	defer serviceDB.Close()
+	require.NoError(t, serviceDB.Ping())
+
+	require.NoError(t, postgres.DropDatabase(log, postgresqlHost, admin, service))
+
+	assert.Equal(t, []string(nil), dbQuery(t, db, "SELECT datname FROM pg_database WHERE datname = '%s'", name), "database should be dropped")
+	for _, role := range []string{name, name + "_read", name + "_readwrite", name + "_readowningwrite"} {
+		assert.False(t, roleExists(t, db, role), "role %s should be dropped", role)
+	}
+	require.NoError(t, postgres.DropDatabase(log, postgresqlHost, admin, service), "dropping an unknown database should be a noop")
+}
+
+func TestRevokeDatabaseLogin(t *testing.T) {
+	postgresqlHost := test.Integration(t)
+	log := test.SetLogger(t)
+	managerRole := "postgres_role_name"
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     postgresqlHost,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, createManagerRole(log, db, managerRole))
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	service := postgres.Credentials{
+		Name:     name,
+		User:     name,
+		Password: "test",
+	}
+	require.NoError(t, postgres.Database(log, postgresqlHost, admin, service, managerRole, nil))
+	assert.True(t, roleCanLogin(t, db, name))
+
+	require.NoError(t, postgres.RevokeDatabaseLogin(log, postgresqlHost, admin, service))
+
+	assert.False(t, roleCanLogin(t, db, name))
+	assert.Equal(t, []string{name}, dbQuery(t, db, "SELECT datname FROM pg_database WHERE datname = '%s'", name), "database should be retained")
+	assert.True(t, roleExists(t, db, name+"_read"), "read role should be retained")
+}
+
 func hasPassword(t *testing.T, log logr.Logger, host, username string) bool {
 	db, err := postgres.Connect(postgres.ConnectionString{
 		Host:     host,
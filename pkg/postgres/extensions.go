@@ -3,16 +3,23 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
-	"k8s.io/utils/strings/slices"
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
 )
 
 type Extensions = []Extension
 
+// ErrExtensionNotDropped is returned by Database if an extension marked to be
+// dropped could not be dropped, eg. because of dependent objects. All other
+// changes of the database are applied regardless.
+var ErrExtensionNotDropped = errors.New("extension not dropped")
+
 func ensureExtensions(ctx context.Context, conn *sql.DB, serviceCredentials, adminCredentials Credentials, extensions Extensions) error {
 	if extensionsIsEmpty(extensions) {
-		// Nothing to reconcile, extensions are not removed if removed from the extensions page
+		// Nothing to reconcile, extensions are only removed if they are marked to be dropped
 		return nil
 	}
 
@@ -21,26 +28,37 @@ func ensureExtensions(ctx context.Context, conn *sql.DB, serviceCredentials, adm
 		return fmt.Errorf("failed to get installed extensions: %w", err)
 	}
 
-	extensionsToInstall, needsReconciliation := extensionsToInstall(extensions, alreadyAvailableExtensions)
-	if !needsReconciliation {
+	changes := extensionChanges(serviceCredentials.Name, extensions, alreadyAvailableExtensions)
+	if len(changes) == 0 {
 		// No work needs to be done, returning
 		return nil
 	}
 
-	if err := installExtensions(ctx, conn, adminCredentials, serviceCredentials, extensionsToInstall); err != nil {
-		return fmt.Errorf("failed to install extensions: %w", err)
+	if err := applyExtensionChanges(ctx, conn, adminCredentials, serviceCredentials, changes); err != nil {
+		return fmt.Errorf("failed to change extensions: %w", err)
 	}
 
 	return nil
 }
 
+// InstalledExtensions returns the extensions installed in database on host
+// with their versions and schemas.
+func InstalledExtensions(log logr.Logger, host string, adminCredentials Credentials, database string) (Extensions, error) {
+	db, closeDB, err := connectAdminTo(log, host, adminCredentials, database)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDB()
+	return getInstalledExtensions(context.Background(), db, adminCredentials)
+}
+
 // getInstalledExtensions finds the already enabled extensions in the database
 func getInstalledExtensions(ctx context.Context, conn *sql.DB, credentials Credentials) (Extensions, error) {
 	// https://www.postgresql.org/docs/current/catalog-pg-extension.html
 	rows, err := conn.QueryContext(
 		ctx,
 		prependSetRole(
-			`SELECT extname FROM pg_extension`,
+			`SELECT e.extname, e.extversion, n.nspname FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace ORDER BY e.extname`,
 			credentials.User,
 		),
 	)
@@ -51,13 +69,13 @@ func getInstalledExtensions(ctx context.Context, conn *sql.DB, credentials Crede
 
 	extensions := make(Extensions, 0)
 	for rows.Next() {
-		var extname string
-		err = rows.Scan(&extname)
+		var extension Extension
+		err = rows.Scan(&extension.Name, &extension.Version, &extension.Schema)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read row: %w", err)
 		}
 
-		extensions = append(extensions, NewExtension(extname))
+		extensions = append(extensions, extension)
 	}
 
 	err = rows.Err()
@@ -69,34 +87,73 @@ func getInstalledExtensions(ctx context.Context, conn *sql.DB, credentials Crede
 
 }
 
-// extensionsToInstall diffs the existing extensions with the desired list and finds the extensions that needs to be installed
-func extensionsToInstall(extensions, alreadyAvailableExtensions Extensions) (Extensions, bool) {
-	alreadyAvailable := make([]string, 0, len(alreadyAvailableExtensions))
+// extensionChange is a statement changing the extension named name. drop marks
+// statements dropping the extension.
+type extensionChange struct {
+	name  string
+	query string
+	drop  bool
+}
+
+// extensionChanges diffs the existing extensions with the desired list and
+// finds the statements that install, update, move and drop extensions.
+// Extensions are installed in a schema named after database unless another
+// schema is requested.
+func extensionChanges(database string, extensions, alreadyAvailableExtensions Extensions) []extensionChange {
+	alreadyAvailable := make(map[string]Extension, len(alreadyAvailableExtensions))
 	for _, e := range alreadyAvailableExtensions {
-		alreadyAvailable = append(alreadyAvailable, e.Name)
+		alreadyAvailable[e.Name] = e
 	}
 
-	toInstall := make(Extensions, 0)
+	var changes []extensionChange
 	for _, e := range extensions {
-		if !slices.Contains(alreadyAvailable, e.Name) {
-			toInstall = append(toInstall, e)
+		installed, ok := alreadyAvailable[e.Name]
+		switch {
+		case e.Drop:
+			if ok {
+				changes = append(changes, extensionChange{e.Name, formatStatement("DROP EXTENSION IF EXISTS %s", identifier(e.Name)), true})
+			}
+		case !ok:
+			schema := e.Schema
+			if schema == "" {
+				schema = database
+			}
+			query := formatStatement("CREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s", identifier(e.Name), identifier(schema))
+			if e.Version != "" {
+				query += formatStatement(" VERSION %s", literal(e.Version))
+			}
+			changes = append(changes, extensionChange{e.Name, query, false})
+		default:
+			if e.Schema != "" && e.Schema != installed.Schema {
+				changes = append(changes, extensionChange{e.Name, formatStatement("ALTER EXTENSION %s SET SCHEMA %s", identifier(e.Name), identifier(e.Schema)), false})
+			}
+			if e.Version != "" && e.Version != installed.Version {
+				changes = append(changes, extensionChange{e.Name, formatStatement("ALTER EXTENSION %s UPDATE TO %s", identifier(e.Name), literal(e.Version)), false})
+			}
 		}
 	}
 
-	return toInstall, !extensionsIsEmpty(toInstall)
+	return changes
 }
 
-// installExtensions actually enable extensions on the database
-func installExtensions(ctx context.Context, conn *sql.DB, adminCredentials, serviceCredentials Credentials, extensionsToInstall []Extension) error {
-	for _, e := range extensionsToInstall {
-		_, err := conn.ExecContext(
-			ctx,
-			fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s", e.Name, serviceCredentials.Name),
-		)
+// applyExtensionChanges actually changes the extensions of the database.
+// Failing drops do not stop the remaining changes and are returned as
+// ErrExtensionNotDropped once they are applied.
+func applyExtensionChanges(ctx context.Context, conn *sql.DB, adminCredentials, serviceCredentials Credentials, changes []extensionChange) error {
+	var dropErrs error
+	for _, change := range changes {
+		_, err := conn.ExecContext(ctx, change.query)
+		if err != nil && change.drop {
+			dropErrs = multierr.Append(dropErrs, fmt.Errorf("extension %s: %w", change.name, err))
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("failed to install: user: %s, db: %s, extension %s: %w", adminCredentials.User, serviceCredentials.Name, e.Name, err)
+			return fmt.Errorf("failed to change: user: %s, db: %s, extension %s: %w", adminCredentials.User, serviceCredentials.Name, change.name, err)
 		}
 	}
+	if dropErrs != nil {
+		return fmt.Errorf("%w: db: %s: %w", ErrExtensionNotDropped, serviceCredentials.Name, dropErrs)
+	}
 
 	return nil
 }
@@ -109,6 +166,17 @@ func extensionsIsEmpty(extensions Extensions) bool {
 // Extension is a reference to a postgresql extension
 type Extension struct {
 	Name string
+	// Version is the version the extension is installed or updated to. The
+	// default version is installed and the installed version is left
+	// unchanged if it is empty.
+	Version string
+	// Schema is the schema the extension is installed in or moved to. New
+	// extensions are installed in a schema named after the database and the
+	// installed schema is left unchanged if it is empty.
+	Schema string
+	// Drop marks an extension that is dropped if it is installed. Extensions
+	// with dependent objects are not dropped.
+	Drop bool
 }
 
 func NewExtension(name string) Extension {
@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/go-logr/logr"
-	"github.com/lib/pq"
 )
 
 // EnsureManagerRole creates the management role on db if it does not
@@ -18,6 +17,6 @@ func EnsureManagerRole(log logr.Logger, db *sql.DB, role string) error {
 	return tryExec(log, db, tryExecReq{
 		objectType: "management role",
 		errorCode:  "duplicate_object",
-		query:      fmt.Sprintf("CREATE ROLE %s", pq.QuoteIdentifier(role)),
+		query:      formatStatement("CREATE ROLE %s", identifier(role)),
 	})
 }
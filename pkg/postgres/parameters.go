@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
+)
+
+// Parameters are runtime parameters by name, eg. statement_timeout=30s.
+type Parameters map[string]string
+
+// DatabaseParameters are the runtime parameters of a database and of its
+// service user in the database.
+type DatabaseParameters struct {
+	// Database is set with ALTER DATABASE ... SET and applies to all roles
+	// connecting to the database.
+	Database Parameters
+	// User is set with ALTER ROLE ... IN DATABASE ... SET for the service
+	// user and takes precedence over Database.
+	User Parameters
+}
+
+// SetDatabaseParameters ensures that the settings of the database created by
+// Database and of its service user in the database are exactly parameters.
+// Settings not in parameters are reset.
+func SetDatabaseParameters(log logr.Logger, host string, adminCredentials, serviceCredentials Credentials, parameters DatabaseParameters) error {
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+	err := serviceCredentials.Validate()
+	if err != nil {
+		return fmt.Errorf("serviceCredentials not valid: %w", err)
+	}
+	log = log.WithValues("database", serviceCredentials.Name, "user", serviceCredentials.User)
+
+	db, closeDB, err := connectAdmin(log, host, adminCredentials)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	existing, err := settings(db, serviceCredentials.Name, "")
+	if err != nil {
+		return fmt.Errorf("read settings of database %s: %w", serviceCredentials.Name, err)
+	}
+	err = applySettings(log, existing[serviceCredentials.Name], parameters.Database, func(action string, args ...sqlArg) error {
+		return execf(db, "ALTER DATABASE %s "+action, append([]sqlArg{identifier(serviceCredentials.Name)}, args...)...)
+	})
+	if err != nil {
+		return fmt.Errorf("set parameters of database %s: %w", serviceCredentials.Name, err)
+	}
+
+	existing, err = settings(db, serviceCredentials.Name, serviceCredentials.User)
+	if err != nil {
+		return fmt.Errorf("read settings of service user %s: %w", serviceCredentials.User, err)
+	}
+	err = applySettings(log, existing[serviceCredentials.Name], parameters.User, func(action string, args ...sqlArg) error {
+		return execf(db, "ALTER ROLE %s IN DATABASE %s "+action, append([]sqlArg{identifier(serviceCredentials.User), identifier(serviceCredentials.Name)}, args...)...)
+	})
+	if err != nil {
+		return fmt.Errorf("set parameters of service user %s: %w", serviceCredentials.User, err)
+	}
+	return nil
+}
+
+// SetRoleParameters ensures that the settings of the login role name in each
+// database it has access to are read for databases with read access only and
+// write for databases with write access. Settings of the role in other
+// databases and settings not in the parameters are reset. Settings of the role
+// that apply to all databases are left untouched.
+func SetRoleParameters(log logr.Logger, db *sql.DB, name string, databases []DatabaseSchema, read, write Parameters) error {
+	log = log.WithValues("role", name)
+	desired := make(map[string]Parameters)
+	for _, database := range databases {
+		switch database.Privileges {
+		case PrivilegeRead:
+			if _, ok := desired[database.Name]; !ok {
+				desired[database.Name] = read
+			}
+		case PrivilegeWrite, PrivilegeOwningWrite:
+			desired[database.Name] = write
+		}
+	}
+	existing, err := settings(db, "", name)
+	if err != nil {
+		return fmt.Errorf("read settings of role %s: %w", name, err)
+	}
+	var errs error
+	for _, database := range settingsDatabases(existing, desired) {
+		err := applySettings(log.WithValues("database", database), existing[database], desired[database], func(action string, args ...sqlArg) error {
+			// access to a database that does not exist is reported when the
+			// roles are granted
+			return tryExec(log, db, tryExecReq{
+				objectType: "role parameter",
+				errorCode:  "invalid_catalog_name",
+				query:      formatStatement("ALTER ROLE %s IN DATABASE %s "+action, append([]sqlArg{identifier(name), identifier(database)}, args...)...),
+			})
+		})
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("set parameters in database %s: %w", database, err))
+		}
+	}
+	return errs
+}
+
+// settingsDatabases returns the sorted names of the databases in existing and
+// desired.
+func settingsDatabases(existing, desired map[string]Parameters) []string {
+	var databases []string
+	for database := range existing {
+		databases = append(databases, database)
+	}
+	for database := range desired {
+		if _, ok := existing[database]; !ok {
+			databases = append(databases, database)
+		}
+	}
+	sort.Strings(databases)
+	return databases
+}
+
+// applySettings sets the parameters in desired that differ from existing and
+// resets the ones not in desired with alter. alter is called with the SET or
+// RESET clause of the statement and its arguments.
+func applySettings(log logr.Logger, existing, desired Parameters, alter func(action string, args ...sqlArg) error) error {
+	set, reset := diffSettings(existing, desired)
+	for _, name := range set {
+		log.Info("Setting parameter", "parameter", name, "value", desired[name])
+		err := alter("SET %s = %s", identifier(name), literal(desired[name]))
+		if err != nil {
+			return fmt.Errorf("set %s: %w", name, err)
+		}
+	}
+	for _, name := range reset {
+		log.Info("Resetting parameter", "parameter", name)
+		err := alter("RESET %s", identifier(name))
+		if err != nil {
+			return fmt.Errorf("reset %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// diffSettings returns the sorted names of the parameters to set and reset
+// for existing to become desired.
+func diffSettings(existing, desired Parameters) (set []string, reset []string) {
+	for name, value := range desired {
+		current, ok := existing[name]
+		if !ok || current != value {
+			set = append(set, name)
+		}
+	}
+	for name := range existing {
+		if _, ok := desired[name]; !ok {
+			reset = append(reset, name)
+		}
+	}
+	sort.Strings(set)
+	sort.Strings(reset)
+	return set, reset
+}
+
+// settings returns the settings stored in pg_db_role_setting by database name.
+// An empty database matches settings of role in any database and an empty
+// role matches settings of the database itself. Settings of a role that apply
+// to all databases are not returned.
+func settings(db *sql.DB, database, role string) (map[string]Parameters, error) {
+	rows, err := db.Query(`
+		SELECT d.datname, unnest(s.setconfig)
+		FROM pg_db_role_setting s
+		JOIN pg_database d ON d.oid = s.setdatabase
+		LEFT JOIN pg_roles r ON r.oid = s.setrole
+		WHERE ($1::text = '' OR d.datname = $1::text)
+		AND (($2::text = '' AND s.setrole = 0) OR r.rolname = $2::text)`, database, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	settings := make(map[string]Parameters)
+	for rows.Next() {
+		var database, setting string
+		err := rows.Scan(&database, &setting)
+		if err != nil {
+			return nil, err
+		}
+		name, value, _ := strings.Cut(setting, "=")
+		if settings[database] == nil {
+			settings[database] = make(Parameters)
+		}
+		settings[database][name] = value
+	}
+	return settings, rows.Err()
+}
@@ -0,0 +1,117 @@
+package postgres_test
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+	"go.lunarway.com/postgresql-controller/test"
+)
+
+// roleSettings returns the sorted settings of role in database. An empty role
+// returns the settings of the database itself.
+func roleSettings(t *testing.T, db *sql.DB, database, role string) []string {
+	t.Helper()
+	settings := dbQuery(t, db, `
+		SELECT unnest(s.setconfig)
+		FROM pg_db_role_setting s
+		JOIN pg_database d ON d.oid = s.setdatabase
+		LEFT JOIN pg_roles r ON r.oid = s.setrole
+		WHERE d.datname = '%s' AND COALESCE(r.rolname, '') = '%s'`, database, role)
+	sort.Strings(settings)
+	return settings
+}
+
+func TestSetDatabaseParameters(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+	managerRole := "postgres_role_name"
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     admin.User,
+		Password: admin.Password,
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	service := postgres.Credentials{
+		Name:     name,
+		User:     name,
+		Password: "test",
+	}
+	require.NoError(t, postgres.Database(log, host, admin, service, managerRole, nil))
+
+	err = postgres.SetDatabaseParameters(log, host, admin, service, postgres.DatabaseParameters{
+		Database: postgres.Parameters{"statement_timeout": "30s", "work_mem": "8MB"},
+		User:     postgres.Parameters{"idle_in_transaction_session_timeout": "1min"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"statement_timeout=30s", "work_mem=8MB"}, roleSettings(t, db, name, ""), "database settings")
+	assert.Equal(t, []string{"idle_in_transaction_session_timeout=1min"}, roleSettings(t, db, name, name), "service user settings")
+
+	// removed parameters are reset
+	err = postgres.SetDatabaseParameters(log, host, admin, service, postgres.DatabaseParameters{
+		Database: postgres.Parameters{"statement_timeout": "1min"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"statement_timeout=1min"}, roleSettings(t, db, name, ""), "database settings after removal")
+	assert.Empty(t, roleSettings(t, db, name, name), "service user settings after removal")
+}
+
+func TestSetRoleParameters(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+	managerRole := "postgres_role_name"
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     admin.User,
+		Password: admin.Password,
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	prefix := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	reads, writes := prefix+"_reads", prefix+"_writes"
+	for _, name := range []string{reads, writes} {
+		require.NoError(t, postgres.Database(log, host, admin, postgres.Credentials{
+			Name:     name,
+			User:     name,
+			Password: "test",
+		}, managerRole, nil))
+	}
+	developer := prefix + "_developer"
+	_, err = postgres.Role(log, db, developer, nil, nil)
+	require.NoError(t, err)
+
+	read := postgres.Parameters{"default_transaction_read_only": "on"}
+	write := postgres.Parameters{"idle_in_transaction_session_timeout": "1min", "log_statement": "all"}
+	databases := []postgres.DatabaseSchema{
+		{Name: reads, Schema: reads, Privileges: postgres.PrivilegeRead},
+		{Name: writes, Schema: writes, Privileges: postgres.PrivilegeRead},
+		{Name: writes, Schema: writes, Privileges: postgres.PrivilegeWrite},
+	}
+	require.NoError(t, postgres.SetRoleParameters(log, db, developer, databases, read, write))
+	assert.Equal(t, []string{"default_transaction_read_only=on"}, roleSettings(t, db, reads, developer), "settings with read access")
+	assert.Equal(t, []string{"idle_in_transaction_session_timeout=1min", "log_statement=all"}, roleSettings(t, db, writes, developer), "settings with write access")
+
+	// settings of databases without access are reset
+	require.NoError(t, postgres.SetRoleParameters(log, db, developer, databases[:1], read, write))
+	assert.Equal(t, []string{"default_transaction_read_only=on"}, roleSettings(t, db, reads, developer), "settings with read access")
+	assert.Empty(t, roleSettings(t, db, writes, developer), "settings without access")
+}
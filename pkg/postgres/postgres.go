@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"net/url"
@@ -50,10 +51,11 @@ func (c ConnectionString) String() string {
 }
 
 func Connect(connectionString ConnectionString) (*sql.DB, error) {
-	db, err := sql.Open("postgres", connectionString.Raw())
+	connector, err := pq.NewConnector(connectionString.Raw())
 	if err != nil {
 		return nil, err
 	}
+	db := sql.OpenDB(hostConnector{Connector: connector, host: connectionString.Host})
 	db.SetMaxIdleConns(0)
 	err = db.Ping()
 	if err != nil {
@@ -62,6 +64,31 @@ func Connect(connectionString ConnectionString) (*sql.DB, error) {
 	return db, nil
 }
 
+// hostConnector is a pq connector that remembers the host it connects to. It
+// allows metrics of statements executed on a *sql.DB to be labelled by host.
+type hostConnector struct {
+	*pq.Connector
+	host string
+}
+
+func (c hostConnector) Driver() driver.Driver {
+	return hostDriver{Driver: c.Connector.Driver(), host: c.host}
+}
+
+type hostDriver struct {
+	driver.Driver
+	host string
+}
+
+// hostOf returns the host db is connected to or "unknown" if db was not
+// opened with Connect.
+func hostOf(db *sql.DB) string {
+	if d, ok := db.Driver().(hostDriver); ok {
+		return d.host
+	}
+	return "unknown"
+}
+
 type Privilege int
 
 const (
@@ -95,14 +122,17 @@ func (p Privilege) String() string {
 	}
 }
 
-func Role(log logr.Logger, db *sql.DB, name string, roles []string, databases []DatabaseSchema) error {
+// Role ensures that the login role name exists and is a member of exactly
+// roles and the access roles of databases. Memberships of other access roles
+// are revoked. It returns the revoked roles.
+func Role(log logr.Logger, db *sql.DB, name string, roles []string, databases []DatabaseSchema) ([]string, error) {
 	log.V(1).Info(fmt.Sprintf("Creating role %s", name))
-	query := fmt.Sprintf("CREATE ROLE %s WITH LOGIN", name)
+	query := formatStatement("CREATE ROLE %s WITH LOGIN", identifier(name))
 	_, err := db.Exec(query)
 	if err != nil {
 		pqError, ok := err.(*pq.Error)
 		if !ok || pqError.Code.Name() != "duplicate_object" {
-			return fmt.Errorf("create role %s: %w", name, err)
+			return nil, fmt.Errorf("create role %s: %w", name, err)
 		}
 		log.V(1).Info(fmt.Sprintf("Role %s already exists", name), "errorCode", pqError.Code, "errorName", pqError.Code.Name())
 	} else {
@@ -112,25 +142,37 @@ func Role(log logr.Logger, db *sql.DB, name string, roles []string, databases []
 	// grant database access roles to created role
 	existingRoles, err := persistedRoles(db, name)
 	if err != nil {
-		return fmt.Errorf("get existing roles: %w", err)
+		return nil, fmt.Errorf("get existing roles: %w", err)
 	}
 	grantableRoles, revokeableRoles := rolesDiff(log, existingRoles, roles, databases)
 	log.V(1).Info(fmt.Sprintf("Found %d grantable and %d revokable roles for %s", len(grantableRoles), len(revokeableRoles), name), "grantable", grantableRoles, "revokeable", revokeableRoles)
 	if len(grantableRoles) != 0 {
 		joinedRoles := strings.Join(grantableRoles, ",")
-		_, err = db.Exec(fmt.Sprintf("GRANT %s TO %s", joinedRoles, name))
+		err = execf(db, "GRANT %s TO %s", identifiers(grantableRoles), identifier(name))
 		if err != nil {
-			return fmt.Errorf("grant access privileges '%s' to '%s': %w", joinedRoles, name, err)
+			return nil, fmt.Errorf("grant access privileges '%s' to '%s': %w", joinedRoles, name, err)
 		}
 	}
 	if len(revokeableRoles) != 0 {
 		joinedRoles := strings.Join(revokeableRoles, ",")
-		_, err = db.Exec(fmt.Sprintf("REVOKE %s FROM %s", joinedRoles, name))
+		err = execf(db, "REVOKE %s FROM %s", identifiers(revokeableRoles), identifier(name))
 		if err != nil {
-			return fmt.Errorf("revoke access privileges '%s' to '%s': %w", joinedRoles, name, err)
+			return nil, fmt.Errorf("revoke access privileges '%s' to '%s': %w", joinedRoles, name, err)
 		}
 	}
-	return nil
+	return revokeableRoles, nil
+}
+
+// IsWriteRole reports whether role is a readwrite or readowningwrite access
+// role of a database.
+func IsWriteRole(role string) bool {
+	return strings.HasSuffix(role, "_"+roleSuffixWrite) || strings.HasSuffix(role, "_"+roleSuffixOwningWrite)
+}
+
+// TerminateSessions terminates all open sessions of role on the host of db. It
+// returns the number of terminated sessions.
+func TerminateSessions(db *sql.DB, role string) (int, error) {
+	return terminateBackends(db, "usename = $1", role)
 }
 
 // rolesDiff returns roles to add and remove from existingRoles slice based of
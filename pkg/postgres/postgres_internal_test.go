@@ -1,8 +1,10 @@
 package postgres
 
 import (
+	"database/sql"
 	"testing"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"go.lunarway.com/postgresql-controller/test"
 )
@@ -129,3 +131,246 @@ func TestRolesDiff(t *testing.T) {
 		})
 	}
 }
+
+func TestStatementObjectType(t *testing.T) {
+	tt := []struct {
+		query  string
+		output string
+	}{
+		{query: "GRANT %s TO %s", output: "GRANT"},
+		{query: "ALTER ROLE %s LOGIN PASSWORD '%s' VALID UNTIL 'infinity'", output: "ALTER ROLE"},
+		{query: "ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT %s ON TABLES TO %s;", output: "ALTER DEFAULT PRIVILEGES"},
+		{query: prependSetRole("GRANT USAGE ON SCHEMA %s TO PUBLIC", "role"), output: "GRANT"},
+		{query: `
+		REVOKE ALL ON DATABASE %s from PUBLIC;
+		REVOKE ALL ON SCHEMA public from PUBLIC;`, output: "REVOKE"},
+		{query: "", output: "unknown"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.output, func(t *testing.T) {
+			assert.Equal(t, tc.output, statementObjectType(tc.query))
+		})
+	}
+}
+
+func TestHostOf(t *testing.T) {
+	// the connection is opened lazily so no host is needed
+	connector, err := pq.NewConnector(ConnectionString{Host: "localhost:1"}.Raw())
+	assert.NoError(t, err)
+	db := sql.OpenDB(hostConnector{Connector: connector, host: "localhost:1"})
+	defer db.Close()
+	assert.Equal(t, "localhost:1", hostOf(db))
+
+	plain, err := sql.Open("postgres", ConnectionString{Host: "localhost:1"}.Raw())
+	assert.NoError(t, err)
+	defer plain.Close()
+	assert.Equal(t, "unknown", hostOf(plain))
+}
+
+func TestFormatStatement(t *testing.T) {
+	tt := []struct {
+		name   string
+		query  string
+		args   []sqlArg
+		output string
+	}{
+		{
+			name:   "identifiers",
+			query:  "GRANT %s TO %s",
+			args:   []sqlArg{identifier("user_read"), identifier("Order-Service")},
+			output: `GRANT "user_read" TO "Order-Service"`,
+		},
+		{
+			name:   "identifier with quote",
+			query:  "CREATE ROLE %s",
+			args:   []sqlArg{identifier(`user"; DROP ROLE admin; --`)},
+			output: `CREATE ROLE "user""; DROP ROLE admin; --"`,
+		},
+		{
+			name:   "identifier list",
+			query:  "REVOKE %s FROM %s",
+			args:   []sqlArg{identifiers{"user_read", "user_readwrite"}, identifier("developer")},
+			output: `REVOKE "user_read", "user_readwrite" FROM "developer"`,
+		},
+		{
+			name:   "literal",
+			query:  "ALTER ROLE %s LOGIN PASSWORD %s",
+			args:   []sqlArg{identifier("user"), literal("it's")},
+			output: `ALTER ROLE "user" LOGIN PASSWORD 'it''s'`,
+		},
+		{
+			name:   "integer",
+			query:  "ALTER DATABASE %s CONNECTION LIMIT %s",
+			args:   []sqlArg{identifier("user"), integer(-1)},
+			output: `ALTER DATABASE "user" CONNECTION LIMIT -1`,
+		},
+		{
+			name:   "keywords",
+			query:  "GRANT %s ON ALL TABLES IN SCHEMA %s TO %s",
+			args:   []sqlArg{keywords("SELECT, INSERT"), identifier("user"), identifier("user_readwrite")},
+			output: `GRANT SELECT, INSERT ON ALL TABLES IN SCHEMA "user" TO "user_readwrite"`,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.output, formatStatement(tc.query, tc.args...))
+		})
+	}
+}
+
+func TestCreateDatabaseStatement(t *testing.T) {
+	connectionLimit := 10
+	tt := []struct {
+		name    string
+		options DatabaseOptions
+		output  string
+	}{
+		{
+			name:   "defaults",
+			output: `CREATE DATABASE "user"`,
+		},
+		{
+			name: "all options",
+			options: DatabaseOptions{
+				Encoding:        "UTF8",
+				LCCollate:       "C",
+				LCCtype:         "C",
+				ICULocale:       "en-US",
+				Template:        "template0",
+				Tablespace:      "fast",
+				ConnectionLimit: &connectionLimit,
+			},
+			output: `CREATE DATABASE "user" TEMPLATE "template0" ENCODING 'UTF8' LC_COLLATE 'C' LC_CTYPE 'C' LOCALE_PROVIDER icu ICU_LOCALE 'en-US' TABLESPACE "fast" CONNECTION LIMIT 10`,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.output, createDatabaseStatement("user", tc.options))
+		})
+	}
+}
+
+func TestChangedOptions(t *testing.T) {
+	existing := DatabaseOptions{
+		Encoding:   "UTF8",
+		LCCollate:  "en_US.UTF-8",
+		LCCtype:    "en_US.UTF-8",
+		Tablespace: "pg_default",
+	}
+	tt := []struct {
+		name      string
+		requested DatabaseOptions
+		output    []string
+	}{
+		{
+			name:      "nothing requested",
+			requested: DatabaseOptions{},
+			output:    nil,
+		},
+		{
+			name:      "same options and a template",
+			requested: DatabaseOptions{Encoding: "UTF8", LCCollate: "en_US.UTF-8", Template: "template0"},
+			output:    nil,
+		},
+		{
+			name:      "differently spelled locales",
+			requested: DatabaseOptions{LCCollate: "en_US.utf8", LCCtype: "en-us.UTF8"},
+			output:    nil,
+		},
+		{
+			name:      "changed options",
+			requested: DatabaseOptions{Encoding: "LATIN1", LCCtype: "C", ICULocale: "en-US", Tablespace: "pg_default"},
+			output: []string{
+				`encoding is "UTF8" and not "LATIN1"`,
+				`lcCtype is "en_US.UTF-8" and not "C"`,
+				`icuLocale is "" and not "en-US"`,
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.output, changedOptions(existing, tc.requested))
+		})
+	}
+}
+
+func TestDiffSettings(t *testing.T) {
+	existing := Parameters{
+		"statement_timeout": "30s",
+		"log_statement":     "all",
+		"work_mem":          "4MB",
+	}
+	desired := Parameters{
+		"statement_timeout":                   "30s",
+		"work_mem":                            "8MB",
+		"idle_in_transaction_session_timeout": "1min",
+	}
+	set, reset := diffSettings(existing, desired)
+	assert.Equal(t, []string{"idle_in_transaction_session_timeout", "work_mem"}, set, "set")
+	assert.Equal(t, []string{"log_statement"}, reset, "reset")
+
+	set, reset = diffSettings(existing, nil)
+	assert.Nil(t, set, "nothing should be set without desired parameters")
+	assert.Equal(t, []string{"log_statement", "statement_timeout", "work_mem"}, reset, "everything should be reset without desired parameters")
+}
+
+func TestExtensionChanges(t *testing.T) {
+	installed := Extensions{
+		{Name: "plpgsql", Version: "1.0", Schema: "pg_catalog"},
+		{Name: "pg_trgm", Version: "1.5", Schema: "user"},
+		{Name: "hstore", Version: "1.8", Schema: "user"},
+	}
+	tt := []struct {
+		name       string
+		extensions Extensions
+		output     []extensionChange
+	}{
+		{
+			name:       "installed",
+			extensions: Extensions{{Name: "pg_trgm"}, {Name: "hstore", Version: "1.8", Schema: "user"}},
+		},
+		{
+			name:       "install",
+			extensions: Extensions{{Name: "citext"}, {Name: "postgis", Version: "3.4.2", Schema: "public"}},
+			output: []extensionChange{
+				{"citext", `CREATE EXTENSION IF NOT EXISTS "citext" WITH SCHEMA "user"`, false},
+				{"postgis", `CREATE EXTENSION IF NOT EXISTS "postgis" WITH SCHEMA "public" VERSION '3.4.2'`, false},
+			},
+		},
+		{
+			name:       "update and move",
+			extensions: Extensions{{Name: "pg_trgm", Version: "1.6", Schema: "extensions"}},
+			output: []extensionChange{
+				{"pg_trgm", `ALTER EXTENSION "pg_trgm" SET SCHEMA "extensions"`, false},
+				{"pg_trgm", `ALTER EXTENSION "pg_trgm" UPDATE TO '1.6'`, false},
+			},
+		},
+		{
+			name:       "drop",
+			extensions: Extensions{{Name: "hstore", Drop: true}, {Name: "citext", Drop: true}},
+			output: []extensionChange{
+				{"hstore", `DROP EXTENSION IF EXISTS "hstore"`, true},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.output, extensionChanges("user", tc.extensions, installed))
+		})
+	}
+}
+
+func TestScramSHA256(t *testing.T) {
+	salt := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	assert.Equal(t, "SCRAM-SHA-256$4096:AAECAwQFBgcICQoLDA0ODw==$zHCdol2044/ZyWzPLi7oxApCkamKw9Z+E4U/QApd/5Y=:dd5peBOitVnLNFu7VmwP+HiDaaw4OUCv396eVCWhYiE=", scramSHA256("pencil", salt, 4096))
+
+	first, err := scramSHA256Verifier("pencil")
+	assert.NoError(t, err)
+	second, err := scramSHA256Verifier("pencil")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^SCRAM-SHA-256\$4096:[A-Za-z0-9+/=]{24}\$[A-Za-z0-9+/=]{44}:[A-Za-z0-9+/=]{44}$`, first, "verifier format")
+	assert.NotEqual(t, first, second, "verifiers should use random salts")
+
+	_, err = scramSHA256Verifier("pencil\u00a0")
+	assert.Error(t, err, "password changed by SASLprep should be refused")
+}
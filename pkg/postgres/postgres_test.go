@@ -2,6 +2,7 @@ package postgres_test
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"sort"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.lunarway.com/postgresql-controller/pkg/postgres"
 	"go.lunarway.com/postgresql-controller/test"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -240,7 +242,7 @@ func TestRole_staticRoles(t *testing.T) {
 			}
 
 			// act
-			err = postgres.Role(log, db, userName, []string{
+			_, err = postgres.Role(log, db, userName, []string{
 				RoleRDSIAM,
 				RoleIAMDeveloper,
 			}, nil)
@@ -300,7 +302,7 @@ func TestRole_owningWritePriviliges(t *testing.T) {
 		t.Fatalf("connect to database failed: %v", err)
 	}
 	defer iamCreatorUserDB.Close()
-	err = postgres.Role(log, iamCreatorUserDB, developerUser, []string{roleRDSIAM}, []postgres.DatabaseSchema{
+	_, err = postgres.Role(log, iamCreatorUserDB, developerUser, []string{roleRDSIAM}, []postgres.DatabaseSchema{
 		{
 			Name:       serviceUser1,
 			Schema:     serviceUser1,
@@ -342,7 +344,7 @@ func TestRole_owningWritePriviliges(t *testing.T) {
 		t.Fatalf("connect to database failed: %v", err)
 	}
 	defer iamCreatorUserDB.Close()
-	err = postgres.Role(log, iamCreatorUserDB, developerUser, []string{roleRDSIAM}, []postgres.DatabaseSchema{
+	_, err = postgres.Role(log, iamCreatorUserDB, developerUser, []string{roleRDSIAM}, []postgres.DatabaseSchema{
 		{
 			Name:       serviceUser1,
 			Schema:     serviceUser1,
@@ -419,7 +421,7 @@ func TestRole_priviliges(t *testing.T) {
 		t.Fatalf("connect to database failed: %v", err)
 	}
 	defer iamCreatorUserDB.Close()
-	err = postgres.Role(log, iamCreatorUserDB, developerUser, []string{roleRDSIAM}, []postgres.DatabaseSchema{
+	_, err = postgres.Role(log, iamCreatorUserDB, developerUser, []string{roleRDSIAM}, []postgres.DatabaseSchema{
 		{
 			Name:       serviceUser1,
 			Schema:     serviceUser1,
@@ -465,7 +467,7 @@ func TestRole_priviliges(t *testing.T) {
 		t.Fatalf("connect to database failed: %v", err)
 	}
 	defer iamCreatorUserDB.Close()
-	err = postgres.Role(log, iamCreatorUserDB, developerUser, nil, []postgres.DatabaseSchema{
+	_, err = postgres.Role(log, iamCreatorUserDB, developerUser, nil, []postgres.DatabaseSchema{
 		{
 			Name:       serviceUser2,
 			Schema:     serviceUser2,
@@ -501,6 +503,67 @@ func TestRole_priviliges(t *testing.T) {
 	}
 }
 
+func TestRole_revokeAndTerminateSessions(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     admin.User,
+		Password: admin.Password,
+	})
+	require.NoError(t, err)
+	defer db.Close()
+	managerRole := "postgres_role_name"
+	require.NoError(t, createManagerRole(log, db, managerRole))
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	developer := fmt.Sprintf("iam_developer_%d", time.Now().UnixNano())
+	require.NoError(t, postgres.Database(log, host, admin, postgres.Credentials{
+		Name: name,
+		User: name,
+	}, managerRole, nil))
+	revoked, err := postgres.Role(log, db, developer, nil, []postgres.DatabaseSchema{{
+		Name:       name,
+		Schema:     name,
+		Privileges: postgres.PrivilegeWrite,
+	}})
+	require.NoError(t, err)
+	assert.Empty(t, revoked, "no roles should be revoked")
+
+	// open a session as the developer
+	developerDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: name,
+		User:     developer,
+	})
+	require.NoError(t, err)
+	defer developerDB.Close()
+	session, err := developerDB.Conn(context.Background())
+	require.NoError(t, err)
+	defer session.Close()
+	require.NoError(t, session.PingContext(context.Background()))
+
+	revoked, err = postgres.Role(log, db, developer, nil, []postgres.DatabaseSchema{{
+		Name:       name,
+		Schema:     name,
+		Privileges: postgres.PrivilegeRead,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{name + "_readwrite"}, revoked, "revoked roles not as expected")
+	assert.True(t, postgres.IsWriteRole(revoked[0]), "revoked role should be a write role")
+
+	terminated, err := postgres.TerminateSessions(db, developer)
+	require.NoError(t, err)
+	assert.Equal(t, 1, terminated, "terminated sessions not as expected")
+	assert.Error(t, session.PingContext(context.Background()), "session should be terminated")
+}
+
 func createServiceDatabase(t *testing.T, log logr.Logger, host, service string) {
 	t.Helper()
 	managerRole := "postgres_manager_role"
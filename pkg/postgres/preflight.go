@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/go-logr/logr"
+
+	"go.lunarway.com/postgresql-controller/pkg/metrics"
 )
 
 // Preflight verifies the invariants the controller relies on for every
@@ -15,7 +17,17 @@ import (
 //   - The database connection is alive.
 //   - The connecting user is a member of superuserRole. The role is
 //     expected to exist on the server.
+//
+// Failed checks are counted by host in the preflight failures metric.
 func Preflight(log logr.Logger, db *sql.DB, superuserRole string) error {
+	err := preflight(log, db, superuserRole)
+	if err != nil {
+		metrics.PreflightFailed(hostOf(db))
+	}
+	return err
+}
+
+func preflight(log logr.Logger, db *sql.DB, superuserRole string) error {
 	if superuserRole == "" {
 		return fmt.Errorf("preflight: superuser role name is empty (configure --superuser-role-name)")
 	}
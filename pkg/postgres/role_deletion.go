@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
+)
+
+// LockRole revokes the memberships managed by Role from the role name, removes
+// its login privilege and terminates its open sessions. The role is left on the
+// host. It is a noop if the role does not exist.
+//
+// Managed memberships are the read, readwrite and readowningwrite roles of
+// databases and staticRoles. Memberships granted out of band are kept.
+func LockRole(log logr.Logger, host string, adminCredentials Credentials, name string, staticRoles []string) error {
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	log = log.WithValues("role", name)
+
+	db, closeDB, err := connectAdmin(log, host, adminCredentials)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	exists, err := lockRole(log, db, name, staticRoles)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Info("Locked role")
+	}
+	return nil
+}
+
+// DropRole locks the role name like LockRole and drops it. Objects owned by the
+// role are reassigned to reassignTo and its remaining privileges are dropped in
+// every database it has dependencies in. If reassignTo is empty objects are
+// reassigned to the connecting user.
+//
+// The connecting user must be a member of reassignTo. It is a noop if the role
+// does not exist.
+func DropRole(log logr.Logger, host string, adminCredentials Credentials, name string, staticRoles []string, reassignTo string) error {
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	log = log.WithValues("role", name)
+
+	db, closeDB, err := connectAdmin(log, host, adminCredentials)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	exists, err := lockRole(log, db, name, staticRoles)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	// the current user must be a member of the role to reassign its objects
+	err = execf(db, "GRANT %s TO CURRENT_USER", identifier(name))
+	if err != nil {
+		return fmt.Errorf("grant role %s to current user: %w", name, err)
+	}
+
+	databases, err := dependentDatabases(db, name)
+	if err != nil {
+		return fmt.Errorf("find databases with dependencies on role %s: %w", name, err)
+	}
+	// shared objects, eg. privileges on databases, are handled from any
+	// database so the postgres database is always included.
+	databases = append([]string{"postgres"}, databases...)
+	var errs error
+	for _, database := range databases {
+		err := dropOwned(log, host, adminCredentials, database, name, reassignTo)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("database %s: %w", database, err))
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("drop objects owned by role %s: %w", name, errs)
+	}
+
+	err = execf(db, "DROP ROLE IF EXISTS %s", identifier(name))
+	if err != nil {
+		return fmt.Errorf("drop role %s: %w", name, err)
+	}
+	log.Info("Dropped role", "databases", databases)
+	return nil
+}
+
+// lockRole revokes managed memberships from the role name, removes its login
+// privilege and terminates its sessions. It returns whether the role exists.
+func lockRole(log logr.Logger, db *sql.DB, name string, staticRoles []string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("lookup role %s: %w", name, err)
+	}
+	if !exists {
+		log.Info("Role does not exist")
+		return false, nil
+	}
+
+	memberships, err := currentGrantedRoles(db, name)
+	if err != nil {
+		return true, fmt.Errorf("get memberships of role %s: %w", name, err)
+	}
+	// an empty expectation makes rolesDiff return every managed database role
+	_, revokeable := rolesDiff(log, memberships, nil, nil)
+	for _, staticRole := range staticRoles {
+		if contains(memberships, staticRole) {
+			revokeable = append(revokeable, staticRole)
+		}
+	}
+	if len(revokeable) != 0 {
+		err = execf(db, "REVOKE %s FROM %s", identifiers(revokeable), identifier(name))
+		if err != nil {
+			return true, fmt.Errorf("revoke memberships of role %s: %w", name, err)
+		}
+	}
+
+	err = execf(db, "ALTER ROLE %s NOLOGIN", identifier(name))
+	if err != nil {
+		return true, fmt.Errorf("revoke login of role %s: %w", name, err)
+	}
+
+	terminated, err := terminateBackends(db, "usename = $1", name)
+	if err != nil {
+		return true, fmt.Errorf("terminate sessions of role %s: %w", name, err)
+	}
+	log.V(1).Info("Revoked memberships and login of role", "revoked", revokeable, "terminatedSessions", terminated)
+	return true, nil
+}
+
+// dependentDatabases returns the databases with objects owned by or privileges
+// granted to the role name.
+func dependentDatabases(db *sql.DB, name string) ([]string, error) {
+	rows, err := db.Query("SELECT DISTINCT d.datname FROM pg_shdepend s JOIN pg_database d ON (d.oid=s.dbid) JOIN pg_roles r ON (r.oid=s.refobjid) WHERE r.rolname=$1 AND d.datallowconn AND d.datname <> 'postgres'", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var databases []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan database name: %w", err)
+		}
+		databases = append(databases, name)
+	}
+	return databases, rows.Err()
+}
+
+// dropOwned reassigns objects owned by role to reassignTo and drops its
+// privileges in database.
+func dropOwned(log logr.Logger, host string, adminCredentials Credentials, database, role, reassignTo string) error {
+	connectionString := ConnectionString{
+		Host:     host,
+		Database: database,
+		User:     adminCredentials.User,
+		Password: adminCredentials.Password,
+		Params:   adminCredentials.Params,
+	}
+	db, err := Connect(connectionString)
+	if err != nil {
+		return fmt.Errorf("connect to host %s: %w", connectionString, err)
+	}
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Error(err, "failed to close database connection", "host", connectionString.Host, "database", database, "user", connectionString.User)
+		}
+	}()
+
+	var target sqlArg = keywords("CURRENT_USER")
+	if reassignTo != "" {
+		target = identifier(reassignTo)
+	}
+	err = execf(db, "REASSIGN OWNED BY %s TO %s", identifier(role), target)
+	if err != nil {
+		return fmt.Errorf("reassign owned objects: %w", err)
+	}
+	err = execf(db, "DROP OWNED BY %s", identifier(role))
+	if err != nil {
+		return fmt.Errorf("drop owned objects: %w", err)
+	}
+	return nil
+}
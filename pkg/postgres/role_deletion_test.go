@@ -0,0 +1,106 @@
+package postgres_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+	"go.lunarway.com/postgresql-controller/test"
+)
+
+func TestLockRole(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     admin.User,
+		Password: admin.Password,
+	})
+	require.NoError(t, err)
+	defer db.Close()
+	managerRole := "postgres_role_name"
+	require.NoError(t, createManagerRole(log, db, managerRole))
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	developer := fmt.Sprintf("iam_developer_%d", time.Now().UnixNano())
+	require.NoError(t, postgres.Database(log, host, admin, postgres.Credentials{
+		Name: name,
+		User: name,
+	}, managerRole, nil))
+	_, err = postgres.Role(log, db, developer, []string{"pg_monitor"}, []postgres.DatabaseSchema{{
+		Name:       name,
+		Schema:     name,
+		Privileges: postgres.PrivilegeRead,
+	}})
+	require.NoError(t, err)
+	// a membership granted out of band
+	dbExec(t, db, "GRANT pg_read_all_settings TO %s", developer)
+
+	err = postgres.LockRole(log, host, admin, developer, []string{"pg_monitor"})
+	require.NoError(t, err)
+
+	assert.True(t, roleExists(t, db, developer), "role should be kept")
+	assert.False(t, roleCanLogin(t, db, developer), "role should not be able to login")
+	assert.ElementsMatch(t, []string{"pg_read_all_settings"}, grantedRoles(t, db, developer), "only out of band memberships should be kept")
+
+	require.NoError(t, postgres.LockRole(log, host, admin, developer, nil), "locking a locked role should be a noop")
+	require.NoError(t, postgres.LockRole(log, host, admin, developer+"_unknown", nil), "locking an unknown role should be a noop")
+}
+
+func TestDropRole(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     admin.User,
+		Password: admin.Password,
+	})
+	require.NoError(t, err)
+	defer db.Close()
+	managerRole := "postgres_role_name"
+	require.NoError(t, createManagerRole(log, db, managerRole))
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	developer := fmt.Sprintf("iam_developer_%d", time.Now().UnixNano())
+	require.NoError(t, postgres.Database(log, host, admin, postgres.Credentials{
+		Name: name,
+		User: name,
+	}, managerRole, nil))
+	_, err = postgres.Role(log, db, developer, nil, []postgres.DatabaseSchema{{
+		Name:       name,
+		Schema:     name,
+		Privileges: postgres.PrivilegeWrite,
+	}})
+	require.NoError(t, err)
+	// a privilege in the service database prevents a plain DROP ROLE
+	serviceDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: name,
+		User:     admin.User,
+		Password: admin.Password,
+	})
+	require.NoError(t, err)
+	defer serviceDB.Close()
+	dbExec(t, serviceDB, "GRANT CREATE ON DATABASE %s TO %s", name, developer)
+
+	err = postgres.DropRole(log, host, admin, developer, nil, "")
+	require.NoError(t, err)
+
+	assert.False(t, roleExists(t, db, developer), "role should be dropped")
+	require.NoError(t, postgres.DropRole(log, host, admin, developer, nil, ""), "dropping an unknown role should be a noop")
+}
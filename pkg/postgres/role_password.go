@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramIterations is the iteration count of SCRAM-SHA-256 verifiers. It is the
+// default of PostgreSQL.
+const scramIterations = 4096
+
+// SetRolePassword sets the password of the login role name and makes it expire
+// at validUntil. The role must exist. The password is sent to the host as a
+// SCRAM-SHA-256 verifier and stored as such regardless of password_encryption.
+//
+// PostgreSQL only checks the expiry when a session is started so sessions
+// opened before validUntil are not terminated.
+func SetRolePassword(log logr.Logger, host string, adminCredentials Credentials, name, password string, validUntil time.Time) error {
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if password == "" {
+		return fmt.Errorf("password is required")
+	}
+
+	db, closeDB, err := connectAdmin(log, host, adminCredentials)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	// the verifier is sent instead of the password so the password never shows
+	// up in statement logs or pg_stat_statements of the host
+	verifier, err := scramSHA256Verifier(password)
+	if err != nil {
+		return fmt.Errorf("hash password of role %s: %w", name, err)
+	}
+	err = execf(db, "ALTER ROLE %s WITH LOGIN PASSWORD %s VALID UNTIL %s", identifier(name), literal(verifier), literal(validUntil.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return fmt.Errorf("set password of role %s: %w", name, err)
+	}
+	log.V(1).Info(fmt.Sprintf("Set password of role %s", name), "validUntil", validUntil)
+	return nil
+}
+
+// scramSHA256Verifier returns the SCRAM-SHA-256 verifier of password with a
+// random salt in the format stored by PostgreSQL in pg_authid.
+//
+// PostgreSQL and clients normalize passwords with SASLprep (RFC 4013) before
+// hashing them. SASLprep leaves printable ASCII unchanged, so such passwords,
+// like generated ones, are hashed as is and others are refused instead of
+// risking a verifier that never matches.
+func scramSHA256Verifier(password string) (string, error) {
+	for _, r := range password {
+		if r < ' ' || r > '~' {
+			return "", fmt.Errorf("password must be printable ASCII")
+		}
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+	return scramSHA256(password, salt, scramIterations), nil
+}
+
+// scramSHA256 returns the SCRAM-SHA-256 verifier of password with salt and
+// iterations as defined in RFC 5802 and RFC 7677.
+func scramSHA256(password string, salt []byte, iterations int) string {
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(saltedPassword, []byte("Server Key"))
+	encode := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s", iterations, encode(salt), encode(storedKey[:]), encode(serverKey))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,60 @@
+package postgres_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+	"go.lunarway.com/postgresql-controller/test"
+)
+
+func TestSetRolePassword(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+	admin := postgres.Credentials{
+		User:     "iam_creator",
+		Password: "iam_creator",
+	}
+
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     admin.User,
+		Password: admin.Password,
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	developer := fmt.Sprintf("Dev.Eloper-%d", time.Now().UnixNano())
+	_, err = postgres.Role(log, db, developer, nil, nil)
+	require.NoError(t, err)
+
+	validUntil := time.Now().Add(time.Hour).Truncate(time.Second)
+	err = postgres.SetRolePassword(log, host, admin, developer, "it's; a secret", validUntil)
+	require.NoError(t, err)
+
+	var (
+		hasPassword bool
+		stored      time.Time
+	)
+	err = db.QueryRow("SELECT rolpassword IS NOT NULL, rolvaliduntil FROM pg_roles WHERE rolname = $1", developer).Scan(&hasPassword, &stored)
+	require.NoError(t, err)
+	assert.True(t, hasPassword, "role should have a password")
+	assert.True(t, validUntil.Equal(stored), "valid until not as expected: %s", stored)
+	assert.True(t, roleCanLogin(t, db, developer), "role should be able to login")
+
+	developerDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     developer,
+		Password: "it's; a secret",
+	})
+	require.NoError(t, err, "role should be able to connect with the password")
+	developerDB.Close()
+
+	err = postgres.SetRolePassword(log, host, admin, developer+"_unknown", "secret", validUntil)
+	assert.Error(t, err, "an unknown role should fail")
+}
@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+)
+
+// serviceUserComment returns the comment of roles created by EnsureServiceUser
+// for owner. It records which resource created a role so roles created by
+// others are never adopted or dropped.
+func serviceUserComment(owner string) string {
+	return fmt.Sprintf("Managed by postgresql-controller for PostgreSQLServiceUser %s", owner)
+}
+
+// EnsureServiceUser creates a login role named name owned by owner if it does
+// not exist, sets its password and synchronises its role memberships to
+// exactly match roles. Owner identifies the resource managing the role, eg.
+// its namespaced name. A role created by someone else is refused with an
+// Invalid error.
+//
+// The password is applied on every call so a changed password is rotated on
+// the next reconciliation. An empty password disables login for the role.
+func EnsureServiceUser(log logr.Logger, db *sql.DB, name, password string, roles []string, owner string) error {
+	if name == "" {
+		return fmt.Errorf("ensure service user: name is empty")
+	}
+	log = log.WithValues("role", name)
+	log.Info("Ensuring service user")
+
+	exists, comment, err := roleComment(db, name)
+	if err != nil {
+		return fmt.Errorf("lookup role %s: %w", name, err)
+	}
+	switch {
+	case !exists:
+		err = createServiceUser(db, name, owner)
+		if err != nil {
+			return fmt.Errorf("create role %s: %w", name, err)
+		}
+		log.Info("Created service user")
+	case comment != serviceUserComment(owner):
+		return ctlerrors.NewInvalid(fmt.Errorf("role %s exists and is not managed by this resource", name))
+	}
+
+	if password != "" {
+		err = execf(db, "ALTER ROLE %s LOGIN PASSWORD %s VALID UNTIL 'infinity'", identifier(name), literal(password))
+	} else {
+		err = execf(db, "ALTER ROLE %s NOLOGIN PASSWORD NULL", identifier(name))
+	}
+	if err != nil {
+		return fmt.Errorf("set password of role %s: %w", name, err)
+	}
+
+	return syncRoleMembership(log, db, name, roles)
+}
+
+// createServiceUser creates the login role name and marks it as owned by owner
+// in one transaction so a role is never left without its owner.
+func createServiceUser(db *sql.DB, name, owner string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	_, err = tx.Exec(formatStatement("CREATE ROLE %s WITH LOGIN", identifier(name)))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(formatStatement("COMMENT ON ROLE %s IS %s", identifier(name), literal(serviceUserComment(owner))))
+	if err != nil {
+		return fmt.Errorf("comment on role: %w", err)
+	}
+	return tx.Commit()
+}
+
+// roleComment returns whether the role name exists and its comment.
+func roleComment(db *sql.DB, name string) (bool, string, error) {
+	var comment sql.NullString
+	err := db.QueryRow("SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1", name).Scan(&comment)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, comment.String, nil
+}
+
+// DropServiceUser drops the service user role created by EnsureServiceUser for
+// owner like DropRole. Objects owned by the role are reassigned to reassignTo,
+// or the connecting user if empty, and its privileges are dropped in every
+// database before the role itself. It is a noop if the role does not exist or
+// is not owned by owner.
+func DropServiceUser(log logr.Logger, host string, adminCredentials Credentials, name, owner, reassignTo string) error {
+	if name == "" {
+		return fmt.Errorf("drop service user: name is empty")
+	}
+	log = log.WithValues("role", name)
+	db, closeDB, err := connectAdmin(log, host, adminCredentials)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	exists, comment, err := roleComment(db, name)
+	if err != nil {
+		return fmt.Errorf("lookup role %s: %w", name, err)
+	}
+	if exists && comment != serviceUserComment(owner) {
+		log.Info("Keeping role as it is not managed by this resource")
+		return nil
+	}
+	return DropRole(log, host, adminCredentials, name, nil, reassignTo)
+}
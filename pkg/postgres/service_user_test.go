@@ -0,0 +1,128 @@
+package postgres_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ctlerrors "go.lunarway.com/postgresql-controller/pkg/errors"
+	"go.lunarway.com/postgresql-controller/pkg/postgres"
+	"go.lunarway.com/postgresql-controller/test"
+)
+
+func TestEnsureServiceUser_createsLoginRole(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	roleName := fmt.Sprintf("service_user_%d", time.Now().UnixNano())
+
+	err = postgres.EnsureServiceUser(log, db, roleName, "secret", []string{"pg_monitor"}, "default/service")
+	require.NoError(t, err)
+
+	assert.True(t, roleExists(t, db, roleName), "role should exist")
+	assert.True(t, roleCanLogin(t, db, roleName), "role should have login")
+	assert.ElementsMatch(t, []string{"pg_monitor"}, grantedRoles(t, db, roleName))
+
+	serviceDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     roleName,
+		Password: "secret",
+	})
+	require.NoError(t, err, "service user should be able to connect with its password")
+	serviceDB.Close()
+}
+
+func TestEnsureServiceUser_rotatesPasswordAndSyncsRoles(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	roleName := fmt.Sprintf("service_user_%d", time.Now().UnixNano())
+
+	require.NoError(t, postgres.EnsureServiceUser(log, db, roleName, "old'secret", []string{"pg_monitor"}, "default/service"))
+	require.NoError(t, postgres.EnsureServiceUser(log, db, roleName, "new'secret", []string{"pg_read_all_settings"}, "default/service"))
+
+	assert.ElementsMatch(t, []string{"pg_read_all_settings"}, grantedRoles(t, db, roleName), "roles should match the latest spec exactly")
+
+	serviceDB, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     roleName,
+		Password: "new'secret",
+	})
+	require.NoError(t, err, "service user should be able to connect with the rotated password")
+	serviceDB.Close()
+}
+
+func TestDropServiceUser(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	roleName := fmt.Sprintf("service_user_%d", time.Now().UnixNano())
+
+	require.NoError(t, postgres.EnsureServiceUser(log, db, roleName, "secret", nil, "default/service"))
+	admin := postgres.Credentials{User: "iam_creator", Password: "iam_creator"}
+	require.NoError(t, postgres.DropServiceUser(log, host, admin, roleName, "default/service", ""))
+	assert.False(t, roleExists(t, db, roleName), "role should be dropped")
+	require.NoError(t, postgres.DropServiceUser(log, host, admin, roleName, "default/service", ""), "dropping an unknown role should be a noop")
+}
+
+func TestEnsureServiceUser_refusesForeignRole(t *testing.T) {
+	host := test.Integration(t)
+	log := test.SetLogger(t)
+
+	db, err := postgres.Connect(postgres.ConnectionString{
+		Host:     host,
+		Database: "postgres",
+		User:     "iam_creator",
+		Password: "iam_creator",
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	roleName := fmt.Sprintf("service_user_%d", time.Now().UnixNano())
+	_, err = db.Exec(fmt.Sprintf("CREATE ROLE %s WITH LOGIN", roleName))
+	require.NoError(t, err)
+
+	err = postgres.EnsureServiceUser(log, db, roleName, "secret", nil, "default/service")
+	assert.True(t, ctlerrors.IsInvalid(err), "pre-existing role should be invalid: %v", err)
+
+	require.NoError(t, postgres.EnsureServiceUser(log, db, roleName+"_owned", "secret", nil, "default/service"))
+	err = postgres.EnsureServiceUser(log, db, roleName+"_owned", "secret", nil, "default/other")
+	assert.True(t, ctlerrors.IsInvalid(err), "role of another resource should be invalid: %v", err)
+
+	admin := postgres.Credentials{User: "iam_creator", Password: "iam_creator"}
+	require.NoError(t, postgres.DropServiceUser(log, host, admin, roleName, "default/service", ""))
+	assert.True(t, roleExists(t, db, roleName), "pre-existing role should not be dropped")
+	require.NoError(t, postgres.DropServiceUser(log, host, admin, roleName+"_owned", "default/other", ""))
+	assert.True(t, roleExists(t, db, roleName+"_owned"), "role of another resource should not be dropped")
+}
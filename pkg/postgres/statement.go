@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// sqlArg is an argument of a statement built with formatStatement. Values from
+// resources, eg. database and role names, passwords and extension names, are
+// passed as an identifier or literal so they are always quoted and cannot
+// change the meaning of a statement.
+type sqlArg interface {
+	sql() string
+}
+
+// identifier is an SQL identifier, eg. a role, database or schema name. It is
+// quoted so names are case sensitive and may contain any character, eg. dashes
+// and quotes.
+type identifier string
+
+func (i identifier) sql() string {
+	return pq.QuoteIdentifier(string(i))
+}
+
+// identifiers is a comma separated list of identifiers, eg. the roles of a
+// GRANT statement.
+type identifiers []string
+
+func (ids identifiers) sql() string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = pq.QuoteIdentifier(id)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// literal is an SQL string literal, eg. a password.
+type literal string
+
+func (l literal) sql() string {
+	return pq.QuoteLiteral(string(l))
+}
+
+// integer is an SQL integer constant, eg. a connection limit.
+type integer int
+
+func (i integer) sql() string {
+	return strconv.Itoa(int(i))
+}
+
+// keywords is a trusted SQL fragment that is inserted as is, eg. a list of
+// privileges. It must only be used for constants of this package and never
+// for values from resources.
+type keywords string
+
+func (k keywords) sql() string {
+	return string(k)
+}
+
+// formatStatement formats query with the quoted args.
+func formatStatement(query string, args ...sqlArg) string {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.sql()
+	}
+	return fmt.Sprintf(query, values...)
+}